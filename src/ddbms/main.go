@@ -0,0 +1,55 @@
+package main
+
+import (
+	"../labrpc"
+	"../models"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// main sets up a network and a cluster in this process, and runs a shell that sends SQL statements to the cluster and
+// injects failures through meta-commands. Statements are read from a script file if one is given, or interactively
+// from the standard input otherwise.
+//
+// Usage: ddbms [-nodes 3] [-data dir] [-f script.sql]
+func main() {
+	nodeNum := flag.Int("nodes", 3, "the number of nodes in the cluster")
+	scriptPath := flag.String("f", "", "a script of statements and meta-commands to run instead of the standard input")
+	dataDir := flag.String("data", "", "a directory keeping the tables of the nodes, which are only kept in memory if empty")
+	flag.Parse()
+	if *nodeNum <= 0 {
+		fmt.Fprintln(os.Stderr, "the number of nodes should be positive")
+		os.Exit(2)
+	}
+
+	// set up a network and a cluster
+	clusterName := "MyCluster"
+	network := labrpc.MakeNetwork()
+	var c *models.Cluster
+	if *dataDir == "" {
+		c = models.NewCluster(*nodeNum, network, clusterName)
+	} else {
+		var err error
+		if c, err = models.NewDiskCluster(*nodeNum, network, clusterName, *dataDir); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+	defer network.Cleanup()
+
+	s := newShell(network, c, *nodeNum, os.Stdout)
+	if *scriptPath == "" {
+		s.run(os.Stdin, true)
+		return
+	}
+	script, err := os.Open(*scriptPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	defer script.Close()
+	if !s.run(script, false) {
+		os.Exit(1)
+	}
+}
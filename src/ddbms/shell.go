@@ -0,0 +1,423 @@
+package main
+
+import (
+	"../labrpc"
+	"../models"
+	"../sql"
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const helpMessage = `Statements end with a semicolon, see package sql for the supported statements.
+Meta-commands:
+  \help                 show this message
+  \tables               list the tables and their columns
+  \fragments <table>    show where the fragments of a table are placed
+  \nodes                list the nodes and whether they are alive
+  \kill <node>          crash a node (e.g., 0 for Node0) and its replica of the catalog
+  \revive <node>        add a crashed node back to the network
+  \restart <node>       restore a node from its data directory, if the shell is given one
+  \reliable on|off      drop and delay messages in the network if off
+  \quorum <n>           require n replicas of a fragment to acknowledge a write
+  \connect [node]       send the statements to the coordinator on a node, or to that of the cluster by default
+  \quit                 exit the shell`
+
+// the name of the end through which the shell sends requests
+const clientName = "ShellClient"
+
+// shell reads statements and meta-commands, and prints their results
+type shell struct {
+	network *labrpc.Network
+	cluster *models.Cluster
+	nodeNum int
+	// the client connected to the coordinator of the cluster, or that on a node, see \connect
+	client *labrpc.ClientEnd
+	// nodeId -> whether the node has been removed from the network
+	killed map[string]bool
+	// the id of the transaction open on the coordinator, 0 if none, see models.QueryResult
+	transaction int
+	out io.Writer
+}
+
+func newShell(network *labrpc.Network, c *models.Cluster, nodeNum int, out io.Writer) *shell {
+	// create a client and connect to the cluster
+	client := network.MakeEnd(clientName)
+	network.Connect(clientName, c.Name)
+	network.Enable(clientName, true)
+	return &shell{
+		network: network,
+		cluster: c,
+		nodeNum: nodeNum,
+		client: client,
+		killed: make(map[string]bool),
+		out: out,
+	}
+}
+
+// run executes the statements and meta-commands read from the input until it ends or \quit is met, and returns false
+// if any of them fails. Prompts are printed if the shell is interactive.
+func (s *shell) run(input io.Reader, interactive bool) bool {
+	if interactive {
+		fmt.Fprintln(s.out, `Connected to a cluster of ` + strconv.Itoa(s.nodeNum) + ` nodes, type \help for help.`)
+	}
+	scanner := bufio.NewScanner(input)
+	succeeded := true
+	buffer := ""
+	for {
+		if interactive {
+			if buffer == "" && s.transaction != 0 {
+				fmt.Fprint(s.out, "ddbms*> ")
+			} else if buffer == "" {
+				fmt.Fprint(s.out, "ddbms> ")
+			} else {
+				fmt.Fprint(s.out, "    -> ")
+			}
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+
+		// meta-commands take a whole line and are not ended by semicolons, the incomplete statement is kept
+		if strings.HasPrefix(strings.TrimSpace(line), `\`) {
+			ok, quit := s.runCommand(strings.Fields(strings.TrimSpace(line)))
+			succeeded = succeeded && ok
+			if quit {
+				return succeeded
+			}
+			continue
+		}
+
+		buffer += line + "\n"
+		statements, rest := splitStatements(buffer)
+		for _, statement := range statements {
+			succeeded = s.runStatement(statement) && succeeded
+		}
+		buffer = rest
+	}
+
+	// the last statement may not be ended by a semicolon
+	if strings.TrimSpace(buffer) != "" {
+		succeeded = s.runStatement(buffer) && succeeded
+	}
+	if interactive {
+		fmt.Fprintln(s.out)
+	}
+	return succeeded
+}
+
+// splitStatements splits the complete statements, which are ended by semicolons, from the input, and returns them
+// with the remaining incomplete input. Semicolons in strings and comments do not end statements.
+func splitStatements(input string) ([]string, string) {
+	tokens, err := sql.Tokenize(input)
+	if err != nil {
+		// probably an unterminated quote, wait for more input
+		return nil, input
+	}
+
+	runes := []rune(input)
+	var statements []string
+	start := 0
+	for _, token := range tokens {
+		if token.Kind == sql.TokenSymbol && token.Text == ";" {
+			if statement := strings.TrimSpace(string(runes[start:token.Pos])); statement != "" {
+				statements = append(statements, statement)
+			}
+			start = token.Pos + 1
+		}
+	}
+	rest := string(runes[start:])
+	if strings.TrimSpace(rest) == "" {
+		rest = ""
+	}
+	return statements, rest
+}
+
+// runStatement sends a statement to the cluster, within the open transaction if any, and prints the result
+func (s *shell) runStatement(statement string) bool {
+	result := models.QueryResult{}
+	var ok bool
+	if s.transaction != 0 {
+		ok = s.client.Call("Cluster.ExecuteTransactionSQL", []interface{}{s.transaction, statement}, &result)
+	} else {
+		ok = s.client.Call("Cluster.ExecuteSQL", statement, &result)
+	}
+	if !ok {
+		fmt.Fprintln(s.out, "Error: the cluster did not reply, the statement may or may not have been executed")
+		return false
+	}
+	if s.transaction != 0 && result.Transaction == 0 && result.Error != "" {
+		fmt.Fprintln(s.out, "The transaction is rolled back")
+	}
+	s.transaction = result.Transaction
+	if result.Error != "" {
+		fmt.Fprintln(s.out, "Error: " + result.Error)
+		return false
+	}
+	if result.Message != "" {
+		fmt.Fprintln(s.out, result.Message)
+	} else {
+		fmt.Fprint(s.out, formatDataset(&result.Dataset))
+	}
+	return true
+}
+
+// runCommand executes a meta-command, and returns whether it succeeds and whether the shell should quit
+func (s *shell) runCommand(fields []string) (bool, bool) {
+	command := fields[0]
+	args := fields[1:]
+	switch command {
+	case `\help`, `\?`:
+		fmt.Fprintln(s.out, helpMessage)
+	case `\quit`, `\q`, `\exit`:
+		return true, true
+	case `\tables`:
+		var schemas []models.TableSchema
+		if !s.client.Call("Cluster.ShowTables", "", &schemas) {
+			fmt.Fprintln(s.out, "Error: the cluster did not reply")
+			return false, false
+		}
+		for _, schema := range schemas {
+			definitions := formatColumns(schema.ColumnSchemas)
+			if len(schema.PrimaryKey) > 0 {
+				definitions += ", PRIMARY KEY (" + strings.Join(schema.PrimaryKey, ", ") + ")"
+			}
+			for _, key := range schema.UniqueKeys {
+				definitions += ", UNIQUE (" + strings.Join(key, ", ") + ")"
+			}
+			for _, fk := range schema.ForeignKeys {
+				definitions += ", FOREIGN KEY (" + strings.Join(fk.Columns, ", ") + ") REFERENCES " + fk.RefTable +
+					" (" + strings.Join(fk.RefColumns, ", ") + ") ON DELETE " + fk.OnDelete
+			}
+			fmt.Fprintln(s.out, schema.TableName + " (" + definitions + ")")
+		}
+	case `\fragments`:
+		if len(args) != 1 {
+			fmt.Fprintln(s.out, `Usage: \fragments <table>`)
+			return false, false
+		}
+		var fragments []models.Fragment
+		if !s.client.Call("Cluster.ShowFragments", args[0], &fragments) {
+			fmt.Fprintln(s.out, "Error: the cluster did not reply")
+			return false, false
+		}
+		if len(fragments) == 0 {
+			fmt.Fprintln(s.out, "No fragment of table " + args[0])
+		}
+		for _, fragment := range fragments {
+			var predicates []string
+			for _, p := range fragment.Predicates {
+				if p.Operator == "IS NULL" || p.Operator == "IS NOT NULL" {
+					predicates = append(predicates, p.ColumnName + " " + p.Operator)
+				} else {
+					predicates = append(predicates, p.ColumnName + " " + p.Operator + " " + formatValue(p.Value))
+				}
+			}
+			where := ""
+			if len(predicates) > 0 {
+				where = " WHERE " + strings.Join(predicates, " AND ")
+			}
+			replica := ""
+			if len(fragment.Replicas) > 0 && fragment.Replicas[0] != fragment.NodeId {
+				replica = " (replica of " + fragment.Replicas[0] + ")"
+			}
+			fmt.Fprintln(s.out, fragment.NodeId + ": (" + formatColumns(fragment.ColumnSchemas) + ")" + where + replica)
+		}
+	case `\nodes`:
+		for i := 0; i < s.nodeNum; i++ {
+			nodeId := "Node" + strconv.Itoa(i)
+			if s.killed[nodeId] {
+				fmt.Fprintln(s.out, nodeId + ": killed")
+			} else {
+				fmt.Fprintln(s.out, nodeId + ": alive")
+			}
+		}
+	case `\kill`, `\revive`:
+		if len(args) != 1 {
+			fmt.Fprintln(s.out, "Usage: " + command + " <node>")
+			return false, false
+		}
+		nodeId := "Node" + strings.TrimPrefix(args[0], "Node")
+		if command == `\kill` {
+			if err := s.cluster.CrashNode(nodeId); err != nil {
+				fmt.Fprintln(s.out, "Error: " + err.Error())
+				return false, false
+			}
+			s.killed[nodeId] = true
+			fmt.Fprintln(s.out, nodeId + " is killed")
+		} else {
+			if err := s.cluster.ReviveNode(nodeId); err != nil {
+				fmt.Fprintln(s.out, "Error: " + err.Error())
+				return false, false
+			}
+			delete(s.killed, nodeId)
+			fmt.Fprintln(s.out, nodeId + " is revived")
+		}
+	case `\restart`:
+		if len(args) != 1 {
+			fmt.Fprintln(s.out, `Usage: \restart <node>`)
+			return false, false
+		}
+		nodeId := "Node" + strings.TrimPrefix(args[0], "Node")
+		if err := s.cluster.RestartNode(nodeId); err != nil {
+			fmt.Fprintln(s.out, "Error: " + err.Error())
+			return false, false
+		}
+		delete(s.killed, nodeId)
+		fmt.Fprintln(s.out, nodeId + " is restarted from the disk")
+	case `\reliable`:
+		if len(args) != 1 || args[0] != "on" && args[0] != "off" {
+			fmt.Fprintln(s.out, `Usage: \reliable on|off`)
+			return false, false
+		}
+		s.network.Reliable(args[0] == "on")
+		fmt.Fprintln(s.out, "The network is reliable: " + args[0])
+	case `\quorum`:
+		quorum := 0
+		if len(args) == 1 {
+			quorum, _ = strconv.Atoi(args[0])
+		}
+		if quorum < 1 {
+			fmt.Fprintln(s.out, `Usage: \quorum <n>`)
+			return false, false
+		}
+		reply := ""
+		if !s.client.Call("Cluster.SetWriteQuorum", quorum, &reply) {
+			fmt.Fprintln(s.out, "Error: the cluster did not reply")
+			return false, false
+		}
+		fmt.Fprintln(s.out, reply)
+	case `\connect`:
+		if len(args) > 1 {
+			fmt.Fprintln(s.out, `Usage: \connect [node]`)
+			return false, false
+		}
+		serverName := s.cluster.Name
+		if len(args) == 1 {
+			serverName = "Node" + strings.TrimPrefix(args[0], "Node")
+			if s.cluster.GetNodeServer(serverName) == nil {
+				fmt.Fprintln(s.out, "Error: no such node " + serverName)
+				return false, false
+			}
+		}
+		// the open transaction is left on the old coordinator, and is aborted once it times out
+		if s.transaction != 0 {
+			fmt.Fprintln(s.out, "Transaction " + strconv.Itoa(s.transaction) + " is left open on the old coordinator")
+			s.transaction = 0
+		}
+		s.network.Connect(clientName, serverName)
+		fmt.Fprintln(s.out, "Connected to " + serverName)
+	default:
+		fmt.Fprintln(s.out, "Unknown command " + command + `, type \help for help`)
+		return false, false
+	}
+	return true, false
+}
+
+// formatColumns formats column schemas like "sid INT32 NOT NULL, name STRING"
+func formatColumns(columns []models.ColumnSchema) string {
+	var definitions []string
+	for _, column := range columns {
+		definition := column.Name + " " + formatDataType(column.DataType)
+		if column.NotNull {
+			definition += " NOT NULL"
+		}
+		definitions = append(definitions, definition)
+	}
+	return strings.Join(definitions, ", ")
+}
+
+func formatDataType(dataType int) string {
+	switch dataType {
+	case models.TypeInt32:
+		return "INT32"
+	case models.TypeInt64:
+		return "INT64"
+	case models.TypeFloat:
+		return "FLOAT"
+	case models.TypeDouble:
+		return "DOUBLE"
+	case models.TypeBoolean:
+		return "BOOLEAN"
+	case models.TypeString:
+		return "STRING"
+	case models.TypeDate:
+		return "DATE"
+	case models.TypeTimestamp:
+		return "TIMESTAMP"
+	case models.TypeDecimal:
+		return "DECIMAL"
+	case models.TypeBytes:
+		return "BYTES"
+	}
+	return "UNKNOWN"
+}
+
+// formatValue formats a value in a cell, where nil is NULL, a date is like 2026-01-01, a timestamp is like
+// 2026-01-01 08:30:00 and bytes are in hex like \x0aff
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case time.Time:
+		if v.Equal(time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, v.Location())) {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05.999999999")
+	case []byte:
+		return `\x` + hex.EncodeToString(v)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// formatDataset formats a dataset as a table whose columns are aligned, followed by the count of rows
+func formatDataset(dataset *models.Dataset) string {
+	columnNum := len(dataset.Schema.ColumnSchemas)
+	cells := make([][]string, len(dataset.Rows) + 1)
+	widths := make([]int, columnNum)
+	cells[0] = make([]string, columnNum)
+	for i, column := range dataset.Schema.ColumnSchemas {
+		cells[0][i] = column.Name
+	}
+	for i, row := range dataset.Rows {
+		cells[i + 1] = make([]string, columnNum)
+		for j := 0; j < columnNum && j < len(row); j++ {
+			cells[i + 1][j] = formatValue(row[j])
+		}
+	}
+	for _, line := range cells {
+		for j, cell := range line {
+			if len([]rune(cell)) > widths[j] {
+				widths[j] = len([]rune(cell))
+			}
+		}
+	}
+
+	var builder strings.Builder
+	separator := "+"
+	for _, width := range widths {
+		separator += strings.Repeat("-", width + 2) + "+"
+	}
+	for i, line := range cells {
+		if i <= 1 {
+			builder.WriteString(separator + "\n")
+		}
+		builder.WriteString("|")
+		for j, cell := range line {
+			builder.WriteString(" " + cell + strings.Repeat(" ", widths[j] - len([]rune(cell))) + " |")
+		}
+		builder.WriteString("\n")
+	}
+	builder.WriteString(separator + "\n")
+	if len(dataset.Rows) == 1 {
+		builder.WriteString("(1 row)\n")
+	} else {
+		builder.WriteString("(" + strconv.Itoa(len(dataset.Rows)) + " rows)\n")
+	}
+	return builder.String()
+}
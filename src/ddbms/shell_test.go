@@ -0,0 +1,96 @@
+package main
+
+import (
+	"../labrpc"
+	"../models"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitStatements(t *testing.T) {
+	statements, rest := splitStatements("SELECT * FROM a; INSERT INTO a VALUES ('x;y');\n SELECT *\n FROM")
+	expected := []string{"SELECT * FROM a", "INSERT INTO a VALUES ('x;y')"}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+	if rest != "\n SELECT *\n FROM" {
+		t.Errorf("Incorrect rest %q", rest)
+	}
+
+	// a semicolon in an unterminated string does not end a statement
+	statements, rest = splitStatements("INSERT INTO a VALUES ('x;\n")
+	if len(statements) != 0 || rest != "INSERT INTO a VALUES ('x;\n" {
+		t.Errorf("Incorrect split %v, %q", statements, rest)
+	}
+}
+
+func TestFormatDataset(t *testing.T) {
+	dataset := models.Dataset{
+		Schema: models.TableSchema{
+			TableName: "student",
+			ColumnSchemas: []models.ColumnSchema{
+				{Name: "sid", DataType: models.TypeInt32},
+				{Name: "name", DataType: models.TypeString},
+			},
+		},
+		Rows: []models.Row{{0, "John"}, {10, nil}},
+	}
+	expected := "+-----+------+\n" +
+		"| sid | name |\n" +
+		"+-----+------+\n" +
+		"| 0   | John |\n" +
+		"| 10  | NULL |\n" +
+		"+-----+------+\n" +
+		"(2 rows)\n"
+	if actual := formatDataset(&dataset); actual != expected {
+		t.Errorf("Incorrect table, expected\n%s\nactual\n%s", expected, actual)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	for _, test := range []struct {
+		value interface{}
+		expected string
+	}{
+		{nil, "NULL"},
+		{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), "2026-01-01"},
+		{time.Date(2026, 1, 1, 8, 30, 0, 500000000, time.UTC), "2026-01-01 08:30:00.5"},
+		{models.NewDecimal(-1250, 2), "-12.5"},
+		{[]byte{10, 255}, `\x0aff`},
+	} {
+		if actual := formatValue(test.value); actual != test.expected {
+			t.Errorf("Incorrect format of %v, expected %s, actual %s", test.value, test.expected, actual)
+		}
+	}
+}
+
+func TestRunTransaction(t *testing.T) {
+	network := labrpc.MakeNetwork()
+	c := models.NewCluster(3, network, "MyCluster")
+	defer c.Shutdown()
+	out := bytes.Buffer{}
+	s := newShell(network, c, 3, &out)
+
+	// the statements between BEGIN and ROLLBACK are sent within the transaction
+	input := `CREATE TABLE student (sid INT32, name STRING) PARTITION BY (NODE 1);
+BEGIN;
+INSERT INTO student VALUES (0, 'John');
+SELECT sid FROM student;
+ROLLBACK;
+SELECT sid FROM student;`
+	if !s.run(strings.NewReader(input), false) {
+		t.Fatalf("The statements should succeed, output:\n%s", out.String())
+	}
+	if s.transaction != 0 {
+		t.Errorf("No transaction should be open, actual %d", s.transaction)
+	}
+	expected := "Build table success\nBegin success\nFragment write success\n" +
+		"+-----+\n| sid |\n+-----+\n| 0   |\n+-----+\n(1 row)\nRollback success\n" +
+		"+-----+\n| sid |\n+-----+\n(0 rows)\n"
+	if out.String() != expected {
+		t.Errorf("Incorrect output, expected\n%s\nactual\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,466 @@
+package models
+
+import (
+	"../labgob"
+	"errors"
+	"strings"
+)
+
+// names of the aggregate functions
+const (
+	AggregateCount = "COUNT"
+	AggregateSum = "SUM"
+	AggregateAvg = "AVG"
+	AggregateMin = "MIN"
+	AggregateMax = "MAX"
+)
+
+// AggregateFunction applies Function, one of the aggregate functions above, to the non-NULL values of ColumnName, or
+// counts the rows if Function is COUNT and ColumnName is empty, i.e., COUNT(*). Its result column is named Alias, or
+// like "SUM(grade)" and "COUNT(*)" if Alias is empty.
+type AggregateFunction struct {
+	Function string
+	ColumnName string
+	Alias string
+}
+
+// getName returns the name of the result column of the function
+func (f *AggregateFunction) getName() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	columnName := f.ColumnName
+	if columnName == "" {
+		columnName = "*"
+	}
+	return strings.ToUpper(f.Function) + "(" + columnName + ")"
+}
+
+// AggregateRequest groups the rows of Table satisfying Predicates by the GroupBy columns, and computes the Aggregates
+// of each group. The result has the GroupBy columns followed by a column for each aggregate, and only keeps the groups
+// satisfying the Having predicates, which refer to the result columns by their names. Without GroupBy, all rows form a
+// single group, which exists even if there is no row.
+type AggregateRequest struct {
+	Table string
+	GroupBy []string
+	Aggregates []AggregateFunction
+	Predicates []Predicate
+	Having []Predicate
+}
+
+// AggregateState is the partial result of an aggregate function over some rows of a group
+type AggregateState struct {
+	// the number of non-NULL values, or the number of rows for COUNT(*)
+	Count int64
+	// the sum of the values for SUM and AVG, which is an int64, a float64 or a Decimal
+	Sum interface{}
+	// the least and the greatest values for MIN and MAX
+	Min interface{}
+	Max interface{}
+}
+
+// AggregateGroup holds the partial results of the aggregate functions over some rows of a group, which is identified
+// by the values of the GroupBy columns (Keys)
+type AggregateGroup struct {
+	Keys Row
+	States []AggregateState
+}
+
+// PartialAggregates is the reply of Node.AggregateRPC
+type PartialAggregates struct {
+	Groups []AggregateGroup
+	// empty if the aggregation succeeds
+	Error string
+}
+
+// Aggregate computes the aggregates described by the request, see AggregateRequest. If each row satisfying the
+// predicates is held by exactly one of the fragments chosen to be aggregated, together with all the columns used by the
+// request, the partial aggregates are computed by the nodes and combined by the coordinator. Otherwise, e.g., if the
+// columns are split into vertical fragments, the rows are merged by their hidden row ids and aggregated by the
+// coordinator. An empty Dataset is replied if the request is invalid.
+func (c *Cluster) Aggregate(request AggregateRequest, reply *Dataset) {
+	c.syncCatalog()
+	dataSet, err := c.aggregate(&request, c.getSnapshot(nil))
+	if err != nil {
+		return
+	}
+	*reply = dataSet
+}
+
+// aggregate is the implementation of Aggregate, which reads the table from the given snapshot
+func (c *Cluster) aggregate(request *AggregateRequest, snapshot Snapshot) (Dataset, error) {
+	labgob.Register(Dataset{})
+	schema, ok := c.getSchema(request.Table)
+	if !ok {
+		return Dataset{}, errors.New("no such table " + request.Table)
+	}
+	typedPredicates, err := getTypedPredicates(&schema, request.Predicates)
+	if err != nil {
+		return Dataset{}, err
+	}
+	if _, err := newAggregator(&schema, request); err != nil {
+		return Dataset{}, err
+	}
+
+	// only the columns used by the request are scanned
+	var scanIds []int
+	isScanned := make([]bool, len(schema.ColumnSchemas))
+	for _, columnName := range request.getColumnNames() {
+		columnId := schema.getColumnId(columnName)
+		if !isScanned[columnId] {
+			isScanned[columnId] = true
+			scanIds = append(scanIds, columnId)
+		}
+	}
+	scanSchema := schema.getSubSchema(scanIds)
+	result, _ := newAggregator(&scanSchema, request)
+
+	c.repairReplicas(request.Table)
+	fragments, pushed := c.getPushdownFragments(&scanSchema, typedPredicates)
+	typedRequest := *request
+	typedRequest.Predicates = typedPredicates
+	var partials []PartialAggregates
+	for i := 0; pushed && i < len(fragments); i++ {
+		partial := PartialAggregates{}
+		// the rows are scanned from the other replicas if a node does not reply
+		if c.call(fragments[i].NodeId, "Node.AggregateRPC",
+			[]interface{}{request.Table, fragments[i].Predicates, typedRequest, snapshot}, &partial) != nil {
+			pushed = false
+			break
+		}
+		// the rows are scanned as well if the node cannot read the snapshot yet or has missed some writes
+		if partial.Error == errCatalogBehind || partial.Error == errStaleReplica {
+			pushed = false
+			break
+		}
+		if partial.Error != "" {
+			return Dataset{}, errors.New(partial.Error)
+		}
+		partials = append(partials, partial)
+	}
+	if pushed {
+		for _, partial := range partials {
+			for _, group := range partial.Groups {
+				if err := result.merge(group); err != nil {
+					return Dataset{}, err
+				}
+			}
+		}
+	} else {
+		dataSet, err := c.scanTable(&scanSchema, typedPredicates, snapshot)
+		if err != nil {
+			return Dataset{}, err
+		}
+		for _, row := range dataSet.Rows {
+			if err := result.add(row); err != nil {
+				return Dataset{}, err
+			}
+		}
+	}
+
+	dataSet := result.getDataSet(&scanSchema, request)
+	return dataSet.getFilteredDataSet(request.Having)
+}
+
+// aggregateDataSet computes the aggregates described by the request over the rows of a dataset, ignoring the table and
+// the predicates of the request
+func aggregateDataSet(dataSet *Dataset, request *AggregateRequest) (Dataset, error) {
+	result, err := newAggregator(&dataSet.Schema, request)
+	if err != nil {
+		return Dataset{}, err
+	}
+	for _, row := range dataSet.Rows {
+		if err := result.add(row); err != nil {
+			return Dataset{}, err
+		}
+	}
+	aggregated := result.getDataSet(&dataSet.Schema, request)
+	return aggregated.getFilteredDataSet(request.Having)
+}
+
+// getColumnNames returns the columns used by the request, which may contain duplicates
+func (request *AggregateRequest) getColumnNames() []string {
+	columnNames := append([]string{}, request.GroupBy...)
+	for _, f := range request.Aggregates {
+		if f.ColumnName != "" {
+			columnNames = append(columnNames, f.ColumnName)
+		}
+	}
+	for _, p := range request.Predicates {
+		columnNames = append(columnNames, p.ColumnName)
+	}
+	return columnNames
+}
+
+// aggregator accumulates rows of a schema into the partial results of their groups
+type aggregator struct {
+	// the ids and the data types of the GroupBy columns in the schema
+	groupIds []int
+	groupTypes []int
+	// for each aggregate, the function in upper case, the id of its column in the schema (-1 for COUNT(*)) and the data
+	// type of the column
+	functions []string
+	columnIds []int
+	dataTypes []int
+	// the hashed keys of the groups in the order they are met
+	keys []string
+	groups map[string]*AggregateGroup
+}
+
+// newAggregator resolves the columns of the request in the given schema
+func newAggregator(schema *TableSchema, request *AggregateRequest) (*aggregator, error) {
+	a := &aggregator{groups: make(map[string]*AggregateGroup)}
+	for _, columnName := range request.GroupBy {
+		columnId := schema.getColumnId(columnName)
+		if columnId < 0 {
+			return nil, errors.New("unknown column " + columnName)
+		}
+		a.groupIds = append(a.groupIds, columnId)
+		a.groupTypes = append(a.groupTypes, schema.ColumnSchemas[columnId].DataType)
+	}
+	for _, f := range request.Aggregates {
+		function := strings.ToUpper(f.Function)
+		columnId, dataType := -1, TypeInt64
+		if f.ColumnName != "" || function != AggregateCount {
+			if columnId = schema.getColumnId(f.ColumnName); columnId < 0 {
+				return nil, errors.New("unknown column " + f.ColumnName)
+			}
+			dataType = schema.ColumnSchemas[columnId].DataType
+		}
+		switch function {
+		case AggregateCount, AggregateMin, AggregateMax:
+		case AggregateSum, AggregateAvg:
+			if !isSummable(dataType) {
+				return nil, errors.New("cannot compute " + function + " of " + getDataTypeName(dataType) + " column " +
+					f.ColumnName)
+			}
+		default:
+			return nil, errors.New("unknown aggregate function " + f.Function)
+		}
+		a.functions = append(a.functions, function)
+		a.columnIds = append(a.columnIds, columnId)
+		a.dataTypes = append(a.dataTypes, dataType)
+	}
+	return a, nil
+}
+
+func isSummable(dataType int) bool {
+	switch dataType {
+	case TypeInt32, TypeInt64, TypeFloat, TypeDouble, TypeDecimal:
+		return true
+	}
+	return false
+}
+
+// getGroup returns the group of the given keys, which is created if it does not exist. Keys of different Go types that
+// are equal in the data types of their columns, e.g., 3 and int32(3), belong to the same group.
+func (a *aggregator) getGroup(keys Row) *AggregateGroup {
+	hashed := make(Row, len(keys))
+	ids := make([]int, len(keys))
+	for i, value := range keys {
+		ids[i] = i
+		hashed[i] = value
+		if coerced, err := coerceValue(a.groupTypes[i], value); value != nil && err == nil {
+			hashed[i] = coerced
+		}
+	}
+	key := hashKey(hashed, ids)
+	group, ok := a.groups[key]
+	if !ok {
+		group = &AggregateGroup{Keys: keys, States: make([]AggregateState, len(a.functions))}
+		a.groups[key] = group
+		a.keys = append(a.keys, key)
+	}
+	return group
+}
+
+// add accumulates a row of the schema of the aggregator, where NULLs are ignored except by COUNT(*)
+func (a *aggregator) add(row Row) error {
+	keys := make(Row, len(a.groupIds))
+	for i, columnId := range a.groupIds {
+		keys[i] = row[columnId]
+	}
+	group := a.getGroup(keys)
+	for i, columnId := range a.columnIds {
+		if columnId < 0 {
+			group.States[i].Count++
+			continue
+		}
+		value := row[columnId]
+		if value == nil {
+			continue
+		}
+		state := AggregateState{Count: 1, Min: value, Max: value}
+		if a.functions[i] == AggregateSum || a.functions[i] == AggregateAvg {
+			var err error
+			if state.Sum, err = toSum(a.dataTypes[i], value); err != nil {
+				return err
+			}
+		}
+		if err := a.mergeState(i, &group.States[i], &state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge combines a group of partial results computed by another aggregator of the same request
+func (a *aggregator) merge(other AggregateGroup) error {
+	group := a.getGroup(other.Keys)
+	for i := range a.functions {
+		if err := a.mergeState(i, &group.States[i], &other.States[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeState combines the partial result of the i-th aggregate into the target
+func (a *aggregator) mergeState(i int, target *AggregateState, source *AggregateState) error {
+	if source.Count == 0 {
+		return nil
+	}
+	target.Count += source.Count
+	switch a.functions[i] {
+	case AggregateSum, AggregateAvg:
+		sum, err := addSums(target.Sum, source.Sum)
+		if err != nil {
+			return err
+		}
+		target.Sum = sum
+	case AggregateMin:
+		if target.Min == nil || compareColumnValues(a.dataTypes[i], source.Min, target.Min) < 0 {
+			target.Min = source.Min
+		}
+	case AggregateMax:
+		if target.Max == nil || compareColumnValues(a.dataTypes[i], source.Max, target.Max) > 0 {
+			target.Max = source.Max
+		}
+	}
+	return nil
+}
+
+// toSum converts a value of a column into the type of its sum, i.e., int64 for integers, float64 for floats and
+// Decimal for decimals
+func toSum(dataType int, value interface{}) (interface{}, error) {
+	row := Row{value}
+	switch dataType {
+	case TypeInt32, TypeInt64:
+		return row.getInt64Value(0)
+	case TypeFloat, TypeDouble:
+		return row.getFloat64Value(0)
+	case TypeDecimal:
+		return row.getDecimalValue(0)
+	}
+	return nil, errors.New("cannot sum " + getDataTypeName(dataType))
+}
+
+// addSums adds two sums of the same type, where nil is no sum
+func addSums(a interface{}, b interface{}) (interface{}, error) {
+	if a == nil {
+		return b, nil
+	}
+	if b == nil {
+		return a, nil
+	}
+	switch va := a.(type) {
+	case int64:
+		return va + b.(int64), nil
+	case float64:
+		return va + b.(float64), nil
+	case Decimal:
+		return va.Add(b.(Decimal))
+	}
+	return nil, errors.New("cannot add sums")
+}
+
+// getGroups returns the partial results of the groups in the order they are met
+func (a *aggregator) getGroups() []AggregateGroup {
+	groups := make([]AggregateGroup, len(a.keys))
+	for i, key := range a.keys {
+		groups[i] = *a.groups[key]
+	}
+	return groups
+}
+
+// getDataSet finishes the aggregates of the groups of rows of the schema, and returns a dataset of the GroupBy columns
+// followed by the aggregates, sorted by the GroupBy columns
+func (a *aggregator) getDataSet(schema *TableSchema, request *AggregateRequest) Dataset {
+	dataSet := Dataset{}
+	groupIds := make([]int, len(a.groupIds))
+	orders := make([]OrderBy, len(a.groupIds))
+	for i, columnId := range a.groupIds {
+		groupIds[i] = i
+		dataSet.Schema.ColumnSchemas = append(dataSet.Schema.ColumnSchemas, ColumnSchema{
+			Name: schema.ColumnSchemas[columnId].Name,
+			DataType: schema.ColumnSchemas[columnId].DataType,
+		})
+	}
+	for i, f := range request.Aggregates {
+		dataSet.Schema.ColumnSchemas = append(dataSet.Schema.ColumnSchemas, ColumnSchema{
+			Name: f.getName(),
+			DataType: a.getResultType(i),
+		})
+	}
+
+	groups := a.getGroups()
+	// all rows form a single group without GroupBy, even if there is no row
+	if len(groups) == 0 && len(a.groupIds) == 0 {
+		groups = append(groups, AggregateGroup{States: make([]AggregateState, len(a.functions))})
+	}
+	for _, group := range groups {
+		row := append(Row{}, group.Keys...)
+		for i, state := range group.States {
+			row = append(row, a.getResult(i, &state))
+		}
+		dataSet.Rows = append(dataSet.Rows, row)
+	}
+	dataSet.sortByOrders(groupIds, orders)
+	return dataSet
+}
+
+// getResultType returns the data type of the result of the i-th aggregate
+func (a *aggregator) getResultType(i int) int {
+	switch a.functions[i] {
+	case AggregateCount:
+		return TypeInt64
+	case AggregateSum:
+		switch a.dataTypes[i] {
+		case TypeInt32, TypeInt64:
+			return TypeInt64
+		case TypeFloat, TypeDouble:
+			return TypeDouble
+		}
+	case AggregateAvg:
+		return TypeDouble
+	}
+	return a.dataTypes[i]
+}
+
+// getResult finishes the i-th aggregate of a group, which is NULL (nil) if there is no value except for COUNT
+func (a *aggregator) getResult(i int, state *AggregateState) interface{} {
+	if a.functions[i] == AggregateCount {
+		return state.Count
+	}
+	if state.Count == 0 {
+		return nil
+	}
+	switch a.functions[i] {
+	case AggregateSum:
+		return state.Sum
+	case AggregateAvg:
+		switch sum := state.Sum.(type) {
+		case int64:
+			return float64(sum) / float64(state.Count)
+		case float64:
+			return sum / float64(state.Count)
+		case Decimal:
+			return sum.Float64() / float64(state.Count)
+		}
+	case AggregateMin:
+		return state.Min
+	case AggregateMax:
+		return state.Max
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"testing"
+)
+
+// rows of student are replicated on node0 and node1 if grade <= 3.6, held by node2 if grade > 3.6 and by node3 if
+// grade is NULL
+func setupAggregate(t *testing.T) {
+	setupScript(t, `
+		CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING, age INT32, grade FLOAT)
+		PARTITION BY (NODES 0|1 WHERE grade <= 3.6, NODE 2 WHERE grade > 3.6, NODE 3 WHERE grade IS NULL);
+		INSERT INTO student VALUES (0, 'John', 22, 4.0), (1, 'Smith', 23, 3.6), (2, 'Hana', 21, 4.0),
+			(3, 'Lily', 22, 3.0), (4, 'Ann', 23, NULL)`)
+}
+
+func TestAggregate(t *testing.T) {
+	setupAggregate(t)
+
+	request := AggregateRequest{
+		Table: "student",
+		GroupBy: []string{"age"},
+		Aggregates: []AggregateFunction{
+			{Function: AggregateCount},
+			{Function: AggregateCount, ColumnName: "grade"},
+			{Function: AggregateSum, ColumnName: "sid"},
+			{Function: AggregateAvg, ColumnName: "grade", Alias: "average"},
+			{Function: AggregateMin, ColumnName: "name"},
+			{Function: AggregateMax, ColumnName: "grade"},
+		},
+	}
+	countBefore := []int{network.GetCount("Node0") + network.GetCount("Node1"), network.GetCount("Node2"),
+		network.GetCount("Node3")}
+	results := Dataset{}
+	cli.Call("Cluster.Aggregate", request, &results)
+	countAfter := []int{network.GetCount("Node0") + network.GetCount("Node1"), network.GetCount("Node2"),
+		network.GetCount("Node3")}
+	for i := range countBefore {
+		if countAfter[i] != countBefore[i] + 1 {
+			t.Errorf("Each group of replicated fragments should be aggregated once, RPC counts before %v, after %v",
+				countBefore, countAfter)
+			break
+		}
+	}
+
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "age", DataType: TypeInt32},
+			{Name: "COUNT(*)", DataType: TypeInt64},
+			{Name: "COUNT(grade)", DataType: TypeInt64},
+			{Name: "SUM(sid)", DataType: TypeInt64},
+			{Name: "average", DataType: TypeDouble},
+			{Name: "MIN(name)", DataType: TypeString},
+			{Name: "MAX(grade)", DataType: TypeFloat},
+		}},
+		Rows: []Row{
+			{21, int64(1), int64(1), int64(2), 4.0, "Hana", 4.0},
+			{22, int64(2), int64(2), int64(3), 3.5, "John", 4.0},
+			{23, int64(2), int64(1), int64(5), 3.6, "Ann", 3.6},
+		},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect aggregate results, expected %v, actual %v", expectedDataset, results)
+	}
+	for i, row := range results.Rows {
+		if i > 0 && compareValues(results.Rows[i - 1][0], row[0]) >= 0 {
+			t.Errorf("Groups should be sorted by the grouped columns, actual %v", results.Rows)
+			break
+		}
+	}
+
+	request.Having = []Predicate{{ColumnName: "COUNT(*)", Operator: ">=", Value: 2}, {ColumnName: "average", Operator: "<",
+		Value: 3.55}}
+	results = Dataset{}
+	cli.Call("Cluster.Aggregate", request, &results)
+	expectedDataset.Rows = expectedDataset.Rows[1:2]
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect aggregate results with HAVING, expected %v, actual %v", expectedDataset, results)
+	}
+}
+
+func TestAggregateWithoutGroups(t *testing.T) {
+	setupAggregate(t)
+
+	request := AggregateRequest{
+		Table: "student",
+		Aggregates: []AggregateFunction{
+			{Function: AggregateCount},
+			{Function: AggregateSum, ColumnName: "age"},
+			{Function: AggregateMax, ColumnName: "sid"},
+		},
+		Predicates: []Predicate{{ColumnName: "age", Operator: ">=", Value: 22}},
+	}
+	results := Dataset{}
+	cli.Call("Cluster.Aggregate", request, &results)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "COUNT(*)", DataType: TypeInt64},
+			{Name: "SUM(age)", DataType: TypeInt64},
+			{Name: "MAX(sid)", DataType: TypeInt32},
+		}},
+		Rows: []Row{{int64(4), int64(90), 4}},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect aggregate results, expected %v, actual %v", expectedDataset, results)
+	}
+
+	// the single group exists even if no row is selected
+	request.Predicates = []Predicate{{ColumnName: "age", Operator: ">", Value: 30}}
+	results = Dataset{}
+	cli.Call("Cluster.Aggregate", request, &results)
+	expectedDataset.Rows = []Row{{int64(0), nil, nil}}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect aggregate results, expected %v, actual %v", expectedDataset, results)
+	}
+
+	for _, invalid := range []AggregateRequest{
+		{Table: "teacher", Aggregates: []AggregateFunction{{Function: AggregateCount}}},
+		{Table: "student", Aggregates: []AggregateFunction{{Function: AggregateSum, ColumnName: "name"}}},
+		{Table: "student", Aggregates: []AggregateFunction{{Function: "MEDIAN", ColumnName: "age"}}},
+		{Table: "student", GroupBy: []string{"tid"}},
+	} {
+		results = Dataset{}
+		cli.Call("Cluster.Aggregate", invalid, &results)
+		if len(results.Schema.ColumnSchemas) != 0 {
+			t.Errorf("Aggregating %v should fail, actual %v", invalid, results)
+		}
+	}
+}
+
+func TestAggregateVerticalFragments(t *testing.T) {
+	// name and grade of the rows whose grade <= 3.6 are held by different fragments
+	setupSQL(t)
+	schema := c.tableSchemaMap["student"]
+	nameSchema, nameGradeSchema := schema.getSubSchema([]int{1}), schema.getSubSchema([]int{1, 3})
+	if _, ok := c.getPushdownFragments(&nameSchema, nil); !ok {
+		t.Errorf("Aggregates of name should be pushed down")
+	}
+	if _, ok := c.getPushdownFragments(&nameGradeSchema, nil); ok {
+		t.Errorf("Aggregates of name and grade should not be pushed down")
+	}
+
+	for _, test := range []struct {
+		script string
+		expected []Row
+	}{
+		{"SELECT name, AVG(grade) FROM student GROUP BY name ORDER BY name", []Row{{"Hana", 4.0}, {"John", 4.0},
+			{"Smith", 3.6}}},
+		{"SELECT COUNT(*) AS total, MIN(age) FROM student WHERE grade < 4.0", []Row{{int64(1), 23}}},
+		{"SELECT grade, COUNT(name) FROM student GROUP BY grade HAVING COUNT(name) > 1", []Row{{4.0, int64(2)}}},
+		{`SELECT courseId, COUNT(*) FROM student JOIN courseRegistration ON student.sid = courseRegistration.sid
+			GROUP BY courseId ORDER BY COUNT(*) DESC, courseId`, []Row{{0, int64(2)}, {1, int64(1)}, {2, int64(1)}}},
+	} {
+		result := QueryResult{}
+		cli.Call("Cluster.ExecuteSQL", test.script, &result)
+		if result.Error != "" {
+			t.Errorf("%s failed: %s", test.script, result.Error)
+			continue
+		}
+		actual := result.Dataset.Rows
+		matched := len(actual) == len(test.expected)
+		for i := 0; matched && i < len(actual); i++ {
+			matched = actual[i].Equals(&test.expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect results of %s, expected %v, actual %v", test.script, test.expected, actual)
+		}
+	}
+
+	for _, script := range []string{
+		"SELECT name, age FROM student GROUP BY name",
+		"SELECT * FROM student GROUP BY name",
+		"SELECT SUM(name) FROM student",
+	} {
+		result := QueryResult{}
+		cli.Call("Cluster.ExecuteSQL", script, &result)
+		if result.Error == "" {
+			t.Errorf("%s should fail, but got %v", script, result)
+		}
+	}
+}
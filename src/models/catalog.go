@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+)
+
+// the files of a persistent node in its directory, where the rows of each table are kept by a DiskRowStore in the
+// directory named by the table under tablesDirName
+const (
+	catalogFileName = "catalog"
+	tablesDirName = "tables"
+)
+
+// nodeCatalog is the metadata of the tables of a persistent node, which is saved whenever a table or an index is
+// created, or the tables miss some writes, so that the node can be restored from its directory
+type nodeCatalog struct {
+	Tables []catalogTable
+	SchemaMap map[string]TableSchema
+	ColumnIdsMap map[string][]int
+	Predicates map[string][]Predicate
+	// the tables whose fragments on the node have missed some writes, see Node.missWrites
+	StaleTables map[string]int
+}
+
+// catalogTable is the schema of a table on a node and the indexes on it, which are rebuilt when the node is restored
+type catalogTable struct {
+	Schema TableSchema
+	// column id -> the kind of the index on the column, see rowIdColumn
+	Indexes map[int]string
+}
+
+// NewPersistentNode creates a node whose tables are kept in files of the directory, see DiskRowStore. If the directory
+// holds the tables of a node, e.g., because the node has crashed, they are restored together with the partition
+// metadata of the node.
+func NewPersistentNode(id string, dir string) (*Node, error) {
+	n := NewNode(id)
+	n.dir = dir
+	if err := os.MkdirAll(filepath.Join(dir, tablesDirName), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(dir, catalogFileName))
+	if os.IsNotExist(err) {
+		return n, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	catalog := nodeCatalog{}
+	if err = gob.NewDecoder(file).Decode(&catalog); err != nil {
+		return nil, err
+	}
+
+	for _, table := range catalog.Tables {
+		rowStore, err := OpenDiskRowStore(filepath.Join(dir, tablesDirName, table.Schema.TableName))
+		if err != nil {
+			return nil, err
+		}
+		schema := table.Schema
+		t := NewTable(&schema, rowStore)
+		for columnId, kind := range table.Indexes {
+			if err = t.CreateIndex(columnId, kind); err != nil {
+				return nil, err
+			}
+		}
+		n.TableMap[schema.TableName] = t
+	}
+	for tableName, schema := range catalog.SchemaMap {
+		n.SchemaMap[tableName] = schema
+	}
+	for tableName, columnIds := range catalog.ColumnIdsMap {
+		n.columnIdsMap[tableName] = columnIds
+	}
+	for tableName, predicates := range catalog.Predicates {
+		n.predicates[tableName] = predicates
+	}
+	for tableName, index := range catalog.StaleTables {
+		n.staleTables[tableName] = index
+	}
+	if err = n.loadTransactions(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// openRowStore creates the store of a new table, which is kept on the disk if the node is persistent
+func (n *Node) openRowStore(schema *TableSchema) (RowStore, error) {
+	if n.dir == "" {
+		return newRowStore(schema)
+	}
+	// the files left by a table unknown to the catalog, e.g., created just before a crash, are dropped
+	dir := filepath.Join(n.dir, tablesDirName, schema.TableName)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	return OpenDiskRowStore(dir)
+}
+
+// saveCatalog saves the metadata of the tables of a persistent node, replacing the old catalog atomically
+func (n *Node) saveCatalog() error {
+	if n.dir == "" {
+		return nil
+	}
+	catalog := nodeCatalog{
+		SchemaMap: n.SchemaMap,
+		ColumnIdsMap: n.columnIdsMap,
+		Predicates: n.predicates,
+		StaleTables: n.staleTables,
+	}
+	for _, t := range n.TableMap {
+		table := catalogTable{Schema: *t.schema, Indexes: make(map[int]string)}
+		for columnId, index := range t.indexes {
+			table.Indexes[columnId] = index.kind
+		}
+		catalog.Tables = append(catalog.Tables, table)
+	}
+
+	path := filepath.Join(n.dir, catalogFileName)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(file).Encode(catalog); err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(path + ".tmp", path)
+}
@@ -3,17 +3,24 @@ package models
 import (
 	"../labgob"
 	"../labrpc"
+	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Cluster consists of a group of nodes to manage distributed tables defined in models/table.go.
-// The Cluster object itself can also be viewed as the only coordinator of a cluster, which means client requests
-// should go through it instead of the nodes.
-// Of course, it is possible to make any of the nodes a coordinator and to make the cluster decentralized. You are
-// welcomed to make such changes and may earn some extra points.
+// The Cluster object itself can also be viewed as a coordinator of a cluster, which receives client requests and
+// processes them with the nodes.
+// Each of the nodes also serves a coordinator of its own, so that the cluster is decentralized and client requests can
+// go through any node, see newCoordinator.
 type Cluster struct {
 	// the identifiers of each node, we use simple numbers like "1,2,3" to register the nodes in the network
 	// needless to say, each identifier should be unique
@@ -24,9 +31,66 @@ type Cluster struct {
 	network *labrpc.Network
 	// the Name of the cluster, also used as a network address of the cluster coordinator in the network above
 	Name string
+	// sends the RPCs of the coordinator to the nodes, see rpc_client.go
+	client *rpcClient
 
+	// guards the catalog and the other state below shared by the requests, which are served concurrently
+	mu sync.RWMutex
 	tableSize map[string]int
 	tableSchemaMap map[string]TableSchema
+	// tableName -> fragments of the table, which tells the coordinator where the columns and rows of a table are
+	fragmentMap map[string][]Fragment
+	// nodeId -> the server of the node, kept so that a node removed from the network can be added back
+	nodeServers map[string]*labrpc.Server
+	// the number of rows fetched from a node by an RPC of a scan
+	scanBatchSize int
+	// tableName -> the indexes of the table
+	indexMap map[string][]IndexDefinition
+	// the directory keeping the tables of the nodes, empty if they are only kept in memory, see NewDiskCluster
+	dataDir string
+	// the number of replicas of a fragment that must acknowledge a write, see SetWriteQuorum
+	writeQuorum int
+	// tableName -> nodeId -> whether the replicas of the table on the node have missed a write, see replica.go
+	staleReplicas map[string]map[string]bool
+	// nodeId -> the replica of the catalog on the node, see replicated_catalog.go
+	catalogReplicas map[string]*CatalogReplica
+	// nodeId -> the server of the replica of the catalog on the node, kept so that a crashed node can be revived
+	catalogServers map[string]*labrpc.Server
+	// the index of the node that led the Raft group of the catalog last time
+	catalogLeader int
+	// the index of the last command of the catalog known to the coordinator, see proposeCatalog
+	catalogIndex int
+	// transactionId -> the open transactions begun through the coordinator, see transaction.go
+	transactions map[int]*Transaction
+	// transactionId -> the commit timestamp of the transaction, or 0 if it is aborted, for the transactions decided in
+	// the catalog
+	decisions map[int]int
+	// how long a transaction is kept undecided after its last request to a node, see SetTransactionTimeout
+	transactionTimeout time.Duration
+	// set by Shutdown, after which the coordinator stops recovering the transactions, see recoverPeriodically
+	dead int32
+}
+
+// Fragment records a piece of a table placed on a node by a partition rule, i.e., the columns it holds and the
+// predicates its rows satisfy. The nodes listed by a rule hold replicas of the same fragment, which share FragmentId.
+type Fragment struct {
+	NodeId string
+	ColumnSchemas []ColumnSchema
+	Predicates []Predicate
+	// the index of the partition rule of the fragment in the table
+	FragmentId int
+	// the nodes holding the replicas of the fragment, where the first one is the primary
+	Replicas []string
+}
+
+// hasColumn checks whether the fragment holds the given column
+func (f *Fragment) hasColumn(columnName string) bool {
+	for _, column := range f.ColumnSchemas {
+		if column.Name == columnName {
+			return true
+		}
+	}
+	return false
 }
 
 // NewCluster creates a Cluster with the given number of nodes and register the nodes to the given network.
@@ -41,15 +105,48 @@ type Cluster struct {
 // the lab, a "Node" is responsible for processing distributed affairs but a "Server" simply receives messages from the
 // net work.
 func NewCluster(nodeNum int, network *labrpc.Network, clusterName string) *Cluster {
+	c, _ := newCluster(nodeNum, network, clusterName, "")
+	return c
+}
+
+// NewDiskCluster creates a cluster like NewCluster, but each node keeps its tables in the directory named by the node
+// under dataDir, e.g., "dataDir/Node0", so that a node can be restarted from the disk by RestartNode. The nodes also
+// keep the catalog replicated among them, which a coordinator created on the same directories loads from the leader
+// once it changes the catalog, see proposeCatalog.
+func NewDiskCluster(nodeNum int, network *labrpc.Network, clusterName string, dataDir string) (*Cluster, error) {
+	return newCluster(nodeNum, network, clusterName, dataDir)
+}
+
+func newCluster(nodeNum int, network *labrpc.Network, clusterName string, dataDir string) (*Cluster, error) {
 	labgob.Register(TableSchema{})
 	labgob.Register(Row{})
+	labgob.Register([]Predicate{})
+	labgob.Register([]Assignment{})
+	labgob.Register(Decimal{})
+	labgob.Register([]byte{})
+	labgob.Register(AggregateRequest{})
+	labgob.Register(SelectRequest{})
+	labgob.Register(ScanRequest{})
+	labgob.Register(IndexDefinition{})
+	labgob.Register([]Row{})
+	labgob.Register(CatalogCommand{})
+	labgob.Register(Snapshot{})
+	// labgob complains about the unexported fields of time.Time, which are never encoded as time.Time implements
+	// GobEncoder, so it is registered with gob directly
+	gob.Register(time.Time{})
 
 	nodeIds := make([]string, nodeNum)
+	nodes := make([]*Node, nodeNum)
+	nodeServers := make(map[string]*labrpc.Server)
 	nodeNamePrefix := "Node"
 	for i := 0; i < nodeNum; i++ {
 		// identify the nodes with "Node0", "Node1", ...
-		node := NewNode(nodeNamePrefix + strconv.Itoa(i))
+		node, err := openNode(nodeNamePrefix + strconv.Itoa(i), dataDir)
+		if err != nil {
+			return nil, err
+		}
 		nodeIds[i] = node.Identifier
+		nodes[i] = node
 		// use go reflection to extract the methods in a Node object and make them as a service.
 		// a service can be viewed as a list of methods that a server provides.
 		// due to the limitation of the framework, the extracted method must only have two parameters, and the first one
@@ -62,16 +159,21 @@ func NewCluster(nodeNum int, network *labrpc.Network, clusterName string) *Clust
 		server.AddService(nodeService)
 		// register the server to the network as "Node0", "Node1", ...
 		network.AddServer(nodeIds[i], server)
+		nodeServers[nodeIds[i]] = server
 	}
 
 	// create a cluster with the nodes and the network
-	c := &Cluster{
-		nodeIds: nodeIds,
-		network: network,
-		Name: clusterName,
-		tableSize: make(map[string]int),
-		tableSchemaMap: make(map[string]TableSchema),
+	c := newCoordinator(nodeIds, network, clusterName, dataDir)
+	c.nodeServers = nodeServers
+	for _, node := range nodes {
+		if err := c.startCatalogPeer(node); err != nil {
+			return nil, err
+		}
+		nodeServers[node.Identifier].AddService(labrpc.MakeService(newCoordinator(nodeIds, network, node.Identifier,
+			dataDir)))
 	}
+	// elect Node0 as the first leader of the catalog without waiting for an election timeout
+	c.catalogReplicas[nodeIds[0]].rf.Campaign()
 	// create a coordinator for the cluster to receive external requests, the steps are similar to those above.
 	// notice that we use the reference of the cluster as the name of the coordinator server,
 	// and the names can be more than strings.
@@ -79,7 +181,133 @@ func NewCluster(nodeNum int, network *labrpc.Network, clusterName string) *Clust
 	server := labrpc.MakeServer()
 	server.AddService(clusterService)
 	network.AddServer(clusterName, server)
-	return c
+	go c.recoverPeriodically()
+	return c, nil
+}
+
+// newCoordinator creates a coordinator of the given nodes, whose server in the network is of the given name. Besides
+// the coordinator of the cluster, the server of each node serves a coordinator of its own as the "Cluster" service, so
+// that a client can send its requests to any node, e.g., "Cluster.ExecuteSQL" to "Node1", and does not depend on the
+// coordinator of the cluster. The coordinators share the catalog replicated among the nodes, see syncCatalog,
+// including the stale replicas found by any of them.
+func newCoordinator(nodeIds []string, network *labrpc.Network, name string, dataDir string) *Cluster {
+	return &Cluster{
+		nodeIds: nodeIds,
+		network: network,
+		Name: name,
+		client: newRPCClient(network, name),
+		tableSize: make(map[string]int),
+		tableSchemaMap: make(map[string]TableSchema),
+		fragmentMap: make(map[string][]Fragment),
+		nodeServers: make(map[string]*labrpc.Server),
+		scanBatchSize: DefaultScanBatchSize,
+		indexMap: make(map[string][]IndexDefinition),
+		dataDir: dataDir,
+		writeQuorum: DefaultWriteQuorum,
+		staleReplicas: make(map[string]map[string]bool),
+		catalogReplicas: make(map[string]*CatalogReplica),
+		catalogServers: make(map[string]*labrpc.Server),
+		transactions: make(map[int]*Transaction),
+		decisions: make(map[int]int),
+		transactionTimeout: DefaultTransactionTimeout,
+	}
+}
+
+// openNode creates a node, which is persistent and restored from its directory under dataDir unless dataDir is empty
+func openNode(nodeId string, dataDir string) (*Node, error) {
+	if dataDir == "" {
+		return NewNode(nodeId), nil
+	}
+	return NewPersistentNode(nodeId, filepath.Join(dataDir, nodeId))
+}
+
+// RestartNode replaces a node of a cluster created by NewDiskCluster with a node restored from its directory, whose
+// state only in memory, e.g., its open cursors, is lost as if the node crashed. The node is bound to a new server, see
+// GetNodeServer, and the transactions left on it are resolved, see recoverTransactions.
+func (c *Cluster) RestartNode(nodeId string) error {
+	if !c.isNodeExists(nodeId) {
+		return errors.New("no such node " + nodeId)
+	}
+	if c.dataDir == "" {
+		return errors.New(nodeId + " is not persistent")
+	}
+	c.network.DeleteServer(nodeId)
+	node, err := openNode(nodeId, c.dataDir)
+	if err != nil {
+		return err
+	}
+	server := labrpc.MakeServer()
+	server.AddService(labrpc.MakeService(node))
+	// the coordinator on the node loses what it has found about the replicas, and syncs its catalog on the first request
+	server.AddService(labrpc.MakeService(newCoordinator(c.nodeIds, c.network, nodeId, c.dataDir)))
+	if err = c.startCatalogPeer(node); err != nil {
+		return err
+	}
+	c.network.AddServer(nodeId, server)
+	c.nodeServers[nodeId] = server
+	c.recoverNode(nodeId)
+	return nil
+}
+
+// Shutdown stops the Raft peers of the nodes and the recovery of the transactions by the coordinator, e.g., before the
+// directories of a disk cluster are removed, after which the catalog of the cluster cannot be changed
+func (c *Cluster) Shutdown() {
+	atomic.StoreInt32(&c.dead, 1)
+	for nodeId, replica := range c.catalogReplicas {
+		c.network.DeleteServer(getCatalogServerName(nodeId))
+		replica.kill()
+	}
+}
+
+// CrashNode removes a node from the network together with its replica of the catalog, whose Raft peer neither sends nor
+// receives RPCs until the node is revived by ReviveNode or restarted by RestartNode. A node removed by
+// Network.DeleteServer alone stops serving its fragments but keeps its vote in the catalog.
+func (c *Cluster) CrashNode(nodeId string) error {
+	if !c.isNodeExists(nodeId) {
+		return errors.New("no such node " + nodeId)
+	}
+	c.network.DeleteServer(nodeId)
+	c.connectCatalogPeer(nodeId, false)
+	return nil
+}
+
+// ReviveNode adds a node crashed by CrashNode back to the network, where its replica of the catalog catches up with the
+// leader, and resolves the transactions left on the node, see recoverTransactions
+func (c *Cluster) ReviveNode(nodeId string) error {
+	if !c.isNodeExists(nodeId) {
+		return errors.New("no such node " + nodeId)
+	}
+	c.network.AddServer(nodeId, c.nodeServers[nodeId])
+	c.connectCatalogPeer(nodeId, true)
+	c.recoverNode(nodeId)
+	return nil
+}
+
+// GetNodeServer returns the server bound to the given node, or nil if the node does not exist. A node removed from the
+// network by Network.DeleteServer can be revived by adding the server back with Network.AddServer.
+func (c *Cluster) GetNodeServer(nodeId string) *labrpc.Server {
+	return c.nodeServers[nodeId]
+}
+
+// ShowTables sets the schemas of all tables ordered by their names to reply, args is not used.
+func (c *Cluster) ShowTables(args interface{}, reply *[]TableSchema) {
+	c.syncCatalog()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var tableNames []string
+	for tableName := range c.tableSchemaMap {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	for _, tableName := range tableNames {
+		*reply = append(*reply, c.tableSchemaMap[tableName])
+	}
+}
+
+// ShowFragments sets the fragments of the given table to reply, in the order they are created.
+func (c *Cluster) ShowFragments(tableName string, reply *[]Fragment) {
+	c.syncCatalog()
+	*reply = append(*reply, c.getFragments(tableName)...)
 }
 
 // SayHello is an example to show how the coordinator communicates with other nodes in the cluster.
@@ -110,99 +338,216 @@ func (c *Cluster) SayHello(visitor string, reply *string) {
 	*reply = fmt.Sprintf("Hello %s, I am the coordinator of %s", visitor, c.Name)
 }
 
-// ScanTableWithRowIds get table data with specified row ids
-func (c *Cluster) ScanTableWithRowIds(tableSchema *TableSchema, rowIds []int) Dataset {
-	var remoteDataSets []Dataset
-	endNamePrefix := "InternalClient"
-	for _, remoteId := range c.nodeIds {
-		remoteEndName := endNamePrefix + remoteId
-		remoteEnd := c.network.MakeEnd(remoteEndName)
-		c.network.Connect(remoteEndName, remoteId)
-		c.network.Enable(remoteEndName, true)
-
-		var datasets []Dataset
-		remoteEnd.Call("Node.ScanTableWithRowIds", []interface{}{tableSchema.TableName, rowIds}, &datasets)
-		for _, dataset := range datasets {
-			if len(dataset.Rows) > 0 {
-				remoteDataSets = append(remoteDataSets, dataset)
-			}
-		}
+// ScanTableWithRowIds get table data with specified row ids, which is fetched from the nodes batch by batch. The rows
+// are read from the given snapshot, and are returned in the order of the given row ids.
+func (c *Cluster) ScanTableWithRowIds(tableSchema *TableSchema, rowIds []int, snapshot Snapshot) (Dataset, error) {
+	// an empty list of row ids is received as nil by the nodes, which would scan all rows
+	if len(rowIds) == 0 {
+		return Dataset{Schema: *tableSchema}, nil
 	}
-
-	var resultDataSet Dataset
-	resultDataSet.Schema = *tableSchema
-	for i, remoteDataSet := range remoteDataSets {
-		if len(remoteDataSet.Schema.ColumnSchemas) != len(tableSchema.ColumnSchemas) {
-			for j := i + 1; j < len(remoteDataSets); j++ {
-				remoteDataSet = remoteDataSet.getMergeDataSet(&remoteDataSets[j])
-			}
-			remoteDataSets[i] = remoteDataSet
-		}
+	c.repairReplicas(tableSchema.TableName)
+	request := ScanRequest{Schema: *tableSchema, RowIds: rowIds, Snapshot: snapshot}
+	merger := newFragmentMerger(tableSchema)
+	if err := c.scanReplicas(&request, nil, merger.add); err != nil {
+		return Dataset{}, err
 	}
+	mergedDataSet := merger.result()
 
 	rowsMap := make(map[int]Row)
 	loc := len(tableSchema.ColumnSchemas)
-	for _, remoteDataSet := range remoteDataSets {
-		if len(remoteDataSet.Schema.ColumnSchemas) == len(tableSchema.ColumnSchemas) {
-			remoteDataSet.changeSchema(tableSchema)
-			for _, row := range remoteDataSet.Rows {
-				rowsMap[row[loc].(int)] = row
-			}
-		}
+	for _, row := range mergedDataSet.Rows {
+		rowsMap[row[loc].(int)] = row
 	}
-
-	var resultRows []Row
+	resultDataSet := Dataset{Schema: *tableSchema}
 	for _, rowId := range rowIds {
-		resultRows = append(resultRows, rowsMap[rowId])
+		resultDataSet.Rows = append(resultDataSet.Rows, rowsMap[rowId])
 	}
-	resultDataSet.Rows = resultRows
-	return resultDataSet
+	return resultDataSet, nil
 }
 
-// ScanTableWithSchema get table data with specified columns
-func (c* Cluster) ScanTableWithSchema(tableSchema *TableSchema) Dataset {
-	var remoteDataSets []Dataset
-	endNamePrefix := "InternalClient"
-	for _, remoteId := range c.nodeIds {
-		remoteEndName := endNamePrefix + remoteId
-		remoteEnd := c.network.MakeEnd(remoteEndName)
-		c.network.Connect(remoteEndName, remoteId)
-		c.network.Enable(remoteEndName, true)
-
-		var dataSets []Dataset
-		remoteEnd.Call("Node.ScanTableWithSchema", []interface{}{*tableSchema}, &dataSets)
-		for _, dataSet := range dataSets {
-			if len(dataSet.Rows) > 0 {
-				remoteDataSets = append(remoteDataSets, dataSet)
+// ScanTableWithSchema get table data with specified columns from the given snapshot, which is fetched from the nodes
+// batch by batch
+func (c* Cluster) ScanTableWithSchema(tableSchema *TableSchema, snapshot Snapshot) (Dataset, error) {
+	c.repairReplicas(tableSchema.TableName)
+	request := ScanRequest{Schema: *tableSchema, Snapshot: snapshot}
+	merger := newFragmentMerger(tableSchema)
+	if err := c.scanReplicas(&request, tableSchema.getColumnNames(), merger.add); err != nil {
+		return Dataset{}, err
+	}
+	return merger.result(), nil
+}
+
+// Join all tables in the given list using NATURAL JOIN (join on the common columns), and return the joined result
+// as a list of rows and set it to reply. The tables are read from the same snapshot, so the join is not disturbed by
+// the writes meanwhile. An empty Dataset is replied if a table cannot be read.
+func (c* Cluster) Join(tableNames []string, reply *Dataset) {
+	c.syncCatalog()
+	dataSet, err := c.join(tableNames, JoinAuto, c.getSnapshot(nil))
+	if err != nil {
+		return
+	}
+	*reply = dataSet
+}
+
+// JoinWithAlgorithm is the same as Join, except that the algorithm used to match the rows is specified by params[1]
+// (one of JoinNestedLoop, JoinHash and JoinSortMerge, or JoinAuto to choose one by the sizes of the tables).
+// The tables to join are given by params[0] ([]string). An empty Dataset is replied if the algorithm is unknown or a
+// table cannot be read.
+func (c *Cluster) JoinWithAlgorithm(params []interface{}, reply *Dataset) {
+	c.syncCatalog()
+	tableNames := params[0].([]string)
+	algorithm := params[1].(string)
+	if getJoinAlgorithm(algorithm, 0, 0) == nil {
+		return
+	}
+	dataSet, err := c.join(tableNames, algorithm, c.getSnapshot(nil))
+	if err != nil {
+		return
+	}
+	*reply = dataSet
+}
+
+// JoinWithConditions joins the tables described by the request on the explicitly named columns, which may have
+// different names in the two tables, and supports inner, left, right and full outer joins. The rows that are not matched
+// by an outer join are padded with NULLs (nil). The columns of a joined table whose names are already used by the
+// preceding tables are renamed to "table.column", and column references may be qualified by table names in the same
+// way. A clause without join columns produces the cartesian product. An empty Dataset is replied if the request is
+// invalid.
+func (c *Cluster) JoinWithConditions(request JoinRequest, reply *Dataset) {
+	c.syncCatalog()
+	dataSet, err := c.joinWithConditions(&request, c.getSnapshot(nil))
+	if err != nil {
+		return
+	}
+	*reply = dataSet
+}
+
+// joinWithConditions is the implementation of JoinWithConditions, which reads the tables from the given snapshot
+func (c *Cluster) joinWithConditions(request *JoinRequest, snapshot Snapshot) (Dataset, error) {
+	labgob.Register(Dataset{})
+	schema, ok := c.getSchema(request.Table)
+	if !ok {
+		return Dataset{}, errors.New("no such table " + request.Table)
+	}
+	if getJoinAlgorithm(request.Algorithm, 0, 0) == nil {
+		return Dataset{}, errors.New("unknown join algorithm " + request.Algorithm)
+	}
+	scannedDataSet, err := c.scanTable(&schema, nil, snapshot)
+	if err != nil {
+		return Dataset{}, err
+	}
+	result := scannedDataSet.getProjectedDataSet(schema.getColumnNames())
+
+	for _, clause := range request.Clauses {
+		joinType := strings.ToUpper(clause.Type)
+		if joinType == "" {
+			joinType = JoinInner
+		}
+		if joinType != JoinInner && joinType != JoinLeft && joinType != JoinRight && joinType != JoinFull {
+			return Dataset{}, errors.New("unknown join type " + clause.Type)
+		}
+		rightSchema, ok := c.getSchema(clause.Table)
+		if !ok {
+			return Dataset{}, errors.New("no such table " + clause.Table)
+		}
+		leftColumns, rightColumns := clause.LeftColumns, clause.RightColumns
+		if clause.Natural {
+			leftColumns, rightColumns = nil, nil
+			for _, column := range rightSchema.ColumnSchemas {
+				if result.Schema.getColumnId(column.Name) >= 0 {
+					leftColumns = append(leftColumns, column.Name)
+					rightColumns = append(rightColumns, column.Name)
+				}
 			}
 		}
-	}
+		if len(leftColumns) != len(rightColumns) {
+			return Dataset{}, errors.New("join columns of " + clause.Table + " do not pair up")
+		}
+		leftKeys := make([]int, len(leftColumns))
+		rightKeys := make([]int, len(rightColumns))
+		for i := range leftColumns {
+			leftKeys[i] = result.Schema.resolveColumn(leftColumns[i])
+			rightKeys[i] = rightSchema.getColumnId(strings.TrimPrefix(rightColumns[i], clause.Table + "."))
+			if leftKeys[i] < 0 {
+				return Dataset{}, errors.New("unknown column " + leftColumns[i])
+			}
+			if rightKeys[i] < 0 {
+				return Dataset{}, errors.New("unknown column " + rightColumns[i])
+			}
+		}
+
+		var rightDataSet Dataset
+		var leftIds, rightIds []int
+		if joinType == JoinInner || joinType == JoinLeft {
+			// semi-join, only the matched rows of the right table are fetched as a whole. The keys of the right table
+			// are probed by those of the left one if they are indexed.
+			keySchema := rightSchema.getSubSchema(rightKeys)
+			keyRequest := ScanRequest{Schema: keySchema, Snapshot: snapshot}
+			if len(rightKeys) == 1 && c.isIndexed(clause.Table, keySchema.ColumnSchemas[0].Name) {
+				keyRequest.KeyColumn = keySchema.ColumnSchemas[0].Name
+				keyRequest.KeyValues = getDistinctValues(result.Rows, leftKeys[0])
+			}
+			keyDataSet, err := c.scanFragments(&keyRequest)
+			if err != nil {
+				return Dataset{}, err
+			}
+			keys := make([]int, len(rightKeys))
+			for i := range keys {
+				keys[i] = i
+			}
+			joinAlgorithm := getJoinAlgorithm(request.Algorithm, len(result.Rows), len(keyDataSet.Rows))
+			var keyIds []int
+			leftIds, keyIds = joinAlgorithm.join(result.Rows, keyDataSet.Rows, leftKeys, keys)
 
-	var resultDataSet Dataset
-	resultDataSet.Schema = *tableSchema
-	for i, remoteDataSet := range remoteDataSets {
-		if len(remoteDataSet.Schema.ColumnSchemas) == len(tableSchema.ColumnSchemas) {
-			remoteDataSet.changeSchema(tableSchema)
-			resultDataSet.Rows = append(resultDataSet.Rows, remoteDataSet.Rows...)
+			// fetch the matched rows in the order of their row ids, which is required by merging vertical fragments
+			var matchedRowIds []int
+			positions := make(map[int]int)
+			for _, keyId := range keyIds {
+				rowId := keyDataSet.Rows[keyId][len(keys)].(int)
+				if _, ok := positions[rowId]; !ok {
+					positions[rowId] = 0
+					matchedRowIds = append(matchedRowIds, rowId)
+				}
+			}
+			sort.Ints(matchedRowIds)
+			for i, rowId := range matchedRowIds {
+				positions[rowId] = i
+			}
+			if rightDataSet, err = c.ScanTableWithRowIds(&rightSchema, matchedRowIds, snapshot); err != nil {
+				return Dataset{}, err
+			}
+			for _, keyId := range keyIds {
+				rightIds = append(rightIds, positions[keyDataSet.Rows[keyId][len(keys)].(int)])
+			}
 		} else {
-			for j := i + 1; j < len(remoteDataSets); j++ {
-				remoteDataSet = remoteDataSet.getMergeDataSet(&remoteDataSets[j])
+			var err error
+			if rightDataSet, err = c.scanTable(&rightSchema, nil, snapshot); err != nil {
+				return Dataset{}, err
 			}
-			if len(remoteDataSet.Schema.ColumnSchemas) == len(tableSchema.ColumnSchemas) {
-				remoteDataSet.changeSchema(tableSchema)
-				resultDataSet.Rows = append(resultDataSet.Rows, remoteDataSet.Rows...)
+			joinAlgorithm := getJoinAlgorithm(request.Algorithm, len(result.Rows), len(rightDataSet.Rows))
+			leftIds, rightIds = joinAlgorithm.join(result.Rows, rightDataSet.Rows, leftKeys, rightKeys)
+		}
+
+		leftWidth := len(result.Schema.ColumnSchemas)
+		result = result.getJoinedDataSet(&rightSchema, rightDataSet.Rows, leftIds, rightIds,
+			joinType == JoinLeft || joinType == JoinFull, joinType == JoinRight || joinType == JoinFull)
+		if clause.Natural {
+			// keep a single copy of each common column, which comes from the right table if the left one is missing
+			rightIds := make([]int, len(rightKeys))
+			for i, rightKey := range rightKeys {
+				rightIds[i] = leftWidth + rightKey
 			}
+			result = result.getCoalescedDataSet(leftKeys, rightIds)
 		}
 	}
-	resultDataSet.sortRows()
-	return resultDataSet
+	return result, nil
 }
 
-// Join all tables in the given list using NATURAL JOIN (join on the common columns), and return the joined result
-// as a list of rows and set it to reply.
-func (c* Cluster) Join(tableNames []string, reply *Dataset) {
+// join is the implementation of Join with the given join algorithm, which reads the tables from the given snapshot
+func (c *Cluster) join(tableNames []string, algorithm string, snapshot Snapshot) (Dataset, error) {
 	labgob.Register(Dataset{})
 	var cacheDataSet Dataset
+	var err error
 	for i := range tableNames {
 		if i == len(tableNames) - 1 {
 			break
@@ -210,55 +555,62 @@ func (c* Cluster) Join(tableNames []string, reply *Dataset) {
 
 		var remoteDataSet Dataset
 		var localDataSet Dataset
-		remoteSchema := c.tableSchemaMap[tableNames[i]]
-		localSchema := c.tableSchemaMap[tableNames[i + 1]]
+		remoteSchema, _ := c.getSchema(tableNames[i])
+		localSchema, _ := c.getSchema(tableNames[i + 1])
 		if i == 0 {
 			localIds, remoteIds := localSchema.getForeignKeys(remoteSchema)
 			if localIds != nil {
 				remoteSubSchema := remoteSchema.getSubSchema(remoteIds)
 				localSubSchema := localSchema.getSubSchema(localIds)
-				remoteDataSet = c.ScanTableWithSchema(&remoteSubSchema)
-				localDataSet = c.ScanTableWithSchema(&localSubSchema)
+				if remoteDataSet, err = c.ScanTableWithSchema(&remoteSubSchema, snapshot); err != nil {
+					return Dataset{}, err
+				}
+				if localDataSet, err = c.ScanTableWithSchema(&localSubSchema, snapshot); err != nil {
+					return Dataset{}, err
+				}
 			}
 		} else {
 			localIds, remoteIds := localSchema.getForeignKeys(cacheDataSet.Schema)
 			if localIds != nil {
 				remoteDataSet = cacheDataSet.getSubColumnDataSet(remoteIds)
 				localSubSchema := localSchema.getSubSchema(localIds)
-				localDataSet = c.ScanTableWithSchema(&localSubSchema)
+				if localDataSet, err = c.ScanTableWithSchema(&localSubSchema, snapshot); err != nil {
+					return Dataset{}, err
+				}
 			}
 		}
 
-		// semi-join
+		// semi-join, both sides hold the common columns in the same order followed by the row id
+		keys := make([]int, len(remoteDataSet.Schema.ColumnSchemas))
+		for j := range keys {
+			keys[j] = j
+		}
+		joinAlgorithm := getJoinAlgorithm(algorithm, len(remoteDataSet.Rows), len(localDataSet.Rows))
+		remoteIds, localIds := joinAlgorithm.join(remoteDataSet.Rows, localDataSet.Rows, keys, keys)
 		var remoteRowIds []int
 		var localRowIds []int
-		for _, rowA := range remoteDataSet.Rows {
-			for _, rowB := range localDataSet.Rows {
-				ok := true
-				for j := 0; j < len(rowA) - 1; j++ {
-					if rowA[j] != rowB[j] {
-						ok = false
-						break
-					}
-				}
-				if ok {
-					remoteRowIds = append(remoteRowIds, rowA[len(rowA) - 1].(int))
-					localRowIds = append(localRowIds, rowB[len(rowB) - 1].(int))
-				}
-			}
+		for j := range remoteIds {
+			rowA := remoteDataSet.Rows[remoteIds[j]]
+			rowB := localDataSet.Rows[localIds[j]]
+			remoteRowIds = append(remoteRowIds, rowA[len(rowA) - 1].(int))
+			localRowIds = append(localRowIds, rowB[len(rowB) - 1].(int))
 		}
 
 		if i == 0 {
-			cacheDataSet = c.ScanTableWithRowIds(&remoteSchema, remoteRowIds)
+			if cacheDataSet, err = c.ScanTableWithRowIds(&remoteSchema, remoteRowIds, snapshot); err != nil {
+				return Dataset{}, err
+			}
 		} else {
 			cacheDataSet = cacheDataSet.getSubRowDataSet(remoteRowIds)
 		}
-		localDataSet = c.ScanTableWithRowIds(&localSchema, localRowIds)
+		if localDataSet, err = c.ScanTableWithRowIds(&localSchema, localRowIds, snapshot); err != nil {
+			return Dataset{}, err
+		}
 
 		cacheDataSet = cacheDataSet.getUnionDataSet(&localDataSet)
 	}
 
-	*reply = cacheDataSet
+	return cacheDataSet, nil
 }
 
 func (c* Cluster) isNodeExists(nodeId string) bool {
@@ -271,6 +623,7 @@ func (c* Cluster) isNodeExists(nodeId string) bool {
 }
 
 func (c* Cluster) BuildTable(params []interface{}, reply *string) {
+	c.syncCatalog()
 	labgob.Register([]Predicate{})
 	schema, schemaErr := params[0].(TableSchema)
 	if schemaErr != true {
@@ -283,91 +636,530 @@ func (c* Cluster) BuildTable(params []interface{}, reply *string) {
 		*reply = "Build table error: Cannot cast params[1] to json!"
 		return
 	}
-	c.tableSize[schema.TableName] = 0
-	c.tableSchemaMap[schema.TableName] = schema
 
-	endNamePrefix := "InternalClient"
-	nodeNamePrefix := "Node"
+	var partitionRules []PartitionRule
 	for nodeIds, reluMap := range rules {
-		nodeIdList := strings.Split(nodeIds, "|")
-		for _, nodeId := range nodeIdList {
-			if !c.isNodeExists(nodeNamePrefix + nodeId) {
-				*reply = "Build table error: Node doesn't exist!"
-				return
-			}
-			rule, ruleErr := reluMap.(map[string]interface{})
-			if ruleErr != true {
+		rule, ruleErr := reluMap.(map[string]interface{})
+		if ruleErr != true {
+			*reply = "Build table error: Cannot cast rule in param[1]!"
+			return
+		}
+		partitionRule := PartitionRule{NodeIds: strings.Split(nodeIds, "|")}
+		columnNames, _ := rule["column"].([]interface{})
+		for _, columnName := range columnNames {
+			name, ok := columnName.(string)
+			if !ok {
 				*reply = "Build table error: Cannot cast rule in param[1]!"
 				return
 			}
-
-			endName := endNamePrefix + nodeNamePrefix + nodeId
-			end := c.network.MakeEnd(endName)
-			c.network.Connect(endName, nodeNamePrefix + nodeId)
-			c.network.Enable(endName, true)
-
-			var columnSchemas []ColumnSchema
-			var columnIds []int
-			for _, columnName := range rule["column"].([]interface{}) {
-				var dataType = schema.getDataType(columnName.(string))
-				var columnId = schema.getColumnId(columnName.(string))
-				if dataType == -1 {
-					*reply = "Build table error: Unknown ColumnName name!"
+			partitionRule.ColumnNames = append(partitionRule.ColumnNames, name)
+		}
+		predicateMap, _ := rule["predicate"].(map[string]interface{})
+		for columnName, predicates := range predicateMap {
+			predicateList, _ := predicates.([]interface{})
+			for _, predicate := range predicateList {
+				predicate, ok := predicate.(map[string]interface{})
+				if !ok {
+					*reply = "Build table error: Cannot cast rule in param[1]!"
 					return
 				}
-				var columnSchema = ColumnSchema{
-					columnName.(string),
-					dataType,
-				}
-				columnSchemas = append(columnSchemas, columnSchema)
-				columnIds = append(columnIds, columnId)
+				operator, _ := predicate["op"].(string)
+				partitionRule.Predicates = append(partitionRule.Predicates, Predicate{
+					columnName,
+					operator,
+					schema.getDataType(columnName),
+					predicate["val"],
+				})
 			}
-			tableSchema := TableSchema{
-				TableName: schema.TableName,
-				ColumnSchemas: columnSchemas,
+		}
+		partitionRules = append(partitionRules, partitionRule)
+	}
+
+	*reply = c.buildTable(schema, partitionRules)
+}
+
+// PartitionRule places the listed columns of the rows satisfying all the predicates on each of the nodes identified by
+// simple numbers, e.g., "0" for "Node0". It is the parsed form of a partition rule accepted by BuildTable.
+type PartitionRule struct {
+	NodeIds []string
+	ColumnNames []string
+	Predicates []Predicate
+}
+
+// buildTable creates the fragments of a table on the nodes by the given partition rules, and returns the message to be
+// replied by BuildTable.
+func (c *Cluster) buildTable(schema TableSchema, rules []PartitionRule) string {
+	if err := schema.checkKeys(); err != nil {
+		return "Build table error: " + err.Error() + "!"
+	}
+	if err := c.checkForeignKeys(&schema); err != nil {
+		return "Build table error: " + err.Error() + "!"
+	}
+	if err := checkStorage(schema.Storage); err != nil {
+		return "Build table error: " + err.Error() + "!"
+	}
+
+	nodeNamePrefix := "Node"
+	var fragments []Fragment
+	for fragmentId, rule := range rules {
+		var columnSchemas []ColumnSchema
+		var columnIds []int
+		for _, columnName := range rule.ColumnNames {
+			var dataType = schema.getDataType(columnName)
+			var columnId = schema.getColumnId(columnName)
+			if dataType == -1 {
+				return "Build table error: Unknown ColumnName name!"
 			}
-			var ps []Predicate
-			for columnName, predicates := range rule["predicate"].(map[string]interface{}) {
-				for _, predicate := range predicates.([]interface{}) {
-
-					var p = Predicate{
-						columnName,
-						predicate.(map[string]interface{})["op"].(string),
-						schema.getDataType(columnName),
-						predicate.(map[string]interface{})["val"],
-					}
-					ps = append(ps, p)
-				}
+			columnSchemas = append(columnSchemas, schema.ColumnSchemas[columnId])
+			columnIds = append(columnIds, columnId)
+		}
+		tableSchema := TableSchema{
+			TableName: schema.TableName,
+			ColumnSchemas: columnSchemas,
+			Storage: schema.Storage,
+		}
+		var ps []Predicate
+		for _, p := range rule.Predicates {
+			p.DataType = schema.getDataType(p.ColumnName)
+			if p.DataType == -1 {
+				return "Build table error: Unknown ColumnName name!"
+			}
+			ps = append(ps, p)
+		}
+		var replicas []string
+		for _, nodeId := range rule.NodeIds {
+			replicas = append(replicas, nodeNamePrefix + nodeId)
+		}
+
+		for _, nodeId := range rule.NodeIds {
+			if !c.isNodeExists(nodeNamePrefix + nodeId) {
+				return "Build table error: Node doesn't exist!"
 			}
 
-			end.Call("Node.CreateTableRPC", []interface{}{tableSchema, columnIds, ps, schema}, reply)
-			if *reply != "" {
-				return
+			reply := ""
+			if err := c.call(nodeNamePrefix + nodeId, "Node.CreateTableRPC",
+				[]interface{}{tableSchema, columnIds, ps, schema}, &reply); err != nil {
+				return "Build table error: " + err.Error() + "!"
 			}
+			if reply != "" {
+				return reply
+			}
+			fragments = append(fragments, Fragment{
+				NodeId: nodeNamePrefix + nodeId,
+				ColumnSchemas: columnSchemas,
+				Predicates: ps,
+				FragmentId: fragmentId,
+				Replicas: replicas,
+			})
 		}
- 	}
+	}
 
-	*reply = "Build table success"
+	// the table is known to the coordinator once the catalog replicated among the nodes records it
+	command := CatalogCommand{Kind: CatalogCreateTable, Schema: schema, Fragments: fragments}
+	if _, err := c.proposeCatalog(command); err != nil {
+		return "Build table error: " + err.Error() + "!"
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tableSize[schema.TableName] = 0
+	c.tableSchemaMap[schema.TableName] = schema
+	c.fragmentMap[schema.TableName] = fragments
+	c.indexMap[schema.TableName] = nil
+	delete(c.staleReplicas, schema.TableName)
+	return "Build table success"
 }
 
+// FragmentWrite inserts a row into a table, where params are the name of the table, the row and optionally the mode
+// handling the values whose types differ from their columns, WriteStrict by default. The row must have a value for each
+// column. In the WriteLenient mode, the columns whose values are coerced are listed in the reply like
+// "Fragment write success, coerced columns: age, grade".
 func (c* Cluster) FragmentWrite(params []interface{}, reply *string) {
-	tableName := params[0].(string)
-	row := params[1].(Row)
-	rowId := c.tableSize[tableName]
-	c.tableSize[tableName] += 1
+	c.syncCatalog()
+	mode := WriteStrict
+	if len(params) > 2 {
+		mode = params[2].(string)
+	}
+	*reply = c.insertRow(params[0].(string), params[1].(Row), mode, nil)
+}
 
-	endNamePrefix := "InternalClient"
+// insertRow is the implementation of FragmentWrite, which writes the row within the given transaction unless it is nil
+func (c *Cluster) insertRow(tableName string, row Row, mode string, transaction *Transaction) string {
+	schema, ok := c.getSchema(tableName)
+	if !ok {
+		return "Fragment write error: no such table!"
+	}
+	// dates, timestamps, decimals and bytes are parsed from their literals in both modes
+	row, err := schema.getNormalizedRow(row)
+	if err != nil {
+		return "Fragment write error: " + err.Error() + "!"
+	}
+	row, coercedColumns, err := schema.validateRow(row, mode)
+	if err != nil {
+		return "Fragment write error: " + err.Error() + "!"
+	}
+	if err := schema.checkNotNull([]Row{row}); err != nil {
+		return "Fragment write error: " + err.Error() + "!"
+	}
+	if !c.isRowPlaced(&schema, &row) {
+		return "Fragment write error: no fragment accepts the row!"
+	}
+	unlockKeys, err := c.lockKeys(&schema, []Row{row})
+	if err != nil {
+		return "Fragment write error: " + err.Error() + "!"
+	}
+	defer unlockKeys()
+	if err := c.checkKeyConstraints(&schema, []Row{row}, nil); err != nil {
+		return "Fragment write error: " + err.Error() + "!"
+	}
+	if err := c.checkReferences(&schema, []Row{row}); err != nil {
+		return "Fragment write error: " + err.Error() + "!"
+	}
+	// the row id is allocated by the catalog replicated among the nodes
+	allocated, err := c.proposeCatalog(CatalogCommand{Kind: CatalogAllocateRows, TableName: tableName, Count: 1})
+	if err != nil {
+		return "Fragment write error: " + err.Error() + "!"
+	}
+	rowId := allocated.FirstRowId
+	c.mu.Lock()
+	c.tableSize[tableName] = rowId + 1
+	c.mu.Unlock()
+
+	if transaction != nil {
+		if reply := c.writeRow(&schema, row, rowId, transaction); reply != "" {
+			return reply
+		}
+	} else {
+		var fragments []Fragment
+		for _, fragment := range c.getFragments(tableName) {
+			if ok, err := checkPredicates(&schema, &row, fragment.Predicates); ok || err != nil {
+				fragments = append(fragments, fragment)
+			}
+		}
+		write := TableWrite{TableName: tableName, Rows: []Row{append(row, rowId)}}
+		if err := c.logWrites([]TableWrite{write}, map[string][]Fragment{tableName: fragments}); err != nil {
+			c.dropRows(tableName, []int{rowId})
+			return err.Error()
+		}
+	}
+	reply := "Fragment write success"
+	if len(coercedColumns) > 0 {
+		reply += ", coerced columns: " + strings.Join(coercedColumns, ", ")
+	}
+	return reply
+}
+
+// writeRow inserts a row with the given row id into the replicas of the fragments whose partition predicates it
+// satisfies within a transaction, and returns an empty string if it succeeds. The write fails with the error replied by
+// a node or if any replica does not reply, and the row is left to the rollback of the transaction. The writes outside
+// transactions are logged instead, see logWrites.
+func (c *Cluster) writeRow(schema *TableSchema, row Row, rowId int, transaction *Transaction) string {
+	c.repairReplicas(schema.TableName)
+	for _, nodeId := range c.getInsertNodes(schema, &row) {
+		// a stale replica gets the row when it is synced, but a stale primary is still locked
+		if c.isStale(schema.TableName, nodeId) {
+			if err := c.lockPrimary(schema.TableName, nodeId, []int{rowId}, transaction); err != nil {
+				return err.Error()
+			}
+			continue
+		}
+		if err := c.lockRows(nodeId, schema.TableName, []int{rowId}, transaction); err != nil {
+			return err.Error()
+		}
+		transaction.join(nodeId)
+		// the request id keeps the row from being inserted twice by the retries
+		args := []interface{}{schema.TableName, row, rowId, c.getSnapshot(transaction), c.client.newRequestId()}
+		reply := ""
+		if err := c.call(nodeId, "Node.InsertRPC", args, &reply); err != nil {
+			return err.Error()
+		}
+		if reply != "" {
+			return reply
+		}
+	}
+	return ""
+}
+
+// getFragmentNodes returns the nodes holding any fragment of the given table that contains at least one of the given
+// columns (any column if nil) and whose partition predicates do not contradict the given predicates.
+func (c *Cluster) getFragmentNodes(tableName string, columnNames []string, predicates []Predicate) []string {
+	selected := make(map[string]bool)
+	for _, fragment := range c.getFragments(tableName) {
+		if !selected[fragment.NodeId] && fragment.isRelevant(columnNames, predicates) {
+			selected[fragment.NodeId] = true
+		}
+	}
+
+	var nodeIds []string
 	for _, nodeId := range c.nodeIds {
-		endName := endNamePrefix + nodeId
-		end := c.network.MakeEnd(endName)
-		c.network.Connect(endName, nodeId)
-		c.network.Enable(endName, true)
+		if selected[nodeId] {
+			nodeIds = append(nodeIds, nodeId)
+		}
+	}
+	return nodeIds
+}
 
-		end.Call("Node.InsertRPC", []interface{}{tableName, row, rowId}, &reply)
-		if *reply != "" {
-			return
+// getInsertNodes returns the nodes holding any fragment of the table whose partition predicates the row satisfies
+func (c *Cluster) getInsertNodes(schema *TableSchema, row *Row) []string {
+	selected := make(map[string]bool)
+	for _, fragment := range c.getFragments(schema.TableName) {
+		if selected[fragment.NodeId] {
+			continue
+		}
+		// let the nodes report the row if the predicates cannot be evaluated
+		ok, err := checkPredicates(schema, row, fragment.Predicates)
+		if ok || err != nil {
+			selected[fragment.NodeId] = true
+		}
+	}
+
+	var nodeIds []string
+	for _, nodeId := range c.nodeIds {
+		if selected[nodeId] {
+			nodeIds = append(nodeIds, nodeId)
+		}
+	}
+	return nodeIds
+}
+
+// getPushdownFragments chooses the fragments to which an operation on the rows satisfying the predicates can be pushed
+// down, so that each row is processed by exactly one node without being merged from vertical fragments by its row id.
+// Fragments with the same partition predicates hold the same rows, so one of them holding all columns of scanSchema is
+// chosen for each such group from the replicas that are not stale, and the groups must be disjoint. It returns false if
+// there is no such choice.
+func (c *Cluster) getPushdownFragments(scanSchema *TableSchema, predicates []Predicate) ([]Fragment, bool) {
+	// the fragments of a node with the same partition predicates are merged into one table by the node
+	var units []Fragment
+	for _, fragment := range c.getFragments(scanSchema.TableName) {
+		if !isPredicatesSatisfiable(append(append([]Predicate{}, predicates...), fragment.Predicates...)) {
+			continue
+		}
+		merged := false
+		for i := range units {
+			if units[i].NodeId == fragment.NodeId && isPredicatesSame(units[i].Predicates, fragment.Predicates) {
+				units[i].ColumnSchemas = append(units[i].ColumnSchemas, fragment.ColumnSchemas...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			units = append(units, Fragment{
+				NodeId: fragment.NodeId,
+				ColumnSchemas: append([]ColumnSchema{}, fragment.ColumnSchemas...),
+				Predicates: fragment.Predicates,
+			})
+		}
+	}
+
+	var chosen []Fragment
+	var groups [][]Predicate
+	for _, unit := range units {
+		groupId := -1
+		for i, groupPredicates := range groups {
+			if isPredicatesSame(groupPredicates, unit.Predicates) {
+				groupId = i
+				break
+			}
+		}
+		if groupId < 0 {
+			groupId = len(groups)
+			groups = append(groups, unit.Predicates)
+			chosen = append(chosen, Fragment{})
+		}
+		if chosen[groupId].NodeId != "" {
+			continue
+		}
+		hasColumns := true
+		for _, column := range scanSchema.ColumnSchemas {
+			hasColumns = hasColumns && unit.hasColumn(column.Name)
+		}
+		if hasColumns && !c.isStale(scanSchema.TableName, unit.NodeId) {
+			chosen[groupId] = unit
+		}
+	}
+
+	for i := range groups {
+		if chosen[i].NodeId == "" {
+			return nil, false
+		}
+		for j := 0; j < i; j++ {
+			if isPredicatesSatisfiable(append(append(append([]Predicate{}, predicates...), groups[i]...), groups[j]...)) {
+				return nil, false
+			}
+		}
+	}
+	return chosen, true
+}
+
+// isPredicatesSame checks whether two lists of predicates contain the same predicates
+func isPredicatesSame(pa []Predicate, pb []Predicate) bool {
+	return isPredicatesEqual(pa, pb) && isPredicatesEqual(pb, pa)
+}
+
+// isRowPlaced checks whether every column of the row is held by some fragment whose partition predicates the row
+// satisfies, otherwise the row would be lost or only partially stored, e.g., if a partitioning column is NULL.
+func (c *Cluster) isRowPlaced(schema *TableSchema, row *Row) bool {
+	placed := make([]bool, len(schema.ColumnSchemas))
+	for _, fragment := range c.getFragments(schema.TableName) {
+		if ok, err := checkPredicates(schema, row, fragment.Predicates); !ok && err == nil {
+			continue
+		}
+		for _, column := range fragment.ColumnSchemas {
+			placed[schema.getColumnId(column.Name)] = true
+		}
+	}
+	for _, ok := range placed {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// getEnd returns a client (end) connected to the given node, the end is created on first use. The RPCs of the
+// coordinator are sent by call instead, which retries them.
+func (c *Cluster) getEnd(nodeId string) *labrpc.ClientEnd {
+	return c.client.getEnd(nodeId)
+}
+
+// call calls the method of a node by the client of the coordinator, and returns an error if the node does not reply,
+// see rpcClient.call
+func (c *Cluster) call(nodeId string, svcMeth string, args interface{}, reply interface{}) error {
+	return c.client.call(nodeId, svcMeth, args, reply)
+}
+
+// getSchema returns the schema of a table, and whether the table exists
+func (c *Cluster) getSchema(tableName string) (TableSchema, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	schema, ok := c.tableSchemaMap[tableName]
+	return schema, ok
+}
+
+// getFragments returns the fragments of a table in the order they are created. The returned slice is shared with the
+// catalog, which only replaces it as a whole, so it must not be modified.
+func (c *Cluster) getFragments(tableName string) []Fragment {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.fragmentMap[tableName]
+}
+
+// Select scans the table named params[0], keeping the columns listed in params[1] ([]string, all columns if empty)
+// of the rows that satisfy all predicates in params[2] ([]Predicate), and sets the result to reply with rows in the
+// order they were written. The predicates are pushed down to the nodes, where fragments whose partition predicates
+// cannot match are pruned. An empty Dataset is replied if the query is invalid, including params of wrong types.
+func (c *Cluster) Select(params []interface{}, reply *Dataset) {
+	c.syncCatalog()
+	tableName, columnNames, predicates, err := getSelectParams(params)
+	if err != nil {
+		return
+	}
+	dataSet, err := c.selectRows(tableName, columnNames, predicates, c.getSnapshot(nil))
+	if err != nil {
+		return
+	}
+	*reply = dataSet
+}
+
+// getSelectParams checks the types of the params of Select, where the columns and the predicates may be omitted or nil
+func getSelectParams(params []interface{}) (string, []string, []Predicate, error) {
+	if len(params) == 0 || len(params) > 3 {
+		return "", nil, nil, fmt.Errorf("expected 1 to 3 params, got %d", len(params))
+	}
+	tableName, ok := params[0].(string)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected a table name, got %v (%T)", params[0], params[0])
+	}
+	var columnNames []string
+	if len(params) > 1 && params[1] != nil {
+		if columnNames, ok = params[1].([]string); !ok {
+			return "", nil, nil, fmt.Errorf("expected column names, got %v (%T)", params[1], params[1])
+		}
+	}
+	var predicates []Predicate
+	if len(params) > 2 && params[2] != nil {
+		if predicates, ok = params[2].([]Predicate); !ok {
+			return "", nil, nil, fmt.Errorf("expected predicates, got %v (%T)", params[2], params[2])
 		}
 	}
+	return tableName, columnNames, predicates, nil
+}
 
-	*reply = "Fragment write success"
+// selectRows is the implementation of Select, which reads the table from the given snapshot
+func (c *Cluster) selectRows(tableName string, columnNames []string, predicates []Predicate,
+	snapshot Snapshot) (Dataset, error) {
+	schema, ok := c.getSchema(tableName)
+	if !ok {
+		return Dataset{}, errors.New("no such table " + tableName)
+	}
+	if len(columnNames) == 0 {
+		for _, column := range schema.ColumnSchemas {
+			columnNames = append(columnNames, column.Name)
+		}
+	}
+
+	// scan the projected columns as well as the columns used by the predicates
+	var scanIds []int
+	isScanned := make([]bool, len(schema.ColumnSchemas))
+	for _, columnName := range columnNames {
+		columnId := schema.getColumnId(columnName)
+		if columnId < 0 {
+			return Dataset{}, errors.New("unknown column " + columnName)
+		}
+		if !isScanned[columnId] {
+			isScanned[columnId] = true
+			scanIds = append(scanIds, columnId)
+		}
+	}
+	typedPredicates, err := getTypedPredicates(&schema, predicates)
+	if err != nil {
+		return Dataset{}, err
+	}
+	for _, p := range typedPredicates {
+		columnId := schema.getColumnId(p.ColumnName)
+		if !isScanned[columnId] {
+			isScanned[columnId] = true
+			scanIds = append(scanIds, columnId)
+		}
+	}
+	scanSchema := schema.getSubSchema(scanIds)
+
+	mergedDataSet, err := c.scanTable(&scanSchema, typedPredicates, snapshot)
+	if err != nil {
+		return Dataset{}, err
+	}
+	return mergedDataSet.getProjectedDataSet(columnNames), nil
+}
+
+// getTypedPredicates checks that the predicates refer to the columns of the table with valid operators, and returns
+// a copy of them whose data types are set by the schema
+func getTypedPredicates(schema *TableSchema, predicates []Predicate) ([]Predicate, error) {
+	typedPredicates := make([]Predicate, len(predicates))
+	for i, p := range predicates {
+		if schema.getColumnId(p.ColumnName) < 0 {
+			return nil, errors.New("unknown column " + p.ColumnName)
+		}
+		if !isValidOperator(p.Operator) {
+			return nil, errors.New("unknown operator " + p.Operator)
+		}
+		p.DataType = schema.getDataType(p.ColumnName)
+		typedPredicates[i] = p
+	}
+	return typedPredicates, nil
+}
+
+// scanTable scans the columns of scanSchema of the rows satisfying the given predicates from the given snapshot, where
+// the data types of the predicates should have been set. The rows are returned in the order of their row ids, and each
+// row carries the hidden row id. It fails if no replica of a fragment holding the rows can be read.
+func (c *Cluster) scanTable(scanSchema *TableSchema, predicates []Predicate, snapshot Snapshot) (Dataset, error) {
+	return c.scanFragments(&ScanRequest{Schema: *scanSchema, Predicates: predicates, Snapshot: snapshot})
+}
+
+// scanFragments is the same as scanTable, except that the rows are scanned by the given request, see ScanRequest
+func (c *Cluster) scanFragments(request *ScanRequest) (Dataset, error) {
+	c.repairReplicas(request.Schema.TableName)
+	merger := newFragmentMerger(&request.Schema)
+	if err := c.scanReplicas(request, request.Schema.getColumnNames(), merger.add); err != nil {
+		return Dataset{}, err
+	}
+	return merger.result(), nil
 }
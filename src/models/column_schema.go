@@ -1,9 +1,10 @@
 package models
 
-// ColumnSchema defines the name and the datatype of a column
+// ColumnSchema defines the name and the datatype of a column, and whether the column accepts NULLs (nil)
 type ColumnSchema struct {
 	Name string
 	DataType int // one of datatype.go
+	NotNull bool
 }
 
 func (cs *ColumnSchema) equals(other *ColumnSchema) bool {
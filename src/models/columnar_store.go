@@ -0,0 +1,337 @@
+package models
+
+// ColumnarRowStore stores the values of each column in a vector of the data type of the column, e.g., the values of an
+// INT32 column in an []int64, instead of a Row of boxed values for each row. The values beyond the columns of the
+// schema, e.g., the hidden row ids of fragments, are kept by vectors of their own. Rows are removed by tombstones like
+// SliceRowStore, and the rows read from the store are assembled from the vectors.
+type ColumnarRowStore struct {
+	dataTypes []int
+	data *columnData
+}
+
+// columnData holds the vectors of a ColumnarRowStore, which are replaced as a whole when the tombstones are dropped,
+// so that the iterators over the old vectors are not affected
+type columnData struct {
+	columns []columnVector
+	// the number of values of each row, and whether the row has been removed
+	widths []int
+	removed []bool
+	removedCount int
+}
+
+// columnVector holds the values of a column, where the i-th value belongs to the i-th row of the store. A vector keeps
+// the exact Go type of each value, e.g., an int and an int32 are both kept by an intVector but read back as they were,
+// and the values it cannot hold natively, e.g., NULLs, are boxed.
+type columnVector interface {
+	append(value interface{})
+	get(i int) interface{}
+	// whether the i-th value equals the given value, see valuesEqual
+	matches(i int, value interface{}) bool
+}
+
+func NewColumnarRowStore(schema *TableSchema) *ColumnarRowStore {
+	s := &ColumnarRowStore{}
+	for _, column := range schema.ColumnSchemas {
+		s.dataTypes = append(s.dataTypes, column.DataType)
+	}
+	s.data = newColumnData(s.dataTypes)
+	return s
+}
+
+func newColumnData(dataTypes []int) *columnData {
+	data := &columnData{}
+	for _, dataType := range dataTypes {
+		data.columns = append(data.columns, newColumnVector(dataType))
+	}
+	return data
+}
+
+func (s *ColumnarRowStore) count() int {
+	return len(s.data.widths) - s.data.removedCount
+}
+
+func (s *ColumnarRowStore) iterator() RowIterator {
+	return &ColumnarRowIterator{data: s.data}
+}
+
+func (s *ColumnarRowStore) insert(row *Row) {
+	s.data.append(*row)
+}
+
+func (s *ColumnarRowStore) remove(row *Row) {
+	data := s.data
+	for i := range data.widths {
+		if !data.removed[i] && data.matches(i, *row) {
+			data.removed[i] = true
+			data.removedCount++
+			if data.removedCount * 2 > len(data.widths) {
+				s.compact()
+			}
+			return
+		}
+	}
+}
+
+// compact copies the rows left into new vectors, dropping the tombstones
+func (s *ColumnarRowStore) compact() {
+	data := newColumnData(s.dataTypes)
+	for i := range s.data.widths {
+		if !s.data.removed[i] {
+			data.append(s.data.row(i))
+		}
+	}
+	s.data = data
+}
+
+func (data *columnData) append(row Row) {
+	// a row wider than the vectors is given vectors of boxed values for the rest values, where the rows before it are
+	// padded with NULLs
+	for len(data.columns) < len(row) {
+		vector := &valueVector{values: make([]interface{}, len(data.widths))}
+		data.columns = append(data.columns, vector)
+	}
+	for i, vector := range data.columns {
+		if i < len(row) {
+			vector.append(row[i])
+		} else {
+			vector.append(nil)
+		}
+	}
+	data.widths = append(data.widths, len(row))
+	data.removed = append(data.removed, false)
+}
+
+func (data *columnData) matches(i int, row Row) bool {
+	if data.widths[i] != len(row) {
+		return false
+	}
+	for j, value := range row {
+		if !data.columns[j].matches(i, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (data *columnData) row(i int) Row {
+	row := make(Row, data.widths[i])
+	for j := range row {
+		row[j] = data.columns[j].get(i)
+	}
+	return row
+}
+
+// ColumnarRowIterator iterates rows in a ColumnarRowStore, skipping the tombstones
+type ColumnarRowIterator struct {
+	data *columnData
+	next int
+}
+
+func (iter *ColumnarRowIterator) HasNext() bool {
+	for iter.next < len(iter.data.widths) && iter.data.removed[iter.next] {
+		iter.next++
+	}
+	return iter.next < len(iter.data.widths)
+}
+
+func (iter *ColumnarRowIterator) Next() *Row {
+	if !iter.HasNext() {
+		return nil
+	}
+	row := iter.data.row(iter.next)
+	iter.next++
+	return &row
+}
+
+// the Go types of the values held natively by the vectors, where kindBoxed marks a value boxed by the vector
+const (
+	kindBoxed byte = iota
+	kindInt
+	kindInt32
+	kindInt64
+	kindFloat32
+	kindFloat64
+	kindNative
+)
+
+func newColumnVector(dataType int) columnVector {
+	switch dataType {
+	case TypeInt32, TypeInt64:
+		return &intVector{}
+	case TypeFloat, TypeDouble:
+		return &floatVector{}
+	case TypeBoolean:
+		return &boolVector{}
+	case TypeString:
+		return &stringVector{}
+	}
+	// dates, timestamps, decimals and bytes are kept as they are
+	return &valueVector{}
+}
+
+// boxedValues holds the values of a vector that are not held natively, indexed by their positions
+type boxedValues map[int]interface{}
+
+func (boxed *boxedValues) set(i int, value interface{}) {
+	if *boxed == nil {
+		*boxed = make(boxedValues)
+	}
+	(*boxed)[i] = value
+}
+
+type intVector struct {
+	values []int64
+	kinds []byte
+	boxed boxedValues
+}
+
+func (vector *intVector) append(value interface{}) {
+	switch v := value.(type) {
+	case int:
+		vector.values, vector.kinds = append(vector.values, int64(v)), append(vector.kinds, kindInt)
+	case int32:
+		vector.values, vector.kinds = append(vector.values, int64(v)), append(vector.kinds, kindInt32)
+	case int64:
+		vector.values, vector.kinds = append(vector.values, v), append(vector.kinds, kindInt64)
+	default:
+		vector.boxed.set(len(vector.values), value)
+		vector.values, vector.kinds = append(vector.values, 0), append(vector.kinds, kindBoxed)
+	}
+}
+
+func (vector *intVector) get(i int) interface{} {
+	switch vector.kinds[i] {
+	case kindInt:
+		return int(vector.values[i])
+	case kindInt32:
+		return int32(vector.values[i])
+	case kindInt64:
+		return vector.values[i]
+	}
+	return vector.boxed[i]
+}
+
+func (vector *intVector) matches(i int, value interface{}) bool {
+	switch v := value.(type) {
+	case int:
+		return vector.kinds[i] == kindInt && vector.values[i] == int64(v)
+	case int32:
+		return vector.kinds[i] == kindInt32 && vector.values[i] == int64(v)
+	case int64:
+		return vector.kinds[i] == kindInt64 && vector.values[i] == v
+	}
+	return vector.kinds[i] == kindBoxed && valuesEqual(vector.boxed[i], value)
+}
+
+type floatVector struct {
+	values []float64
+	kinds []byte
+	boxed boxedValues
+}
+
+func (vector *floatVector) append(value interface{}) {
+	switch v := value.(type) {
+	case float32:
+		vector.values, vector.kinds = append(vector.values, float64(v)), append(vector.kinds, kindFloat32)
+	case float64:
+		vector.values, vector.kinds = append(vector.values, v), append(vector.kinds, kindFloat64)
+	default:
+		vector.boxed.set(len(vector.values), value)
+		vector.values, vector.kinds = append(vector.values, 0), append(vector.kinds, kindBoxed)
+	}
+}
+
+func (vector *floatVector) get(i int) interface{} {
+	switch vector.kinds[i] {
+	case kindFloat32:
+		return float32(vector.values[i])
+	case kindFloat64:
+		return vector.values[i]
+	}
+	return vector.boxed[i]
+}
+
+func (vector *floatVector) matches(i int, value interface{}) bool {
+	switch v := value.(type) {
+	case float32:
+		return vector.kinds[i] == kindFloat32 && vector.values[i] == float64(v)
+	case float64:
+		return vector.kinds[i] == kindFloat64 && vector.values[i] == v
+	}
+	return vector.kinds[i] == kindBoxed && valuesEqual(vector.boxed[i], value)
+}
+
+type boolVector struct {
+	values []bool
+	kinds []byte
+	boxed boxedValues
+}
+
+func (vector *boolVector) append(value interface{}) {
+	if v, ok := value.(bool); ok {
+		vector.values, vector.kinds = append(vector.values, v), append(vector.kinds, kindNative)
+		return
+	}
+	vector.boxed.set(len(vector.values), value)
+	vector.values, vector.kinds = append(vector.values, false), append(vector.kinds, kindBoxed)
+}
+
+func (vector *boolVector) get(i int) interface{} {
+	if vector.kinds[i] == kindNative {
+		return vector.values[i]
+	}
+	return vector.boxed[i]
+}
+
+func (vector *boolVector) matches(i int, value interface{}) bool {
+	if v, ok := value.(bool); ok {
+		return vector.kinds[i] == kindNative && vector.values[i] == v
+	}
+	return vector.kinds[i] == kindBoxed && valuesEqual(vector.boxed[i], value)
+}
+
+type stringVector struct {
+	values []string
+	kinds []byte
+	boxed boxedValues
+}
+
+func (vector *stringVector) append(value interface{}) {
+	if v, ok := value.(string); ok {
+		vector.values, vector.kinds = append(vector.values, v), append(vector.kinds, kindNative)
+		return
+	}
+	vector.boxed.set(len(vector.values), value)
+	vector.values, vector.kinds = append(vector.values, ""), append(vector.kinds, kindBoxed)
+}
+
+func (vector *stringVector) get(i int) interface{} {
+	if vector.kinds[i] == kindNative {
+		return vector.values[i]
+	}
+	return vector.boxed[i]
+}
+
+func (vector *stringVector) matches(i int, value interface{}) bool {
+	if v, ok := value.(string); ok {
+		return vector.kinds[i] == kindNative && vector.values[i] == v
+	}
+	return vector.kinds[i] == kindBoxed && valuesEqual(vector.boxed[i], value)
+}
+
+// valueVector keeps the values boxed, for the data types without a native vector
+type valueVector struct {
+	values []interface{}
+}
+
+func (vector *valueVector) append(value interface{}) {
+	vector.values = append(vector.values, value)
+}
+
+func (vector *valueVector) get(i int) interface{} {
+	return vector.values[i]
+}
+
+func (vector *valueVector) matches(i int, value interface{}) bool {
+	return valuesEqual(vector.values[i], value)
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// checkKeys checks that the keys of a schema refer to its columns
+func (ts *TableSchema) checkKeys() error {
+	for _, key := range append([][]string{ts.PrimaryKey}, ts.UniqueKeys...) {
+		for _, columnName := range key {
+			if ts.getColumnId(columnName) < 0 {
+				return errors.New("unknown key column " + columnName)
+			}
+		}
+	}
+	for _, key := range ts.UniqueKeys {
+		if len(key) == 0 {
+			return errors.New("empty unique key")
+		}
+	}
+	return nil
+}
+
+// checkNotNull checks that the given rows have no NULL (nil) in the columns declared NotNull
+func (ts *TableSchema) checkNotNull(rows []Row) error {
+	for i, column := range ts.ColumnSchemas {
+		if !column.NotNull {
+			continue
+		}
+		for _, row := range rows {
+			if i >= len(row) || row[i] == nil {
+				return errors.New("NULL value in column " + column.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// isAnyKeyColumn checks whether any of the given columns belongs to the primary key or a unique key
+func (ts *TableSchema) isAnyKeyColumn(columnIds []int) bool {
+	for _, key := range append([][]string{ts.PrimaryKey}, ts.UniqueKeys...) {
+		for _, columnName := range key {
+			for _, columnId := range columnIds {
+				if ts.ColumnSchemas[columnId].Name == columnName {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkKeyConstraints checks that the given rows, which are about to be written to a table, neither share the values
+// of the primary key or a unique key with each other nor with the rows in the table, except those with the excluded
+// row ids (i.e., the rows to be replaced). The rows in the table are looked up by pushing the key values down to the
+// fragments holding the key columns, so the keys may be split from the rest of the row. The latest rows are read rather
+// than a snapshot, so the keys written by the pending transactions are taken.
+func (c *Cluster) checkKeyConstraints(schema *TableSchema, rows []Row, excludedRowIds map[int]bool) error {
+	keys := schema.UniqueKeys
+	if len(schema.PrimaryKey) > 0 {
+		keys = append([][]string{schema.PrimaryKey}, keys...)
+	}
+	for i, key := range keys {
+		isPrimary := i == 0 && len(schema.PrimaryKey) > 0
+		keyIds := make([]int, len(key))
+		for j, columnName := range key {
+			keyIds[j] = schema.getColumnId(columnName)
+		}
+		keySchema := schema.getSubSchema(keyIds)
+
+		var checkedPredicates [][]Predicate
+		for _, row := range rows {
+			predicates, values, hasNull := getKeyPredicates(schema, row, keyIds)
+			if hasNull {
+				if isPrimary {
+					return errors.New("NULL value in primary key (" + strings.Join(key, ", ") + ")")
+				}
+				// NULLs are not equal to each other, so the key is always unique
+				continue
+			}
+
+			duplicated := false
+			for _, ps := range checkedPredicates {
+				if ok, err := checkPredicates(schema, &row, ps); err == nil && ok {
+					duplicated = true
+					break
+				}
+			}
+			if !duplicated {
+				dataSet, err := c.scanTable(&keySchema, predicates, c.getLatestSnapshot())
+				if err != nil {
+					return err
+				}
+				for _, rowId := range getRowIds(&dataSet) {
+					if !excludedRowIds[rowId] {
+						duplicated = true
+						break
+					}
+				}
+			}
+			if duplicated {
+				keyName := "unique key"
+				if isPrimary {
+					keyName = "primary key"
+				}
+				return errors.New("duplicate value (" + strings.Join(values, ", ") + ") of " + keyName + " (" +
+					strings.Join(key, ", ") + ")")
+			}
+			checkedPredicates = append(checkedPredicates, predicates)
+		}
+	}
+	return nil
+}
+
+// getKeyPredicates returns the predicates that match the values of the given key columns of a row, the formatted
+// values, and whether any of the values is NULL (or missing)
+func getKeyPredicates(schema *TableSchema, row Row, keyIds []int) ([]Predicate, []string, bool) {
+	var predicates []Predicate
+	var values []string
+	for _, columnId := range keyIds {
+		if columnId >= len(row) || row[columnId] == nil {
+			return nil, nil, true
+		}
+		column := schema.ColumnSchemas[columnId]
+		predicates = append(predicates, Predicate{
+			ColumnName: column.Name,
+			Operator: "==",
+			DataType: column.DataType,
+			Value: row[columnId],
+		})
+		values = append(values, fmt.Sprintf("%v", row[columnId]))
+	}
+	return predicates, values, false
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// the primary key sid of student is held by node0, while the other columns are held by node1
+func setupConstraint(t *testing.T) {
+	setupLab3(t)
+	studentTableSchema.PrimaryKey = []string{"sid"}
+	studentTableSchema.UniqueKeys = [][]string{{"name", "age"}}
+
+	m := map[string]interface{}{
+		"0": map[string]interface{}{
+			"column": [...]string{
+				"sid",
+			},
+		},
+		"1": map[string]interface{}{
+			"column": [...]string{
+				"name", "age", "grade",
+			},
+		},
+	}
+	studentTablePartitionRules, _ = json.Marshal(m)
+
+	replyMsg := ""
+	cli.Call("Cluster.BuildTable", []interface{}{*studentTableSchema, studentTablePartitionRules}, &replyMsg)
+	if replyMsg != "Build table success" {
+		t.Fatalf("Failed to build table: %s", replyMsg)
+	}
+	for _, row := range studentRows {
+		replyMsg = ""
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, row}, &replyMsg)
+		if replyMsg != "Fragment write success" {
+			t.Fatalf("Failed to write %v: %s", row, replyMsg)
+		}
+	}
+}
+
+func TestPrimaryKey(t *testing.T) {
+	setupConstraint(t)
+
+	replyMsg := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{1, "Smith2", 23, 3.0}}, &replyMsg)
+	if replyMsg != "Fragment write error: duplicate value (1) of primary key (sid)!" {
+		t.Errorf("Duplicate primary key should be rejected, reply: %s", replyMsg)
+	}
+	replyMsg = ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{nil, "Smith2", 23, 3.0}}, &replyMsg)
+	if replyMsg != "Fragment write error: NULL value in primary key (sid)!" {
+		t.Errorf("NULL primary key should be rejected, reply: %s", replyMsg)
+	}
+	replyMsg = ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Smith2", 23, 3.0}}, &replyMsg)
+	if replyMsg != "Fragment write success" {
+		t.Errorf("A new primary key should be accepted, reply: %s", replyMsg)
+	}
+
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{studentTableName, []string{"sid"}, []Predicate{}}, &results)
+	if len(results.Rows) != 4 {
+		t.Errorf("Incorrect rows, expected 4 rows, actual %v", results)
+	}
+
+	// the key of a deleted row can be reused
+	cli.Call("Cluster.Delete", []interface{}{studentTableName,
+		[]Predicate{{ColumnName: "sid", Operator: "==", Value: 3}}}, &replyMsg)
+	replyMsg = ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Smith3", 23, 3.0}}, &replyMsg)
+	if replyMsg != "Fragment write success" {
+		t.Errorf("The key of a deleted row should be accepted, reply: %s", replyMsg)
+	}
+}
+
+func TestUniqueKey(t *testing.T) {
+	setupConstraint(t)
+
+	replyMsg := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "John", 22, 3.0}}, &replyMsg)
+	if replyMsg != "Fragment write error: duplicate value (John, 22) of unique key (name, age)!" {
+		t.Errorf("Duplicate unique key should be rejected, reply: %s", replyMsg)
+	}
+	// NULLs never conflict
+	for _, sid := range []int{3, 4} {
+		replyMsg = ""
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{sid, "John", nil, 3.0}}, &replyMsg)
+		if replyMsg != "Fragment write success" {
+			t.Errorf("A unique key with NULL should be accepted, reply: %s", replyMsg)
+		}
+	}
+}
+
+func TestConcurrentKeys(t *testing.T) {
+	setupConstraint(t)
+
+	// the writes of the same key are checked and written one by one, so only one of them succeeds
+	for sid := 100; sid < 120; sid++ {
+		var wg sync.WaitGroup
+		replies := make([]string, 5)
+		for i := range replies {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				row := Row{sid, "name" + strconv.Itoa(i), sid, 3.0}
+				cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, row}, &replies[i])
+			}(i)
+		}
+		wg.Wait()
+		succeeded := 0
+		for _, reply := range replies {
+			if reply == "Fragment write success" {
+				succeeded++
+			} else if !strings.HasPrefix(reply, "Fragment write error: duplicate value") {
+				t.Errorf("Writing a duplicate key should fail, reply: %s", reply)
+			}
+		}
+		results := Dataset{}
+		cli.Call("Cluster.Select", []interface{}{studentTableName, []string{"sid"},
+			[]Predicate{{ColumnName: "sid", Operator: "==", Value: sid}}}, &results)
+		if succeeded != 1 || len(results.Rows) != 1 {
+			t.Fatalf("Only one write of key %d should succeed, actual %v %v", sid, replies, results.Rows)
+		}
+	}
+}
+
+func TestUpdateKey(t *testing.T) {
+	setupConstraint(t)
+
+	replyMsg := ""
+	cli.Call("Cluster.Update", []interface{}{
+		studentTableName,
+		[]Assignment{{ColumnName: "sid", Value: 0}},
+		[]Predicate{{ColumnName: "name", Operator: "==", Value: "Smith"}},
+	}, &replyMsg)
+	if !strings.Contains(replyMsg, "duplicate value (0) of primary key (sid)") {
+		t.Errorf("Updating to a duplicate primary key should be rejected, reply: %s", replyMsg)
+	}
+	// all updated rows get the same key
+	cli.Call("Cluster.Update", []interface{}{
+		studentTableName,
+		[]Assignment{{ColumnName: "sid", Value: 5}},
+		[]Predicate{{ColumnName: "grade", Operator: ">", Value: 3.6}},
+	}, &replyMsg)
+	if !strings.Contains(replyMsg, "duplicate value (5) of primary key (sid)") {
+		t.Errorf("Updating rows to the same primary key should be rejected, reply: %s", replyMsg)
+	}
+
+	// a row may keep its own key
+	replyMsg = ""
+	cli.Call("Cluster.Update", []interface{}{
+		studentTableName,
+		[]Assignment{{ColumnName: "sid", Value: 1}, {ColumnName: "grade", Value: 2.0}},
+		[]Predicate{{ColumnName: "sid", Operator: "==", Value: 1}},
+	}, &replyMsg)
+	if replyMsg != "Update success" {
+		t.Errorf("Updating a row to its own key should be accepted, reply: %s", replyMsg)
+	}
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{studentTableName, []string{"sid", "grade"}, []Predicate{}}, &results)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{{Name: "sid", DataType: TypeInt32}, {Name: "grade", DataType: TypeFloat}}},
+		Rows: []Row{{0, 4.0}, {1, 2.0}, {2, 4.0}},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect rows after update, expected %v, actual %v", expectedDataset, results)
+	}
+}
+
+func TestSQLKeys(t *testing.T) {
+	setupLab3(t)
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", `CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING UNIQUE)
+		PARTITION BY (NODE 0 WHERE sid < 10, NODE 1 WHERE sid >= 10);
+		INSERT INTO student VALUES (1, 'John'), (11, 'Smith')`, &result)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "INSERT INTO student VALUES (12, 'John')", &result)
+	if result.Error != "Fragment write error: duplicate value (John) of unique key (name)!" {
+		t.Errorf("Duplicate unique key should be rejected, result: %v", result)
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "CREATE TABLE teacher (tid INT32, PRIMARY KEY (id))", &result)
+	if result.Error != "Build table error: unknown key column id!" {
+		t.Errorf("Unknown key column should be rejected, result: %v", result)
+	}
+}
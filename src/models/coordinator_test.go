@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestNodeCoordinators(t *testing.T) {
+	setupScript(t, `CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING)
+			PARTITION BY (NODES 0|1 WHERE sid < 100, NODES 2|3 WHERE sid >= 100);
+		INSERT INTO student VALUES (0, 'John'), (100, 'Smith')`)
+
+	// the coordinators on the nodes see the tables created by the coordinator of the cluster and the writes of
+	// each other, in the order of the row ids allocated by the catalog
+	network.DeleteServer(c.Name)
+	network.Connect("ClientA", "Node1")
+	checkQuery(t, "SELECT sid, name FROM student", []Row{{0, "John"}, {100, "Smith"}})
+	checkQuery(t, "INSERT INTO student VALUES (1, 'Hana')", []Row{})
+	network.Connect("ClientA", "Node3")
+	checkQuery(t, `INSERT INTO student VALUES (101, 'Lily');
+		CREATE TABLE course (cid INT32, sid INT32) PARTITION BY (NODE 4);
+		INSERT INTO course VALUES (7, 1), (8, 101)`, []Row{})
+	network.Connect("ClientA", "Node2")
+	checkQuery(t, "SELECT sid FROM student", []Row{{0}, {100}, {1}, {101}})
+	checkQuery(t, "INSERT INTO student VALUES (1, 'Mary')", nil)
+	checkQuery(t, "SELECT cid, name FROM course JOIN student ON course.sid = student.sid ORDER BY cid",
+		[]Row{{7, "Hana"}, {8, "Lily"}})
+	var schemas []TableSchema
+	cli.Call("Cluster.ShowTables", "", &schemas)
+	if len(schemas) != 2 {
+		t.Errorf("Node2 should show 2 tables, actual %v", schemas)
+	}
+
+	// the requests are still served by the other nodes once the leader of the catalog is lost
+	leader := getCatalogLeader(t)
+	c.CrashNode(leader)
+	for _, nodeId := range c.nodeIds {
+		if nodeId != leader {
+			network.Connect("ClientA", nodeId)
+			break
+		}
+	}
+	checkQuery(t, "INSERT INTO student VALUES (2, 'Ann')", []Row{})
+	checkQuery(t, "SELECT sid FROM student ORDER BY sid", []Row{{0}, {1}, {2}, {100}, {101}})
+}
@@ -0,0 +1,390 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultScanBatchSize is the number of rows fetched from a node by an RPC of a scan unless specified otherwise
+const DefaultScanBatchSize = 1024
+
+// scanCursorTimeout is how long a cursor is kept by a node after it was last used, so that the cursors abandoned by
+// their callers, e.g., because of network failures, do not live forever
+var scanCursorTimeout = time.Minute
+
+// ScanRequest opens a scan over the fragments of Schema.TableName on a node, keeping the columns in Schema and the
+// rows satisfying Predicates, and only the rows whose hidden row ids are in RowIds if it is not nil, and whose values
+// of KeyColumn equal any of KeyValues if KeyColumn is not empty, e.g., to probe the table by the keys of a join.
+// Fragments whose partition predicates contradict the predicates are skipped, and a predicate or the keys are only
+// evaluated on the fragments holding their columns, so the caller should merge the vertically split pieces by the
+// hidden row id. The rows are looked up by the indexes of the fragments if possible, and are read from Snapshot, see
+// mvcc.go.
+type ScanRequest struct {
+	Schema TableSchema
+	Predicates []Predicate
+	RowIds []int
+	KeyColumn string
+	KeyValues []interface{}
+	Snapshot Snapshot
+}
+
+// ScanBatch is the reply of Node.OpenScanRPC and Node.FetchScanRPC. Each Dataset holds the rows of a fragment, whose
+// schema is named by the fragment, e.g., "student-0", and each row carries the hidden row id. Done is set if there is
+// no row left, when the cursor stops scanning and only keeps the batch for a retried fetch until it expires.
+type ScanBatch struct {
+	CursorId int
+	DataSets []Dataset
+	Done bool
+	Error string
+}
+
+// scanCursor is an open scan on a node, which reads the rows of its fragments batch by batch as they are fetched, and
+// returns the rows seen by the snapshot of the request, so the rows written to a fragment while it is being scanned are
+// not returned unless the latest rows are read, see snapshotIterator.
+type scanCursor struct {
+	// guards the cursor against a retried fetch served together with the original one
+	mu sync.Mutex
+	request ScanRequest
+	// the id of the request opening the cursor, by which a retried open finds the cursor, see OpenScanRPC
+	requestId string
+	// the number of the last batch returned, which is 0 for the batch returned by opening the cursor, and the batch
+	// itself, which is returned again to a retried fetch, see FetchScanRPC
+	sequence int
+	lastBatch ScanBatch
+	rowIds map[int]bool
+	// the fragments left to scan, the first of which is being scanned
+	fragments []scanFragment
+	// the next row to return and the schema of its fragment, which has been read to tell whether any row is left
+	peekedRow Row
+	peekedSchema *TableSchema
+	lastUsed time.Time
+}
+
+// scanFragment is a fragment to be scanned by a cursor
+type scanFragment struct {
+	// the schema of the fragment, and the iterator of its rows that may be returned by the cursor
+	tableSchema *TableSchema
+	rows *snapshotIterator
+	// the scanned columns of the fragment, and their positions in the rows of the fragment followed by the row id
+	schema TableSchema
+	columnIds []int
+	// the predicates on the columns held by the fragment
+	predicates []Predicate
+	// the position of the key column in the rows of the fragment, or -1 if the keys are not evaluated, and the keys
+	// converted into the data type of the column, which are also formatted into a set
+	keyColumnId int
+	keyValues []interface{}
+	keys map[string]bool
+}
+
+// OpenScanRPC is an RPC interface that opens a cursor of the request (args[0], ScanRequest) on this node, and replies
+// its id together with at most args[1] (int) rows, so that a small scan takes a single RPC. The rest rows are fetched by
+// FetchScanRPC batch by batch. The id of the request may follow as args[2], so that a retried request replies the first
+// batch of the cursor opened by the earlier one instead of opening another cursor. A scan finished by the first batch
+// keeps no cursor, and a retried request simply scans again, as scans are idempotent.
+func (n *Node) OpenScanRPC(args []interface{}, reply *ScanBatch) {
+	if requestId := getRequestId(args, 2); requestId != "" {
+		n.cursorMu.Lock()
+		for _, cursor := range n.cursors {
+			if cursor.requestId == requestId {
+				cursor.lastUsed = time.Now()
+				n.cursorMu.Unlock()
+				cursor.mu.Lock()
+				defer cursor.mu.Unlock()
+				if cursor.sequence != 0 {
+					reply.Error = "cursor " + strconv.Itoa(cursor.lastBatch.CursorId) + " has been fetched"
+					return
+				}
+				*reply = cursor.lastBatch
+				return
+			}
+		}
+		n.cursorMu.Unlock()
+	}
+	n.openScan(args, reply)
+}
+
+// openScan is the implementation of OpenScanRPC
+func (n *Node) openScan(args []interface{}, reply *ScanBatch) {
+	request := args[0].(ScanRequest)
+	batchSize := args[1].(int)
+	commits, err := n.resolveSnapshot(request.Schema.TableName, request.Snapshot)
+	if err != nil {
+		reply.Error = err.Error()
+		return
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	cursor := &scanCursor{request: request, requestId: getRequestId(args, 2), lastUsed: time.Now()}
+	if request.RowIds != nil {
+		cursor.rowIds = make(map[int]bool)
+		for _, rowId := range request.RowIds {
+			cursor.rowIds[rowId] = true
+		}
+	}
+	for tableCount := 0; ; tableCount++ {
+		pTableName := request.Schema.TableName + "-" + strconv.Itoa(tableCount)
+		t, ok := n.TableMap[pTableName]
+		if !ok {
+			break
+		}
+		if !isPredicatesSatisfiable(append(append([]Predicate{}, request.Predicates...), n.predicates[pTableName]...)) {
+			continue
+		}
+
+		fragment := scanFragment{tableSchema: t.schema, schema: TableSchema{TableName: t.schema.TableName}}
+		for _, columnA := range request.Schema.ColumnSchemas {
+			for i, columnB := range t.schema.ColumnSchemas {
+				if columnA == columnB {
+					fragment.schema.ColumnSchemas = append(fragment.schema.ColumnSchemas, columnA)
+					fragment.columnIds = append(fragment.columnIds, i)
+				}
+			}
+		}
+		if len(fragment.columnIds) == 0 {
+			continue
+		}
+		fragment.columnIds = append(fragment.columnIds, len(t.schema.ColumnSchemas))
+		for _, p := range request.Predicates {
+			if t.schema.getColumnId(p.ColumnName) >= 0 {
+				fragment.predicates = append(fragment.predicates, p)
+			}
+		}
+		fragment.keyColumnId = -1
+		if request.KeyColumn != "" {
+			fragment.keyColumnId = t.schema.getColumnId(request.KeyColumn)
+		}
+		if fragment.keyColumnId >= 0 {
+			fragment.keys = make(map[string]bool)
+			dataType := t.schema.ColumnSchemas[fragment.keyColumnId].DataType
+			for _, value := range request.KeyValues {
+				if key, ok := getIndexKey(dataType, value); ok {
+					fragment.keyValues = append(fragment.keyValues, key)
+					fragment.keys[fmt.Sprintf("%v", key)] = true
+				}
+			}
+		}
+		if fragment.rows, err = t.snapshotIterator(cursor.getIterator(t, &fragment), request.Snapshot, commits); err != nil {
+			reply.Error = err.Error()
+			return
+		}
+		cursor.fragments = append(cursor.fragments, fragment)
+	}
+
+	if reply.DataSets, reply.Done, err = cursor.next(batchSize); err != nil {
+		reply.Error = err.Error()
+		return
+	}
+	if reply.Done {
+		return
+	}
+	n.cursorMu.Lock()
+	defer n.cursorMu.Unlock()
+	n.expireCursors()
+	n.nextCursorId++
+	reply.CursorId = n.nextCursorId
+	cursor.lastBatch = *reply
+	n.cursors[n.nextCursorId] = cursor
+}
+
+// FetchScanRPC is an RPC interface that fetches at most args[1] (int) rows from the cursor whose id is args[0] (int),
+// see ScanBatch. The error of the reply is set if the cursor does not exist, e.g., because it has expired. The number
+// of the batch may follow as args[2] (int), which is 1 for the first fetch, so that a retried request replies the same
+// rows again instead of skipping them.
+func (n *Node) FetchScanRPC(args []interface{}, reply *ScanBatch) {
+	cursorId := args[0].(int)
+	batchSize := args[1].(int)
+	sequence := -1
+	if len(args) > 2 {
+		sequence = args[2].(int)
+	}
+
+	n.cursorMu.Lock()
+	n.expireCursors()
+	cursor, ok := n.cursors[cursorId]
+	if ok {
+		cursor.lastUsed = time.Now()
+	}
+	n.cursorMu.Unlock()
+	if !ok {
+		reply.Error = "no such cursor " + strconv.Itoa(cursorId)
+		return
+	}
+
+	cursor.mu.Lock()
+	defer cursor.mu.Unlock()
+	if sequence == cursor.sequence {
+		*reply = cursor.lastBatch
+		return
+	}
+	if sequence >= 0 && sequence != cursor.sequence + 1 {
+		reply.Error = fmt.Sprintf("batch %d of cursor %d is not the next one", sequence, cursorId)
+		return
+	}
+	reply.CursorId, reply.Done = cursorId, true
+	if !cursor.lastBatch.Done {
+		// the rows are read from the fragments as they are fetched
+		n.mu.RLock()
+		dataSets, done, err := cursor.next(batchSize)
+		n.mu.RUnlock()
+		if err != nil {
+			// the cursor is closed, as the rows left cannot be read, e.g., because the snapshot is too old
+			reply.Error = err.Error()
+			n.cursorMu.Lock()
+			delete(n.cursors, cursorId)
+			n.cursorMu.Unlock()
+			return
+		}
+		reply.DataSets, reply.Done = dataSets, done
+	}
+	cursor.sequence++
+	cursor.lastBatch = *reply
+	if reply.Done {
+		// the rows left are released, while the last batch is kept until the cursor expires
+		cursor.fragments = nil
+	}
+}
+
+// CloseScanRPC is an RPC interface that closes the cursor whose id is args (int) before all its rows are fetched
+func (n *Node) CloseScanRPC(args int, reply *string) {
+	n.cursorMu.Lock()
+	defer n.cursorMu.Unlock()
+	if _, ok := n.cursors[args]; !ok {
+		*reply = "no such cursor " + strconv.Itoa(args)
+		return
+	}
+	delete(n.cursors, args)
+	*reply = "Close scan success"
+}
+
+// expireCursors closes the cursors that have not been used for scanCursorTimeout, the caller should hold cursorMu
+func (n *Node) expireCursors() {
+	for cursorId, cursor := range n.cursors {
+		if time.Since(cursor.lastUsed) > scanCursorTimeout {
+			delete(n.cursors, cursorId)
+		}
+	}
+}
+
+// next returns at most batchSize rows left in the cursor grouped by their fragments, where fragments without rows in
+// the batch are omitted, and whether all rows have been returned. The caller should hold the lock of the node.
+func (cursor *scanCursor) next(batchSize int) ([]Dataset, bool, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultScanBatchSize
+	}
+	var dataSets []Dataset
+	for count := 0; count < batchSize; count++ {
+		row, schema, err := cursor.nextRow()
+		if err != nil {
+			return nil, false, err
+		}
+		if row == nil {
+			break
+		}
+		if last := len(dataSets) - 1; last < 0 || dataSets[last].Schema.TableName != schema.TableName {
+			dataSets = append(dataSets, Dataset{Schema: *schema})
+		}
+		dataSets[len(dataSets) - 1].Rows = append(dataSets[len(dataSets) - 1].Rows, row)
+	}
+	// read a row ahead, so that the caller does not need another RPC to find out that nothing is left
+	if cursor.peekedRow == nil {
+		var err error
+		if cursor.peekedRow, cursor.peekedSchema, err = cursor.nextRow(); err != nil {
+			return nil, false, err
+		}
+	}
+	return dataSets, cursor.peekedRow == nil, nil
+}
+
+// nextRow returns the next row left in the cursor and the schema of its fragment, or nil if there is no row left
+func (cursor *scanCursor) nextRow() (Row, *TableSchema, error) {
+	if cursor.peekedRow != nil {
+		row := cursor.peekedRow
+		cursor.peekedRow = nil
+		return row, cursor.peekedSchema, nil
+	}
+	for len(cursor.fragments) > 0 {
+		fragment := &cursor.fragments[0]
+		curRow, err := fragment.rows.next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if curRow == nil {
+			cursor.fragments = cursor.fragments[1:]
+			continue
+		}
+
+		if cursor.rowIds != nil && !cursor.rowIds[curRow[len(curRow) - 1].(int)] {
+			continue
+		}
+		if fragment.keyColumnId >= 0 {
+			key, ok := getIndexKey(fragment.tableSchema.ColumnSchemas[fragment.keyColumnId].DataType,
+				curRow[fragment.keyColumnId])
+			if !ok || !fragment.keys[fmt.Sprintf("%v", key)] {
+				continue
+			}
+		}
+		ok, err := checkPredicates(fragment.tableSchema, &curRow, fragment.predicates)
+		if err != nil || !ok {
+			continue
+		}
+		row := make(Row, len(fragment.columnIds))
+		for i, id := range fragment.columnIds {
+			row[i] = curRow[id]
+		}
+		return row, &fragment.schema, nil
+	}
+	return nil, nil, nil
+}
+
+// getIterator returns an iterator of the rows of a fragment in the table t that may be returned by the cursor, which
+// are looked up by the row ids, the keys or the predicates if the fragment is indexed on their columns
+func (cursor *scanCursor) getIterator(t *Table, fragment *scanFragment) RowIterator {
+	if cursor.request.RowIds != nil {
+		if rows, ok := t.lookupIndex(rowIdColumn, "==", toValues(cursor.request.RowIds)); ok {
+			return NewRowSliceIterator(rows)
+		}
+	}
+	if fragment.keyColumnId >= 0 {
+		if rows, ok := t.lookupIndex(fragment.keyColumnId, "==", fragment.keyValues); ok {
+			return NewRowSliceIterator(rows)
+		}
+	}
+	return t.predicateIterator(fragment.predicates)
+}
+
+// scanNode scans the fragments of a table on a node by a cursor, fetching at most scanBatchSize rows by each RPC, and
+// hands the rows of each fragment in a batch to handle as the batch arrives, so that the batches are not kept, see
+// ScanRequest. It returns an error if the scan fails, which may happen after some batches have been handled.
+func (c *Cluster) scanNode(nodeId string, request ScanRequest, handle func(Dataset)) error {
+	batch := ScanBatch{}
+	args := []interface{}{request, c.scanBatchSize, c.client.newRequestId()}
+	if err := c.call(nodeId, "Node.OpenScanRPC", args, &batch); err != nil {
+		return err
+	}
+	cursorId := batch.CursorId
+
+	for sequence := 0; ; {
+		if batch.Error != "" {
+			return errors.New(batch.Error)
+		}
+		for _, dataSet := range batch.DataSets {
+			handle(dataSet)
+		}
+		if batch.Done {
+			return nil
+		}
+
+		batch = ScanBatch{}
+		sequence++
+		args = []interface{}{cursorId, c.scanBatchSize, sequence}
+		if err := c.call(nodeId, "Node.FetchScanRPC", args, &batch); err != nil {
+			reply := ""
+			c.call(nodeId, "Node.CloseScanRPC", cursorId, &reply)
+			return err
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// rows of score are held by node4 only
+func setupCursor(t *testing.T) {
+	setupScript(t, `
+		CREATE TABLE score (sid INT32, points INT32) PARTITION BY (NODE 4);
+		INSERT INTO score VALUES (0, 90), (1, 85), (2, 70), (3, 95), (4, 60)`)
+}
+
+func TestScanBatches(t *testing.T) {
+	setupCursor(t)
+	c.scanBatchSize = 2
+
+	// the first batch is returned by opening the cursor, and the last one is returned by the third RPC
+	countBefore := network.GetCount("Node4")
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"score", []string{"points"},
+		[]Predicate{{ColumnName: "sid", Operator: ">=", Value: 0}}}, &results)
+	if countAfter := network.GetCount("Node4"); countAfter != countBefore + 3 {
+		t.Errorf("5 rows should be fetched by 3 RPCs, RPC counts before %d, after %d", countBefore, countAfter)
+	}
+	expected := []Row{{90}, {85}, {70}, {95}, {60}}
+	matched := len(results.Rows) == len(expected)
+	for i := 0; matched && i < len(expected); i++ {
+		matched = results.Rows[i].Equals(&expected[i])
+	}
+	if !matched {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expected, results.Rows)
+	}
+
+	// the batches are handed to the caller one by one as they arrive
+	var sizes []int
+	schema, _ := c.getSchema("score")
+	err := c.scanNode("Node4", ScanRequest{Schema: schema}, func(dataSet Dataset) {
+		sizes = append(sizes, len(dataSet.Rows))
+	})
+	if err != nil || len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 2 || sizes[2] != 1 {
+		t.Errorf("5 rows should be handled in batches of 2, 2 and 1 rows, actual %v %v", err, sizes)
+	}
+
+	// a scan fitting in a batch takes a single RPC
+	countBefore = network.GetCount("Node4")
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"score", []string{},
+		[]Predicate{{ColumnName: "points", Operator: ">", Value: 88}}}, &results)
+	if countAfter := network.GetCount("Node4"); countAfter != countBefore + 1 {
+		t.Errorf("2 rows should be fetched by 1 RPC, RPC counts before %d, after %d", countBefore, countAfter)
+	}
+	if len(results.Rows) != 2 {
+		t.Errorf("Incorrect select results, expected 2 rows, actual %v", results.Rows)
+	}
+}
+
+func TestJoinInBatches(t *testing.T) {
+	setupSQL(t)
+
+	expected := Dataset{}
+	cli.Call("Cluster.Join", []string{"student", "courseRegistration"}, &expected)
+	if len(expected.Rows) != 4 {
+		t.Fatalf("Incorrect join results, expected 4 rows, actual %v", expected.Rows)
+	}
+	c.scanBatchSize = 1
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{"student", "courseRegistration"}, &results)
+	if !datasetDuplicateChecking(expected, results) {
+		t.Errorf("Joining in batches should not change the results, expected %v, actual %v", expected, results)
+	}
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", `SELECT name, courseId FROM student JOIN courseRegistration
+		ON student.sid = courseRegistration.sid ORDER BY name, courseId`, &result)
+	expectedRows := []Row{{"Hana", 2}, {"John", 0}, {"John", 1}, {"Smith", 0}}
+	matched := result.Error == "" && len(result.Dataset.Rows) == len(expectedRows)
+	for i := 0; matched && i < len(expectedRows); i++ {
+		matched = result.Dataset.Rows[i].Equals(&expectedRows[i])
+	}
+	if !matched {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedRows, result)
+	}
+}
+
+func TestScanCursor(t *testing.T) {
+	setupCursor(t)
+	schema := c.tableSchemaMap["score"]
+	end := c.getEnd("Node4")
+	open := func() ScanBatch {
+		batch := ScanBatch{}
+		end.Call("Node.OpenScanRPC", []interface{}{ScanRequest{Schema: schema}, 2}, &batch)
+		if batch.Done || len(batch.DataSets) != 1 || len(batch.DataSets[0].Rows) != 2 {
+			t.Fatalf("The first batch should hold 2 rows, actual %v", batch)
+		}
+		return batch
+	}
+
+	// a closed cursor cannot be fetched
+	batch := open()
+	reply := ""
+	end.Call("Node.CloseScanRPC", batch.CursorId, &reply)
+	if reply != "Close scan success" {
+		t.Errorf("Incorrect reply of closing a cursor: %s", reply)
+	}
+	fetched := ScanBatch{}
+	end.Call("Node.FetchScanRPC", []interface{}{batch.CursorId, 2}, &fetched)
+	if fetched.Error == "" {
+		t.Errorf("Fetching a closed cursor should fail, actual %v", fetched)
+	}
+
+	// a retried open replies the cursor opened before, and a retried fetch replies the same batch again
+	args := []interface{}{ScanRequest{Schema: schema}, 2, c.client.newRequestId()}
+	batch, retried := ScanBatch{}, ScanBatch{}
+	end.Call("Node.OpenScanRPC", args, &batch)
+	end.Call("Node.OpenScanRPC", args, &retried)
+	if batch.CursorId == 0 || retried.CursorId != batch.CursorId {
+		t.Errorf("A retried open should reply cursor %d, actual %v", batch.CursorId, retried)
+	}
+	for sequence, rows := range []int{2, 1} {
+		var batches [2]ScanBatch
+		for i := range batches {
+			end.Call("Node.FetchScanRPC", []interface{}{batch.CursorId, 2, sequence + 1}, &batches[i])
+			if batches[i].Error != "" || batches[i].Done != (sequence == 1) || len(batches[i].DataSets) != 1 ||
+				len(batches[i].DataSets[0].Rows) != rows {
+				t.Fatalf("Batch %d should hold %d rows, actual %v", sequence + 1, rows, batches[i])
+			}
+		}
+		if !batches[1].DataSets[0].Rows[0].Equals(&batches[0].DataSets[0].Rows[0]) {
+			t.Errorf("A retried fetch should reply the same rows, expected %v, actual %v", batches[0], batches[1])
+		}
+	}
+	fetched = ScanBatch{}
+	end.Call("Node.FetchScanRPC", []interface{}{batch.CursorId, 2, 5}, &fetched)
+	if fetched.Error == "" {
+		t.Errorf("Fetching a batch out of order should fail, actual %v", fetched)
+	}
+
+	// a cursor expires if it is not used for a while
+	timeout := scanCursorTimeout
+	scanCursorTimeout = 200 * time.Millisecond
+	defer func() {
+		scanCursorTimeout = timeout
+	}()
+	batch = open()
+	time.Sleep(20 * time.Millisecond)
+	fetched = ScanBatch{}
+	end.Call("Node.FetchScanRPC", []interface{}{batch.CursorId, 2}, &fetched)
+	if fetched.Error != "" || len(fetched.DataSets) != 1 || len(fetched.DataSets[0].Rows) != 2 {
+		t.Errorf("The second batch should hold 2 rows, actual %v", fetched)
+	}
+	time.Sleep(400 * time.Millisecond)
+	fetched = ScanBatch{}
+	end.Call("Node.FetchScanRPC", []interface{}{batch.CursorId, 2}, &fetched)
+	if fetched.Error != "no such cursor " + strconv.Itoa(batch.CursorId) {
+		t.Errorf("Fetching an expired cursor should fail, actual %v", fetched)
+	}
+}
+
+func TestScanCursorSnapshot(t *testing.T) {
+	setupCursor(t)
+	schema := c.tableSchemaMap["score"]
+	end := c.getEnd("Node4")
+
+	// the rows are read from the fragment as they are fetched, and are those seen by the snapshot of the scan even if
+	// they are written in between
+	request := ScanRequest{Schema: schema, Snapshot: c.getSnapshot(nil)}
+	batch := ScanBatch{}
+	end.Call("Node.OpenScanRPC", []interface{}{request, 1}, &batch)
+	checkQuery(t, `DELETE FROM score WHERE sid < 3; UPDATE score SET points = 0 WHERE sid = 4;
+		INSERT INTO score VALUES (5, 50)`, []Row{})
+	// rowId -> points
+	points := make(map[int]int)
+	for sequence := 1; ; sequence++ {
+		if batch.Error != "" {
+			t.Fatal(batch.Error)
+		}
+		for _, dataSet := range batch.DataSets {
+			for _, row := range dataSet.Rows {
+				points[row[2].(int)] = row[1].(int)
+			}
+		}
+		if batch.Done {
+			break
+		}
+		cursorId := batch.CursorId
+		batch = ScanBatch{}
+		end.Call("Node.FetchScanRPC", []interface{}{cursorId, 1, sequence}, &batch)
+	}
+	expected := map[int]int{0: 90, 1: 85, 2: 70, 3: 95, 4: 60}
+	if len(points) != len(expected) {
+		t.Errorf("The scan should see the rows of its snapshot, expected %v, actual %v", expected, points)
+	}
+	for rowId, value := range expected {
+		if points[rowId] != value {
+			t.Errorf("The scan should see the rows of its snapshot, expected %v, actual %v", expected, points)
+			break
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
-import "sort"
+import (
+	"errors"
+	"sort"
+)
 
 type Dataset struct {
 	Schema TableSchema
@@ -23,8 +26,8 @@ func (d *Dataset) getSubColumnDataSet(columnIds []int) Dataset {
 	}
 	return Dataset{
 		TableSchema{
-			d.Schema.TableName,
-			subColumns,
+			TableName: d.Schema.TableName,
+			ColumnSchemas: subColumns,
 		},
 		replyRows,
 	}
@@ -152,4 +155,248 @@ func (d *Dataset) getUnionDataSet(other *Dataset) Dataset {
 		resultSchema,
 		resultRows,
 	}
-}
\ No newline at end of file
+}
+// fragmentMerger assembles rows of the given schema from the vertically and horizontally split fragment datasets, each
+// row of which carries the hidden row id as its last column. The datasets are added one by one, e.g., the batches of a
+// scan as they arrive, so that only the merged rows are kept. Pieces are matched by the row id, and a piece added again
+// replaces the earlier one of the same row id.
+type fragmentMerger struct {
+	schema *TableSchema
+	// rowId -> the merged row, and which columns of it have been provided
+	rowsMap map[int]Row
+	filledMap map[int][]bool
+}
+
+// newFragmentMerger creates a fragmentMerger of rows of the given schema
+func newFragmentMerger(schema *TableSchema) *fragmentMerger {
+	return &fragmentMerger{schema: schema, rowsMap: make(map[int]Row), filledMap: make(map[int][]bool)}
+}
+
+// add merges the rows of a fragment dataset
+func (m *fragmentMerger) add(dataSet Dataset) {
+	loc := len(m.schema.ColumnSchemas)
+	columnIds := make([]int, len(dataSet.Schema.ColumnSchemas))
+	for i, column := range dataSet.Schema.ColumnSchemas {
+		columnIds[i] = -1
+		for j, target := range m.schema.ColumnSchemas {
+			if column == target {
+				columnIds[i] = j
+				break
+			}
+		}
+	}
+
+	for _, row := range dataSet.Rows {
+		rowId := row[len(row) - 1].(int)
+		if _, ok := m.rowsMap[rowId]; !ok {
+			m.rowsMap[rowId] = make(Row, loc + 1)
+			m.rowsMap[rowId][loc] = rowId
+			m.filledMap[rowId] = make([]bool, loc)
+		}
+		for i, columnId := range columnIds {
+			if columnId >= 0 {
+				m.rowsMap[rowId][columnId] = row[i]
+				m.filledMap[rowId][columnId] = true
+			}
+		}
+	}
+}
+
+// result returns the rows merged so far, where a row is kept only if every column of the schema is provided by some
+// fragment, and the rows are sorted by the row id with the hidden row id kept as the last column
+func (m *fragmentMerger) result() Dataset {
+	result := Dataset{Schema: *m.schema}
+	for rowId, row := range m.rowsMap {
+		complete := true
+		for _, filled := range m.filledMap[rowId] {
+			if !filled {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			result.Rows = append(result.Rows, row)
+		}
+	}
+	result.sortRows()
+	return result
+}
+
+// getProjectedDataSet keeps the given columns of a dataset whose rows carry the hidden row id, and drops the row id
+func (d *Dataset) getProjectedDataSet(columnNames []string) Dataset {
+	var columns []ColumnSchema
+	var columnIds []int
+	for _, columnName := range columnNames {
+		columnId := d.Schema.getColumnId(columnName)
+		columns = append(columns, d.Schema.ColumnSchemas[columnId])
+		columnIds = append(columnIds, columnId)
+	}
+
+	var rows []Row
+	for _, row := range d.Rows {
+		projectedRow := make(Row, len(columnIds))
+		for i, columnId := range columnIds {
+			projectedRow[i] = row[columnId]
+		}
+		rows = append(rows, projectedRow)
+	}
+	return Dataset{
+		TableSchema{
+			TableName: d.Schema.TableName,
+			ColumnSchemas: columns,
+		},
+		rows,
+	}
+}
+
+// getJoinedDataSet concatenates the rows of this dataset and the given rows of another table by the matched pairs
+// leftIds[i] and rightIds[i], which should be ordered by the left index. The rows of the other table may carry the
+// hidden row id, which is dropped. If keepLeft (keepRight) is set, the unmatched rows of this dataset (the other table)
+// are kept and padded with NULLs. Columns of the other table whose names conflict are renamed to "table.column".
+func (d *Dataset) getJoinedDataSet(otherSchema *TableSchema, otherRows []Row, leftIds []int, rightIds []int,
+	keepLeft bool, keepRight bool) Dataset {
+	columns := make([]ColumnSchema, len(d.Schema.ColumnSchemas))
+	copy(columns, d.Schema.ColumnSchemas)
+	for _, column := range otherSchema.ColumnSchemas {
+		if d.Schema.getColumnId(column.Name) >= 0 {
+			column.Name = otherSchema.TableName + "." + column.Name
+		}
+		columns = append(columns, column)
+	}
+	leftWidth := len(d.Schema.ColumnSchemas)
+	rightWidth := len(otherSchema.ColumnSchemas)
+
+	joinRows := func(left Row, right Row) Row {
+		row := make(Row, leftWidth + rightWidth)
+		if left != nil {
+			copy(row, left[:leftWidth])
+		}
+		if right != nil {
+			copy(row[leftWidth:], right[:rightWidth])
+		}
+		return row
+	}
+
+	var resultRows []Row
+	rightMatched := make([]bool, len(otherRows))
+	k := 0
+	for i, left := range d.Rows {
+		matched := false
+		for k < len(leftIds) && leftIds[k] == i {
+			resultRows = append(resultRows, joinRows(left, otherRows[rightIds[k]]))
+			rightMatched[rightIds[k]] = true
+			matched = true
+			k++
+		}
+		if !matched && keepLeft {
+			resultRows = append(resultRows, joinRows(left, nil))
+		}
+	}
+	if keepRight {
+		for i, right := range otherRows {
+			if !rightMatched[i] {
+				resultRows = append(resultRows, joinRows(nil, right))
+			}
+		}
+	}
+
+	return Dataset{
+		TableSchema{
+			TableName: d.Schema.TableName,
+			ColumnSchemas: columns,
+		},
+		resultRows,
+	}
+}
+
+// getCoalescedDataSet merges each column rightIds[i] into the column leftIds[i], whose NULLs are replaced by the values
+// of the former, and drops the columns in rightIds.
+func (d *Dataset) getCoalescedDataSet(leftIds []int, rightIds []int) Dataset {
+	dropped := make([]bool, len(d.Schema.ColumnSchemas))
+	for _, rightId := range rightIds {
+		dropped[rightId] = true
+	}
+	var columns []ColumnSchema
+	for i, column := range d.Schema.ColumnSchemas {
+		if !dropped[i] {
+			columns = append(columns, column)
+		}
+	}
+
+	var rows []Row
+	for _, row := range d.Rows {
+		var resultRow Row
+		for i := range leftIds {
+			if row[leftIds[i]] == nil {
+				row[leftIds[i]] = row[rightIds[i]]
+			}
+		}
+		for i, value := range row {
+			if !dropped[i] {
+				resultRow = append(resultRow, value)
+			}
+		}
+		rows = append(rows, resultRow)
+	}
+	return Dataset{
+		TableSchema{
+			TableName: d.Schema.TableName,
+			ColumnSchemas: columns,
+		},
+		rows,
+	}
+}
+
+// sortByOrders sorts the rows stably by the given columns in turn, where orders[i] sorts by the column columnIds[i].
+// Values are compared according to the data types of the columns.
+func (d *Dataset) sortByOrders(columnIds []int, orders []OrderBy) {
+	compare := getOrderComparator(&d.Schema, columnIds, orders)
+	sort.SliceStable(d.Rows, func(i, j int) bool {
+		return compare(d.Rows[i], d.Rows[j]) < 0
+	})
+}
+
+// compareColumnValues compares two values of a column of the given data type, values that cannot be converted to the
+// data type are compared by compareValues
+func compareColumnValues(dataType int, a interface{}, b interface{}) int {
+	p := Predicate{DataType: dataType, Value: b}
+	cmp, err := p.compareWith(a)
+	if err != nil || dataType == TypeBoolean {
+		return compareValues(a, b)
+	}
+	return cmp
+}
+
+// getFilteredDataSet keeps the rows satisfying all the predicates, whose columns are resolved by resolveColumn and whose
+// data types are taken from the schema of the dataset
+func (d *Dataset) getFilteredDataSet(predicates []Predicate) (Dataset, error) {
+	columnIds := make([]int, len(predicates))
+	typedPredicates := make([]Predicate, len(predicates))
+	for i, p := range predicates {
+		columnIds[i] = d.Schema.resolveColumn(p.ColumnName)
+		if columnIds[i] < 0 {
+			return Dataset{}, errors.New("unknown column " + p.ColumnName)
+		}
+		if !isValidOperator(p.Operator) {
+			return Dataset{}, errors.New("unknown operator " + p.Operator)
+		}
+		p.DataType = d.Schema.ColumnSchemas[columnIds[i]].DataType
+		typedPredicates[i] = p
+	}
+
+	result := Dataset{Schema: d.Schema}
+	for _, row := range d.Rows {
+		matched := true
+		for i, p := range typedPredicates {
+			ok, err := p.evaluate(row[columnIds[i]])
+			if err != nil || !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result.Rows = append(result.Rows, row)
+		}
+	}
+	return result, nil
+}
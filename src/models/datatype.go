@@ -8,4 +8,66 @@ const (
 	TypeDouble
 	TypeBoolean
 	TypeString
+	TypeDate
+	TypeTimestamp
+	TypeDecimal
+	TypeBytes
 )
+
+// dataTypeNames maps the names of data types in SQL statements to the data types
+var dataTypeNames = map[string]int{
+	"INT": TypeInt32,
+	"INT32": TypeInt32,
+	"INTEGER": TypeInt32,
+	"BIGINT": TypeInt64,
+	"INT64": TypeInt64,
+	"FLOAT": TypeFloat,
+	"DOUBLE": TypeDouble,
+	"BOOL": TypeBoolean,
+	"BOOLEAN": TypeBoolean,
+	"STRING": TypeString,
+	"VARCHAR": TypeString,
+	"TEXT": TypeString,
+	"DATE": TypeDate,
+	"TIMESTAMP": TypeTimestamp,
+	"DATETIME": TypeTimestamp,
+	"DECIMAL": TypeDecimal,
+	"NUMERIC": TypeDecimal,
+	"BYTES": TypeBytes,
+	"BLOB": TypeBytes,
+}
+
+// getDataTypeByName returns the data type of the given (upper case) name, or -1 if the name is unknown
+func getDataTypeByName(name string) int {
+	if dataType, ok := dataTypeNames[name]; ok {
+		return dataType
+	}
+	return -1
+}
+
+// getDataTypeName returns the canonical name of a data type, e.g., "INT32"
+func getDataTypeName(dataType int) string {
+	switch dataType {
+	case TypeInt32:
+		return "INT32"
+	case TypeInt64:
+		return "INT64"
+	case TypeFloat:
+		return "FLOAT"
+	case TypeDouble:
+		return "DOUBLE"
+	case TypeBoolean:
+		return "BOOLEAN"
+	case TypeString:
+		return "STRING"
+	case TypeDate:
+		return "DATE"
+	case TypeTimestamp:
+		return "TIMESTAMP"
+	case TypeDecimal:
+		return "DECIMAL"
+	case TypeBytes:
+		return "BYTES"
+	}
+	return "UNKNOWN"
+}
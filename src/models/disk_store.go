@@ -0,0 +1,315 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// the files of a DiskRowStore in its directory
+const (
+	dataFileName = "data"
+	compactFileName = "data.compact"
+	walFileName = "wal"
+)
+
+// walCheckpointRecords is the number of records logged by the write-ahead log of a DiskRowStore before they are
+// flushed into the data file and the log is cleared
+var walCheckpointRecords = 1024
+
+// DiskRowStore keeps rows in files of a directory, so that they survive a restart of their node. Each write is
+// appended to a write-ahead log and synced to the disk before it is applied, while the data file, which is
+// append-only, receives the writes through a buffer and is only synced by checkpoints, when the log is cleared. When
+// the store is opened, the writes in the data file are replayed, followed by the writes in the log that have not been
+// flushed, and a record torn by a crash at the end of a file is dropped. The data file is rewritten with only the rows
+// left once most of its records are obsolete. The rows are also kept in memory, so reads never touch the disk.
+//
+// Since RowStore does not return errors, the first error of the files is kept by the store, after which writes are
+// no longer persisted, see Err.
+type DiskRowStore struct {
+	dir string
+	rows *SliceRowStore
+	wal *os.File
+	walRecords int
+	data *os.File
+	dataWriter *bufio.Writer
+	// the number of records in the data file, which are replayed when the store is opened
+	dataRecords int
+	// the sequence number of the last write
+	seq int64
+	err error
+}
+
+// diskRecord is a write logged by a DiskRowStore, which inserts the row or removes the first row equal to it
+type diskRecord struct {
+	Seq int64
+	Remove bool
+	Row Row
+}
+
+// OpenDiskRowStore opens the store in the directory, which is created if it does not exist, and recovers its rows
+func OpenDiskRowStore(dir string) (*DiskRowStore, error) {
+	// the values of rows are encoded as interfaces, whose concrete types should be registered
+	gob.Register(Decimal{})
+	gob.Register([]byte{})
+	gob.Register(time.Time{})
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	// a data file being rewritten when the node crashed is incomplete, and the old data file is still intact
+	if err := os.Remove(filepath.Join(dir, compactFileName)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	s := &DiskRowStore{dir: dir, rows: NewSliceRowStore()}
+	var err error
+	if s.data, err = os.OpenFile(filepath.Join(dir, dataFileName), os.O_RDWR | os.O_CREATE, 0644); err != nil {
+		return nil, err
+	}
+	if s.wal, err = os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR | os.O_CREATE, 0644); err != nil {
+		s.data.Close()
+		return nil, err
+	}
+	if err = s.recover(); err != nil {
+		s.data.Close()
+		s.wal.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// recover replays the data file and the log, moves the writes only in the log into the data file and clears the log
+func (s *DiskRowStore) recover() error {
+	records, size, err := readRecords(s.data)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		s.apply(record)
+	}
+	s.dataRecords = len(records)
+	// drop the torn record, if any, and append the writes after it
+	if err = s.data.Truncate(size); err != nil {
+		return err
+	}
+	if _, err = s.data.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+	s.dataWriter = bufio.NewWriter(s.data)
+
+	records, _, err = readRecords(s.wal)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		// the writes flushed before the log was cleared are already in the data file
+		if record.Seq <= s.seq {
+			continue
+		}
+		s.apply(record)
+		if err = writeRecord(s.dataWriter, record); err != nil {
+			return err
+		}
+		s.dataRecords++
+	}
+	return s.checkpoint()
+}
+
+func (s *DiskRowStore) apply(record diskRecord) {
+	if record.Remove {
+		s.rows.remove(&record.Row)
+	} else {
+		s.rows.insert(&record.Row)
+	}
+	if record.Seq > s.seq {
+		s.seq = record.Seq
+	}
+}
+
+func (s *DiskRowStore) count() int {
+	return s.rows.count()
+}
+
+func (s *DiskRowStore) iterator() RowIterator {
+	return s.rows.iterator()
+}
+
+func (s *DiskRowStore) insert(row *Row) {
+	s.write(diskRecord{Row: *row})
+}
+
+func (s *DiskRowStore) remove(row *Row) {
+	s.write(diskRecord{Remove: true, Row: *row})
+}
+
+// write logs a write, applies it and flushes the log into the data file if the log is long enough
+func (s *DiskRowStore) write(record diskRecord) {
+	record.Seq = s.seq + 1
+	if s.err == nil {
+		s.err = writeRecord(s.wal, record)
+	}
+	if s.err == nil {
+		s.err = s.wal.Sync()
+	}
+	s.apply(record)
+	if s.err != nil {
+		return
+	}
+
+	s.walRecords++
+	if s.err = writeRecord(s.dataWriter, record); s.err != nil {
+		return
+	}
+	s.dataRecords++
+	if s.walRecords >= walCheckpointRecords {
+		s.err = s.checkpoint()
+	}
+}
+
+// checkpoint syncs the data file and clears the log, and rewrites the data file if most of its records are obsolete
+func (s *DiskRowStore) checkpoint() error {
+	if err := s.dataWriter.Flush(); err != nil {
+		return err
+	}
+	if err := s.data.Sync(); err != nil {
+		return err
+	}
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.walRecords = 0
+	if s.dataRecords > walCheckpointRecords && s.dataRecords > 2 * s.rows.count() {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact writes the rows left into a new data file, which replaces the old one atomically
+func (s *DiskRowStore) compact() error {
+	path := filepath.Join(s.dir, compactFileName)
+	file, err := os.OpenFile(path, os.O_RDWR | os.O_CREATE | os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for iterator := s.rows.iterator(); iterator.HasNext(); {
+		if err = writeRecord(writer, diskRecord{Seq: s.seq, Row: *iterator.Next()}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err = writer.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(path, filepath.Join(s.dir, dataFileName))
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.data.Close()
+	s.data = file
+	s.dataWriter = bufio.NewWriter(file)
+	s.dataRecords = s.rows.count()
+	return nil
+}
+
+// Err returns the first error of the files of the store, after which its writes are only applied in memory
+func (s *DiskRowStore) Err() error {
+	return s.err
+}
+
+// Close flushes the writes into the data file and closes the files of the store
+func (s *DiskRowStore) Close() error {
+	err := s.err
+	if err == nil {
+		err = s.checkpoint()
+	}
+	s.data.Close()
+	s.wal.Close()
+	if err == nil {
+		s.err = errors.New("the store is closed")
+	}
+	return err
+}
+
+// writeRecord writes a record framed by the length and the checksum of its encoding. Each record is encoded by its own
+// encoder, as a file may be appended by the encoders of many runs. The records of a transaction log are framed alike,
+// see transaction.go.
+func writeRecord(writer io.Writer, record interface{}) error {
+	buffer := bytes.Buffer{}
+	if err := gob.NewEncoder(&buffer).Encode(record); err != nil {
+		return err
+	}
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header, uint32(buffer.Len()))
+	binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(buffer.Bytes()))
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+	_, err := writer.Write(buffer.Bytes())
+	return err
+}
+
+// readRecords reads the records of a file from its beginning, and returns them with the size of the file they take,
+// where reading stops at the first incomplete or corrupted record. A record that is intact but cannot be decoded is an
+// error.
+func readRecords(file *os.File) ([]diskRecord, int64, error) {
+	payloads, size, err := readPayloads(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	records := make([]diskRecord, len(payloads))
+	for i, payload := range payloads {
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&records[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return records, size, nil
+}
+
+// readPayloads reads the encodings of the records written by writeRecord from the beginning of a file like readRecords
+func readPayloads(file *os.File) ([][]byte, int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	reader := bufio.NewReader(file)
+	var payloads [][]byte
+	var size int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return payloads, size, nil
+		}
+		// a corrupted length may exceed the file
+		length := int64(binary.LittleEndian.Uint32(header))
+		if size + int64(len(header)) + length > info.Size() {
+			return payloads, size, nil
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return payloads, size, nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			return payloads, size, nil
+		}
+		payloads = append(payloads, payload)
+		size += int64(len(header) + len(payload))
+	}
+}
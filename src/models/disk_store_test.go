@@ -0,0 +1,160 @@
+package models
+
+import (
+	"../labrpc"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func checkStoreRows(t *testing.T, store RowStore, expected []Row) {
+	actual := iterateStore(store)
+	matched := store.count() == len(expected) && len(actual) == len(expected)
+	for i := 0; matched && i < len(expected); i++ {
+		matched = actual[i].Equals(&expected[i])
+	}
+	if !matched {
+		t.Errorf("Incorrect rows, expected %v, actual %v", expected, actual)
+	}
+}
+
+func TestDiskRowStore(t *testing.T) {
+	checkpointRecords := walCheckpointRecords
+	walCheckpointRecords = 4
+	defer func() {
+		walCheckpointRecords = checkpointRecords
+	}()
+	dir := t.TempDir()
+	store, err := OpenDiskRowStore(dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the writes are logged, checkpointed and compacted, and each reopening recovers them as if the store crashed
+	var expected []Row
+	for i := 0; i < 30; i++ {
+		row := Row{i, "name", float32(i) / 2, time.Date(2021, 6, 1, 0, 0, i, 0, time.UTC), nil, NewDecimal(int64(i), 2), i}
+		store.insert(&row)
+		if i % 3 == 0 {
+			expected = append(expected, row)
+		} else {
+			store.remove(&row)
+		}
+		if i % 7 == 0 {
+			if store, err = OpenDiskRowStore(dir); err != nil {
+				t.Fatal(err.Error())
+			}
+			checkStoreRows(t, store, expected)
+		}
+	}
+	if store, err = OpenDiskRowStore(dir); err != nil {
+		t.Fatal(err.Error())
+	}
+	checkStoreRows(t, store, expected)
+
+	// a record torn by a crash is dropped
+	store.insert(&Row{100})
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_WRONLY | os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	wal.Write([]byte{200, 0, 0, 0, 1, 2, 3})
+	wal.Close()
+	if store, err = OpenDiskRowStore(dir); err != nil {
+		t.Fatal(err.Error())
+	}
+	checkStoreRows(t, store, append(expected, Row{100}))
+	store.insert(&Row{101})
+	if err = store.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if store, err = OpenDiskRowStore(dir); err != nil {
+		t.Fatal(err.Error())
+	}
+	checkStoreRows(t, store, append(expected, Row{100}, Row{101}))
+	store.Close()
+}
+
+func TestRestartNode(t *testing.T) {
+	dataDir := t.TempDir()
+	network = labrpc.MakeNetwork()
+	var err error
+	if c, err = NewDiskCluster(4, network, "MyCluster", dataDir); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Shutdown()
+	cli = network.MakeEnd("ClientA")
+	network.Connect("ClientA", c.Name)
+	network.Enable("ClientA", true)
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", `
+		CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING, age INT32, grade FLOAT)
+		PARTITION BY (NODES 0|1 COLUMNS (sid, name) WHERE grade <= 3.6, NODE 2 COLUMNS (sid, age, grade) WHERE grade <= 3.6,
+			NODE 2 WHERE grade > 3.6);
+		CREATE INDEX studentGrade ON student (grade);
+		INSERT INTO student VALUES (0, 'John', 22, 4.0), (1, 'Smith', 23, 3.6), (2, 'Hana', 21, 4.0), (3, 'Lily', 22, 3.0);
+		DELETE FROM student WHERE sid = 3;
+		UPDATE student SET age = 24 WHERE sid = 1`, &result)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	script := "SELECT sid, name, age, grade FROM student WHERE grade > 3.0 ORDER BY sid"
+	expected := []Row{{0, "John", 22, 4.0}, {1, "Smith", 24, 3.6}, {2, "Hana", 21, 4.0}}
+	check := func() {
+		result := QueryResult{}
+		cli.Call("Cluster.ExecuteSQL", script, &result)
+		matched := result.Error == "" && len(result.Dataset.Rows) == len(expected)
+		for i := 0; matched && i < len(expected); i++ {
+			matched = result.Dataset.Rows[i].Equals(&expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect results, expected %v, actual %v", expected, result)
+		}
+	}
+	check()
+
+	// kill the node, which cannot be reached until it is restarted from the disk
+	network.DeleteServer("Node2")
+	cli.Call("Cluster.ExecuteSQL", script, &result)
+	if result.Error == "" && len(result.Dataset.Rows) == len(expected) {
+		t.Errorf("Node2 should not be reachable after it is killed")
+	}
+	if err = c.RestartNode("Node2"); err != nil {
+		t.Fatal(err.Error())
+	}
+	check()
+
+	// the restored node keeps its partition metadata and indexes
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", `INSERT INTO student VALUES (4, 'Ann', 23, 3.9);
+		DELETE FROM student WHERE sid = 0`, &result)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	expected = []Row{{1, "Smith", 24, 3.6}, {2, "Hana", 21, 4.0}, {4, "Ann", 23, 3.9}}
+	for _, nodeId := range []string{"Node0", "Node1", "Node2"} {
+		network.DeleteServer(nodeId)
+		if err = c.RestartNode(nodeId); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	check()
+	node, err := NewPersistentNode("Node2", filepath.Join(dataDir, "Node2"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(node.TableMap) != 2 || len(node.predicates["student-1"]) != 1 || len(node.columnIdsMap["student-0"]) != 3 ||
+		node.TableMap["student-1"].indexes[3] == nil || node.TableMap["student-0"].indexes[rowIdColumn] == nil {
+		t.Errorf("Incorrect metadata of the restored node, tables %v, predicates %v", node.TableMap, node.predicates)
+	}
+
+	if err = c.RestartNode("Node9"); err == nil {
+		t.Errorf("An unknown node should not be restarted")
+	}
+	setupLab3(t)
+	if err = c.RestartNode("Node0"); err == nil {
+		t.Errorf("A node in memory should not be restarted")
+	}
+}
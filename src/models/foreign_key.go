@@ -0,0 +1,332 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// actions on the referencing rows when a referenced row is deleted
+const (
+	// the referenced row cannot be deleted
+	ForeignKeyRestrict = "RESTRICT"
+	// the referencing rows are deleted as well
+	ForeignKeyCascade = "CASCADE"
+)
+
+// ForeignKey requires the values of Columns in each row, unless any of them is NULL, to match the values of RefColumns
+// in some row of RefTable, where RefColumns should be the primary key (the default if empty) or a unique key of
+// RefTable.
+type ForeignKey struct {
+	Columns []string
+	RefTable string
+	RefColumns []string
+	// ForeignKeyRestrict (the default if empty) or ForeignKeyCascade
+	OnDelete string
+}
+
+// checkForeignKeys checks that the foreign keys of a schema refer to the keys of existing tables, and fills in the
+// default referenced columns and actions
+func (c *Cluster) checkForeignKeys(schema *TableSchema) error {
+	for i := range schema.ForeignKeys {
+		fk := &schema.ForeignKeys[i]
+		refSchema, ok := c.getSchema(fk.RefTable)
+		if fk.RefTable == schema.TableName {
+			refSchema, ok = *schema, true
+		}
+		if !ok {
+			return errors.New("unknown referenced table " + fk.RefTable)
+		}
+		if len(fk.RefColumns) == 0 {
+			fk.RefColumns = refSchema.PrimaryKey
+		}
+		if len(fk.Columns) == 0 || len(fk.Columns) != len(fk.RefColumns) {
+			return errors.New("foreign key (" + strings.Join(fk.Columns, ", ") + ") does not match the key of " +
+				fk.RefTable)
+		}
+		for _, columnName := range fk.Columns {
+			if schema.getColumnId(columnName) < 0 {
+				return errors.New("unknown foreign key column " + columnName)
+			}
+		}
+		if !refSchema.isKey(fk.RefColumns) {
+			return errors.New("(" + strings.Join(fk.RefColumns, ", ") + ") is not a key of " + fk.RefTable)
+		}
+		fk.OnDelete = strings.ToUpper(fk.OnDelete)
+		if fk.OnDelete == "" {
+			fk.OnDelete = ForeignKeyRestrict
+		}
+		if fk.OnDelete != ForeignKeyRestrict && fk.OnDelete != ForeignKeyCascade {
+			return errors.New("unknown action ON DELETE " + fk.OnDelete)
+		}
+	}
+	return nil
+}
+
+// isKey checks whether the given columns, in any order, are the primary key or a unique key of the table
+func (ts *TableSchema) isKey(columnNames []string) bool {
+	for _, key := range append([][]string{ts.PrimaryKey}, ts.UniqueKeys...) {
+		if len(key) != len(columnNames) {
+			continue
+		}
+		matched := true
+		for _, columnName := range columnNames {
+			found := false
+			for _, keyColumn := range key {
+				if keyColumn == columnName {
+					found = true
+					break
+				}
+			}
+			if !found {
+				matched = false
+				break
+			}
+		}
+		if matched && len(key) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isAnyForeignKeyColumn checks whether any of the given columns belongs to a foreign key
+func (ts *TableSchema) isAnyForeignKeyColumn(columnIds []int) bool {
+	for _, fk := range ts.ForeignKeys {
+		for _, columnName := range fk.Columns {
+			for _, columnId := range columnIds {
+				if ts.ColumnSchemas[columnId].Name == columnName {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkReferences checks that each of the given rows, which are about to be written to a table, refers to existing
+// rows by the foreign keys of the table. The referenced rows are looked up on the nodes holding the referenced table,
+// where the latest rows are read like checkKeyConstraints.
+func (c *Cluster) checkReferences(schema *TableSchema, rows []Row) error {
+	for _, fk := range schema.ForeignKeys {
+		refSchema, _ := c.getSchema(fk.RefTable)
+		columnIds := make([]int, len(fk.Columns))
+		refIds := make([]int, len(fk.RefColumns))
+		for i := range fk.Columns {
+			columnIds[i] = schema.getColumnId(fk.Columns[i])
+			refIds[i] = refSchema.getColumnId(fk.RefColumns[i])
+		}
+		refKeySchema := refSchema.getSubSchema(refIds)
+		for _, row := range rows {
+			values := make(Row, len(columnIds))
+			hasNull := false
+			for i, columnId := range columnIds {
+				if columnId >= len(row) || row[columnId] == nil {
+					hasNull = true
+					break
+				}
+				values[i] = row[columnId]
+			}
+			if hasNull {
+				continue
+			}
+			predicates, formatted, _ := getKeyPredicates(&refKeySchema, values, keysOf(len(refIds)))
+			dataSet, err := c.scanTable(&refKeySchema, predicates, c.getLatestSnapshot())
+			if err != nil {
+				return err
+			}
+			if len(dataSet.Rows) == 0 {
+				return errors.New("foreign key (" + strings.Join(fk.Columns, ", ") + ") = (" +
+					strings.Join(formatted, ", ") + ") refers to no row of " + fk.RefTable)
+			}
+		}
+	}
+	return nil
+}
+
+// reference is a foreign key of a child table referring to a parent table
+type reference struct {
+	childSchema TableSchema
+	fk ForeignKey
+}
+
+// getReferences returns the foreign keys referring to the given table, ordered by the names of the child tables
+func (c *Cluster) getReferences(tableName string) []reference {
+	var tableNames []string
+	c.mu.RLock()
+	for name := range c.tableSchemaMap {
+		tableNames = append(tableNames, name)
+	}
+	c.mu.RUnlock()
+	sort.Strings(tableNames)
+	var references []reference
+	for _, name := range tableNames {
+		schema, _ := c.getSchema(name)
+		for _, fk := range schema.ForeignKeys {
+			if fk.RefTable == tableName {
+				references = append(references, reference{schema, fk})
+			}
+		}
+	}
+	return references
+}
+
+// getReferencingRowIds returns the row ids of the rows in the child table whose foreign key matches the referenced
+// columns of the given parent row
+func (c *Cluster) getReferencingRowIds(ref *reference, parentSchema *TableSchema, parentRow Row) ([]int, error) {
+	columnIds := make([]int, len(ref.fk.Columns))
+	values := make(Row, len(ref.fk.Columns))
+	for i := range ref.fk.Columns {
+		columnIds[i] = ref.childSchema.getColumnId(ref.fk.Columns[i])
+		values[i] = parentRow[parentSchema.getColumnId(ref.fk.RefColumns[i])]
+		if values[i] == nil {
+			return nil, nil
+		}
+	}
+	keySchema := ref.childSchema.getSubSchema(columnIds)
+	predicates, _, _ := getKeyPredicates(&keySchema, values, keysOf(len(columnIds)))
+	dataSet, err := c.scanTable(&keySchema, predicates, c.getLatestSnapshot())
+	if err != nil {
+		return nil, err
+	}
+	return getRowIds(&dataSet), nil
+}
+
+// planDeletion collects the rows to be deleted together with the given rows of a table, i.e., the rows referring to
+// them by foreign keys with ForeignKeyCascade, recursively. It fails if any of the collected rows is referred to by a
+// foreign key with ForeignKeyRestrict from a row that is not to be deleted. The result maps table names to the sorted
+// row ids to be deleted.
+func (c *Cluster) planDeletion(tableName string, rowIds []int) (map[string][]int, error) {
+	planned := map[string]map[int]bool{tableName: {}}
+	for _, rowId := range rowIds {
+		planned[tableName][rowId] = true
+	}
+	type restriction struct {
+		childTable string
+		rowIds []int
+		message string
+	}
+	var restrictions []restriction
+
+	type pending struct {
+		tableName string
+		rowIds []int
+	}
+	queue := []pending{{tableName, rowIds}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		references := c.getReferences(current.tableName)
+		if len(references) == 0 || len(current.rowIds) == 0 {
+			continue
+		}
+		parentSchema, _ := c.getSchema(current.tableName)
+		sortedIds := append([]int{}, current.rowIds...)
+		sort.Ints(sortedIds)
+		parentDataSet, err := c.ScanTableWithRowIds(&parentSchema, sortedIds, c.getLatestSnapshot())
+		if err != nil {
+			return nil, err
+		}
+		for _, parentRow := range parentDataSet.Rows {
+			if parentRow == nil {
+				continue
+			}
+			for i := range references {
+				ref := &references[i]
+				childIds, err := c.getReferencingRowIds(ref, &parentSchema, parentRow)
+				if err != nil {
+					return nil, err
+				}
+				if len(childIds) == 0 {
+					continue
+				}
+				childTable := ref.childSchema.TableName
+				if ref.fk.OnDelete == ForeignKeyRestrict {
+					restrictions = append(restrictions, restriction{childTable, childIds,
+						getReferredMessage(ref, &parentSchema, parentRow)})
+					continue
+				}
+				if planned[childTable] == nil {
+					planned[childTable] = make(map[int]bool)
+				}
+				var newIds []int
+				for _, childId := range childIds {
+					if !planned[childTable][childId] {
+						planned[childTable][childId] = true
+						newIds = append(newIds, childId)
+					}
+				}
+				queue = append(queue, pending{childTable, newIds})
+			}
+		}
+	}
+
+	// a restricting row may be deleted by another cascade, so the restrictions are checked at last
+	for _, r := range restrictions {
+		for _, childId := range r.rowIds {
+			if !planned[r.childTable][childId] {
+				return nil, errors.New(r.message)
+			}
+		}
+	}
+
+	plan := make(map[string][]int)
+	for name, ids := range planned {
+		for rowId := range ids {
+			plan[name] = append(plan[name], rowId)
+		}
+		sort.Ints(plan[name])
+	}
+	return plan, nil
+}
+
+// checkReferencedKeys checks that no row refers to the old values of the referenced columns of the updated rows by a
+// foreign key, if the values are changed. oldRows carry the hidden row ids, while newRows do not.
+func (c *Cluster) checkReferencedKeys(schema *TableSchema, oldRows []Row, newRows []Row) error {
+	references := c.getReferences(schema.TableName)
+	for i := range references {
+		ref := &references[i]
+		for j, oldRow := range oldRows {
+			changed := false
+			for _, columnName := range ref.fk.RefColumns {
+				columnId := schema.getColumnId(columnName)
+				if compareColumnValues(schema.ColumnSchemas[columnId].DataType, oldRow[columnId], newRows[j][columnId]) != 0 {
+					changed = true
+					break
+				}
+			}
+			if !changed {
+				continue
+			}
+			childIds, err := c.getReferencingRowIds(ref, schema, oldRow)
+			if err != nil {
+				return err
+			}
+			if len(childIds) > 0 {
+				return errors.New(getReferredMessage(ref, schema, oldRow))
+			}
+		}
+	}
+	return nil
+}
+
+// getReferredMessage tells that a row of the parent table is referred to by the child table of the reference, e.g.,
+// "(sid) = (0) of student is referred to by courseRegistration"
+func getReferredMessage(ref *reference, parentSchema *TableSchema, parentRow Row) string {
+	var values []string
+	for _, columnName := range ref.fk.RefColumns {
+		values = append(values, fmt.Sprintf("%v", parentRow[parentSchema.getColumnId(columnName)]))
+	}
+	return "(" + strings.Join(ref.fk.RefColumns, ", ") + ") = (" + strings.Join(values, ", ") + ") of " +
+		parentSchema.TableName + " is referred to by " + ref.childSchema.TableName
+}
+
+// keysOf returns the column ids 0, 1, ..., n - 1
+func keysOf(n int) []int {
+	keys := make([]int, n)
+	for i := range keys {
+		keys[i] = i
+	}
+	return keys
+}
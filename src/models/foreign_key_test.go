@@ -0,0 +1,108 @@
+package models
+
+import (
+	"testing"
+)
+
+// student is split over node0 and node1, while course, courseRegistration and thesis are held by node2, node3 and
+// node4 respectively
+func setupForeignKey(t *testing.T) {
+	setupScript(t, `
+		CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING) PARTITION BY (NODE 0 WHERE sid < 2, NODE 1 WHERE sid >= 2);
+		CREATE TABLE course (cid INT32 PRIMARY KEY, title STRING) PARTITION BY (NODE 2);
+		CREATE TABLE courseRegistration (sid INT32 REFERENCES student ON DELETE CASCADE, courseId INT32,
+			FOREIGN KEY (courseId) REFERENCES course (cid)) PARTITION BY (NODE 3);
+		CREATE TABLE thesis (sid INT32 REFERENCES student (sid) ON DELETE RESTRICT, title STRING) PARTITION BY (NODE 4);
+		INSERT INTO student VALUES (0, 'John'), (1, 'Smith'), (2, 'Hana');
+		INSERT INTO course VALUES (0, 'Database'), (1, 'Network'), (2, 'Compiler');
+		INSERT INTO courseRegistration VALUES (0, 0), (0, 1), (1, 0), (2, 1);
+		INSERT INTO thesis VALUES (1, 'Distributed Joins');`)
+}
+
+func TestForeignKeyOnInsert(t *testing.T) {
+	setupForeignKey(t)
+
+	replyMsg := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{"courseRegistration", Row{3, 0}}, &replyMsg)
+	if replyMsg != "Fragment write error: foreign key (sid) = (3) refers to no row of student!" {
+		t.Errorf("A row referring to no student should be rejected, reply: %s", replyMsg)
+	}
+	replyMsg = ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{"courseRegistration", Row{2, 5}}, &replyMsg)
+	if replyMsg != "Fragment write error: foreign key (courseId) = (5) refers to no row of course!" {
+		t.Errorf("A row referring to no course should be rejected, reply: %s", replyMsg)
+	}
+	// a NULL foreign key refers to nothing
+	for _, row := range []Row{{2, 2}, {nil, 2}} {
+		replyMsg = ""
+		cli.Call("Cluster.FragmentWrite", []interface{}{"courseRegistration", row}, &replyMsg)
+		if replyMsg != "Fragment write success" {
+			t.Errorf("Row %v should be accepted, reply: %s", row, replyMsg)
+		}
+	}
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "UPDATE courseRegistration SET sid = 4 WHERE courseId = 2", &result)
+	if result.Error == "" {
+		t.Errorf("Updating a foreign key to refer to no row should be rejected")
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "CREATE TABLE exam (cid INT32 REFERENCES teacher)", &result)
+	if result.Error != "Build table error: unknown referenced table teacher!" {
+		t.Errorf("A foreign key to an unknown table should be rejected, result: %v", result)
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "CREATE TABLE exam (title STRING REFERENCES course (title))", &result)
+	if result.Error != "Build table error: (title) is not a key of course!" {
+		t.Errorf("A foreign key to a non-key column should be rejected, result: %v", result)
+	}
+}
+
+func TestForeignKeyOnDelete(t *testing.T) {
+	setupForeignKey(t)
+
+	// Smith has a thesis
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "DELETE FROM student WHERE name = 'Smith'", &result)
+	if result.Error != "Delete error: (sid) = (1) of student is referred to by thesis!" {
+		t.Errorf("Deleting a row referred to by a restricting foreign key should be rejected, result: %v", result)
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "DELETE FROM course WHERE cid = 1", &result)
+	if result.Error != "Delete error: (cid) = (1) of course is referred to by courseRegistration!" {
+		t.Errorf("Deleting a row referred to by a restricting foreign key should be rejected, result: %v", result)
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "UPDATE student SET sid = 5 WHERE sid = 2", &result)
+	if result.Error == "" {
+		t.Errorf("Updating a referred key should be rejected")
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "SELECT * FROM student NATURAL JOIN courseRegistration", &result)
+	if len(result.Dataset.Rows) != 4 {
+		t.Errorf("No row should be deleted by rejected statements, actual %v", result)
+	}
+
+	// the registrations of John and Hana are deleted together
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "DELETE FROM student WHERE sid != 1", &result)
+	if result.Error != "" || result.Message != "Delete success, 2 rows affected" {
+		t.Fatalf("Incorrect delete result %v", result)
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "SELECT * FROM courseRegistration", &result)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{{Name: "sid", DataType: TypeInt32}, {Name: "courseId", DataType: TypeInt32}}},
+		Rows: []Row{{1, 0}},
+	}
+	if !datasetDuplicateChecking(expectedDataset, result.Dataset) {
+		t.Errorf("Incorrect rows after cascading delete, expected %v, actual %v", expectedDataset, result)
+	}
+
+	// courses not referred to any more can be deleted
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "DELETE FROM course WHERE cid > 0", &result)
+	if result.Error != "" || result.Message != "Delete success, 2 rows affected" {
+		t.Errorf("Incorrect delete result %v", result)
+	}
+}
@@ -0,0 +1,417 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// kinds of indexes
+const (
+	// a hash index only supports equality lookups
+	IndexHash = "HASH"
+	// an ordered index, which is a skip list, supports equality and range lookups
+	IndexOrdered = "BTREE"
+)
+
+// rowIdColumn is the column id by which a fragment is indexed on its hidden row id, i.e., the last value of each row
+const rowIdColumn = -1
+
+// IndexDefinition creates an index named Name on a column of a table, whose kind is one of the kinds of indexes above,
+// or IndexOrdered if empty. Each fragment holding the column indexes its rows by itself.
+type IndexDefinition struct {
+	Name string
+	Table string
+	ColumnName string
+	Kind string
+}
+
+// CreateIndex creates the index described by the definition on each fragment holding its column, which is maintained by
+// the nodes as rows are inserted and removed, and is used by the scans with predicates on the column and by the joins
+// probing the column. The names of the indexes of a table should be unique, and a column can only be indexed once.
+// The reply is "Create index success" or the error like "Create index error: no such table!".
+func (c *Cluster) CreateIndex(definition IndexDefinition, reply *string) {
+	c.syncCatalog()
+	if err := c.createIndex(&definition); err != nil {
+		*reply = "Create index error: " + err.Error() + "!"
+		return
+	}
+	*reply = "Create index success"
+}
+
+// createIndex is the implementation of CreateIndex
+func (c *Cluster) createIndex(definition *IndexDefinition) error {
+	schema, ok := c.getSchema(definition.Table)
+	if !ok {
+		return errors.New("no such table")
+	}
+	if schema.getColumnId(definition.ColumnName) < 0 {
+		return errors.New("unknown column " + definition.ColumnName)
+	}
+	definition.Kind = strings.ToUpper(definition.Kind)
+	if definition.Kind == "" {
+		definition.Kind = IndexOrdered
+	}
+	if definition.Kind != IndexHash && definition.Kind != IndexOrdered {
+		return errors.New("unknown kind of index " + definition.Kind)
+	}
+	c.mu.RLock()
+	indexes := c.indexMap[definition.Table]
+	c.mu.RUnlock()
+	for _, index := range indexes {
+		if index.Name == definition.Name {
+			return errors.New("index " + definition.Name + " already exists")
+		}
+		if index.ColumnName == definition.ColumnName {
+			return errors.New("column " + definition.ColumnName + " is already indexed by " + index.Name)
+		}
+	}
+
+	for _, nodeId := range c.getFragmentNodes(definition.Table, []string{definition.ColumnName}, nil) {
+		reply := ""
+		args := []interface{}{definition.Table, definition.ColumnName, definition.Kind, c.client.newRequestId()}
+		if err := c.call(nodeId, "Node.CreateIndexRPC", args, &reply); err != nil {
+			return err
+		}
+		if reply != "" {
+			return errors.New(reply)
+		}
+	}
+	if _, err := c.proposeCatalog(CatalogCommand{Kind: CatalogCreateIndex, Index: *definition}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indexMap[definition.Table] = append(c.indexMap[definition.Table], *definition)
+	return nil
+}
+
+// isIndexed checks whether a column of a table is indexed
+func (c *Cluster) isIndexed(tableName string, columnName string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, index := range c.indexMap[tableName] {
+		if index.ColumnName == columnName {
+			return true
+		}
+	}
+	return false
+}
+
+// getDistinctValues returns the distinct values of the column columnId of the rows except NULLs
+func getDistinctValues(rows []Row, columnId int) []interface{} {
+	var values []interface{}
+	isAdded := make(map[string]bool)
+	for _, row := range rows {
+		if row[columnId] == nil {
+			continue
+		}
+		if key := hashKey(row, []int{columnId}); !isAdded[key] {
+			isAdded[key] = true
+			values = append(values, row[columnId])
+		}
+	}
+	return values
+}
+
+// rowIndex indexes rows by the keys converted into the data type of the indexed column, NULLs are not indexed
+type rowIndex interface {
+	insert(key interface{}, row Row)
+	// only removes the first row under the key that equals to the argument
+	remove(key interface{}, row *Row)
+	// lookup returns the rows whose keys satisfy the comparison with the given key, and whether the operator is
+	// supported by the index
+	lookup(operator string, key interface{}) ([]Row, bool)
+}
+
+// columnIndex is an index of a column of a table
+type columnIndex struct {
+	kind string
+	dataType int
+	rowIndex
+}
+
+// CreateIndex creates an index of the given kind on the column columnId of the table, or on the hidden row id if
+// columnId is rowIdColumn, and indexes the existing rows. It returns an error if the column is already indexed.
+func (t *Table) CreateIndex(columnId int, kind string) error {
+	dataType := TypeInt64
+	if columnId != rowIdColumn {
+		if columnId < 0 || columnId >= len(t.schema.ColumnSchemas) {
+			return errors.New("no such column")
+		}
+		dataType = t.schema.ColumnSchemas[columnId].DataType
+	}
+	if _, ok := t.indexes[columnId]; ok {
+		return errors.New("column " + t.getIndexedColumnName(columnId) + " is already indexed")
+	}
+
+	index := &columnIndex{kind: strings.ToUpper(kind), dataType: dataType}
+	switch index.kind {
+	case IndexHash:
+		index.rowIndex = &hashIndex{rows: make(map[string][]Row)}
+	case IndexOrdered, "":
+		index.kind = IndexOrdered
+		index.rowIndex = newOrderedIndex(dataType)
+	default:
+		return errors.New("unknown kind of index " + kind)
+	}
+	iterator := t.RowIterator()
+	for iterator.HasNext() {
+		index.insertRow(columnId, iterator.Next())
+	}
+	if t.indexes == nil {
+		t.indexes = make(map[int]*columnIndex)
+	}
+	t.indexes[columnId] = index
+	return nil
+}
+
+func (t *Table) getIndexedColumnName(columnId int) string {
+	if columnId == rowIdColumn {
+		return "row id"
+	}
+	return t.schema.ColumnSchemas[columnId].Name
+}
+
+// insertRow indexes a row by its value of the column columnId
+func (index *columnIndex) insertRow(columnId int, row *Row) {
+	if key, ok := index.getKey(getIndexedValue(columnId, row)); ok {
+		index.insert(key, *row)
+	}
+}
+
+// removeRow removes a row from the index
+func (index *columnIndex) removeRow(columnId int, row *Row) {
+	if key, ok := index.getKey(getIndexedValue(columnId, row)); ok {
+		index.remove(key, row)
+	}
+}
+
+// getKey converts a value into the data type of the index, see getIndexKey
+func (index *columnIndex) getKey(value interface{}) (interface{}, bool) {
+	return getIndexKey(index.dataType, value)
+}
+
+// getIndexKey converts a value into the given data type. NULLs and the values of other types have no key, as converting
+// them, e.g., truncating 3.5 into 3, may change the results of comparisons.
+func getIndexKey(dataType int, value interface{}) (interface{}, bool) {
+	if value == nil || !isValueOfType(dataType, value) {
+		return nil, false
+	}
+	key, err := coerceValue(dataType, value)
+	return key, err == nil
+}
+
+func getIndexedValue(columnId int, row *Row) interface{} {
+	if columnId == rowIdColumn {
+		return (*row)[len(*row) - 1]
+	}
+	return (*row)[columnId]
+}
+
+// lookupIndex returns the rows whose values of the column columnId satisfy the comparison with any of the given values
+// by the index of the column, and whether the column is indexed by an index supporting the operator and the values.
+// The rows of a fragment, which is indexed on its hidden row id, are returned in the order they were written.
+func (t *Table) lookupIndex(columnId int, operator string, values []interface{}) ([]Row, bool) {
+	index, ok := t.indexes[columnId]
+	if !ok {
+		return nil, false
+	}
+	var rows []Row
+	isLookedUp := make(map[string]bool)
+	for _, value := range values {
+		key, ok := index.getKey(value)
+		if !ok {
+			return nil, false
+		}
+		if hash := fmt.Sprintf("%v", key); !isLookedUp[hash] {
+			isLookedUp[hash] = true
+			matched, ok := index.lookup(operator, key)
+			if !ok {
+				return nil, false
+			}
+			rows = append(rows, matched...)
+		}
+	}
+	if _, ok := t.indexes[rowIdColumn]; ok {
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i][len(rows[i]) - 1].(int) < rows[j][len(rows[j]) - 1].(int)
+		})
+	}
+	return rows, true
+}
+
+// predicateIterator returns an iterator of the rows that may satisfy all the predicates. If some predicates can be
+// evaluated by the indexes, only the rows looked up by the most selective one are iterated, otherwise all rows are.
+func (t *Table) predicateIterator(predicates []Predicate) RowIterator {
+	var candidates []Row
+	isIndexed := false
+	for _, p := range predicates {
+		columnId := t.schema.getColumnId(p.ColumnName)
+		if columnId < 0 {
+			continue
+		}
+		if rows, ok := t.lookupIndex(columnId, p.Operator, []interface{}{p.Value}); ok {
+			if !isIndexed || len(rows) < len(candidates) {
+				candidates = rows
+			}
+			isIndexed = true
+		}
+	}
+	if !isIndexed {
+		return t.RowIterator()
+	}
+	return NewRowSliceIterator(candidates)
+}
+
+// hashIndex indexes rows by the formatted keys
+type hashIndex struct {
+	rows map[string][]Row
+}
+
+func (index *hashIndex) insert(key interface{}, row Row) {
+	hash := fmt.Sprintf("%v", key)
+	index.rows[hash] = append(index.rows[hash], row)
+}
+
+func (index *hashIndex) remove(key interface{}, row *Row) {
+	hash := fmt.Sprintf("%v", key)
+	if rows := removeIndexedRow(index.rows[hash], row); len(rows) > 0 {
+		index.rows[hash] = rows
+	} else {
+		delete(index.rows, hash)
+	}
+}
+
+func (index *hashIndex) lookup(operator string, key interface{}) ([]Row, bool) {
+	if operator != "==" {
+		return nil, false
+	}
+	return index.rows[fmt.Sprintf("%v", key)], true
+}
+
+// the maximum level of the skip lists
+const maxIndexLevel = 16
+
+// orderedIndex is a skip list of the keys in the increasing order, each of which holds the rows under it
+type orderedIndex struct {
+	dataType int
+	// the sentinel before the first key on all levels
+	head *orderedIndexNode
+	level int
+	random *rand.Rand
+}
+
+type orderedIndexNode struct {
+	key interface{}
+	rows []Row
+	next []*orderedIndexNode
+}
+
+func newOrderedIndex(dataType int) *orderedIndex {
+	return &orderedIndex{
+		dataType: dataType,
+		head: &orderedIndexNode{next: make([]*orderedIndexNode, maxIndexLevel)},
+		level: 1,
+		random: rand.New(rand.NewSource(1)),
+	}
+}
+
+// seek returns the last node whose key is less than the given key on each level
+func (index *orderedIndex) seek(key interface{}) []*orderedIndexNode {
+	prev := make([]*orderedIndexNode, maxIndexLevel)
+	node := index.head
+	for level := index.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && compareColumnValues(index.dataType, node.next[level].key, key) < 0 {
+			node = node.next[level]
+		}
+		prev[level] = node
+	}
+	return prev
+}
+
+func (index *orderedIndex) insert(key interface{}, row Row) {
+	prev := index.seek(key)
+	if node := prev[0].next[0]; node != nil && compareColumnValues(index.dataType, node.key, key) == 0 {
+		node.rows = append(node.rows, row)
+		return
+	}
+
+	// each node is promoted to the next level with the probability 1/4
+	level := 1
+	for level < maxIndexLevel && index.random.Intn(4) == 0 {
+		level++
+	}
+	for ; index.level < level; index.level++ {
+		prev[index.level] = index.head
+	}
+	node := &orderedIndexNode{key: key, rows: []Row{row}, next: make([]*orderedIndexNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = prev[i].next[i]
+		prev[i].next[i] = node
+	}
+}
+
+func (index *orderedIndex) remove(key interface{}, row *Row) {
+	prev := index.seek(key)
+	node := prev[0].next[0]
+	if node == nil || compareColumnValues(index.dataType, node.key, key) != 0 {
+		return
+	}
+	if node.rows = removeIndexedRow(node.rows, row); len(node.rows) > 0 {
+		return
+	}
+	for i := range node.next {
+		prev[i].next[i] = node.next[i]
+	}
+}
+
+func (index *orderedIndex) lookup(operator string, key interface{}) ([]Row, bool) {
+	var rows []Row
+	switch operator {
+	case "==", ">", ">=":
+		node := index.seek(key)[0].next[0]
+		for ; node != nil; node = node.next[0] {
+			cmp := compareColumnValues(index.dataType, node.key, key)
+			if cmp == 0 && operator == ">" {
+				continue
+			}
+			if cmp > 0 && operator == "==" {
+				break
+			}
+			rows = append(rows, node.rows...)
+		}
+	case "<", "<=":
+		for node := index.head.next[0]; node != nil; node = node.next[0] {
+			cmp := compareColumnValues(index.dataType, node.key, key)
+			if cmp > 0 || cmp == 0 && operator == "<" {
+				break
+			}
+			rows = append(rows, node.rows...)
+		}
+	default:
+		return nil, false
+	}
+	return rows, true
+}
+
+// toValues converts integers, e.g., row ids, into values to be looked up
+func toValues(ints []int) []interface{} {
+	values := make([]interface{}, len(ints))
+	for i, v := range ints {
+		values[i] = v
+	}
+	return values
+}
+
+// removeIndexedRow removes the first row that equals to the argument from the rows
+func removeIndexedRow(rows []Row, row *Row) []Row {
+	for i := range rows {
+		if rows[i].Equals(row) {
+			return append(rows[:i:i], rows[i + 1:]...)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestTableIndex(t *testing.T) {
+	schema := TableSchema{TableName: "score-0", ColumnSchemas: []ColumnSchema{
+		{Name: "points", DataType: TypeInt32},
+		{Name: "name", DataType: TypeString},
+	}}
+	table := NewTable(&schema, NewMemoryListRowStore())
+	if err := table.CreateIndex(rowIdColumn, IndexHash); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the rows carry their row ids, and some of them are indexed when the indexes are created
+	random := rand.New(rand.NewSource(0))
+	var rows []Row
+	for i := 0; i < 200; i++ {
+		row := Row{random.Intn(50), string(rune('a' + random.Intn(5))), i}
+		if i % 17 == 0 {
+			row[0] = nil
+		}
+		rows = append(rows, row)
+		table.Insert(&row)
+		if i == 100 {
+			if err := table.CreateIndex(0, IndexOrdered); err != nil {
+				t.Fatal(err.Error())
+			}
+			if err := table.CreateIndex(1, IndexHash); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+	}
+	for i := 0; i < 200; i += 3 {
+		table.Remove(&rows[i])
+	}
+	if err := table.CreateIndex(0, IndexHash); err == nil {
+		t.Errorf("A column should not be indexed twice")
+	}
+	if err := table.CreateIndex(1, "BITMAP"); err == nil {
+		t.Errorf("Unknown kinds of indexes should be rejected")
+	}
+
+	for _, test := range []struct {
+		columnId int
+		operator string
+		value interface{}
+	}{
+		{0, "==", 10}, {0, "<", 10}, {0, "<=", int32(10)}, {0, ">", int64(45)}, {0, ">=", 0}, {0, "==", 100},
+		{1, "==", "c"}, {rowIdColumn, "==", 101},
+	} {
+		actual, ok := table.lookupIndex(test.columnId, test.operator, []interface{}{test.value})
+		if !ok {
+			t.Errorf("Column %d should be looked up by %s", test.columnId, test.operator)
+			continue
+		}
+		var expected []Row
+		for i, row := range rows {
+			p := Predicate{DataType: TypeInt32, Operator: test.operator, Value: test.value}
+			if test.columnId == 1 {
+				p.DataType = TypeString
+			}
+			value := getIndexedValue(test.columnId, &row)
+			if ok, _ := p.evaluate(value); ok && i % 3 != 0 {
+				expected = append(expected, row)
+			}
+		}
+		matched := len(actual) == len(expected)
+		for i := 0; matched && i < len(expected); i++ {
+			matched = actual[i].Equals(&expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect rows of column %d %s %v, expected %v, actual %v", test.columnId, test.operator,
+				test.value, expected, actual)
+		}
+	}
+
+	// hash indexes do not support ranges, and values of other types are not looked up
+	if _, ok := table.lookupIndex(1, "<", []interface{}{"c"}); ok {
+		t.Errorf("A hash index should not support ranges")
+	}
+	if _, ok := table.lookupIndex(0, "<", []interface{}{9.5}); ok {
+		t.Errorf("9.5 should not be looked up in an INT32 column")
+	}
+	iterator := table.predicateIterator([]Predicate{{ColumnName: "name", Operator: "!=", Value: "c"}})
+	if count := countRows(iterator); count != len(rows) - (len(rows) + 2) / 3 {
+		t.Errorf("All rows should be iterated if no predicate can be evaluated by the indexes, actual %d rows", count)
+	}
+}
+
+func countRows(iterator RowIterator) int {
+	count := 0
+	for iterator.HasNext() {
+		iterator.Next()
+		count++
+	}
+	return count
+}
+
+func TestCreateIndex(t *testing.T) {
+	setupAggregate(t)
+
+	selectRows := func() []Dataset {
+		var results []Dataset
+		for _, predicates := range [][]Predicate{
+			{{ColumnName: "grade", Operator: "<=", Value: 3.6}},
+			{{ColumnName: "grade", Operator: ">", Value: 3.0}, {ColumnName: "name", Operator: "==", Value: "John"}},
+			{{ColumnName: "name", Operator: "==", Value: "Ann"}},
+			{{ColumnName: "age", Operator: "==", Value: 22}},
+		} {
+			dataSet := Dataset{}
+			cli.Call("Cluster.Select", []interface{}{"student", []string{}, predicates}, &dataSet)
+			results = append(results, dataSet)
+		}
+		return results
+	}
+	expected := selectRows()
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", `CREATE INDEX studentGrade ON student (grade);
+		CREATE INDEX studentName ON student (name) USING HASH`, &result)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	for i, actual := range selectRows() {
+		if !datasetDuplicateChecking(expected[i], actual) {
+			t.Errorf("Indexes should not change the results, expected %v, actual %v", expected[i], actual)
+		}
+	}
+
+	// indexes are maintained as rows are written
+	cli.Call("Cluster.ExecuteSQL", `INSERT INTO student VALUES (5, 'Ann', 20, 3.2);
+		DELETE FROM student WHERE grade > 3.9; UPDATE student SET name = 'Lily' WHERE sid = 4;
+		SELECT sid FROM student WHERE name = 'Lily' ORDER BY sid`, &result)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	expectedRows := []Row{{3}, {4}}
+	matched := len(result.Dataset.Rows) == len(expectedRows)
+	for i := 0; matched && i < len(expectedRows); i++ {
+		matched = result.Dataset.Rows[i].Equals(&expectedRows[i])
+	}
+	if !matched {
+		t.Errorf("Incorrect results, expected %v, actual %v", expectedRows, result.Dataset.Rows)
+	}
+	cli.Call("Cluster.ExecuteSQL", "SELECT sid FROM student WHERE grade >= 3.2 AND grade < 4.0 ORDER BY sid", &result)
+	expectedRows = []Row{{1}, {5}}
+	matched = result.Error == "" && len(result.Dataset.Rows) == len(expectedRows)
+	for i := 0; matched && i < len(expectedRows); i++ {
+		matched = result.Dataset.Rows[i].Equals(&expectedRows[i])
+	}
+	if !matched {
+		t.Errorf("Incorrect results, expected %v, actual %v", expectedRows, result)
+	}
+
+	for _, test := range []struct {
+		definition IndexDefinition
+		message string
+	}{
+		{IndexDefinition{Name: "studentGrade", Table: "student", ColumnName: "age"}, "already exists"},
+		{IndexDefinition{Name: "studentGrade2", Table: "student", ColumnName: "grade"}, "already indexed"},
+		{IndexDefinition{Name: "studentTid", Table: "student", ColumnName: "tid"}, "unknown column"},
+		{IndexDefinition{Name: "studentAge", Table: "student", ColumnName: "age", Kind: "BITMAP"}, "unknown kind"},
+		{IndexDefinition{Name: "teacherAge", Table: "teacher", ColumnName: "age"}, "no such table"},
+	} {
+		reply := ""
+		cli.Call("Cluster.CreateIndex", test.definition, &reply)
+		if !strings.HasPrefix(reply, "Create index error: ") || !strings.Contains(reply, test.message) {
+			t.Errorf("Creating %v should fail for %s, actual %s", test.definition, test.message, reply)
+		}
+	}
+}
+
+func TestJoinProbe(t *testing.T) {
+	setupSQL(t)
+
+	script := `SELECT name, courseId FROM student JOIN courseRegistration ON student.sid = courseRegistration.sid
+		WHERE grade > 3.6 ORDER BY name, courseId`
+	expected := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", script, &expected)
+	if expected.Error != "" || len(expected.Dataset.Rows) != 3 {
+		t.Fatalf("Incorrect join results %v", expected)
+	}
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "CREATE INDEX registrationSid ON courseRegistration (sid) USING HASH", &result)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	cli.Call("Cluster.ExecuteSQL", script, &result)
+	if !datasetDuplicateChecking(expected.Dataset, result.Dataset) {
+		t.Errorf("Probing the index should not change the results, expected %v, actual %v", expected, result)
+	}
+
+	// only the rows matching the probed keys are scanned
+	schema := c.tableSchemaMap["courseRegistration"]
+	keySchema := schema.getSubSchema([]int{schema.getColumnId("sid")})
+	keyDataSet, err := c.scanFragments(&ScanRequest{Schema: keySchema, KeyColumn: "sid", KeyValues: []interface{}{0, 2, 7}})
+	if err != nil || len(keyDataSet.Rows) != 3 {
+		t.Errorf("3 rows should match sid 0, 2 and 7, actual %v", keyDataSet.Rows)
+	}
+}
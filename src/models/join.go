@@ -0,0 +1,302 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// names of the join algorithms that can be requested by clients
+const (
+	JoinAuto = ""
+	JoinNestedLoop = "nested-loop"
+	JoinHash = "hash"
+	JoinSortMerge = "sort-merge"
+)
+
+// types of the joins that can be requested by clients
+const (
+	JoinInner = "INNER"
+	JoinLeft = "LEFT"
+	JoinRight = "RIGHT"
+	JoinFull = "FULL"
+)
+
+// JoinRequest describes a join of several tables on explicitly named columns, Table is joined with the table of the
+// first clause, and the result is joined with the table of the next clause, and so on.
+type JoinRequest struct {
+	Table string
+	Clauses []JoinClause
+	// one of the join algorithms above, JoinAuto by default
+	Algorithm string
+}
+
+// JoinClause joins the result of the preceding tables with Table, a row of the preceding result matches a row of Table
+// if the values of LeftColumns (of the preceding result) equal the values of RightColumns (of Table) pairwise.
+type JoinClause struct {
+	Table string
+	// one of the join types above, JoinInner by default
+	Type string
+	// a natural join matches the columns with the same names and keeps one copy of them, the join columns are ignored
+	Natural bool
+	LeftColumns []string
+	RightColumns []string
+}
+
+// inputs whose sizes multiply to no more than this threshold are joined by nested loops, as building hash tables or
+// sorting does not pay off for them
+const nestedLoopJoinThreshold = 4096
+
+// JoinAlgorithm finds the matching rows of two row lists on their key columns. Two rows match if the values of their
+// key columns are pairwise equal, where leftKeys[i] of a left row is compared with rightKeys[i] of a right row.
+type JoinAlgorithm interface {
+	// join returns the indexes of the matching left rows and right rows, ordered by the left index and then by the right
+	// index, which is also the order produced by a nested loop over the left rows and the right rows.
+	join(left []Row, right []Row, leftKeys []int, rightKeys []int) ([]int, []int)
+}
+
+// getJoinAlgorithm returns the join algorithm of the given name, or chooses one by the sizes of the inputs if the name
+// is JoinAuto. It returns nil if the name is unknown.
+func getJoinAlgorithm(name string, leftSize int, rightSize int) JoinAlgorithm {
+	switch name {
+	case JoinNestedLoop:
+		return &NestedLoopJoin{}
+	case JoinHash:
+		return &HashJoin{}
+	case JoinSortMerge:
+		return &SortMergeJoin{}
+	case JoinAuto:
+		if leftSize * rightSize <= nestedLoopJoinThreshold {
+			return &NestedLoopJoin{}
+		}
+		// build a hash table on a much smaller side, or sort both sides if they are comparable in size
+		if leftSize * 8 < rightSize || rightSize * 8 < leftSize {
+			return &HashJoin{}
+		}
+		return &SortMergeJoin{}
+	}
+	return nil
+}
+
+// NestedLoopJoin compares every left row with every right row.
+type NestedLoopJoin struct{}
+
+func (j *NestedLoopJoin) join(left []Row, right []Row, leftKeys []int, rightKeys []int) ([]int, []int) {
+	var leftIds, rightIds []int
+	for i, rowA := range left {
+		for k, rowB := range right {
+			if isKeysEqual(rowA, rowB, leftKeys, rightKeys) {
+				leftIds = append(leftIds, i)
+				rightIds = append(rightIds, k)
+			}
+		}
+	}
+	return leftIds, rightIds
+}
+
+// HashJoin builds a hash table on the smaller input and probes it with the other one.
+type HashJoin struct{}
+
+func (j *HashJoin) join(left []Row, right []Row, leftKeys []int, rightKeys []int) ([]int, []int) {
+	buildRows, buildKeys, probeRows, probeKeys := right, rightKeys, left, leftKeys
+	swapped := len(left) < len(right)
+	if swapped {
+		buildRows, buildKeys, probeRows, probeKeys = left, leftKeys, right, rightKeys
+	}
+
+	buckets := make(map[string][]int)
+	for i, row := range buildRows {
+		key := hashKey(row, buildKeys)
+		buckets[key] = append(buckets[key], i)
+	}
+
+	var leftIds, rightIds []int
+	for i, row := range probeRows {
+		// keys are verified again as different values may be formatted to the same hash key
+		for _, k := range buckets[hashKey(row, probeKeys)] {
+			if !isKeysEqual(row, buildRows[k], probeKeys, buildKeys) {
+				continue
+			}
+			if swapped {
+				leftIds = append(leftIds, k)
+				rightIds = append(rightIds, i)
+			} else {
+				leftIds = append(leftIds, i)
+				rightIds = append(rightIds, k)
+			}
+		}
+	}
+	if swapped {
+		sortJoinResult(leftIds, rightIds)
+	}
+	return leftIds, rightIds
+}
+
+// SortMergeJoin sorts both inputs on their keys and merges the runs of equal keys.
+type SortMergeJoin struct{}
+
+func (j *SortMergeJoin) join(left []Row, right []Row, leftKeys []int, rightKeys []int) ([]int, []int) {
+	leftOrder := sortedRowIds(left, leftKeys)
+	rightOrder := sortedRowIds(right, rightKeys)
+
+	var leftIds, rightIds []int
+	a, b := 0, 0
+	for a < len(leftOrder) && b < len(rightOrder) {
+		cmp := compareKeys(left[leftOrder[a]], right[rightOrder[b]], leftKeys, rightKeys)
+		if cmp < 0 {
+			a++
+		} else if cmp > 0 {
+			b++
+		} else {
+			// find the runs of equal keys on both sides and output their cartesian product
+			aEnd := a + 1
+			for aEnd < len(leftOrder) && compareKeys(left[leftOrder[a]], left[leftOrder[aEnd]], leftKeys, leftKeys) == 0 {
+				aEnd++
+			}
+			bEnd := b + 1
+			for bEnd < len(rightOrder) &&
+				compareKeys(right[rightOrder[b]], right[rightOrder[bEnd]], rightKeys, rightKeys) == 0 {
+				bEnd++
+			}
+			for _, i := range leftOrder[a:aEnd] {
+				for _, k := range rightOrder[b:bEnd] {
+					if isKeysEqual(left[i], right[k], leftKeys, rightKeys) {
+						leftIds = append(leftIds, i)
+						rightIds = append(rightIds, k)
+					}
+				}
+			}
+			a, b = aEnd, bEnd
+		}
+	}
+	sortJoinResult(leftIds, rightIds)
+	return leftIds, rightIds
+}
+
+// sortedRowIds returns the indexes of the rows ordered by their keys
+func sortedRowIds(rows []Row, keys []int) []int {
+	ids := make([]int, len(rows))
+	for i := range ids {
+		ids[i] = i
+	}
+	sort.SliceStable(ids, func(a, b int) bool {
+		return compareKeys(rows[ids[a]], rows[ids[b]], keys, keys) < 0
+	})
+	return ids
+}
+
+// sortJoinResult sorts the matching pairs by the left index and then by the right index
+func sortJoinResult(leftIds []int, rightIds []int) {
+	sort.Sort(joinResult{leftIds, rightIds})
+}
+
+type joinResult struct {
+	leftIds []int
+	rightIds []int
+}
+
+func (r joinResult) Len() int {
+	return len(r.leftIds)
+}
+
+func (r joinResult) Less(i, j int) bool {
+	if r.leftIds[i] != r.leftIds[j] {
+		return r.leftIds[i] < r.leftIds[j]
+	}
+	return r.rightIds[i] < r.rightIds[j]
+}
+
+func (r joinResult) Swap(i, j int) {
+	r.leftIds[i], r.leftIds[j] = r.leftIds[j], r.leftIds[i]
+	r.rightIds[i], r.rightIds[j] = r.rightIds[j], r.rightIds[i]
+}
+
+// isKeysEqual checks whether the key columns of two rows are pairwise equal, where NULL (nil) equals nothing
+func isKeysEqual(rowA Row, rowB Row, keysA []int, keysB []int) bool {
+	for i := range keysA {
+		if rowA[keysA[i]] == nil || !valuesEqual(rowA[keysA[i]], rowB[keysB[i]]) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareKeys compares the key columns of two rows one by one with compareValues
+func compareKeys(rowA Row, rowB Row, keysA []int, keysB []int) int {
+	for i := range keysA {
+		if cmp := compareValues(rowA[keysA[i]], rowB[keysB[i]]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// hashKey formats the key columns of a row into a string, equal keys are always formatted to the same string
+func hashKey(row Row, keys []int) string {
+	key := ""
+	for _, columnId := range keys {
+		value := row[columnId]
+		// -0.0 equals 0.0 but is formatted differently
+		switch v := value.(type) {
+		case float32:
+			if v == 0 {
+				value = float32(0)
+			}
+		case float64:
+			if v == 0 {
+				value = float64(0)
+			}
+		}
+		key += fmt.Sprintf("%T:%v|", value, value)
+	}
+	return key
+}
+
+// compareValues orders any two values in a way that agrees with the equality of interfaces: values of different types
+// are ordered by their type names, and values of the same type by their natural order.
+func compareValues(a interface{}, b interface{}) int {
+	typeA, typeB := fmt.Sprintf("%T", a), fmt.Sprintf("%T", b)
+	if typeA != typeB {
+		return compareStrings(typeA, typeB)
+	}
+	switch va := a.(type) {
+	case int:
+		return compareOrdered(va < b.(int), va == b.(int))
+	case int32:
+		return compareOrdered(va < b.(int32), va == b.(int32))
+	case int64:
+		return compareOrdered(va < b.(int64), va == b.(int64))
+	case float32:
+		return compareFloats(float64(va), float64(b.(float32)))
+	case float64:
+		return compareFloats(va, b.(float64))
+	case bool:
+		return compareOrdered(!va && b.(bool), va == b.(bool))
+	case string:
+		return compareStrings(va, b.(string))
+	case time.Time:
+		return compareOrdered(va.Before(b.(time.Time)), va.Equal(b.(time.Time)))
+	case Decimal:
+		return va.Cmp(b.(Decimal))
+	case []byte:
+		return bytes.Compare(va, b.([]byte))
+	}
+	if valuesEqual(a, b) {
+		return 0
+	}
+	return compareStrings(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+func compareStrings(a string, b string) int {
+	return compareOrdered(a < b, a == b)
+}
+
+// compareFloats orders NaN before any other number so that the order is total
+func compareFloats(a float64, b float64) int {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return compareOrdered(math.IsNaN(a) && !math.IsNaN(b), math.IsNaN(a) && math.IsNaN(b))
+	}
+	return compareOrdered(a < b, a == b)
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestJoinAlgorithms(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	for caseNum := 0; caseNum < 20; caseNum++ {
+		left := make([]Row, r.Intn(200))
+		for i := range left {
+			left[i] = Row{r.Intn(20), r.Intn(3), i}
+		}
+		right := make([]Row, r.Intn(200))
+		for i := range right {
+			right[i] = Row{r.Intn(3), r.Intn(20), i}
+		}
+		leftKeys := []int{0, 1}
+		rightKeys := []int{1, 0}
+
+		expectedLeft, expectedRight := (&NestedLoopJoin{}).join(left, right, leftKeys, rightKeys)
+		for _, algorithm := range []JoinAlgorithm{&HashJoin{}, &SortMergeJoin{}} {
+			leftIds, rightIds := algorithm.join(left, right, leftKeys, rightKeys)
+			if !reflect.DeepEqual(expectedLeft, leftIds) || !reflect.DeepEqual(expectedRight, rightIds) {
+				t.Errorf("%T produces different results from the nested loop join, caseNum: %d", algorithm, caseNum)
+			}
+		}
+	}
+}
+
+func TestJoinAlgorithmsWithMixedTypes(t *testing.T) {
+	left := []Row{{1}, {int32(1)}, {"1"}, {1.0}, {0.0}}
+	right := []Row{{"1"}, {1}, {-0.0}, {int64(1)}}
+	keys := []int{0}
+
+	expectedLeft, expectedRight := (&NestedLoopJoin{}).join(left, right, keys, keys)
+	if len(expectedLeft) != 3 {
+		t.Errorf("Values of different types should not match, actual matches %v %v", expectedLeft, expectedRight)
+	}
+	for _, algorithm := range []JoinAlgorithm{&HashJoin{}, &SortMergeJoin{}} {
+		leftIds, rightIds := algorithm.join(left, right, keys, keys)
+		if !reflect.DeepEqual(expectedLeft, leftIds) || !reflect.DeepEqual(expectedRight, rightIds) {
+			t.Errorf("%T produces different results from the nested loop join", algorithm)
+		}
+	}
+}
+
+func TestClusterJoinWithAlgorithm(t *testing.T) {
+	setupSelect(t)
+
+	expectedDataset := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &expectedDataset)
+	for _, algorithm := range []string{JoinNestedLoop, JoinHash, JoinSortMerge} {
+		results := Dataset{}
+		cli.Call("Cluster.JoinWithAlgorithm",
+			[]interface{}{[]string{studentTableName, courseRegistrationTableName}, algorithm}, &results)
+		if !reflect.DeepEqual(expectedDataset, results) {
+			t.Errorf("Incorrect %s join results, expected %v, actual %v", algorithm, expectedDataset, results)
+		}
+	}
+}
+
+// adds a student without any course registration and a course registration of an unknown student
+func setupOuterJoin(t *testing.T) {
+	setupSelect(t)
+
+	replyMsg := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Lily", 20, 3.0}}, &replyMsg)
+	cli.Call("Cluster.FragmentWrite", []interface{}{courseRegistrationTableName, Row{10, 3}}, &replyMsg)
+}
+
+func TestJoinWithConditions(t *testing.T) {
+	setupOuterJoin(t)
+
+	// join on differently named columns, the conflicting sid of courseRegistration is renamed
+	request := JoinRequest{
+		Table: studentTableName,
+		Clauses: []JoinClause{{
+			Table: courseRegistrationTableName,
+			LeftColumns: []string{"age"},
+			RightColumns: []string{"courseId"},
+		}},
+	}
+	results := Dataset{}
+	cli.Call("Cluster.JoinWithConditions", request, &results)
+	if len(results.Rows) != 0 {
+		t.Errorf("Incorrect join results, expected no rows, actual %v", results)
+	}
+
+	request.Clauses[0].LeftColumns = []string{"sid"}
+	request.Clauses[0].RightColumns = []string{"sid"}
+	results = Dataset{}
+	cli.Call("Cluster.JoinWithConditions", request, &results)
+	expectedSchema := TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+		{Name: "sid", DataType: TypeInt32},
+		{Name: "name", DataType: TypeString},
+		{Name: "age", DataType: TypeInt32},
+		{Name: "grade", DataType: TypeFloat},
+		{Name: "courseRegistration.sid", DataType: TypeInt32},
+		{Name: "courseId", DataType: TypeInt32},
+	}}
+	expectedDataset := Dataset{
+		Schema: expectedSchema,
+		Rows: []Row{
+			{0, "John", 22, 4.0, 0, 0},
+			{0, "John", 22, 4.0, 0, 1},
+			{1, "Smith", 23, 3.6, 1, 0},
+			{2, "Hana", 21, 4.0, 2, 2},
+		},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+}
+
+func TestOuterJoins(t *testing.T) {
+	setupOuterJoin(t)
+
+	expectedSchema := TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+		{Name: "sid", DataType: TypeInt32},
+		{Name: "name", DataType: TypeString},
+		{Name: "age", DataType: TypeInt32},
+		{Name: "grade", DataType: TypeFloat},
+		{Name: "courseRegistration.sid", DataType: TypeInt32},
+		{Name: "courseId", DataType: TypeInt32},
+	}}
+	innerRows := []Row{
+		{0, "John", 22, 4.0, 0, 0},
+		{0, "John", 22, 4.0, 0, 1},
+		{1, "Smith", 23, 3.6, 1, 0},
+		{2, "Hana", 21, 4.0, 2, 2},
+	}
+	leftRow := Row{3, "Lily", 20, 3.0, nil, nil}
+	rightRow := Row{nil, nil, nil, nil, 10, 3}
+	cases := map[string][]Row{
+		JoinLeft: append(append([]Row{}, innerRows...), leftRow),
+		JoinRight: append(append([]Row{}, innerRows...), rightRow),
+		JoinFull: append(append([]Row{}, innerRows...), leftRow, rightRow),
+	}
+
+	for joinType, expectedRows := range cases {
+		for _, algorithm := range []string{JoinNestedLoop, JoinHash, JoinSortMerge} {
+			request := JoinRequest{
+				Table: studentTableName,
+				Clauses: []JoinClause{{
+					Table: courseRegistrationTableName,
+					Type: joinType,
+					LeftColumns: []string{"sid"},
+					RightColumns: []string{"sid"},
+				}},
+				Algorithm: algorithm,
+			}
+			results := Dataset{}
+			cli.Call("Cluster.JoinWithConditions", request, &results)
+			expectedDataset := Dataset{
+				Schema: expectedSchema,
+				Rows: expectedRows,
+			}
+			if !datasetDuplicateChecking(expectedDataset, results) {
+				t.Errorf("Incorrect %s %s join results, expected %v, actual %v",
+					joinType, algorithm, expectedDataset, results)
+			}
+		}
+	}
+}
@@ -12,6 +12,7 @@ func TestLab1Basic(t *testing.T) {
 	clusterName := "MyCluster"
 	network := labrpc.MakeNetwork()
 	c := NewCluster(6, network, clusterName)
+	defer c.Shutdown()
 
 	// create a client and connect to the cluster
 	clientName := "ClientA"
@@ -209,8 +210,8 @@ func TestLab1Basic(t *testing.T) {
 
 	expectedDataset0 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "address", DataType: TypeString},
 				{Name: "sale_price", DataType: TypeDouble},
@@ -229,8 +230,8 @@ func TestLab1Basic(t *testing.T) {
 
 	expectedDataset1 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "sale_terms", DataType: TypeString},
 				{Name: "verified_by", DataType: TypeString},
@@ -249,8 +250,8 @@ func TestLab1Basic(t *testing.T) {
 
 	expectedDataset2 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "address", DataType: TypeString},
 				{Name: "sale_price", DataType: TypeDouble},
@@ -266,8 +267,8 @@ func TestLab1Basic(t *testing.T) {
 
 	expectedDataset3 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "address", DataType: TypeString},
 				{Name: "sale_price", DataType: TypeDouble},
@@ -282,8 +283,8 @@ func TestLab1Basic(t *testing.T) {
 
 	expectedDataset4 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "address", DataType: TypeString},
 				{Name: "sale_price", DataType: TypeDouble},
@@ -315,8 +316,8 @@ func TestLab1Basic(t *testing.T) {
 
 	expectedDataset5 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "sale_terms", DataType: TypeString},
 				{Name: "verified_by", DataType: TypeString},
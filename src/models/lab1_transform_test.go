@@ -12,6 +12,7 @@ func TestLab1Transform(t *testing.T) {
 	clusterName := "MyCluster"
 	network := labrpc.MakeNetwork()
 	c := NewCluster(5, network, clusterName)
+	defer c.Shutdown()
 
 	// create a client and connect to the cluster
 	clientName := "ClientA"
@@ -171,8 +172,8 @@ func TestLab1Transform(t *testing.T) {
 
 	expectedDataset0 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "object_name", DataType: TypeString},
 				{Name: "sale_price", DataType: TypeDouble},
@@ -188,8 +189,8 @@ func TestLab1Transform(t *testing.T) {
 
 	expectedDataset1 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "object_name", DataType: TypeString},
 				{Name: "sale_price", DataType: TypeDouble},
@@ -204,8 +205,8 @@ func TestLab1Transform(t *testing.T) {
 
 	expectedDataset2 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "object_name", DataType: TypeString},
 				{Name: "sale_price", DataType: TypeDouble},
@@ -220,8 +221,8 @@ func TestLab1Transform(t *testing.T) {
 
 	expectedDataset3 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "object_name", DataType: TypeString},
 				{Name: "sale_price", DataType: TypeDouble},
@@ -235,8 +236,8 @@ func TestLab1Transform(t *testing.T) {
 
 	expectedDataset4 := Dataset{
 		Schema: TableSchema{
-			"",
-			[]ColumnSchema{
+			TableName: "",
+			ColumnSchemas: []ColumnSchema{
 				{Name: "object_id", DataType: TypeInt32},
 				{Name: "object_name", DataType: TypeString},
 				{Name: "sale_price", DataType: TypeDouble},
@@ -56,9 +56,9 @@ func stDefineTables() {
 	}
 
 	stJoinedTableSchema = TableSchema{
-		"",
-		[]ColumnSchema{
-			{"sid", TypeInt32},
+		TableName: "",
+		ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
 			{Name: "tid", DataType: TypeInt32},
 			{Name: "sname", DataType: TypeString},
 			{Name: "tname", DataType: TypeString},
@@ -73,11 +73,12 @@ func stDefineTables() {
 	}
 }
 
-func stSetupCli() {
+func stSetupCli(t *testing.T) {
 	// set up a network and a cluster
 	clusterName := "MyCluster"
 	network = labrpc.MakeNetwork()
 	c = NewCluster(3, network, clusterName)
+	t.Cleanup(c.Shutdown)
 
 	// create a client and connect to the cluster
 	clientName := "ClientA"
@@ -87,7 +88,7 @@ func stSetupCli() {
 }
 
 func TestLab2MultiForeignKeyTableJoin(t *testing.T) {
-	stSetupCli()
+	stSetupCli(t)
 	stDefineTables()
 
 	m := map[string]interface{}{
@@ -180,7 +181,7 @@ func TestLab2MultiForeignKeyTableJoin(t *testing.T) {
 }
 
 func TestLab3MultiForeignKeyTableJoin(t *testing.T) {
-	stSetupCli()
+	stSetupCli(t)
 	stDefineTables()
 
 	m := map[string]interface{}{
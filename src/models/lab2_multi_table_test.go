@@ -104,14 +104,14 @@ func MDefineTables() {
 	}
 
 	joinedTableSchemaA = TableSchema{
-		"",
-		[]ColumnSchema{
-			{"sid", TypeInt32},
-			{"sname", TypeString},
-			{"age", TypeInt32},
-			{"grade", TypeFloat},
-			{"courseId", TypeInt32},
-			{"cname", TypeString},
+		TableName: "",
+		ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "sname", DataType: TypeString},
+			{Name: "age", DataType: TypeInt32},
+			{Name: "grade", DataType: TypeFloat},
+			{Name: "courseId", DataType: TypeInt32},
+			{Name: "cname", DataType: TypeString},
 		},
 	}
 
@@ -134,16 +134,16 @@ func MDefineTables() {
 	}
 
 	joinedTableSchemaB = TableSchema{
-		"",
-		[]ColumnSchema{
-			{"sid", TypeInt32},
-			{"sname", TypeString},
-			{"age", TypeInt32},
-			{"grade", TypeFloat},
-			{"courseId", TypeInt32},
-			{"cname", TypeString},
-			{"tid", TypeInt32},
-			{"tname", TypeString},
+		TableName: "",
+		ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "sname", DataType: TypeString},
+			{Name: "age", DataType: TypeInt32},
+			{Name: "grade", DataType: TypeFloat},
+			{Name: "courseId", DataType: TypeInt32},
+			{Name: "cname", DataType: TypeString},
+			{Name: "tid", DataType: TypeInt32},
+			{Name: "tname", DataType: TypeString},
 		},
 	}
 
@@ -166,11 +166,12 @@ func MDefineTables() {
 	}
 }
 
-func setupCli() {
+func setupCli(t *testing.T) {
 	// set up a network and a cluster
 	clusterName := "MyCluster"
 	network = labrpc.MakeNetwork()
 	c = NewCluster(4, network, clusterName)
+	t.Cleanup(c.Shutdown)
 
 	// create a client and connect to the cluster
 	clientName := "ClientA"
@@ -180,7 +181,7 @@ func setupCli() {
 }
 
 func TestLab2MultiTableJoin(t *testing.T) {
-	setupCli()
+	setupCli(t)
 	MDefineTables()
 
 	// use the client to create table and insert
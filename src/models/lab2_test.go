@@ -52,13 +52,13 @@ func defineTables() {
 	}
 
 	joinedTableSchema = TableSchema{
-		"",
-		[]ColumnSchema{
-			{"sid", TypeInt32},
-			{"name", TypeString},
-			{"age", TypeInt32},
-			{"grade", TypeFloat},
-			{"courseId", TypeInt32},
+		TableName: "",
+		ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "name", DataType: TypeString},
+			{Name: "age", DataType: TypeInt32},
+			{Name: "grade", DataType: TypeFloat},
+			{Name: "courseId", DataType: TypeInt32},
 		},
 	}
 
@@ -70,11 +70,12 @@ func defineTables() {
 	}
 }
 
-func setup() {
+func setup(t *testing.T) {
 	// set up a network and a cluster
 	clusterName := "MyCluster"
 	network = labrpc.MakeNetwork()
 	c = NewCluster(3, network, clusterName)
+	t.Cleanup(c.Shutdown)
 
 	// create a client and connect to the cluster
 	clientName := "ClientA"
@@ -87,7 +88,7 @@ func setup() {
 
 // student table is held by two nodes and courseRegistration table is held by the last node
 func TestLab2NonOverlapping(t *testing.T) {
-	setup()
+	setup(t)
 
 	// use the client to create table and insert
 	// divide student table into two partitions and assign them to node0 and node1
@@ -153,7 +154,7 @@ func TestLab2NonOverlapping(t *testing.T) {
 
 // student table is held by node0 and node1 and courseRegistration is held by node1
 func TestLab2FullyOverlapping(t *testing.T) {
-	setup()
+	setup(t)
 
 	// use the client to create table and insert
 	// divide student table into two partitions and assign them to node0 and node1
@@ -219,7 +220,7 @@ func TestLab2FullyOverlapping(t *testing.T) {
 
 // two tables are distributed to node0
 func TestLab2FullyCentralized(t *testing.T) {
-	setup()
+	setup(t)
 
 	// use the client to create table and insert
 	// divide student table into two partitions and assign them to node0 and node1
@@ -273,7 +274,7 @@ func TestLab2FullyCentralized(t *testing.T) {
 
 // student table is distributed to node0 and node1, courseRegistration table is distributed to node1 and node2
 func TestLab2PartiallyOverlapping(t *testing.T) {
-	setup()
+	setup(t)
 
 	// use the client to create table and insert
 	// divide student table into two partitions and assign them to node0 and node1
@@ -351,7 +352,7 @@ func TestLab2PartiallyOverlapping(t *testing.T) {
 
 // courseRegistration table is empty in this test
 func TestLab2EmptyTable(t *testing.T) {
-	setup()
+	setup(t)
 
 	courseRegistrationRows = []Row {}
 	joinedTableContent = []Row {}
@@ -432,7 +433,7 @@ func TestLab2EmptyTable(t *testing.T) {
 
 // there is no matching tuple in this test
 func TestLab2NoMatching(t *testing.T) {
-	setup()
+	setup(t)
 
 	courseRegistrationRows = []Row{
 		{10, 0},
@@ -6,7 +6,7 @@ import (
 )
 
 func TestLab3MergeSchema(t *testing.T) {
-	setupLab3()
+	setupLab3(t)
 
 	m := map[string]interface{}{
 		"0|1": map[string]interface{}{
@@ -92,7 +92,7 @@ func TestLab3MergeSchema(t *testing.T) {
 }
 
 func TestLab3MultiRow(t *testing.T) {
-	setupLab3()
+	setupLab3(t)
 
 	m := map[string]interface{}{
 		"0|1": map[string]interface{}{
@@ -32,13 +32,13 @@ func defineTablesLab3() {
 	}
 
 	joinedTableSchema = TableSchema{
-		"",
-		[]ColumnSchema{
-			{"sid", TypeInt32},
-			{"name", TypeString},
-			{"age", TypeInt32},
-			{"grade", TypeFloat},
-			{"courseId", TypeInt32},
+		TableName: "",
+		ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "name", DataType: TypeString},
+			{Name: "age", DataType: TypeInt32},
+			{Name: "grade", DataType: TypeFloat},
+			{Name: "courseId", DataType: TypeInt32},
 		},
 	}
 
@@ -51,11 +51,12 @@ func defineTablesLab3() {
 }
 
 
-func setupLab3() {
+func setupLab3(t *testing.T) {
 	// set up a network and a cluster
 	clusterName := "MyCluster"
 	network = labrpc.MakeNetwork()
 	c = NewCluster(5, network, clusterName)
+	t.Cleanup(c.Shutdown)
 
 	// create a client and connect to the cluster
 	clientName := "ClientA"
@@ -68,7 +69,7 @@ func setupLab3() {
 
 // student table is held by three nodes and courseRegistration table is held by the last node
 func TestLab3NonOverlapping(t *testing.T) {
-	setupLab3()
+	setupLab3(t)
 
 	// use the client to create table and insert
 	// divide student table into two partitions and assign them to node0 and node1
@@ -134,7 +135,7 @@ func TestLab3NonOverlapping(t *testing.T) {
 
 // student table is held by node 0, 1, 2 and courseRegistration is held by node 0, 1, 2
 func TestLab3FullyOverlapping(t *testing.T) {
-	setupLab3()
+	setupLab3(t)
 
 	// use the client to create table and insert
 	// divide student table into two partitions and assign their replica to node0 and node1
@@ -200,7 +201,7 @@ func TestLab3FullyOverlapping(t *testing.T) {
 
 // two tables are distributed to node0
 func TestLab3FullyCentralized(t *testing.T) {
-	setupLab3()
+	setupLab3(t)
 
 	// use the client to create table and insert
 	// divide student table into two partitions and assign them to node0 and node1
@@ -255,7 +256,7 @@ func TestLab3FullyCentralized(t *testing.T) {
 
 // student table is distributed to node0 and node1, courseRegistration table is distributed to node1 and node2
 func TestLab3PartiallyOverlapping(t *testing.T) {
-	setupLab3()
+	setupLab3(t)
 
 	// use the client to create table and insert
 	// divide student table into two partitions and assign them to node0, node1, node 2 and node 3
@@ -333,7 +334,7 @@ func TestLab3PartiallyOverlapping(t *testing.T) {
 
 // courseRegistration table is empty in this test
 func TestLab3EmptyTable(t *testing.T) {
-	setupLab3()
+	setupLab3(t)
 
 	courseRegistrationRows = []Row {}
 	joinedTableContent = []Row {}
@@ -414,7 +415,7 @@ func TestLab3EmptyTable(t *testing.T) {
 
 // there is no matching tuple in this test
 func TestLab3NoMatching(t *testing.T) {
-	setupLab3()
+	setupLab3(t)
 
 	courseRegistrationRows = []Row{
 		{10, 0},
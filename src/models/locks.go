@@ -0,0 +1,480 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A transaction begun by BEGIN ISOLATION LEVEL SERIALIZABLE is isolated by strict two-phase locking instead of its
+// snapshot, see mvcc.go. Each node manages the locks of the fragments and the rows it holds:
+//   - before a statement of the transaction reads a table, the coordinator locks the fragments of the table shared on
+//     their primaries, see lockStatement;
+//   - before a row is inserted or removed on a node, the coordinator locks the row exclusively on the node, together
+//     with an intention lock on the fragments of the table there, which conflicts with the shared locks of the readers.
+//     A write skipping a stale primary still locks the row there, see lockPrimary;
+//   - the locks are held until the transaction commits or rolls back, and are released by the node once it finishes
+//     the transaction, see Node.FinishTransactionRPC, or by ReleaseLocksRPC on the nodes that the transaction only
+//     read.
+// Once the locks of a statement are held, the transaction reads the latest rows, i.e., its snapshot moves forward to
+// the last command of the catalog. A lock that cannot be granted is retried by the coordinator every lockRetryInterval,
+// while the node queues the waiting transaction after the earlier waiters, and records which transactions it waits
+// for. The coordinator aggregates these edges of all nodes into a wait-for graph, and if the waiting transaction is in
+// a cycle, i.e., a deadlock, the youngest transaction of the cycle is the victim, which fails with an error and is
+// rolled back by its coordinator. Every coordinator picks
+// the same victim, so only the victim gives up. A lock that is not granted within lockTimeout fails as well, e.g., when
+// it is held by a transaction whose coordinator has failed.
+// The locks only order the serializable transactions among themselves, while the other transactions and the statements
+// outside transactions are isolated by their snapshots, and they are only kept in memory, so a restarted node loses
+// them. Besides, every write locks the values of the keys it writes for a moment, so that it checks and writes them
+// before any other write of the same values, see lockKeys.
+
+// lockRetryInterval is how long the coordinator waits before it retries a lock that is not granted
+var lockRetryInterval = 10 * time.Millisecond
+
+// lockTimeout is how long the coordinator waits for a lock before the statement fails
+var lockTimeout = 10 * time.Second
+
+// lock modes, where the intention modes are only held on fragments by the transactions locking their rows
+const (
+	LockIntentShared = iota
+	LockIntentExclusive
+	LockShared
+	LockExclusive
+)
+
+// lockCompatible tells whether a lock in the first mode may be held together with a lock in the second mode by
+// another transaction
+var lockCompatible = [4][4]bool{
+	LockIntentShared: {LockIntentShared: true, LockIntentExclusive: true, LockShared: true},
+	LockIntentExclusive: {LockIntentShared: true, LockIntentExclusive: true},
+	LockShared: {LockIntentShared: true, LockShared: true},
+	LockExclusive: {},
+}
+
+// LockRequest locks the rows of a table on a node in Mode within a transaction, together with the intention lock of
+// the mode on each fragment of the table on the node, or the fragments themselves if RowIds is nil, see Node.LockRPC.
+// The values of the keys of the table are locked instead if Keys is set, see lockKeys.
+type LockRequest struct {
+	Transaction int
+	TableName string
+	RowIds []int
+	Keys []string
+	// LockShared or LockExclusive
+	Mode int
+}
+
+// LockReply is the reply of Node.LockRPC
+type LockReply struct {
+	Granted bool
+	// the transactions holding the conflicting locks if the lock is not granted
+	Holders []int
+	Error string
+}
+
+// lockKey is a lock managed by a node, i.e., a fragment of a table on the node if RowId is -1, or a row of a table, or
+// the value of a key of a table if Key is set
+type lockKey struct {
+	TableName string
+	RowId int
+	Key string
+}
+
+// lockState is a lock held or waited for by some transactions
+type lockState struct {
+	// transactionId -> the modes the transaction holds, one bit for each mode
+	holders map[int]int
+	// the transactions waiting for the lock in the order they first ask for it
+	waiters []lockWaiter
+}
+
+// lockWaiter is a transaction waiting for a lock in a mode
+type lockWaiter struct {
+	transaction int
+	mode int
+}
+
+// conflictsWith returns the transactions other than the given one that hold the lock in a mode incompatible with mode,
+// or wait for it in such a mode before the given one, so that a waiting writer is not starved by the later readers. A
+// transaction holding the lock already does not wait for the waiters, as they may wait for it.
+func (l *lockState) conflictsWith(transactionId int, mode int) []int {
+	var conflicts []int
+	for holder, modes := range l.holders {
+		if holder == transactionId {
+			continue
+		}
+		for held := LockIntentShared; held <= LockExclusive; held++ {
+			if modes & (1 << uint(held)) != 0 && !lockCompatible[mode][held] {
+				conflicts = append(conflicts, holder)
+				break
+			}
+		}
+	}
+	if l.holders[transactionId] != 0 {
+		return conflicts
+	}
+	for _, waiter := range l.waiters {
+		if waiter.transaction == transactionId {
+			break
+		}
+		if !lockCompatible[mode][waiter.mode] {
+			conflicts = append(conflicts, waiter.transaction)
+		}
+	}
+	return conflicts
+}
+
+// isWaiting checks whether a transaction waits for the lock
+func (l *lockState) isWaiting(transactionId int) bool {
+	for _, waiter := range l.waiters {
+		if waiter.transaction == transactionId {
+			return true
+		}
+	}
+	return false
+}
+
+// removeWaiter removes a transaction from the waiters of the lock
+func (l *lockState) removeWaiter(transactionId int) {
+	for i, waiter := range l.waiters {
+		if waiter.transaction == transactionId {
+			l.waiters = append(l.waiters[:i], l.waiters[i + 1:]...)
+			return
+		}
+	}
+}
+
+// getLockKeys returns the locks asked for by a request with their modes. The caller should hold mu.
+func (n *Node) getLockKeys(request *LockRequest) (map[lockKey]int, error) {
+	if request.Mode != LockShared && request.Mode != LockExclusive {
+		return nil, errors.New("invalid lock mode " + strconv.Itoa(request.Mode))
+	}
+	keys := make(map[lockKey]int)
+	if request.Keys != nil {
+		for _, key := range request.Keys {
+			keys[lockKey{TableName: request.TableName, RowId: -1, Key: key}] = request.Mode
+		}
+		return keys, nil
+	}
+	fragmentMode := request.Mode
+	if request.RowIds != nil {
+		fragmentMode = request.Mode - LockShared + LockIntentShared
+	}
+	for tableCount := 0; ; tableCount++ {
+		pTableName := request.TableName + "-" + strconv.Itoa(tableCount)
+		if _, ok := n.TableMap[pTableName]; !ok {
+			break
+		}
+		keys[lockKey{TableName: pTableName, RowId: -1}] = fragmentMode
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no fragment of " + request.TableName + " on " + n.Identifier)
+	}
+	for _, rowId := range request.RowIds {
+		keys[lockKey{TableName: request.TableName, RowId: rowId}] = request.Mode
+	}
+	return keys, nil
+}
+
+// LockRPC is an RPC interface that grants the locks of a LockRequest to its transaction if none of them conflicts with
+// the locks held by the other transactions or waited for by the earlier ones. The conflicting transactions are replied
+// otherwise, and the transaction is queued as a waiter of the locks, which waits for them until it asks again, see
+// LockWaitsRPC. A transaction may lock what it holds already in another mode.
+func (n *Node) LockRPC(args LockRequest, reply *LockReply) {
+	n.mu.RLock()
+	keys, err := n.getLockKeys(&args)
+	n.mu.RUnlock()
+	if err != nil {
+		reply.Error = err.Error()
+		return
+	}
+	n.lockMu.Lock()
+	defer n.lockMu.Unlock()
+	holders := make(map[int]bool)
+	for key, mode := range keys {
+		if state, ok := n.locks[key]; ok {
+			for _, holder := range state.conflictsWith(args.Transaction, mode) {
+				holders[holder] = true
+			}
+		}
+	}
+	granted := len(holders) == 0
+	for key, mode := range keys {
+		state, ok := n.locks[key]
+		if !ok {
+			state = &lockState{holders: make(map[int]int)}
+			n.locks[key] = state
+		}
+		if state.holders[args.Transaction] == 0 && !state.isWaiting(args.Transaction) {
+			n.lockKeys[args.Transaction] = append(n.lockKeys[args.Transaction], key)
+		}
+		if granted {
+			state.removeWaiter(args.Transaction)
+			state.holders[args.Transaction] |= 1 << uint(mode)
+		} else if !state.isWaiting(args.Transaction) {
+			state.waiters = append(state.waiters, lockWaiter{transaction: args.Transaction, mode: mode})
+		}
+	}
+	if granted {
+		delete(n.lockWaits, args.Transaction)
+		reply.Granted = true
+		return
+	}
+	n.lockWaits[args.Transaction] = nil
+	for holder := range holders {
+		n.lockWaits[args.Transaction] = append(n.lockWaits[args.Transaction], holder)
+	}
+	sort.Ints(n.lockWaits[args.Transaction])
+	reply.Holders = n.lockWaits[args.Transaction]
+}
+
+// LockWaitsRPC is an RPC interface that replies the transactions waiting for locks on the node, each with the
+// transactions holding the locks it waits for, which are the edges of the wait-for graph on the node
+func (n *Node) LockWaitsRPC(args interface{}, reply *map[int][]int) {
+	n.lockMu.Lock()
+	defer n.lockMu.Unlock()
+	*reply = make(map[int][]int)
+	for transactionId, holders := range n.lockWaits {
+		(*reply)[transactionId] = holders
+	}
+}
+
+// ReleaseLocksRPC is an RPC interface that releases the locks held by the transaction whose id is args (int)
+func (n *Node) ReleaseLocksRPC(args int, reply *string) {
+	n.releaseLocks(args)
+}
+
+// releaseLocks releases the locks held by a transaction on the node, and forgets the locks it waits for
+func (n *Node) releaseLocks(transactionId int) {
+	n.lockMu.Lock()
+	defer n.lockMu.Unlock()
+	for _, key := range n.lockKeys[transactionId] {
+		if state, ok := n.locks[key]; ok {
+			delete(state.holders, transactionId)
+			state.removeWaiter(transactionId)
+			if len(state.holders) == 0 && len(state.waiters) == 0 {
+				delete(n.locks, key)
+			}
+		}
+	}
+	delete(n.lockKeys, transactionId)
+	delete(n.lockWaits, transactionId)
+}
+
+// lockStatement locks the tables read by a statement of a serializable transaction shared, and then moves the snapshot
+// of the transaction forward to the last command of the catalog, so that it reads the latest rows. The rows written by
+// the statement are locked as they are written, see lockRows.
+func (c *Cluster) lockStatement(tableNames []string, transaction *Transaction) error {
+	for _, tableName := range tableNames {
+		for _, fragment := range c.getFragments(tableName) {
+			if fragment.NodeId != fragment.Replicas[0] {
+				continue
+			}
+			request := LockRequest{Transaction: transaction.Id, TableName: tableName, Mode: LockShared}
+			if err := c.acquireLock(fragment.NodeId, &request, transaction); err != nil {
+				return err
+			}
+		}
+	}
+	c.syncCatalog()
+	transaction.snapshot = c.getCatalogIndex()
+	return nil
+}
+
+// lockRows locks the rows of a table written on a node exclusively within a serializable transaction, and does nothing
+// for the other transactions
+func (c *Cluster) lockRows(nodeId string, tableName string, rowIds []int, transaction *Transaction) error {
+	if transaction == nil || !transaction.serializable {
+		return nil
+	}
+	request := LockRequest{Transaction: transaction.Id, TableName: tableName, RowIds: rowIds, Mode: LockExclusive}
+	return c.acquireLock(nodeId, &request, transaction)
+}
+
+// lockPrimary locks the rows of a table exclusively on a node whose stale replicas are skipped by a write, if the node
+// holds the primary of a fragment of the table. The readers only lock the fragments on their primaries, so the write
+// must conflict with them there even though it does not reach the primary, and it fails if the primary cannot be
+// locked, e.g., because its node is down.
+func (c *Cluster) lockPrimary(tableName string, nodeId string, rowIds []int, transaction *Transaction) error {
+	for _, fragment := range c.getFragments(tableName) {
+		if fragment.NodeId == nodeId && fragment.Replicas[0] == nodeId {
+			return c.lockRows(nodeId, tableName, rowIds, transaction)
+		}
+	}
+	return nil
+}
+
+// lockKeys locks the values of the primary key and the unique keys of the rows to be written to a table exclusively, so
+// that checking the keys and writing the rows are not interleaved with another write of the same values, which would
+// pass the check as well. A write holds the locks on a majority of the nodes, so that two writes of the same values
+// never hold them together, while the keys are written as long as a majority of the nodes are alive like the catalog.
+// The locks are held by an id allocated by the catalog, which is negated to tell it from the ids of the transactions.
+// A write that cannot lock a majority releases what it holds and tries again every lockRetryInterval, so the writes
+// never wait for each other while holding the locks, and it fails once it has tried for lockTimeout. The returned
+// function releases the locks once the rows are written, or written by a transaction, whose pending rows are taken by
+// the checks of the other writes.
+func (c *Cluster) lockKeys(schema *TableSchema, rows []Row) (func(), error) {
+	keys := schema.UniqueKeys
+	if len(schema.PrimaryKey) > 0 {
+		keys = append([][]string{schema.PrimaryKey}, keys...)
+	}
+	var lockedKeys []string
+	for i, key := range keys {
+		keyIds := make([]int, len(key))
+		for j, columnName := range key {
+			keyIds[j] = schema.getColumnId(columnName)
+		}
+		for _, row := range rows {
+			if _, values, hasNull := getKeyPredicates(schema, row, keyIds); !hasNull {
+				lockedKeys = append(lockedKeys, fmt.Sprintf("%d%q", i, values))
+			}
+		}
+	}
+	if len(lockedKeys) == 0 {
+		return func() {}, nil
+	}
+	owner, err := c.allocateTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	request := LockRequest{Transaction: -owner, TableName: schema.TableName, Keys: lockedKeys, Mode: LockExclusive}
+	// the nodes asked for the locks, which hold or queue the request
+	var asked []string
+	release := func() {
+		for _, nodeId := range asked {
+			reply := ""
+			c.call(nodeId, "Node.ReleaseLocksRPC", request.Transaction, &reply)
+		}
+		asked = nil
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		granted := 0
+		for i, nodeId := range c.nodeIds {
+			if granted > len(c.nodeIds) / 2 || granted + len(c.nodeIds) - i <= len(c.nodeIds) / 2 {
+				break
+			}
+			reply := LockReply{}
+			if c.call(nodeId, "Node.LockRPC", request, &reply) != nil {
+				continue
+			}
+			asked = append(asked, nodeId)
+			if reply.Error != "" {
+				release()
+				return nil, errors.New(reply.Error)
+			}
+			if reply.Granted {
+				granted++
+			}
+		}
+		if granted > len(c.nodeIds) / 2 {
+			// the checks read the latest rows once the nodes have applied the writes logged by the last holder
+			c.syncCatalog()
+			return release, nil
+		}
+		release()
+		if time.Now().After(deadline) {
+			return nil, errors.New("lock wait timeout, the keys are being written by another write")
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// acquireLock asks a node for the locks of a request until they are granted. It fails if the transaction is chosen as
+// the victim of a deadlock, see findDeadlock, or once it has waited for lockTimeout.
+func (c *Cluster) acquireLock(nodeId string, request *LockRequest, transaction *Transaction) error {
+	transaction.lock(nodeId)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		reply := LockReply{}
+		if err := c.call(nodeId, "Node.LockRPC", *request, &reply); err != nil {
+			return err
+		}
+		if reply.Error != "" {
+			return errors.New(reply.Error)
+		}
+		if reply.Granted {
+			return nil
+		}
+		if cycle := c.findDeadlock(transaction.Id); cycle != nil && cycle[len(cycle) - 1] == transaction.Id {
+			return fmt.Errorf("deadlock among transactions %s, transaction %d is aborted as the victim",
+				formatTransactionIds(cycle), transaction.Id)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("lock wait timeout, transaction %d waits for %s on %s", transaction.Id,
+				formatTransactionIds(reply.Holders), nodeId)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// findDeadlock aggregates the wait-for graph of the live nodes, and returns the transactions of a cycle through the
+// given transaction in the increasing order of their ids, or nil if there is none. The last one, i.e., the youngest
+// transaction of the cycle, is the victim.
+func (c *Cluster) findDeadlock(transactionId int) []int {
+	graph := make(map[int]map[int]bool)
+	for _, nodeId := range c.nodeIds {
+		var waits map[int][]int
+		if c.call(nodeId, "Node.LockWaitsRPC", "", &waits) != nil {
+			continue
+		}
+		for waiter, holders := range waits {
+			if graph[waiter] == nil {
+				graph[waiter] = make(map[int]bool)
+			}
+			for _, holder := range holders {
+				graph[waiter][holder] = true
+			}
+		}
+	}
+
+	// a depth-first search from the transaction, where path holds the transactions from it to the current one
+	var path []int
+	visited := make(map[int]bool)
+	var search func(current int) bool
+	search = func(current int) bool {
+		path = append(path, current)
+		for next := range graph[current] {
+			if next == transactionId {
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				if search(next) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path) - 1]
+		return false
+	}
+	visited[transactionId] = true
+	if !search(transactionId) {
+		return nil
+	}
+	sort.Ints(path)
+	return path
+}
+
+// releaseLocks releases the locks of a transaction on the nodes that it has locked but not written, as the
+// participants release them once they finish the transaction
+func (c *Cluster) releaseLocks(transaction *Transaction) {
+	for _, nodeId := range c.nodeIds {
+		if transaction.locked[nodeId] && !transaction.participants[nodeId] {
+			reply := ""
+			c.call(nodeId, "Node.ReleaseLocksRPC", transaction.Id, &reply)
+		}
+	}
+}
+
+// formatTransactionIds formats the ids of some transactions like "1, 2, 3"
+func formatTransactionIds(transactionIds []int) string {
+	ids := make([]string, len(transactionIds))
+	for i, transactionId := range transactionIds {
+		ids[i] = strconv.Itoa(transactionId)
+	}
+	return strings.Join(ids, ", ")
+}
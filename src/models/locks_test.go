@@ -0,0 +1,196 @@
+package models
+
+import (
+	"../labrpc"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// makeClient connects a client of the given name to the cluster, so that the clients send their requests concurrently
+func makeClient(name string) *labrpc.ClientEnd {
+	end := network.MakeEnd(name)
+	network.Connect(name, c.Name)
+	network.Enable(name, true)
+	return end
+}
+
+// executeAsync executes a script within a transaction by the given client, and sends the result once it is done
+func executeAsync(end *labrpc.ClientEnd, transactionId int, script string) chan QueryResult {
+	done := make(chan QueryResult, 1)
+	go func() {
+		result := QueryResult{}
+		end.Call("Cluster.ExecuteTransactionSQL", []interface{}{transactionId, script}, &result)
+		done <- result
+	}()
+	return done
+}
+
+// checkBlocked checks that a script sent by executeAsync is still waiting for locks
+func checkBlocked(t *testing.T, done chan QueryResult, script string) {
+	select {
+	case result := <-done:
+		t.Fatalf("%s should wait for the locks, actual %v", script, result)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSerializableLocks(t *testing.T) {
+	setupTransactions(t)
+	writer := makeClient("ClientB")
+
+	// a serializable transaction reading the accounts blocks the writers until it commits
+	reader := beginTransaction(t, "BEGIN ISOLATION LEVEL SERIALIZABLE; SELECT aid FROM account")
+	id := beginTransaction(t, "BEGIN TRANSACTION ISOLATION LEVEL SERIALIZABLE")
+	script := "UPDATE account SET balance = 0 WHERE aid = 1"
+	done := executeAsync(writer, id, script)
+	checkBlocked(t, done, script)
+	checkTransactionQuery(t, reader, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 100}, {101, 50}}, true)
+	checkTransactionQuery(t, reader, "COMMIT", []Row{}, false)
+	if result := <-done; result.Error != "" || result.Transaction != id {
+		t.Fatalf("%s should succeed once the reader commits, actual %v", script, result)
+	}
+
+	// the writer keeps the rows it writes locked, while a snapshot transaction still reads them without waiting
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 100}, {101, 50}})
+	script = "SELECT aid, balance FROM account ORDER BY aid"
+	reader = beginTransaction(t, "BEGIN ISOLATION LEVEL SERIALIZABLE")
+	done = executeAsync(writer, reader, script)
+	checkBlocked(t, done, script)
+	checkTransactionQuery(t, id, "COMMIT", []Row{}, false)
+	if result := <-done; result.Error != "" || len(result.Dataset.Rows) != 2 || result.Dataset.Rows[0][1] != 0 {
+		t.Errorf("%s should read the committed writes, actual %v", script, result)
+	}
+
+	checkTransactionQuery(t, reader, "COMMIT", []Row{}, false)
+
+	// the inserts of different rows do not conflict, while the intention locks they hold on the fragments block readers
+	other := beginTransaction(t, "BEGIN ISOLATION LEVEL SERIALIZABLE; INSERT INTO account VALUES (2, 10)")
+	id = beginTransaction(t, "BEGIN ISOLATION LEVEL SERIALIZABLE; INSERT INTO account VALUES (4, 10), (102, 10)")
+	checkTransactionQuery(t, other, "INSERT INTO account VALUES (3, 10)", []Row{}, true)
+	script = "SELECT aid FROM account ORDER BY aid"
+	reader = beginTransaction(t, "BEGIN ISOLATION LEVEL SERIALIZABLE")
+	done = executeAsync(writer, reader, script)
+	checkBlocked(t, done, script)
+	checkTransactionQuery(t, id, "ROLLBACK", []Row{}, false)
+	checkBlocked(t, done, script)
+	checkTransactionQuery(t, other, "COMMIT", []Row{}, false)
+	if result := <-done; result.Error != "" || len(result.Dataset.Rows) != 4 {
+		t.Errorf("%s should read the committed inserts, actual %v", script, result)
+	}
+	checkTransactionQuery(t, reader, "COMMIT", []Row{}, false)
+	checkUnlocked(t)
+}
+
+// checkUnlocked checks that no lock is left on the tables of setupTransactions, so that a serializable transaction
+// locks all their rows at once
+func checkUnlocked(t *testing.T) {
+	defer func(timeout time.Duration) { lockTimeout = timeout }(lockTimeout)
+	lockTimeout = 200 * time.Millisecond
+	checkQuery(t, "BEGIN ISOLATION LEVEL SERIALIZABLE; DELETE FROM account; DELETE FROM transfer; ROLLBACK", []Row{})
+}
+
+func TestSerializableStalePrimary(t *testing.T) {
+	setupTransactions(t)
+
+	// a serializable reader locks the accounts on the primaries, and then Node0 is down and misses a write, after
+	// which its replica is stale
+	reader := beginTransaction(t, "BEGIN ISOLATION LEVEL SERIALIZABLE; SELECT aid FROM account")
+	network.DeleteServer("Node0")
+	checkQuery(t, "UPDATE account SET balance = 90 WHERE aid = 1", []Row{})
+
+	// an insert skips the stale primary, but it cannot lock the row there, so it fails instead of slipping past the
+	// shared locks of the reader
+	checkQuery(t, "BEGIN ISOLATION LEVEL SERIALIZABLE; INSERT INTO account VALUES (2, 10); COMMIT", nil)
+	network.AddServer("Node0", c.GetNodeServer("Node0"))
+	checkTransactionQuery(t, reader, "SELECT aid FROM account ORDER BY aid", []Row{{1}, {101}}, true)
+	checkTransactionQuery(t, reader, "COMMIT", []Row{}, false)
+}
+
+func TestDeadlockDetection(t *testing.T) {
+	setupTransactions(t)
+	clients := []*labrpc.ClientEnd{makeClient("ClientB"), makeClient("ClientC")}
+
+	// both transactions read the accounts, and then update them, so each waits for the other to release its shared
+	// locks, where the younger one is aborted
+	older := beginTransaction(t, "BEGIN ISOLATION LEVEL SERIALIZABLE; SELECT aid FROM account")
+	younger := beginTransaction(t, "BEGIN ISOLATION LEVEL SERIALIZABLE; SELECT aid FROM account")
+	script := "UPDATE account SET balance = 60 WHERE aid = 1"
+	first := executeAsync(clients[0], older, script)
+	checkBlocked(t, first, script)
+	second := executeAsync(clients[1], younger, "UPDATE account SET balance = 70 WHERE aid = 101")
+	result := <-second
+	expected := fmt.Sprintf("deadlock among transactions %d, %d, transaction %d is aborted as the victim", older,
+		younger, younger)
+	if !strings.Contains(result.Error, expected) || result.Transaction != 0 {
+		t.Errorf("The younger transaction should be aborted by %s, actual %v", expected, result)
+	}
+	if result = <-first; result.Error != "" || result.Transaction != older {
+		t.Fatalf("The older transaction should go on, actual %v", result)
+	}
+	checkTransactionQuery(t, older, "COMMIT", []Row{}, false)
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 60}, {101, 50}})
+	checkUnlocked(t)
+}
+
+func TestConcurrentTransfers(t *testing.T) {
+	setupTransactions(t)
+
+	// the clients move money among the accounts in serializable transactions, which conflict with each other all the
+	// time, and retry the transactions aborted by deadlocks, so the total balance is kept
+	const clients, transfers = 4, 5
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	var aborts int32
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			end := makeClient(fmt.Sprintf("Transfer%d", i))
+			from, to := 1, 101
+			if i % 2 == 1 {
+				from, to = 101, 1
+			}
+			for j := 0; j < transfers; {
+				result := QueryResult{}
+				end.Call("Cluster.ExecuteSQL", fmt.Sprintf(`BEGIN ISOLATION LEVEL SERIALIZABLE;
+					SELECT balance FROM account WHERE aid = %d`, from), &result)
+				id := result.Transaction
+				if result.Error == "" {
+					balance, _ := strconv.Atoi(fmt.Sprint(result.Dataset.Rows[0][0]))
+					end.Call("Cluster.ExecuteTransactionSQL", []interface{}{id, fmt.Sprintf(`
+						UPDATE account SET balance = %d WHERE aid = %d;
+						SELECT balance FROM account WHERE aid = %d`, balance - 1, from, to)}, &result)
+				}
+				if result.Error == "" {
+					balance, _ := strconv.Atoi(fmt.Sprint(result.Dataset.Rows[0][0]))
+					end.Call("Cluster.ExecuteTransactionSQL", []interface{}{id, fmt.Sprintf(`
+						UPDATE account SET balance = %d WHERE aid = %d; COMMIT`, balance + 1, to)}, &result)
+				}
+				if strings.Contains(result.Error, "deadlock") {
+					atomic.AddInt32(&aborts, 1)
+					continue
+				}
+				if result.Error != "" {
+					errs <- fmt.Errorf("client %d: %s", i, result.Error)
+					return
+				}
+				j++
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err.Error())
+	}
+	if aborts == 0 {
+		t.Error("The conflicting transfers should run into deadlocks")
+	}
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 100}, {101, 50}})
+	checkUnlocked(t)
+}
@@ -0,0 +1,474 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The nodes keep multiple versions of the rows written recently, so that a query reads a consistent snapshot of the
+// tables while other clients keep writing them, e.g., a long join does not see the rows inserted after it begins, nor
+// half of a transaction committed while it runs. The timestamps are the indexes of the commands in the log of the
+// catalog replicated among the nodes, see replicated_catalog.go, which every coordinator agrees on:
+//   - the rows written outside transactions are stamped with the CatalogWriteRows command logging the statement, which
+//     the nodes apply in the order of the log;
+//   - the writes of a transaction are pending until it commits, and are then stamped with the command logging the
+//     decision to commit it, see transaction.go;
+//   - a query reads the snapshot at the last command known to the coordinator when it begins, after the coordinator
+//     syncs its catalog with the leader, so it sees every write that has been acknowledged to a client before, while a
+//     transaction reads the snapshot at the command beginning it together with its own pending writes.
+// Each row written recently has a version chain on the node, whose versions are stamped with the timestamps they are
+// created and removed at. The row store keeps the latest rows as before, i.e., including the pending writes, which are
+// read by the checks of the constraints. A node reads a snapshot once it has applied the commands up to it, and a
+// snapshot may see a version of a prepared transaction whose decision has not reached the node yet, both of which are
+// resolved by the replica of the catalog on the node, see Node.resolveSnapshot.
+// Version chains are pruned once they have not changed for versionRetention, after which the older snapshots of the
+// table cannot be read. A transaction that removes a row changed after its snapshot, or a row written by another
+// pending transaction, fails with a write conflict, so that the first writer wins.
+// The versions are only kept in memory, so a node restored from the disk serves its latest committed rows to the
+// snapshots taken before it restarts. A statement outside transactions that removes a row written by a pending
+// transaction fails on the nodes holding the pending write, but it is not undone on the other nodes.
+
+// versionRetention is how long the versions of a row are kept since it was last written
+var versionRetention = time.Minute
+
+// Snapshot is the point in the history of the tables read by a query, which sees the rows committed at or before
+// Timestamp, together with the pending writes of Transaction if it is not 0. The zero Snapshot reads the latest rows,
+// including the pending writes of every transaction, once the node has applied the commands up to Index, see
+// Cluster.getLatestSnapshot. A write is stamped with a Snapshot as well: the write of a transaction is pending until
+// the transaction commits, and conflicts with the writes committed after Timestamp, while a write outside transactions
+// is committed at Timestamp.
+type Snapshot struct {
+	Timestamp int
+	Transaction int
+	Index int
+}
+
+// rowVersion is a version of a row in the version chain of the row, see Table.versions
+type rowVersion struct {
+	row Row
+	// the timestamp the version is created at, 0 if it is older than the chain, or the pending transaction creating it
+	begin int
+	creator int
+	// the timestamp the version is removed at, 0 if it is not, or the pending transaction removing it
+	end int
+	remover int
+	// the older version of the row
+	prev *rowVersion
+	// the time the chain was last changed, which is only kept by the latest version
+	changed time.Time
+}
+
+// isLatest checks whether the latest rows snapshot is read, in which case the versions are ignored
+func (s *Snapshot) isLatest() bool {
+	return s.Timestamp == 0 && s.Transaction == 0
+}
+
+// isCommitted checks whether a pending transaction is seen as committed by the snapshot, where commits holds the
+// commit timestamps of the prepared transactions known to be committed, see Node.resolveSnapshot
+func (s *Snapshot) isCommitted(transactionId int, commits map[int]int) bool {
+	if transactionId == s.Transaction {
+		return true
+	}
+	timestamp, ok := commits[transactionId]
+	return ok && timestamp <= s.Timestamp
+}
+
+// isVisible checks whether the version is seen by the snapshot
+func (v *rowVersion) isVisible(s *Snapshot, commits map[int]int) bool {
+	created := v.creator == 0 && v.begin <= s.Timestamp || v.creator != 0 && s.isCommitted(v.creator, commits)
+	removed := v.remover == 0 && v.end != 0 && v.end <= s.Timestamp ||
+		v.remover != 0 && s.isCommitted(v.remover, commits)
+	return created && !removed
+}
+
+// isPending checks whether the version is written by a pending transaction
+func (v *rowVersion) isPending() bool {
+	return v.creator != 0 || v.remover != 0
+}
+
+// getRowId returns the hidden row id carried by the last column of a row of a fragment
+func getRowId(row Row) int {
+	return row[len(row) - 1].(int)
+}
+
+// insertVersion inserts a row written by the given stamp, which creates a version of the row unless the stamp is the
+// zero Snapshot, see Snapshot
+func (t *Table) insertVersion(row *Row, stamp Snapshot) {
+	t.Insert(row)
+	if !stamp.isLatest() {
+		t.pushVersion(*row, stamp)
+	}
+}
+
+// removeVersion removes a row by the given stamp, which ends the latest version of the row. A row removed by the zero
+// Snapshot loses its versions as if it had never been written, e.g., the row of a failed write.
+func (t *Table) removeVersion(row *Row, stamp Snapshot) {
+	t.Remove(row)
+	if stamp.isLatest() {
+		delete(t.versions, getRowId(*row))
+		return
+	}
+	t.endVersion(*row, stamp)
+}
+
+// pushVersion creates the latest version of a row written by the stamp
+func (t *Table) pushVersion(row Row, stamp Snapshot) {
+	rowId := getRowId(row)
+	version := &rowVersion{row: row, begin: stamp.Timestamp, creator: stamp.Transaction, changed: time.Now()}
+	if stamp.Transaction != 0 {
+		version.begin = 0
+	}
+	version.prev = t.versions[rowId]
+	if t.versions == nil {
+		t.versions = make(map[int]*rowVersion)
+	}
+	t.versions[rowId] = version
+	t.pruneVersions()
+}
+
+// endVersion ends the latest version of a row removed by the stamp, where a row without versions is older than any
+// snapshot that may be read
+func (t *Table) endVersion(row Row, stamp Snapshot) {
+	rowId := getRowId(row)
+	version, ok := t.versions[rowId]
+	if !ok {
+		version = &rowVersion{row: row}
+		if t.versions == nil {
+			t.versions = make(map[int]*rowVersion)
+		}
+		t.versions[rowId] = version
+	}
+	if stamp.Transaction != 0 {
+		version.remover = stamp.Transaction
+	} else {
+		version.end = stamp.Timestamp
+	}
+	version.changed = time.Now()
+	t.pruneVersions()
+}
+
+// checkWrite checks whether the row of the given row id can be removed by the stamp. It returns an error if the row is
+// written by another pending transaction, or if the stamp is of a transaction and the row is changed after its
+// snapshot.
+func (t *Table) checkWrite(rowId int, stamp Snapshot) error {
+	version, ok := t.versions[rowId]
+	if !ok {
+		return nil
+	}
+	for _, transactionId := range []int{version.creator, version.remover} {
+		if transactionId != 0 && transactionId != stamp.Transaction {
+			return fmt.Errorf("write conflict, row %d of %s is written by transaction %d", rowId,
+				t.schema.TableName, transactionId)
+		}
+	}
+	if stamp.Transaction != 0 && (version.begin > stamp.Timestamp || version.end > stamp.Timestamp) {
+		return fmt.Errorf("write conflict, row %d of %s is changed after the snapshot of transaction %d", rowId,
+			t.schema.TableName, stamp.Transaction)
+	}
+	return nil
+}
+
+// commitVersions stamps the versions of a row written by a transaction with its commit timestamp
+func (t *Table) commitVersions(rowId int, transactionId int, timestamp int) {
+	latest, ok := t.versions[rowId]
+	if !ok {
+		return
+	}
+	for version := latest; version != nil; version = version.prev {
+		if version.creator == transactionId {
+			version.creator, version.begin = 0, timestamp
+		}
+		if version.remover == transactionId {
+			version.remover, version.end = 0, timestamp
+		}
+	}
+	latest.changed = time.Now()
+}
+
+// abortVersions drops the versions of a row created by a transaction that is rolled back, and restores those removed
+// by it. The rows in the store are restored by the caller, see Node.undoWrites.
+func (t *Table) abortVersions(rowId int, transactionId int) {
+	var kept *rowVersion
+	var last *rowVersion
+	for version := t.versions[rowId]; version != nil; version = version.prev {
+		if version.creator == transactionId {
+			continue
+		}
+		if version.remover == transactionId {
+			version.remover = 0
+		}
+		if last == nil {
+			kept = version
+		} else {
+			last.prev = version
+		}
+		last = version
+	}
+	if kept == nil {
+		delete(t.versions, rowId)
+		return
+	}
+	last.prev = nil
+	kept.changed = time.Now()
+	t.versions[rowId] = kept
+}
+
+// pruneVersions drops the version chains that have not changed for versionRetention, except those written by pending
+// transactions, after which the snapshots before the timestamps of the chains cannot be read. It only looks at the
+// chains once every versionRetention.
+func (t *Table) pruneVersions() {
+	now := time.Now()
+	if now.Sub(t.prunedAt) < versionRetention {
+		return
+	}
+	t.prunedAt = now
+	for rowId, version := range t.versions {
+		if now.Sub(version.changed) < versionRetention || version.isPending() {
+			continue
+		}
+		if version.begin > t.horizon {
+			t.horizon = version.begin
+		}
+		if version.end > t.horizon {
+			t.horizon = version.end
+		}
+		delete(t.versions, rowId)
+	}
+}
+
+// clearVersions drops all version chains of the table once its rows are replaced by the latest rows at the given
+// timestamp, so the older snapshots cannot be read
+func (t *Table) clearVersions(timestamp int) {
+	t.versions = nil
+	if timestamp > t.horizon {
+		t.horizon = timestamp
+	}
+}
+
+// snapshotIterator iterates the rows seen by a snapshot among the candidates from the row store lazily, e.g., the rows
+// looked up by an index, so that a scan does not read its fragments in full before it returns the first batch. The
+// versions kept by the table when the iterator is created are resolved at once, while a row changed later is read from
+// its versions once the candidates are exhausted, which may return a row already returned from the store again, so the
+// caller should replace the rows of the same row ids. The versions may not be among the candidates, so the caller
+// should filter the rows again. The caller should hold the lock of the node while iterating.
+type snapshotIterator struct {
+	table *Table
+	snapshot Snapshot
+	commits map[int]int
+	candidates RowIterator
+	// rowId -> whether the row had versions when the iterator was created, nil if the latest rows are read
+	versioned map[int]bool
+	// the rows of the versions seen by the snapshot, which are returned after the candidates
+	rows []Row
+	// whether the rows changed since the iterator was created have been read from their versions
+	changedRead bool
+}
+
+// snapshotIterator creates a snapshotIterator of the rows seen by a snapshot, and returns an error if the snapshot is
+// older than the versions kept by the table
+func (t *Table) snapshotIterator(candidates RowIterator, s Snapshot, commits map[int]int) (*snapshotIterator, error) {
+	iterator := &snapshotIterator{table: t, snapshot: s, commits: commits, candidates: candidates}
+	if err := iterator.checkHorizon(); err != nil {
+		return nil, err
+	}
+	if s.isLatest() {
+		return iterator, nil
+	}
+	iterator.versioned = make(map[int]bool)
+	for rowId, latest := range t.versions {
+		iterator.versioned[rowId] = true
+		if row := latest.getVisibleRow(&s, commits); row != nil {
+			iterator.rows = append(iterator.rows, row)
+		}
+	}
+	// the versions are kept in a map, so the rows are ordered by their row ids to be deterministic
+	sortRowsById(iterator.rows)
+	return iterator, nil
+}
+
+// checkHorizon returns an error if the versions the snapshot needs have been pruned, which may happen while the rows
+// are being iterated
+func (iterator *snapshotIterator) checkHorizon() error {
+	if !iterator.snapshot.isLatest() && iterator.snapshot.Timestamp < iterator.table.horizon {
+		return errors.New("the snapshot of " + iterator.table.schema.TableName + " is too old")
+	}
+	return nil
+}
+
+// next returns the next row seen by the snapshot, or nil if there is no row left
+func (iterator *snapshotIterator) next() (Row, error) {
+	if err := iterator.checkHorizon(); err != nil {
+		return nil, err
+	}
+	t := iterator.table
+	for iterator.candidates.HasNext() {
+		row := *iterator.candidates.Next()
+		if iterator.versioned == nil {
+			return row, nil
+		}
+		// a row with versions is read from them instead
+		rowId := getRowId(row)
+		if _, ok := t.versions[rowId]; !ok && !iterator.versioned[rowId] {
+			return row, nil
+		}
+	}
+	if !iterator.changedRead && iterator.versioned != nil {
+		iterator.changedRead = true
+		var changed []Row
+		for rowId, latest := range t.versions {
+			if iterator.versioned[rowId] {
+				continue
+			}
+			if row := latest.getVisibleRow(&iterator.snapshot, iterator.commits); row != nil {
+				changed = append(changed, row)
+			}
+		}
+		sortRowsById(changed)
+		iterator.rows = append(iterator.rows, changed...)
+	}
+	if len(iterator.rows) == 0 {
+		return nil, nil
+	}
+	row := iterator.rows[0]
+	iterator.rows = iterator.rows[1:]
+	return row, nil
+}
+
+// getVisibleRow returns the row of the version in the chain that is seen by the snapshot, or nil if there is none
+func (v *rowVersion) getVisibleRow(s *Snapshot, commits map[int]int) Row {
+	for version := v; version != nil; version = version.prev {
+		if version.isVisible(s, commits) {
+			return version.row
+		}
+	}
+	return nil
+}
+
+// snapshotRows returns all rows seen by a snapshot among the given candidates, ordered by their row ids if the table
+// keeps any versions, see snapshotIterator
+func (t *Table) snapshotRows(candidates RowIterator, s Snapshot, commits map[int]int) ([]Row, error) {
+	iterator, err := t.snapshotIterator(candidates, s, commits)
+	if err != nil {
+		return nil, err
+	}
+	var rows []Row
+	for {
+		row, err := iterator.next()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	if len(t.versions) > 0 && !s.isLatest() {
+		sortRowsById(rows)
+	}
+	return rows, nil
+}
+
+// sortRowsById sorts the rows of a fragment by their row ids
+func sortRowsById(rows []Row) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return getRowId(rows[i]) < getRowId(rows[j])
+	})
+}
+
+// resolveSnapshot prepares the node to read a snapshot of a table, for which the replica of the catalog on the node
+// applies the commands up to the snapshot, or up to its Index if the latest rows are read, so that the node has
+// applied the writes logged up to them. The node waits as long as its catalog makes progress, see
+// CatalogReplica.catchUp, and fails if its replicas of the table are stale. It returns the commit timestamps of the
+// transactions prepared on the node that the snapshot should see as committed, i.e., those committed at or before the
+// timestamp of the snapshot, whose decisions may not have reached the node. A transaction that is not prepared yet cannot be committed before the snapshot, as its
+// decision would follow the commands known to the coordinator.
+func (n *Node) resolveSnapshot(tableName string, s Snapshot) (map[int]int, error) {
+	if n.isStale(tableName) {
+		return nil, errors.New(errStaleReplica)
+	}
+	if n.catalog == nil {
+		return nil, nil
+	}
+	index := s.Index
+	if s.Timestamp > index {
+		index = s.Timestamp
+	}
+	if err := n.catalog.waitApplied(index); err != nil {
+		return nil, err
+	}
+	if s.isLatest() {
+		return nil, nil
+	}
+	var prepared []int
+	n.transactionMu.Lock()
+	for transactionId, log := range n.transactions {
+		if log.Prepared && transactionId != s.Transaction {
+			prepared = append(prepared, transactionId)
+		}
+	}
+	n.transactionMu.Unlock()
+	if len(prepared) == 0 {
+		return nil, nil
+	}
+	return n.catalog.getCommits(prepared, s.Timestamp)
+}
+
+// finishVersions stamps the versions written by a transaction on the node with its commit timestamp, or drops them if
+// the timestamp is 0 as the transaction is rolled back. The caller should hold mu.
+func (n *Node) finishVersions(log *TransactionLog, timestamp int) {
+	for _, write := range log.Writes {
+		t, ok := n.TableMap[write.TableName]
+		if !ok {
+			continue
+		}
+		if timestamp == 0 {
+			t.abortVersions(getRowId(write.Row), log.Id)
+		} else {
+			t.commitVersions(getRowId(write.Row), log.Id, timestamp)
+		}
+	}
+}
+
+// restoreVersions makes the writes of a transaction restored from its log pending again, which are read as the latest
+// rows by the node restored from the disk
+func (n *Node) restoreVersions(log *TransactionLog) {
+	stamp := Snapshot{Transaction: log.Id}
+	for _, write := range log.Writes {
+		t, ok := n.TableMap[write.TableName]
+		if !ok {
+			continue
+		}
+		if write.Removed {
+			t.endVersion(write.Row, stamp)
+		} else {
+			t.pushVersion(write.Row, stamp)
+		}
+	}
+}
+
+// getSnapshot returns the snapshot read by a statement within the given transaction, or that of the last command of
+// the catalog known to the coordinator if the transaction is nil, which should have been synced with the leader
+func (c *Cluster) getSnapshot(transaction *Transaction) Snapshot {
+	if transaction != nil {
+		return Snapshot{Timestamp: transaction.snapshot, Transaction: transaction.Id}
+	}
+	return Snapshot{Timestamp: c.getCatalogIndex()}
+}
+
+// getLatestSnapshot returns the Snapshot reading the latest rows, including the writes logged up to the last command
+// of the catalog known to the coordinator, e.g., by the checks of the constraints
+func (c *Cluster) getLatestSnapshot() Snapshot {
+	return Snapshot{Index: c.getCatalogIndex()}
+}
+
+// allocateTimestamp allocates a timestamp by a command of the catalog, which follows the snapshots of the queries that
+// have begun and is unique among the coordinators
+func (c *Cluster) allocateTimestamp() (int, error) {
+	reply, err := c.proposeCatalog(CatalogCommand{Kind: CatalogAllocateTimestamp})
+	if err != nil {
+		return 0, err
+	}
+	return reply.Index, nil
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVersionChains(t *testing.T) {
+	schema := TableSchema{TableName: "account-0", ColumnSchemas: []ColumnSchema{
+		{Name: "aid", DataType: TypeInt32},
+		{Name: "balance", DataType: TypeInt32},
+	}}
+	table := NewTable(&schema, NewSliceRowStore())
+	readRows := func(s Snapshot, commits map[int]int) []Row {
+		rows, err := table.snapshotRows(table.RowIterator(), s, commits)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return rows
+	}
+	checkRows := func(s Snapshot, commits map[int]int, expected []Row) {
+		rows := readRows(s, commits)
+		matched := len(rows) == len(expected)
+		for i := 0; matched && i < len(expected); i++ {
+			matched = rows[i].Equals(&expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect rows of snapshot %v, expected %v, actual %v", s, expected, rows)
+		}
+	}
+
+	// rows written outside transactions are seen by the snapshots at or after their timestamps
+	first, second := Row{1, 100, 0}, Row{2, 50, 1}
+	table.insertVersion(&first, Snapshot{Timestamp: 3})
+	table.insertVersion(&second, Snapshot{Timestamp: 5})
+	checkRows(Snapshot{Timestamp: 2}, nil, []Row{})
+	checkRows(Snapshot{Timestamp: 4}, nil, []Row{first})
+	checkRows(Snapshot{Timestamp: 5}, nil, []Row{first, second})
+
+	// an update ends the old version and pushes a new one, while the older snapshots still see the old version
+	updated := Row{1, 70, 0}
+	table.removeVersion(&first, Snapshot{Timestamp: 7})
+	table.insertVersion(&updated, Snapshot{Timestamp: 7})
+	checkRows(Snapshot{Timestamp: 6}, nil, []Row{first, second})
+	checkRows(Snapshot{Timestamp: 7}, nil, []Row{updated, second})
+	checkRows(Snapshot{}, nil, []Row{second, updated})
+
+	// the pending writes of a transaction are only seen by itself until it commits
+	table.removeVersion(&second, Snapshot{Timestamp: 7, Transaction: 20})
+	checkRows(Snapshot{Timestamp: 8}, nil, []Row{updated, second})
+	checkRows(Snapshot{Timestamp: 8, Transaction: 20}, nil, []Row{updated})
+	checkRows(Snapshot{Timestamp: 9}, map[int]int{20: 9}, []Row{updated})
+	if err := table.checkWrite(0, Snapshot{Timestamp: 8, Transaction: 21}); err != nil {
+		t.Errorf("Row 0 should be written by transaction 21, actual %v", err)
+	}
+	if err := table.checkWrite(0, Snapshot{Timestamp: 6, Transaction: 21}); err == nil {
+		t.Error("Row 0 is changed after the snapshot of transaction 21, which should not write it")
+	}
+	if err := table.checkWrite(1, Snapshot{Timestamp: 8, Transaction: 21}); err == nil {
+		t.Error("Row 1 is written by transaction 20, which should not be written by transaction 21")
+	}
+	if err := table.checkWrite(1, Snapshot{Timestamp: 8, Transaction: 20}); err != nil {
+		t.Errorf("Row 1 should be written by transaction 20 again, actual %v", err)
+	}
+
+	// the rolled back transaction leaves the row as before
+	table.Insert(&second)
+	table.abortVersions(1, 20)
+	checkRows(Snapshot{Timestamp: 9}, map[int]int{20: 9}, []Row{updated, second})
+
+	// pruned chains cannot be read by the snapshots before them
+	defer func(retention time.Duration) { versionRetention = retention }(versionRetention)
+	versionRetention = 0
+	table.pruneVersions()
+	if len(table.versions) != 0 {
+		t.Errorf("The version chains should be pruned, actual %v", table.versions)
+	}
+	checkRows(Snapshot{Timestamp: 9}, nil, []Row{updated, second})
+	if _, err := table.snapshotRows(table.RowIterator(), Snapshot{Timestamp: 6}, nil); err == nil {
+		t.Error("The snapshot at 6 should be too old")
+	}
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	setupTransactions(t)
+
+	// a transaction reads the snapshot when it begins, while the writes after it are seen by the later queries
+	id := beginTransaction(t, "BEGIN; SELECT aid FROM account")
+	checkQuery(t, "INSERT INTO account VALUES (2, 10); UPDATE account SET balance = 60 WHERE aid = 101", []Row{})
+	checkTransactionQuery(t, id, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 100}, {101, 50}}, true)
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 100}, {2, 10}, {101, 60}})
+
+	// the first writer wins, so the transaction fails to write a row changed after its snapshot
+	checkTransactionQuery(t, id, "UPDATE account SET balance = 0 WHERE aid = 101", nil, false)
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 100}, {2, 10}, {101, 60}})
+
+	// and a write of another pending transaction conflicts with it as well
+	id = beginTransaction(t, "BEGIN; UPDATE account SET balance = 90 WHERE aid = 1")
+	other := beginTransaction(t, "BEGIN; INSERT INTO transfer VALUES (0, 10)")
+	checkTransactionQuery(t, other, "DELETE FROM account WHERE aid = 1", nil, false)
+	checkQuery(t, "SELECT aid, balance FROM account WHERE aid = 1", []Row{{1, 100}})
+	checkTransactionQuery(t, id, "COMMIT", []Row{}, false)
+	checkQuery(t, "SELECT aid, balance FROM account WHERE aid = 1", []Row{{1, 90}})
+	checkQuery(t, "SELECT tid FROM transfer", []Row{})
+	for _, nodeId := range c.nodeIds {
+		checkTransactionLogs(t, nodeId, 0, 0)
+	}
+}
+
+func TestConcurrentSnapshots(t *testing.T) {
+	setupScript(t, `CREATE TABLE orders (oid INT32 PRIMARY KEY, amount INT32) PARTITION BY (NODE 0);
+		CREATE TABLE payment (oid INT32 PRIMARY KEY, paid INT32) PARTITION BY (NODE 3);
+		CREATE TABLE audit (aid INT32, oid INT32) PARTITION BY (NODE 1 WHERE aid < 1000, NODE 2 WHERE aid >= 1000)`)
+
+	// the writers insert every order together with its payment in a transaction, and its audits outside transactions,
+	// while the readers join the orders with their payments, which should always be matched
+	const writers, readers, orders = 4, 4, 15
+	var wg, written sync.WaitGroup
+	errs := make(chan error, writers + readers)
+	stopped := make(chan struct{})
+	for i := 0; i < writers; i++ {
+		written.Add(1)
+		go func(i int) {
+			defer written.Done()
+			end := network.MakeEnd(fmt.Sprintf("Writer%d", i))
+			network.Connect(fmt.Sprintf("Writer%d", i), c.Name)
+			network.Enable(fmt.Sprintf("Writer%d", i), true)
+			for j := 0; j < orders; j++ {
+				oid := i * orders + j
+				result := QueryResult{}
+				end.Call("Cluster.ExecuteSQL", fmt.Sprintf(`BEGIN; INSERT INTO orders VALUES (%d, %d);
+					INSERT INTO payment VALUES (%d, %d); COMMIT`, oid, j, oid, j), &result)
+				if result.Error != "" {
+					errs <- fmt.Errorf("order %d: %s", oid, result.Error)
+					return
+				}
+				end.Call("Cluster.ExecuteSQL", fmt.Sprintf("INSERT INTO audit VALUES (%d, %d), (%d, %d)",
+					oid, oid, oid + 1000, oid), &result)
+				if result.Error != "" {
+					errs <- fmt.Errorf("audit %d: %s", oid, result.Error)
+					return
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			end := network.MakeEnd(fmt.Sprintf("Reader%d", i))
+			network.Connect(fmt.Sprintf("Reader%d", i), c.Name)
+			network.Enable(fmt.Sprintf("Reader%d", i), true)
+			// the readers stop once they see every order, or once the writers stop
+			seen := 0
+			for seen < writers * orders {
+				select {
+				case <-stopped:
+					return
+				default:
+				}
+				result := QueryResult{}
+				end.Call("Cluster.ExecuteSQL", `SELECT orders.oid, amount, paid FROM orders
+					LEFT JOIN payment ON orders.oid = payment.oid`, &result)
+				if result.Error != "" {
+					errs <- fmt.Errorf("join: %s", result.Error)
+					return
+				}
+				for _, row := range result.Dataset.Rows {
+					if row[2] == nil || row[1] != row[2] {
+						errs <- fmt.Errorf("the order %v is not matched by its payment", row)
+						return
+					}
+				}
+				// the later snapshots see every order seen by the earlier ones
+				if len(result.Dataset.Rows) < seen {
+					errs <- fmt.Errorf("%d orders are seen after %d", len(result.Dataset.Rows), seen)
+					return
+				}
+				seen = len(result.Dataset.Rows)
+				end.Call("Cluster.ExecuteSQL", "SELECT COUNT(*) FROM audit", &result)
+				if result.Error != "" {
+					errs <- fmt.Errorf("audit: %s", result.Error)
+					return
+				}
+			}
+		}(i)
+	}
+	written.Wait()
+	close(stopped)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err.Error())
+	}
+	checkQuery(t, "SELECT COUNT(*) FROM orders JOIN payment ON orders.oid = payment.oid",
+		[]Row{{int64(writers * orders)}})
+	checkQuery(t, "SELECT COUNT(*) FROM audit", []Row{{int64(2 * writers * orders)}})
+}
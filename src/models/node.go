@@ -3,13 +3,19 @@ package models
 import (
 	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"strconv"
+	"sync"
 )
 
 // Node manages some tables defined in models/table.go
 type Node struct {
 	// the name of the Node, and it should be unique across the cluster
 	Identifier string
+	// guards the tables and their metadata below, which are read and written by the RPCs served concurrently. The
+	// methods that are not RPCs leave the locking to their callers.
+	mu sync.RWMutex
 	// tableName -> table
 	TableMap map[string]*Table
 	// tableName -> original table schema
@@ -18,6 +24,40 @@ type Node struct {
 	columnIdsMap map[string][]int
 	// tableName -> ColumnName predicate
 	predicates map[string][]Predicate
+	// cursorId -> open scan, see OpenScanRPC
+	cursors map[int]*scanCursor
+	nextCursorId int
+	cursorMu sync.Mutex
+	// the directory keeping the tables of a persistent node, empty if the tables are only kept in memory, see
+	// NewPersistentNode
+	dir string
+	// the replica of the catalog of the cluster, see replicated_catalog.go
+	catalog *CatalogReplica
+	// tableName -> the index of the snapshot of the catalog before which the fragments of the table on the node have
+	// missed some writes, see missWrites
+	staleTables map[string]int
+	// tableName -> the index of the last command of the catalog whose writes are applied to the table, see applyWrites
+	writeIndexes map[string]int
+	// log index -> the error of applying the writes of the command at the index
+	writeErrors map[int]string
+	// transactionId -> the log of the writes of the transaction on the node, see transaction.go
+	transactions map[int]*TransactionLog
+	transactionMu sync.Mutex
+	// the file appended by the changes of the logs of the transactions on a persistent node, see appendTransactions
+	transactionFile *os.File
+	// the number of records in transactionFile
+	transactionRecords int
+	// the locks of the serializable transactions, see locks.go
+	locks map[lockKey]*lockState
+	// transactionId -> the locks held or waited for by the transaction
+	lockKeys map[int][]lockKey
+	// transactionId -> the transactions holding the locks that the transaction waits for
+	lockWaits map[int][]int
+	lockMu sync.Mutex
+	// requestId -> the write served by the node, and the ids in the order they are served, see serveOnce
+	servedRequests map[string]*servedRequest
+	requestOrder []string
+	requestMu sync.Mutex
 }
 
 // NewNode creates a new node with the given name and an empty set of tables
@@ -28,6 +68,15 @@ func NewNode(id string) *Node {
 		SchemaMap: make(map[string]TableSchema),
 		columnIdsMap: make(map[string][]int),
 		predicates: make(map[string][]Predicate),
+		cursors: make(map[int]*scanCursor),
+		staleTables: make(map[string]int),
+		writeIndexes: make(map[string]int),
+		writeErrors: make(map[int]string),
+		transactions: make(map[int]*TransactionLog),
+		locks: make(map[lockKey]*lockState),
+		lockKeys: make(map[int][]lockKey),
+		lockWaits: make(map[int][]int),
+		servedRequests: make(map[string]*servedRequest),
 	}
 }
 
@@ -59,6 +108,8 @@ func (n *Node) CreateTableRPC(args []interface{}, reply *string) {
 	if originErr != true {
 		*reply = "Create table error: Cannot cast params[1] to type []Predicate!"
 	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
 
 	// check if table partition already exists
 	tableExists := false
@@ -89,6 +140,9 @@ func (n *Node) CreateTableRPC(args []interface{}, reply *string) {
 		}
 	}
 	if tableExists {
+		if err := n.saveCatalog(); err != nil {
+			*reply = err.Error()
+		}
 		return
 	}
 
@@ -97,45 +151,82 @@ func (n *Node) CreateTableRPC(args []interface{}, reply *string) {
 		*reply = err.Error()
 		return
 	}
+	// rows of fragments are looked up by their hidden row ids
+	n.TableMap[schema.TableName].CreateIndex(rowIdColumn, IndexHash)
 	n.columnIdsMap[schema.TableName] = columnIds
 	for _, predicate := range predicates {
 		n.predicates[schema.TableName] = append(n.predicates[schema.TableName], predicate)
 	}
 	n.SchemaMap[schema.TableName] = origin
+	if err := n.saveCatalog(); err != nil {
+		*reply = err.Error()
+	}
 }
 
-// CreateTable creates a Table on this node with the provided schema. It returns nil if the table is created
-// successfully, or an error if another table with the same name already exists.
+// CreateTable creates a Table on this node with the provided schema, whose rows are stored by the storage of the
+// schema, or on the disk if the node is persistent. It returns nil if the table is created successfully, or an error if
+// another table with the same name already exists or the storage is unknown.
 func (n *Node) CreateTable(schema *TableSchema) error {
 	// check if the table already exists
 	if _, ok := n.TableMap[schema.TableName]; ok {
 		return errors.New("table already exists")
 	}
+	rowStore, err := n.openRowStore(schema)
+	if err != nil {
+		return err
+	}
 	// create a table and store it in the map
 	t := NewTable(
 		schema,
-		NewMemoryListRowStore(),
+		rowStore,
 	)
 	n.TableMap[schema.TableName] = t
-	return nil
+	return n.saveCatalog()
 }
 
-// InsertRPC is an RPC interface for insert a row into specified table
+// InsertRPC is an RPC interface for insert a row into specified table, where args are the name of the table, the row,
+// its row id and optionally the Snapshot stamping the write, which tells the transaction writing the row if any, see
+// mvcc.go and transaction.go, and the id of the request, by which a retried request is applied once, see serveOnce
 func (n *Node) InsertRPC(args []interface{}, reply *string) {
+	n.serveOnce(getRequestId(args, 4), reply, func() {
+		n.insertRequest(args, reply)
+	})
+}
+
+// insertRequest is the implementation of InsertRPC
+func (n *Node) insertRequest(args []interface{}, reply *string) {
 	tableName := args[0].(string)
 	row := args[1].(Row)
 	rowId := args[2].(int)
+	stamp := Snapshot{}
+	if len(args) > 3 {
+		stamp = args[3].(Snapshot)
+	}
+	if stamp.Transaction > 0 {
+		if err := n.beginWrites(stamp); err != nil {
+			*reply = err.Error()
+			return
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.insertRow(tableName, row, rowId, stamp); err != nil {
+		*reply = err.Error()
+	}
+}
 
+// insertRow inserts a row of the given id into the fragments of a table on the node, the caller should hold mu
+func (n *Node) insertRow(tableName string, row Row, rowId int, stamp Snapshot) error {
 	for tableCount := 0; ; tableCount++ {
 		pTableName := tableName + "-" + strconv.Itoa(tableCount)
-		if n.predicates[pTableName] == nil {
-			return
+		t, ok := n.TableMap[pTableName]
+		if !ok {
+			return nil
 		}
 
 		ok, err := n.PredicateCheck(pTableName, &row)
 		if err != nil {
-			*reply = err.Error()
-			return
+			return err
 		}
 		if ok {
 			var insertRow Row
@@ -143,139 +234,32 @@ func (n *Node) InsertRPC(args []interface{}, reply *string) {
 				insertRow = append(insertRow, row[columnId])
 			}
 			insertRow = append(insertRow, rowId)
-			err = n.Insert(pTableName, &insertRow)
-			if err != nil {
-				*reply = err.Error()
+			if stamp.Transaction > 0 {
+				write := TransactionWrite{TableName: pTableName, Row: insertRow}
+				if err = n.logWrites(stamp.Transaction, []TransactionWrite{write}); err != nil {
+					return err
+				}
+			}
+			t.insertVersion(&insertRow, stamp)
+			if err = t.storeError(); err != nil {
+				return err
 			}
 		}
 	}
-
 }
 
 // PredicateCheck checks whether a row is satisfied all predicates
 func (n *Node) PredicateCheck(tableName string, row *Row) (bool, error) {
-	ps := n.predicates[tableName]
 	schema := n.SchemaMap[tableName]
-	for _, p := range ps {
-		var lessFlag, equalFlag bool
-		columnId := schema.getColumnId(p.ColumnName)
-		// get comparison results based on data types
-		switch p.DataType {
-			case TypeInt32:
-				rowValue, err := row.getInt32Value(columnId)
-				if err != nil {
-					return false, err
-				}
-				pValue, err := p.getInt32Value()
-				if err != nil {
-					return false, err
-				}
-				lessFlag = rowValue < pValue
-				equalFlag = rowValue == pValue
-				break
-			case TypeInt64:
-				rowValue, err := row.getInt64Value(columnId)
-				if err != nil {
-					return false, err
-				}
-				pValue, err := p.getInt64Value()
-				if err != nil {
-					return false, err
-				}
-				lessFlag = rowValue < pValue
-				equalFlag = rowValue == pValue
-				break
-			case TypeFloat:
-				rowValue, err := row.getFloat32Value(columnId)
-				if err != nil {
-					return false, err
-				}
-				pValue, err := p.getFloat32Value()
-				if err != nil {
-					return false, err
-				}
-				lessFlag = rowValue < pValue
-				equalFlag = rowValue == pValue
-				break
-			case TypeDouble:
-				rowValue, err := row.getFloat64Value(columnId)
-				if err != nil {
-					return false, err
-				}
-				pValue, err := p.getFloat64Value()
-				if err != nil {
-					return false, err
-				}
-				lessFlag = rowValue < pValue
-				equalFlag = rowValue == pValue
-				break
-			case TypeBoolean:
-				rowValue, err := row.getBoolValue(columnId)
-				if err != nil {
-					return false, err
-				}
-				pValue, err := p.getBoolValue()
-				if err != nil {
-					return false, err
-				}
-				lessFlag = false
-				equalFlag = rowValue == pValue
-				break
-			case TypeString:
-				rowValue, err := row.getStringValue(columnId)
-				if err != nil {
-					return false, err
-				}
-				pValue, err := p.getStringValue()
-				if err != nil {
-					return false, err
-				}
-				lessFlag = rowValue < pValue
-				equalFlag = rowValue == pValue
-				break
-		}
-		// check predicates
-		switch p.Operator {
-			case "<":
-				if !lessFlag {
-					return false, nil
-				}
-				break
-			case "<=":
-				if !lessFlag && !equalFlag {
-					return false, nil
-				}
-				break
-			case "==":
-				if !(equalFlag) {
-					return false, nil
-				}
-				break
-			case ">":
-				if lessFlag || equalFlag {
-					return false, nil
-				}
-			case ">=":
-				if lessFlag {
-					return false, nil
-				}
-				break
-			case "!=":
-				if equalFlag {
-					return false, nil
-				}
-				break
-		}
-	}
-
-	return true, nil
+	return checkPredicates(&schema, row, n.predicates[tableName])
 }
 
-// Insert inserts a row into the specified table, and returns nil if succeeds or an error if the table does not exist.
+// Insert inserts a row into the specified table, and returns nil if succeeds or an error if the table does not exist or
+// its rows cannot be persisted.
 func (n *Node) Insert(tableName string, row *Row) error {
 	if t, ok := n.TableMap[tableName]; ok {
 		t.Insert(row)
-		return nil
+		return t.storeError()
 	} else {
 		return errors.New("no such table")
 	}
@@ -286,12 +270,138 @@ func (n *Node) Insert(tableName string, row *Row) error {
 func (n *Node) Remove(tableName string, row *Row) error {
 	if t, ok := n.TableMap[tableName]; ok {
 		t.Remove(row)
-		return nil
+		return t.storeError()
 	} else {
 		return errors.New("no such table")
 	}
 }
 
+// RemoveRowsRPC is an RPC interface that removes the rows with the given row ids (args[1], []int) from all fragments of
+// the table named args[0], optionally stamped by the Snapshot args[2], which tells the transaction removing the rows if
+// any. Row ids that are not found are ignored. No row is removed if any of them cannot be removed by the stamp, see
+// Table.checkWrite, while a removal without a stamp drops the rows of failed writes as if they were never written. The
+// id of the request may follow as args[3], see serveOnce.
+func (n *Node) RemoveRowsRPC(args []interface{}, reply *string) {
+	n.serveOnce(getRequestId(args, 3), reply, func() {
+		n.removeRows(args, reply)
+	})
+}
+
+// removeRows is the implementation of RemoveRowsRPC
+func (n *Node) removeRows(args []interface{}, reply *string) {
+	tableName := args[0].(string)
+	rowIds := args[1].([]int)
+	stamp := Snapshot{}
+	if len(args) > 2 {
+		stamp = args[2].(Snapshot)
+	}
+	if stamp.Transaction > 0 {
+		if err := n.beginWrites(stamp); err != nil {
+			*reply = err.Error()
+			return
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.removeRowIds(tableName, rowIds, stamp); err != nil {
+		*reply = err.Error()
+	}
+}
+
+// removeRowIds removes the rows with the given row ids from the fragments of a table on the node by the stamp, see
+// RemoveRowsRPC. The caller should hold mu.
+func (n *Node) removeRowIds(tableName string, rowIds []int, stamp Snapshot) error {
+	// collect the rows before removing them, as the iterator is invalidated by removals
+	var tables []*Table
+	var removedRows [][]Row
+	for tableCount := 0; ; tableCount++ {
+		t, ok := n.TableMap[tableName + "-" + strconv.Itoa(tableCount)]
+		if !ok {
+			break
+		}
+		rows := n.lookupRowIds(t, rowIds)
+		if !stamp.isLatest() {
+			for _, row := range rows {
+				if err := t.checkWrite(getRowId(row), stamp); err != nil {
+					return err
+				}
+			}
+		}
+		tables = append(tables, t)
+		removedRows = append(removedRows, rows)
+	}
+	for i, t := range tables {
+		if stamp.Transaction > 0 && len(removedRows[i]) > 0 {
+			writes := make([]TransactionWrite, len(removedRows[i]))
+			for j, row := range removedRows[i] {
+				writes[j] = TransactionWrite{TableName: t.schema.TableName, Row: row, Removed: true}
+			}
+			if err := n.logWrites(stamp.Transaction, writes); err != nil {
+				return err
+			}
+		}
+		for j := range removedRows[i] {
+			t.removeVersion(&removedRows[i][j], stamp)
+			if err := t.storeError(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReplaceRowsRPC is an RPC interface that replaces the rows of all fragments of the table named args[0] with the given
+// rows (args[1], []Row) of the whole table, each followed by its row id and placed as InsertRPC does. It syncs the
+// replicas on the node that have missed some writes, see missWrites. The rows are those committed at the timestamp
+// args[2] (int), and the snapshots before it cannot be read from the replicas any more. The writes logged after the
+// timestamp are applied to the rows as the node catches up with the log, so the rows are refused if the node has
+// applied such a write to the table, or if they miss the writes discarded from the log before the node got them.
+func (n *Node) ReplaceRowsRPC(args []interface{}, reply *string) {
+	tableName := args[0].(string)
+	rows, _ := args[1].([]Row)
+	timestamp := 0
+	if len(args) > 2 {
+		timestamp = args[2].(int)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.writeIndexes[tableName] > timestamp || n.staleTables[tableName] > timestamp {
+		*reply = "the rows of " + tableName + " at " + strconv.Itoa(timestamp) + " are older than the replica"
+		return
+	}
+	for tableCount := 0; ; tableCount++ {
+		pTableName := tableName + "-" + strconv.Itoa(tableCount)
+		t, ok := n.TableMap[pTableName]
+		if !ok {
+			break
+		}
+		var oldRows []Row
+		for iterator := t.RowIterator(); iterator.HasNext(); {
+			oldRows = append(oldRows, *iterator.Next())
+		}
+		for i := range oldRows {
+			if err := n.Remove(pTableName, &oldRows[i]); err != nil {
+				*reply = err.Error()
+				return
+			}
+		}
+		t.clearVersions(timestamp)
+	}
+	for _, row := range rows {
+		loc := len(row) - 1
+		if err := n.insertRow(tableName, row[:loc], row[loc].(int), Snapshot{}); err != nil {
+			*reply = err.Error()
+			return
+		}
+	}
+	if _, ok := n.staleTables[tableName]; ok {
+		delete(n.staleTables, tableName)
+		if err := n.saveCatalog(); err != nil {
+			*reply = err.Error()
+		}
+	}
+}
+
 // IterateTable returns an iterator of the table through which the caller can retrieve all rows in the table in the
 // order they are inserted. It returns (iterator, nil) if the Table can be found, or (nil, err) if the Table does not
 // exist.
@@ -313,80 +423,163 @@ func (n *Node) count(tableName string) (int, error) {
 	}
 }
 
-func (n *Node) ScanTableWithRowIds(args []interface{}, datasets *[]Dataset) {
-	tableName := args[0].(string)
-	rowIds := args[1].([]int)
+// CreateIndexRPC is an RPC interface that creates an index of the kind args[2] (string) on the column args[1] (string)
+// of each fragment of the table named args[0] that holds the column, see Table.CreateIndex. The id of the request may
+// follow as args[3], as a retried request would find the column indexed, see serveOnce.
+func (n *Node) CreateIndexRPC(args []interface{}, reply *string) {
+	n.serveOnce(getRequestId(args, 3), reply, func() {
+		n.createIndex(args, reply)
+	})
+}
 
+// createIndex is the implementation of CreateIndexRPC
+func (n *Node) createIndex(args []interface{}, reply *string) {
+	tableName := args[0].(string)
+	columnName := args[1].(string)
+	kind := args[2].(string)
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	for tableCount := 0; ; tableCount++ {
-		pTableName := tableName + "-" + strconv.Itoa(tableCount)
-		if t, ok := n.TableMap[pTableName]; ok {
-			iterator := t.RowIterator()
-			loc := len(t.schema.ColumnSchemas)
-			rowsMap := make(map[int]Row)
-
-			for iterator.HasNext() {
-				curRow := *iterator.Next()
-				rowsMap[curRow[loc].(int)] = curRow
-			}
-
-			var resultRows []Row
-			for _, id := range rowIds {
-				if rowsMap[id] != nil {
-					resultRows = append(resultRows, rowsMap[id])
-				}
-			}
-			*datasets = append(*datasets, Dataset{
-				*t.schema,
-				resultRows,
-			})
-		} else {
+		t, ok := n.TableMap[tableName + "-" + strconv.Itoa(tableCount)]
+		if !ok {
 			break
 		}
+		if columnId := t.schema.getColumnId(columnName); columnId >= 0 {
+			if err := t.CreateIndex(columnId, kind); err != nil {
+				*reply = err.Error()
+				return
+			}
+		}
+	}
+	if err := n.saveCatalog(); err != nil {
+		*reply = err.Error()
+	}
+}
+
+// AggregateRPC is an RPC interface that computes the partial aggregates of the request (args[2], AggregateRequest) over
+// the rows satisfying its predicates in the fragment of the table named args[0] whose partition predicates are args[1]
+// ([]Predicate) and which holds all the columns used by the request. The rows are read from the Snapshot args[3] if it
+// is given, or the latest rows otherwise.
+func (n *Node) AggregateRPC(args []interface{}, reply *PartialAggregates) {
+	tableName := args[0].(string)
+	partitionPredicates, _ := args[1].([]Predicate)
+	request := args[2].(AggregateRequest)
+	snapshot := Snapshot{}
+	if len(args) > 3 {
+		snapshot = args[3].(Snapshot)
+	}
+	commits, err := n.resolveSnapshot(tableName, snapshot)
+	if err != nil {
+		reply.Error = err.Error()
+		return
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	t := n.getFragmentTable(tableName, partitionPredicates, request.getColumnNames())
+	if t == nil {
+		reply.Error = "no fragment of " + tableName + " on " + n.Identifier + " holds the aggregated columns"
+		return
+	}
+	a, err := newAggregator(t.schema, &request)
+	if err != nil {
+		reply.Error = err.Error()
+		return
 	}
 
+	rows, err := t.snapshotRows(t.predicateIterator(request.Predicates), snapshot, commits)
+	if err != nil {
+		reply.Error = err.Error()
+		return
+	}
+	for _, curRow := range rows {
+		ok, err := checkPredicates(t.schema, &curRow, request.Predicates)
+		if err == nil && ok {
+			err = a.add(curRow)
+		}
+		if err != nil {
+			reply.Error = err.Error()
+			return
+		}
+	}
+	reply.Groups = a.getGroups()
 }
 
-func (n *Node) ScanTableWithSchema(args []interface{}, datasets *[]Dataset) {
-	tableSchema := args[0].(TableSchema)
-	for tableCount := 0; ; tableCount++ {
-		pTableName := tableSchema.TableName + "-" + strconv.Itoa(tableCount)
-		if t, ok := n.TableMap[pTableName]; ok {
-			var resultColumns []ColumnSchema
-			var resultIds []int
-			for _, columnA := range tableSchema.ColumnSchemas {
-				for i, columnB := range t.schema.ColumnSchemas {
-					if columnA == columnB {
-						resultColumns = append(resultColumns, columnA)
-						resultIds = append(resultIds, i)
-					}
-				}
-			}
-			if len(resultIds) == 0 {
-				return
-			}
-			resultIds = append(resultIds, len(t.schema.ColumnSchemas))
+// ScanTopRPC is an RPC interface that returns the columns ColumnNames of the first Limit rows (all rows if Limit is
+// negative) satisfying the predicates of the request (args[2], SelectRequest) in its order, from the fragment of the table
+// named args[0] whose partition predicates are args[1] ([]Predicate) and which holds all the columns. Each row carries
+// the hidden row id, by which rows equal in the order are sorted. The rows are read from the Snapshot args[3] if it is
+// given, or the latest rows otherwise. An empty Dataset is replied if there is no such fragment or the snapshot cannot
+// be read.
+func (n *Node) ScanTopRPC(args []interface{}, reply *Dataset) {
+	tableName := args[0].(string)
+	partitionPredicates, _ := args[1].([]Predicate)
+	request := args[2].(SelectRequest)
+	snapshot := Snapshot{}
+	if len(args) > 3 {
+		snapshot = args[3].(Snapshot)
+	}
+	commits, err := n.resolveSnapshot(tableName, snapshot)
+	if err != nil {
+		return
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	t := n.getFragmentTable(tableName, partitionPredicates, request.ColumnNames)
+	if t == nil {
+		return
+	}
+	rows, err := t.snapshotRows(t.predicateIterator(request.Predicates), snapshot, commits)
+	if err != nil {
+		return
+	}
+	resultIds := make([]int, len(request.ColumnNames))
+	for i, columnName := range request.ColumnNames {
+		resultIds[i] = t.schema.getColumnId(columnName)
+	}
+	resultSchema := t.schema.getSubSchema(resultIds)
+	resultIds = append(resultIds, len(t.schema.ColumnSchemas))
 
-			var resultRows []Row
-			iterator := t.RowIterator()
-			for iterator.HasNext() {
-				curRow := *iterator.Next()
-				var row Row
-				for _, id := range resultIds {
-					row = append(row, curRow[id])
-				}
+	var resultRows []Row
+	for _, curRow := range rows {
+		ok, err := checkPredicates(t.schema, &curRow, request.Predicates)
+		if err != nil || !ok {
+			continue
+		}
+		row := make(Row, len(resultIds))
+		for i, id := range resultIds {
+			row[i] = curRow[id]
+		}
+		resultRows = append(resultRows, row)
+	}
 
-				resultRows = append(resultRows, row)
-			}
+	compare := getRowComparator(&resultSchema, request.OrderBy)
+	sort.Slice(resultRows, func(i, j int) bool {
+		return compare(resultRows[i], resultRows[j]) < 0
+	})
+	if request.Limit >= 0 && request.Limit < len(resultRows) {
+		resultRows = resultRows[:request.Limit]
+	}
+	*reply = Dataset{resultSchema, resultRows}
+}
 
-			*datasets = append(*datasets, Dataset{
-				TableSchema{
-					t.schema.TableName,
-					resultColumns,
-				},
-				resultRows,
-			})
-		} else {
-			break
+// getFragmentTable returns the fragment of a table whose partition predicates are the given ones and which holds all
+// the given columns, or nil if there is no such fragment. The caller should hold mu.
+func (n *Node) getFragmentTable(tableName string, partitionPredicates []Predicate, columnNames []string) *Table {
+	for tableCount := 0; ; tableCount++ {
+		pTableName := tableName + "-" + strconv.Itoa(tableCount)
+		t, ok := n.TableMap[pTableName]
+		if !ok {
+			return nil
+		}
+		if !isPredicatesSame(n.predicates[pTableName], partitionPredicates) {
+			continue
+		}
+		hasColumns := true
+		for _, columnName := range columnNames {
+			hasColumns = hasColumns && t.schema.getColumnId(columnName) >= 0
+		}
+		if hasColumns {
+			return t
 		}
 	}
 }
@@ -398,6 +591,8 @@ func (n *Node) ScanTableWithSchema(args []interface{}, datasets *[]Dataset) {
 // table through network all at once, so sending a whole table in one RPC is very impractical. One recommended way is to
 // fetch a batch of Rows a time.
 func (n *Node) ScanTable(tableName string, dataset *Dataset) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
 	for tableCount := 0; ; tableCount++ {
 		pTableName := tableName + "-" + strconv.Itoa(tableCount)
 		if t, ok := n.TableMap[pTableName]; ok {
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"../labgob"
+	"bytes"
+	"testing"
+)
+
+// rows of student whose grades are NULL are held by node2
+func setupNull(t *testing.T) {
+	setupScript(t, `
+		CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING NOT NULL, grade FLOAT)
+		PARTITION BY (NODE 0 WHERE grade <= 3.6, NODE 1 WHERE grade > 3.6, NODE 2 WHERE grade IS NULL);
+		CREATE TABLE courseRegistration (sid INT32, courseId INT32) PARTITION BY (NODE 3);
+		INSERT INTO student VALUES (0, 'John', 4.0), (1, 'Smith', NULL), (2, 'Hana', 3.0);
+		INSERT INTO student (sid, name) VALUES (3, 'Ann');
+		INSERT INTO courseRegistration VALUES (0, 0), (1, NULL), (NULL, 1)`)
+}
+
+func TestNullPredicates(t *testing.T) {
+	setupNull(t)
+
+	countBefore := []int{network.GetCount("Node0"), network.GetCount("Node1"), network.GetCount("Node2")}
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{"sid"},
+		[]Predicate{{ColumnName: "grade", Operator: "IS NULL"}}}, &results)
+	countAfter := []int{network.GetCount("Node0"), network.GetCount("Node1"), network.GetCount("Node2")}
+	if countAfter[0] != countBefore[0] || countAfter[1] != countBefore[1] || countAfter[2] != countBefore[2] + 1 {
+		t.Errorf("Select should only reach Node2, RPC counts before %v, after %v", countBefore, countAfter)
+	}
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{{Name: "sid", DataType: TypeInt32}}},
+		Rows: []Row{{1}, {3}},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, results)
+	}
+
+	// comparisons with NULL are never satisfied
+	for _, predicate := range []Predicate{
+		{ColumnName: "grade", Operator: "!=", Value: 4.0},
+		{ColumnName: "grade", Operator: "<", Value: 4.0},
+	} {
+		results = Dataset{}
+		cli.Call("Cluster.Select", []interface{}{"student", []string{"sid"}, []Predicate{predicate}}, &results)
+		expectedDataset.Rows = []Row{{2}}
+		if !datasetDuplicateChecking(expectedDataset, results) {
+			t.Errorf("Incorrect select results of %v, expected %v, actual %v", predicate, expectedDataset, results)
+		}
+	}
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{"sid"},
+		[]Predicate{{ColumnName: "grade", Operator: "==", Value: nil}}}, &results)
+	if len(results.Rows) != 0 {
+		t.Errorf("Comparing with NULL should select nothing, actual %v", results)
+	}
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "SELECT sid, grade FROM student WHERE grade IS NOT NULL AND sid >= 0", &result)
+	expectedDataset = Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "grade", DataType: TypeFloat},
+		}},
+		Rows: []Row{{0, 4.0}, {2, 3.0}},
+	}
+	if result.Error != "" || !datasetDuplicateChecking(expectedDataset, result.Dataset) {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, result)
+	}
+}
+
+func TestNotNull(t *testing.T) {
+	setupNull(t)
+
+	replyMsg := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{"student", Row{4, nil, 3.0}}, &replyMsg)
+	if replyMsg != "Fragment write error: NULL value in column name!" {
+		t.Errorf("NULL in a NOT NULL column should be rejected, reply: %s", replyMsg)
+	}
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "UPDATE student SET name = NULL WHERE sid = 0", &result)
+	if result.Error != "Update error: NULL value in column name!" {
+		t.Errorf("NULL in a NOT NULL column should be rejected, result: %v", result)
+	}
+
+	// a row whose partitioning column is NULL is rejected if no fragment accepts it
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", `CREATE TABLE course (cid INT32, title STRING)
+		PARTITION BY (NODE 0 WHERE cid < 10, NODE 1 WHERE cid >= 10);
+		INSERT INTO course VALUES (NULL, 'Database')`, &result)
+	if result.Error != "Fragment write error: no fragment accepts the row!" {
+		t.Errorf("A row belonging to no fragment should be rejected, result: %v", result)
+	}
+}
+
+func TestNullJoin(t *testing.T) {
+	setupNull(t)
+
+	// NULL keys never match
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", `SELECT student.sid, name, courseId FROM courseRegistration
+		LEFT JOIN student ON courseRegistration.sid = student.sid`, &result)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "student.sid", DataType: TypeInt32},
+			{Name: "name", DataType: TypeString},
+			{Name: "courseId", DataType: TypeInt32},
+		}},
+		Rows: []Row{{0, "John", 0}, {1, "Smith", nil}, {nil, nil, 1}},
+	}
+	if result.Error != "" || !datasetDuplicateChecking(expectedDataset, result.Dataset) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, result)
+	}
+
+	left := []Row{{nil, 0}, {1, 1}}
+	right := []Row{{nil}, {1}}
+	for _, algorithm := range []string{JoinNestedLoop, JoinHash, JoinSortMerge} {
+		leftIds, rightIds := getJoinAlgorithm(algorithm, 0, 0).join(left, right, []int{0}, []int{0})
+		if len(leftIds) != 1 || leftIds[0] != 1 || rightIds[0] != 1 {
+			t.Errorf("NULL keys should not match by %s, actual %v, %v", algorithm, leftIds, rightIds)
+		}
+	}
+}
+
+func TestNullEncoding(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	row := Row{nil, 1, nil, "a"}
+	predicates := []Predicate{{ColumnName: "a", Operator: "IS NULL"}}
+	encoder := labgob.NewEncoder(buffer)
+	if err := encoder.Encode(row); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := encoder.Encode(predicates); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var decodedRow Row
+	var decodedPredicates []Predicate
+	decoder := labgob.NewDecoder(buffer)
+	if err := decoder.Decode(&decodedRow); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decoder.Decode(&decodedPredicates); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !decodedRow.Equals(&row) || len(decodedPredicates) != 1 || decodedPredicates[0].Value != nil {
+		t.Errorf("NULLs should survive encoding, expected %v and %v, actual %v and %v", row, predicates,
+			decodedRow, decodedPredicates)
+	}
+}
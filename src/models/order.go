@@ -0,0 +1,247 @@
+package models
+
+import (
+	"../labgob"
+	"container/heap"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// placements of NULLs in an order
+const (
+	// NULLs are greater than any value, i.e., last in ascending order and first in descending order
+	NullsDefault = ""
+	NullsFirst = "FIRST"
+	NullsLast = "LAST"
+)
+
+// OrderBy sorts rows by a column in ascending order, or in descending order if Desc is set, where NULLs are placed by
+// Nulls, one of the placements above
+type OrderBy struct {
+	ColumnName string
+	Desc bool
+	Nulls string
+}
+
+// isNullsFirst checks whether NULLs come before the other values in the order
+func (o *OrderBy) isNullsFirst() bool {
+	nulls := strings.ToUpper(o.Nulls)
+	return nulls == NullsFirst || nulls == NullsDefault && o.Desc
+}
+
+// SelectRequest selects the columns ColumnNames (all columns if empty) of the rows of Table satisfying Predicates,
+// sorted by OrderBy and then by the order they were written, and keeps Limit rows after skipping the first Offset rows.
+type SelectRequest struct {
+	Table string
+	ColumnNames []string
+	Predicates []Predicate
+	OrderBy []OrderBy
+	// the number of rows to keep, all rows if negative
+	Limit int
+	Offset int
+}
+
+// SelectSorted replies the result of the request, see SelectRequest. If each row satisfying the predicates is held by
+// exactly one of the fragments chosen to be scanned, together with all the columns used by the request, each of their
+// nodes only returns its first Offset + Limit rows in the order, which are merged by the coordinator. Otherwise, e.g.,
+// if the columns are split into vertical fragments, the rows are merged by their hidden row ids and sorted by the
+// coordinator. An empty Dataset is replied if the request is invalid.
+func (c *Cluster) SelectSorted(request SelectRequest, reply *Dataset) {
+	c.syncCatalog()
+	dataSet, err := c.selectSorted(&request, c.getSnapshot(nil))
+	if err != nil {
+		return
+	}
+	*reply = dataSet
+}
+
+// selectSorted is the implementation of SelectSorted, which reads the table from the given snapshot
+func (c *Cluster) selectSorted(request *SelectRequest, snapshot Snapshot) (Dataset, error) {
+	labgob.Register(Dataset{})
+	schema, ok := c.getSchema(request.Table)
+	if !ok {
+		return Dataset{}, errors.New("no such table " + request.Table)
+	}
+	columnNames := request.ColumnNames
+	if len(columnNames) == 0 {
+		columnNames = schema.getColumnNames()
+	}
+	typedPredicates, err := getTypedPredicates(&schema, request.Predicates)
+	if err != nil {
+		return Dataset{}, err
+	}
+
+	// scan the selected columns as well as the columns used for sorting and by the predicates
+	var scanIds []int
+	isScanned := make([]bool, len(schema.ColumnSchemas))
+	usedNames := append([]string{}, columnNames...)
+	for _, order := range request.OrderBy {
+		usedNames = append(usedNames, order.ColumnName)
+	}
+	for _, p := range typedPredicates {
+		usedNames = append(usedNames, p.ColumnName)
+	}
+	for _, columnName := range usedNames {
+		columnId := schema.getColumnId(columnName)
+		if columnId < 0 {
+			return Dataset{}, errors.New("unknown column " + columnName)
+		}
+		if !isScanned[columnId] {
+			isScanned[columnId] = true
+			scanIds = append(scanIds, columnId)
+		}
+	}
+	for _, order := range request.OrderBy {
+		if nulls := strings.ToUpper(order.Nulls); nulls != NullsDefault && nulls != NullsFirst && nulls != NullsLast {
+			return Dataset{}, errors.New("unknown placement of NULLs " + order.Nulls)
+		}
+	}
+	scanSchema := schema.getSubSchema(scanIds)
+	scanNames := scanSchema.getColumnNames()
+	compare := getRowComparator(&scanSchema, request.OrderBy)
+
+	// the number of rows needed from each fragment
+	topN := -1
+	if request.Limit >= 0 {
+		topN = request.Offset + request.Limit
+	}
+	c.repairReplicas(request.Table)
+	fragments, pushed := c.getPushdownFragments(&scanSchema, typedPredicates)
+	nodeRequest := SelectRequest{
+		Table: request.Table,
+		ColumnNames: scanNames,
+		Predicates: typedPredicates,
+		OrderBy: request.OrderBy,
+		Limit: topN,
+	}
+	var sortedRows [][]Row
+	for i := 0; pushed && i < len(fragments); i++ {
+		dataSet := Dataset{}
+		// the rows are scanned from the other replicas if a node does not reply, or by a scan telling the error if the
+		// node cannot read the snapshot
+		if c.call(fragments[i].NodeId, "Node.ScanTopRPC",
+			[]interface{}{request.Table, fragments[i].Predicates, nodeRequest, snapshot}, &dataSet) != nil ||
+			dataSet.Schema.TableName == "" {
+			pushed = false
+			break
+		}
+		sortedRows = append(sortedRows, dataSet.Rows)
+	}
+	var rows []Row
+	if pushed {
+		rows = mergeSortedRows(sortedRows, compare, topN)
+	} else {
+		dataSet, err := c.scanTable(&scanSchema, typedPredicates, snapshot)
+		if err != nil {
+			return Dataset{}, err
+		}
+		rows = dataSet.Rows
+		sort.SliceStable(rows, func(i, j int) bool {
+			return compare(rows[i], rows[j]) < 0
+		})
+		if topN >= 0 && topN < len(rows) {
+			rows = rows[:topN]
+		}
+	}
+
+	if request.Offset > 0 {
+		if request.Offset > len(rows) {
+			request.Offset = len(rows)
+		}
+		rows = rows[request.Offset:]
+	}
+	dataSet := Dataset{Schema: scanSchema, Rows: rows}
+	return dataSet.getProjectedDataSet(columnNames), nil
+}
+
+// getRowComparator returns a function comparing two rows of the schema followed by their hidden row ids by the orders,
+// and then by the row ids
+func getRowComparator(schema *TableSchema, orders []OrderBy) func(a Row, b Row) int {
+	columnIds := make([]int, len(orders))
+	for i, order := range orders {
+		columnIds[i] = schema.getColumnId(order.ColumnName)
+	}
+	compareOrders := getOrderComparator(schema, columnIds, orders)
+	loc := len(schema.ColumnSchemas)
+	return func(a Row, b Row) int {
+		if cmp := compareOrders(a, b); cmp != 0 {
+			return cmp
+		}
+		return compareOrdered(a[loc].(int) < b[loc].(int), a[loc].(int) == b[loc].(int))
+	}
+}
+
+// getOrderComparator returns a function comparing two rows of the schema by the orders, where orders[i] sorts by the
+// column columnIds[i]
+func getOrderComparator(schema *TableSchema, columnIds []int, orders []OrderBy) func(a Row, b Row) int {
+	return func(a Row, b Row) int {
+		for i, columnId := range columnIds {
+			va, vb := a[columnId], b[columnId]
+			if va == nil || vb == nil {
+				if va == nil && vb == nil {
+					continue
+				}
+				return compareOrdered((va == nil) == orders[i].isNullsFirst(), false)
+			}
+			cmp := compareColumnValues(schema.ColumnSchemas[columnId].DataType, va, vb)
+			if orders[i].Desc {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp
+			}
+		}
+		return 0
+	}
+}
+
+// mergeSortedRows merges the lists of rows sorted by compare into the first n rows in the order, or all rows if n is
+// negative
+func mergeSortedRows(lists [][]Row, compare func(a Row, b Row) int, n int) []Row {
+	h := &rowHeap{compare: compare}
+	for _, rows := range lists {
+		if len(rows) > 0 {
+			h.cursors = append(h.cursors, rows)
+		}
+	}
+	heap.Init(h)
+	var merged []Row
+	for h.Len() > 0 && (n < 0 || len(merged) < n) {
+		merged = append(merged, h.cursors[0][0])
+		if h.cursors[0] = h.cursors[0][1:]; len(h.cursors[0]) == 0 {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+	return merged
+}
+
+// rowHeap is a heap of the remaining rows of sorted lists, ordered by their first rows
+type rowHeap struct {
+	cursors [][]Row
+	compare func(a Row, b Row) int
+}
+
+func (h *rowHeap) Len() int {
+	return len(h.cursors)
+}
+
+func (h *rowHeap) Less(i, j int) bool {
+	return h.compare(h.cursors[i][0], h.cursors[j][0]) < 0
+}
+
+func (h *rowHeap) Swap(i, j int) {
+	h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i]
+}
+
+func (h *rowHeap) Push(x interface{}) {
+	h.cursors = append(h.cursors, x.([]Row))
+}
+
+func (h *rowHeap) Pop() interface{} {
+	last := h.cursors[len(h.cursors) - 1]
+	h.cursors = h.cursors[:len(h.cursors) - 1]
+	return last
+}
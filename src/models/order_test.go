@@ -0,0 +1,140 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestSelectSorted(t *testing.T) {
+	setupAggregate(t)
+
+	for _, test := range []struct {
+		orders []OrderBy
+		limit int
+		offset int
+		expected []Row
+	}{
+		{[]OrderBy{{ColumnName: "grade", Desc: true, Nulls: NullsLast}, {ColumnName: "sid"}}, 2, 1,
+			[]Row{{2, "Hana"}, {1, "Smith"}}},
+		{[]OrderBy{{ColumnName: "grade", Desc: true}}, -1, 0,
+			[]Row{{4, "Ann"}, {0, "John"}, {2, "Hana"}, {1, "Smith"}, {3, "Lily"}}},
+		{[]OrderBy{{ColumnName: "age"}, {ColumnName: "grade", Nulls: NullsFirst}}, 10, 0,
+			[]Row{{2, "Hana"}, {3, "Lily"}, {0, "John"}, {4, "Ann"}, {1, "Smith"}}},
+		{[]OrderBy{{ColumnName: "grade"}}, 3, 3, []Row{{2, "Hana"}, {4, "Ann"}}},
+		{nil, 2, 0, []Row{{0, "John"}, {1, "Smith"}}},
+		{[]OrderBy{{ColumnName: "age"}}, 0, 0, nil},
+	} {
+		request := SelectRequest{
+			Table: "student",
+			ColumnNames: []string{"sid", "name"},
+			OrderBy: test.orders,
+			Limit: test.limit,
+			Offset: test.offset,
+		}
+		countBefore := []int{network.GetCount("Node0") + network.GetCount("Node1"), network.GetCount("Node2"),
+			network.GetCount("Node3")}
+		results := Dataset{}
+		cli.Call("Cluster.SelectSorted", request, &results)
+		countAfter := []int{network.GetCount("Node0") + network.GetCount("Node1"), network.GetCount("Node2"),
+			network.GetCount("Node3")}
+		for i := range countBefore {
+			if countAfter[i] != countBefore[i] + 1 {
+				t.Errorf("Each group of replicated fragments should be scanned once, RPC counts before %v, after %v",
+					countBefore, countAfter)
+				break
+			}
+		}
+
+		matched := len(results.Rows) == len(test.expected) && len(results.Schema.ColumnSchemas) == 2
+		for i := 0; matched && i < len(test.expected); i++ {
+			matched = results.Rows[i].Equals(&test.expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect results of %v, expected %v, actual %v", request, test.expected, results)
+		}
+	}
+
+	for _, invalid := range []SelectRequest{
+		{Table: "teacher", Limit: -1},
+		{Table: "student", OrderBy: []OrderBy{{ColumnName: "tid"}}, Limit: -1},
+		{Table: "student", OrderBy: []OrderBy{{ColumnName: "sid", Nulls: "MIDDLE"}}, Limit: -1},
+	} {
+		results := Dataset{}
+		cli.Call("Cluster.SelectSorted", invalid, &results)
+		if len(results.Schema.ColumnSchemas) != 0 {
+			t.Errorf("Selecting %v should fail, actual %v", invalid, results)
+		}
+	}
+}
+
+func TestScanTop(t *testing.T) {
+	setupAggregate(t)
+
+	// each node only returns its first rows in the order, together with their row ids
+	schema := c.tableSchemaMap["student"]
+	fragments, ok := c.getPushdownFragments(&schema, nil)
+	if !ok {
+		t.Fatalf("Sorting student should be pushed down")
+	}
+	request := SelectRequest{
+		Table: "student",
+		ColumnNames: []string{"grade", "sid"},
+		OrderBy: []OrderBy{{ColumnName: "grade", Desc: true}},
+		Limit: 1,
+	}
+	sids := make(map[interface{}]bool)
+	for _, fragment := range fragments {
+		results := Dataset{}
+		c.getEnd(fragment.NodeId).Call("Node.ScanTopRPC", []interface{}{"student", fragment.Predicates, request},
+			&results)
+		if len(results.Rows) != 1 || len(results.Rows[0]) != 3 {
+			t.Errorf("%s should return its first row with the row id, actual %v", fragment.NodeId, results.Rows)
+			continue
+		}
+		sids[results.Rows[0][1]] = true
+	}
+	if len(sids) != 3 || !sids[1] || !sids[0] || !sids[4] {
+		t.Errorf("Incorrect first rows of the fragments, expected sids 0, 1 and 4, actual %v", sids)
+	}
+}
+
+func TestSQLOrderBy(t *testing.T) {
+	// name and grade of the rows whose grade <= 3.6 are held by different fragments, whose rows are sorted by the
+	// coordinator
+	setupSQL(t)
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "INSERT INTO student VALUES (3, 'Lily', 22, 3.0)", &result)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	for _, test := range []struct {
+		script string
+		expected []Row
+	}{
+		{"SELECT name FROM student ORDER BY grade NULLS FIRST, name DESC LIMIT 3", []Row{{"Lily"}, {"Smith"}, {"John"}}},
+		{"SELECT name, grade FROM student WHERE sid > 0 ORDER BY grade DESC LIMIT 2 OFFSET 1",
+			[]Row{{"Smith", 3.6}, {"Lily", 3.0}}},
+		{"SELECT student.sid FROM student ORDER BY student.age DESC, sid", []Row{{1}, {0}, {3}, {2}}},
+		{`SELECT name, courseId FROM student JOIN courseRegistration ON student.sid = courseRegistration.sid
+			ORDER BY courseId DESC NULLS LAST, name LIMIT 2`, []Row{{"Hana", 2}, {"John", 1}}},
+		{`SELECT name, courseId FROM student LEFT JOIN courseRegistration ON student.sid = courseRegistration.sid
+			ORDER BY courseId DESC NULLS FIRST, name LIMIT 2 OFFSET 1`, []Row{{"Hana", 2}, {"John", 1}}},
+		{`SELECT name, courseId FROM student LEFT JOIN courseRegistration ON student.sid = courseRegistration.sid
+			ORDER BY courseId DESC NULLS LAST, name OFFSET 4`, []Row{{"Lily", nil}}},
+	} {
+		result := QueryResult{}
+		cli.Call("Cluster.ExecuteSQL", test.script, &result)
+		if result.Error != "" {
+			t.Errorf("%s failed: %s", test.script, result.Error)
+			continue
+		}
+		actual := result.Dataset.Rows
+		matched := len(actual) == len(test.expected)
+		for i := 0; matched && i < len(actual); i++ {
+			matched = actual[i].Equals(&test.expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect results of %s, expected %v, actual %v", test.script, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// student table is split horizontally on node0 and node1, and courseRegistration table is held by node2
+func setupPartition(t *testing.T) {
+	setup(t)
+
+	m := map[string]interface{}{
+		"0": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  "<=",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "name", "age", "grade",
+			},
+		},
+		"1": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  ">",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "name", "age", "grade",
+			},
+		},
+	}
+	studentTablePartitionRules, _ = json.Marshal(m)
+
+	m = map[string]interface{}{
+		"2": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"courseId": [...]map[string]interface{}{{
+					"op":  ">=",
+					"val": 0,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "courseId",
+			},
+		},
+	}
+	courseRegistrationTablePartitionRules, _ = json.Marshal(m)
+
+	buildTables(cli)
+}
+
+func TestPartitionPruningOnInsert(t *testing.T) {
+	setupPartition(t)
+
+	countBefore := []int{network.GetCount("Node0"), network.GetCount("Node1"), network.GetCount("Node2")}
+	replyMsg := ""
+	// John has a grade of 4.0, so only node1 should receive the row
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, studentRows[0]}, &replyMsg)
+	countAfter := []int{network.GetCount("Node0"), network.GetCount("Node1"), network.GetCount("Node2")}
+	if countAfter[0] != countBefore[0] || countAfter[1] != countBefore[1] + 1 || countAfter[2] != countBefore[2] {
+		t.Errorf("Insert should only reach Node1, RPC counts before %v, after %v", countBefore, countAfter)
+	}
+
+	for _, row := range studentRows[1:] {
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, row}, &replyMsg)
+	}
+	for _, row := range courseRegistrationRows {
+		cli.Call("Cluster.FragmentWrite", []interface{}{courseRegistrationTableName, row}, &replyMsg)
+	}
+	if network.GetCount("Node2") != countBefore[2] + len(courseRegistrationRows) {
+		t.Errorf("Node2 should only receive courseRegistration rows, RPC count %v", network.GetCount("Node2"))
+	}
+
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows: joinedTableContent,
+	}
+	if !compareDataset(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+}
+
+func TestPartitionPruningOnScan(t *testing.T) {
+	setupPartition(t)
+	insertData(cli)
+
+	countBefore := []int{network.GetCount("Node0"), network.GetCount("Node1"), network.GetCount("Node2")}
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{
+		studentTableName,
+		[]string{"sid", "name"},
+		[]Predicate{{ColumnName: "grade", Operator: ">", Value: 3.6}},
+	}, &results)
+	countAfter := []int{network.GetCount("Node0"), network.GetCount("Node1"), network.GetCount("Node2")}
+	if countAfter[0] != countBefore[0] || countAfter[1] != countBefore[1] + 1 || countAfter[2] != countBefore[2] {
+		t.Errorf("Select should only reach Node1, RPC counts before %v, after %v", countBefore, countAfter)
+	}
+
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "name", DataType: TypeString},
+		}},
+		Rows: []Row{
+			{0, "John"},
+			{2, "Hana"},
+		},
+	}
+	if !compareDataset(expectedDataset, results) {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, results)
+	}
+}
@@ -1,10 +1,14 @@
 package models
 
 import (
+	"bytes"
 	"errors"
 	"strconv"
+	"time"
 )
 
+// Predicate compares a column with Value by Operator, one of "<", "<=", "==", ">", ">=" and "!=", or tests whether a
+// column is NULL by "IS NULL" or "IS NOT NULL", which ignore Value.
 type Predicate struct {
 	ColumnName string
 	Operator string
@@ -14,7 +18,7 @@ type Predicate struct {
 
 func (p *Predicate) equals(other *Predicate) bool {
 	return p.ColumnName == other.ColumnName && p.Operator == other.Operator &&
-		p.DataType == other.DataType && p.Value == other.Value
+		p.DataType == other.DataType && valuesEqual(p.Value, other.Value)
 }
 
 func isPredicatesEqual(pa []Predicate, pb []Predicate) bool {
@@ -188,4 +192,297 @@ func (p *Predicate) getStringValue() (string, error) {
 	default:
 		return "", errors.New("unknown data type")
 	}
-}
\ No newline at end of file
+}
+
+func (p *Predicate) getDateValue() (time.Time, error) {
+	return toTime(p.Value, true)
+}
+
+func (p *Predicate) getTimestampValue() (time.Time, error) {
+	return toTime(p.Value, false)
+}
+
+func (p *Predicate) getDecimalValue() (Decimal, error) {
+	return toDecimal(p.Value)
+}
+
+func (p *Predicate) getBytesValue() ([]byte, error) {
+	return toBytes(p.Value)
+}
+
+// compareWith compares the given value with the value of the predicate based on the data type of the predicate.
+// It returns a negative number, zero or a positive number if the given value is less than, equal to or greater than
+// the predicate value. Booleans are not ordered, so any two different booleans are reported as "greater".
+func (p *Predicate) compareWith(value interface{}) (int, error) {
+	row := Row{value}
+	switch p.DataType {
+	case TypeInt32:
+		rowValue, err := row.getInt32Value(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getInt32Value()
+		if err != nil {
+			return 0, err
+		}
+		return compareOrdered(rowValue < pValue, rowValue == pValue), nil
+	case TypeInt64:
+		rowValue, err := row.getInt64Value(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getInt64Value()
+		if err != nil {
+			return 0, err
+		}
+		return compareOrdered(rowValue < pValue, rowValue == pValue), nil
+	case TypeFloat:
+		rowValue, err := row.getFloat32Value(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getFloat32Value()
+		if err != nil {
+			return 0, err
+		}
+		return compareOrdered(rowValue < pValue, rowValue == pValue), nil
+	case TypeDouble:
+		rowValue, err := row.getFloat64Value(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getFloat64Value()
+		if err != nil {
+			return 0, err
+		}
+		return compareOrdered(rowValue < pValue, rowValue == pValue), nil
+	case TypeBoolean:
+		rowValue, err := row.getBoolValue(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getBoolValue()
+		if err != nil {
+			return 0, err
+		}
+		return compareOrdered(false, rowValue == pValue), nil
+	case TypeString:
+		rowValue, err := row.getStringValue(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getStringValue()
+		if err != nil {
+			return 0, err
+		}
+		return compareOrdered(rowValue < pValue, rowValue == pValue), nil
+	case TypeDate:
+		rowValue, err := row.getDateValue(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getDateValue()
+		if err != nil {
+			return 0, err
+		}
+		return compareOrdered(rowValue.Before(pValue), rowValue.Equal(pValue)), nil
+	case TypeTimestamp:
+		rowValue, err := row.getTimestampValue(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getTimestampValue()
+		if err != nil {
+			return 0, err
+		}
+		return compareOrdered(rowValue.Before(pValue), rowValue.Equal(pValue)), nil
+	case TypeDecimal:
+		rowValue, err := row.getDecimalValue(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getDecimalValue()
+		if err != nil {
+			return 0, err
+		}
+		return rowValue.Cmp(pValue), nil
+	case TypeBytes:
+		rowValue, err := row.getBytesValue(0)
+		if err != nil {
+			return 0, err
+		}
+		pValue, err := p.getBytesValue()
+		if err != nil {
+			return 0, err
+		}
+		return bytes.Compare(rowValue, pValue), nil
+	default:
+		return 0, errors.New("unknown data type")
+	}
+}
+
+func compareOrdered(less bool, equal bool) int {
+	if less {
+		return -1
+	} else if equal {
+		return 0
+	}
+	return 1
+}
+
+// evaluate checks whether the given value satisfies the predicate. A comparison involving NULL (nil) is unknown rather
+// than true or false, and is not satisfied just like a false one, as predicates are only joined by AND.
+func (p *Predicate) evaluate(value interface{}) (bool, error) {
+	switch p.Operator {
+	case "IS NULL":
+		return value == nil, nil
+	case "IS NOT NULL":
+		return value != nil, nil
+	}
+	if value == nil || p.Value == nil {
+		return false, nil
+	}
+	cmp, err := p.compareWith(value)
+	if err != nil {
+		return false, err
+	}
+	switch p.Operator {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case "==":
+		return cmp == 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "!=":
+		return cmp != 0, nil
+	}
+	return true, nil
+}
+
+// isValidOperator checks whether the operator can be evaluated by a predicate
+func isValidOperator(operator string) bool {
+	switch operator {
+	case "<", "<=", "==", ">", ">=", "!=", "IS NULL", "IS NOT NULL":
+		return true
+	}
+	return false
+}
+
+// checkPredicates checks whether a row of the given schema satisfies all predicates
+func checkPredicates(schema *TableSchema, row *Row, ps []Predicate) (bool, error) {
+	for _, p := range ps {
+		columnId := schema.getColumnId(p.ColumnName)
+		if columnId < 0 || columnId >= len(*row) {
+			return false, errors.New("unknown column " + p.ColumnName)
+		}
+		ok, err := p.evaluate((*row)[columnId])
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// isPredicatesSatisfiable checks whether there may exist a row that satisfies all the given predicates. It is used to
+// prune fragments, so when in doubt (e.g., values cannot be compared), it answers true.
+func isPredicatesSatisfiable(ps []Predicate) bool {
+	columnPredicates := make(map[string][]Predicate)
+	for _, p := range ps {
+		columnPredicates[p.ColumnName] = append(columnPredicates[p.ColumnName], p)
+	}
+
+	for _, cps := range columnPredicates {
+		// a NULL satisfies nothing but IS NULL, while any other value fails IS NULL
+		isNull, isCompared := false, false
+		for _, p := range cps {
+			switch {
+			case p.Operator == "IS NULL":
+				isNull = true
+			case p.Operator == "IS NOT NULL":
+			case p.Value == nil:
+				return false
+			default:
+				isCompared = true
+			}
+		}
+		if isNull {
+			if isCompared {
+				return false
+			}
+			for _, p := range cps {
+				if p.Operator == "IS NOT NULL" {
+					return false
+				}
+			}
+			continue
+		}
+
+		// an equality fixes the value of the column, so simply test it against the others
+		fixed := false
+		for _, p := range cps {
+			if p.Operator == "==" {
+				fixed = true
+				for _, other := range cps {
+					ok, err := other.evaluate(p.Value)
+					if err == nil && !ok {
+						return false
+					}
+				}
+				break
+			}
+		}
+		if fixed {
+			continue
+		}
+
+		// otherwise the range formed by the tightest lower bound and upper bound should not be empty
+		var lower, upper *Predicate
+		for i := range cps {
+			p := &cps[i]
+			switch p.Operator {
+			case ">", ">=":
+				if lower == nil {
+					lower = p
+				} else if cmp, err := lower.compareWith(p.Value); err == nil &&
+					(cmp > 0 || cmp == 0 && p.Operator == ">") {
+					lower = p
+				}
+			case "<", "<=":
+				if upper == nil {
+					upper = p
+				} else if cmp, err := upper.compareWith(p.Value); err == nil &&
+					(cmp < 0 || cmp == 0 && p.Operator == "<") {
+					upper = p
+				}
+			}
+		}
+		if lower == nil || upper == nil {
+			continue
+		}
+		cmp, err := upper.compareWith(lower.Value)
+		if err != nil {
+			continue
+		}
+		if cmp > 0 {
+			return false
+		}
+		if cmp == 0 {
+			if lower.Operator == ">" || upper.Operator == "<" {
+				return false
+			}
+			for _, p := range cps {
+				if ok, err := p.evaluate(lower.Value); err == nil && !ok {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
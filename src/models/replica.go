@@ -0,0 +1,346 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// DefaultWriteQuorum is the number of replicas of a fragment that must acknowledge a write by default
+const DefaultWriteQuorum = 1
+
+// The nodes listed by a partition rule, e.g., "0|1", hold replicas of the same fragment, where the first one is the
+// primary. Reads prefer the primary and fail over to the next live replica if a node does not reply. The rows written
+// outside transactions are logged in the catalog replicated among the nodes, from which every replica applies them,
+// see replicated_catalog.go, and a write succeeds once a quorum of the replicas of each fragment acknowledges that they
+// have applied it, see SetWriteQuorum. A replica that does not acknowledge a write, e.g., because its node does not
+// reply to the coordinator, still applies it as its node catches up with the log. A replica is stale if its node has
+// missed some writes discarded from the log by a snapshot of the catalog, see Node.missWrites: it is marked in the
+// catalog and not read by any coordinator until it is synced with the other replicas before a later operation on the
+// table. The writes of a transaction are sent to every replica directly instead, see writeRow.
+
+// isRelevant checks whether the fragment contains at least one of the given columns (any column if nil) and its
+// partition predicates do not contradict the given predicates
+func (f *Fragment) isRelevant(columnNames []string, predicates []Predicate) bool {
+	hasColumn := columnNames == nil
+	for _, columnName := range columnNames {
+		if f.hasColumn(columnName) {
+			hasColumn = true
+			break
+		}
+	}
+	return hasColumn && isPredicatesSatisfiable(append(append([]Predicate{}, predicates...), f.Predicates...))
+}
+
+// SetWriteQuorum sets the number of replicas of a fragment that must acknowledge a write, which is capped by the
+// number of replicas of each fragment, and replies "Set write quorum success" or an error message.
+func (c *Cluster) SetWriteQuorum(quorum int, reply *string) {
+	if quorum < 1 {
+		*reply = "Set write quorum error: the quorum should be positive!"
+		return
+	}
+	c.mu.Lock()
+	c.writeQuorum = quorum
+	c.mu.Unlock()
+	*reply = "Set write quorum success"
+}
+
+// isStale checks whether the replicas of a table on a node have missed a write
+func (c *Cluster) isStale(tableName string, nodeId string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.staleReplicas[tableName][nodeId]
+}
+
+// markStale excludes the replicas of a table on a node from reads once the node replies that they are stale, until they
+// are synced, see repairReplicas. The replicas are marked in the catalog, so that the other coordinators do not read
+// them either. A coordinator that misses the mark still finds the replicas stale by the replies of their node.
+func (c *Cluster) markStale(tableName string, nodeId string) {
+	c.proposeCatalog(CatalogCommand{Kind: CatalogMarkStale, TableName: tableName, NodeId: nodeId})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.staleReplicas[tableName] == nil {
+		c.staleReplicas[tableName] = make(map[string]bool)
+	}
+	c.staleReplicas[tableName][nodeId] = true
+}
+
+// scanReplicas scans each fragment of a table relevant to the request from one of its replicas that is not stale,
+// trying the primary first and failing over to the next replica if a node does not reply. A node holding several
+// fragments scans all of them at once. The rows are handed to handle batch by batch, see scanNode. A node failing in
+// the middle of its scan may have handed some rows, which are handed again by the next replica, so handle should
+// replace the rows of the same row ids, e.g., by a fragmentMerger. It returns an error if no replica of a fragment can
+// be read.
+func (c *Cluster) scanReplicas(request *ScanRequest, columnNames []string, handle func(Dataset)) error {
+	tableName := request.Schema.TableName
+	scanned := make(map[string]bool)
+	failed := make(map[string]bool)
+	for _, fragment := range c.getFragments(tableName) {
+		if !fragment.isRelevant(columnNames, request.Predicates) {
+			continue
+		}
+		covered := false
+		for _, nodeId := range fragment.Replicas {
+			covered = covered || scanned[nodeId]
+		}
+		for i := 0; !covered && i < len(fragment.Replicas); i++ {
+			nodeId := fragment.Replicas[i]
+			if failed[nodeId] || c.isStale(tableName, nodeId) {
+				continue
+			}
+			err := c.scanNode(nodeId, *request, handle)
+			// a node whose catalog lags behind the snapshot is alive and catching up with the log, so it is tried
+			// again for a while rather than failed over
+			deadline := time.Now().Add(catalogTimeout)
+			for err != nil && err.Error() == errCatalogBehind && time.Now().Before(deadline) {
+				time.Sleep(catalogRetryInterval)
+				err = c.scanNode(nodeId, *request, handle)
+			}
+			if err != nil {
+				if err.Error() == errStaleReplica {
+					c.markStale(tableName, nodeId)
+				}
+				failed[nodeId] = true
+				continue
+			}
+			scanned[nodeId] = true
+			covered = true
+		}
+		if !covered {
+			return errors.New("no live replica of fragment " + strconv.Itoa(fragment.FragmentId) + " of " + tableName)
+		}
+	}
+	return nil
+}
+
+// checkQuorum checks that a write of a table has been acknowledged by a quorum of the replicas of each of the given
+// fragments, where acked tells the nodes that acknowledged it
+func (c *Cluster) checkQuorum(tableName string, fragments []Fragment, acked map[string]bool) error {
+	for _, fragment := range fragments {
+		count := 0
+		for _, nodeId := range fragment.Replicas {
+			if acked[nodeId] {
+				count++
+			}
+		}
+		c.mu.RLock()
+		quorum := c.writeQuorum
+		c.mu.RUnlock()
+		if quorum > len(fragment.Replicas) {
+			quorum = len(fragment.Replicas)
+		}
+		if count < quorum {
+			return errors.New("only " + strconv.Itoa(count) + " of " + strconv.Itoa(quorum) + " replicas of fragment " +
+				strconv.Itoa(fragment.FragmentId) + " of " + tableName + " acknowledged the write")
+		}
+	}
+	return nil
+}
+
+// logWrites writes rows outside transactions by a CatalogWriteRows command, whose index is the commit timestamp of the
+// writes, and waits for the replicas of the given fragments of each table to apply them. It fails with the error of
+// applying the writes replied by a node, e.g., a write conflict, or if a quorum of the replicas of any of the fragments
+// does not acknowledge the writes, see checkQuorum. The writes of a failed command may be applied by the nodes anyway,
+// so a failed insert should be dropped, see dropRows.
+func (c *Cluster) logWrites(writes []TableWrite, fragments map[string][]Fragment) error {
+	reply, err := c.proposeCatalog(CatalogCommand{Kind: CatalogWriteRows, Writes: writes})
+	if err != nil {
+		return err
+	}
+	for _, write := range writes {
+		// nodeId -> whether the node has applied the writes
+		acked := make(map[string]bool)
+		for _, fragment := range fragments[write.TableName] {
+			if _, ok := acked[fragment.NodeId]; ok {
+				continue
+			}
+			applied := ""
+			args := []interface{}{write.TableName, reply.Index}
+			err := c.call(fragment.NodeId, "Node.WaitWriteRPC", args, &applied)
+			// a node catching up with the log is waited for a while like a scan, see scanReplicas
+			deadline := time.Now().Add(catalogTimeout)
+			for err == nil && applied == errCatalogBehind && time.Now().Before(deadline) {
+				time.Sleep(catalogRetryInterval)
+				applied = ""
+				err = c.call(fragment.NodeId, "Node.WaitWriteRPC", args, &applied)
+			}
+			if err != nil {
+				acked[fragment.NodeId] = false
+				continue
+			}
+			if applied == errStaleReplica {
+				c.markStale(write.TableName, fragment.NodeId)
+			} else if applied != "" && applied != errCatalogBehind {
+				return errors.New(applied)
+			}
+			acked[fragment.NodeId] = applied == ""
+		}
+		if err := c.checkQuorum(write.TableName, fragments[write.TableName], acked); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropRows drops the rows of a failed insert by a CatalogDropRows command, after which they are never read, as the
+// rows may have been applied by some replicas, or be committed later if the command writing them is not known to be
+// committed. The command is retried in the background until it is committed.
+func (c *Cluster) dropRows(tableName string, rowIds []int) {
+	command := CatalogCommand{Kind: CatalogDropRows, Writes: []TableWrite{{TableName: tableName, RowIds: rowIds}}}
+	if _, err := c.proposeCatalog(command); err == nil {
+		return
+	}
+	go func() {
+		for {
+			if _, err := c.proposeCatalog(command); err == nil {
+				return
+			}
+		}
+	}()
+}
+
+// repairReplicas syncs each stale replica of a table with the other replicas by replacing its rows with those committed
+// at the last command of the catalog known to the coordinator, which are read from the other replicas, after which the
+// older snapshots cannot be read from the synced replica. The replicas that cannot be repaired, e.g., because their
+// nodes are down, are left for the next operation on the table, and the synced ones are marked in the catalog.
+func (c *Cluster) repairReplicas(tableName string) {
+	for _, nodeId := range c.nodeIds {
+		if !c.isStale(tableName, nodeId) {
+			continue
+		}
+		schema, _ := c.getSchema(tableName)
+		snapshot := c.getSnapshot(nil)
+		merger := newFragmentMerger(&schema)
+		if c.scanReplicas(&ScanRequest{Schema: schema, Snapshot: snapshot}, nil, merger.add) != nil {
+			return
+		}
+		dataSet := merger.result()
+		reply := ""
+		args := []interface{}{tableName, dataSet.Rows, snapshot.Timestamp}
+		if c.call(nodeId, "Node.ReplaceRowsRPC", args, &reply) != nil || reply != "" {
+			continue
+		}
+		command := CatalogCommand{Kind: CatalogMarkSynced, TableName: tableName, NodeId: nodeId}
+		if _, err := c.proposeCatalog(command); err == nil {
+			c.mu.Lock()
+			delete(c.staleReplicas[tableName], nodeId)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// errStaleReplica is replied by a node whose replicas of a table have missed some writes, see Node.missWrites
+const errStaleReplica = "the replica has missed some writes"
+
+// applyWrites applies the writes of a command committed to the catalog at the given index to the fragments on the
+// node, which are stamped with the index, see mvcc.go, while a CatalogDropRows command removes the rows as if they had
+// never been written. The commands after the snapshot of the catalog are applied again when a persistent node
+// restarts, so a row that the node holds already is not inserted again. The error of applying the writes, e.g., a
+// write conflict with a pending transaction, is kept for the coordinator, see WaitWriteRPC.
+func (n *Node) applyWrites(command *CatalogCommand, index int) {
+	stamp := Snapshot{Timestamp: index}
+	if command.Kind == CatalogDropRows {
+		stamp = Snapshot{}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, write := range command.Writes {
+		n.writeIndexes[write.TableName] = index
+		if err := n.applyWrite(&write, stamp); err != nil {
+			n.writeErrors[index] = err.Error()
+			// only the errors of the recent commands are kept, as the coordinator waits for them at once
+			for oldIndex := range n.writeErrors {
+				if oldIndex <= index - servedRequestLimit {
+					delete(n.writeErrors, oldIndex)
+				}
+			}
+			return
+		}
+	}
+}
+
+// applyWrite applies a write of a command to the fragments of its table on the node, the caller should hold mu
+func (n *Node) applyWrite(write *TableWrite, stamp Snapshot) error {
+	if err := n.removeRowIds(write.TableName, write.RowIds, stamp); err != nil {
+		return err
+	}
+	for _, row := range write.Rows {
+		loc := len(row) - 1
+		rowId := row[loc].(int)
+		if n.hasRow(write.TableName, rowId) {
+			continue
+		}
+		if err := n.insertRow(write.TableName, row[:loc], rowId, stamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasRow checks whether any fragment of a table on the node holds the row of the given row id, the caller should hold
+// mu
+func (n *Node) hasRow(tableName string, rowId int) bool {
+	for tableCount := 0; ; tableCount++ {
+		t, ok := n.TableMap[tableName + "-" + strconv.Itoa(tableCount)]
+		if !ok {
+			return false
+		}
+		if len(n.lookupRowIds(t, []int{rowId})) > 0 {
+			return true
+		}
+	}
+}
+
+// missWrites marks the fragments of the given tables on the node stale once the replica of the catalog installs a
+// snapshot of the given index sent by the leader, as the writes to the tables logged before the snapshot that the node
+// has not applied are discarded from the log. A stale replica of a table serves no read and acknowledges no write until
+// it is synced with the rows at the index or later, see Cluster.repairReplicas.
+func (n *Node) missWrites(tableNames []string, index int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	missed := false
+	for pTableName := range n.TableMap {
+		tableName := n.SchemaMap[pTableName].TableName
+		for _, name := range tableNames {
+			if name == tableName {
+				n.staleTables[tableName] = index
+				missed = true
+			}
+		}
+	}
+	if missed {
+		n.saveCatalog()
+	}
+}
+
+// isStale checks whether the replicas of a table on the node have missed some writes, see missWrites
+func (n *Node) isStale(tableName string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	_, ok := n.staleTables[tableName]
+	return ok
+}
+
+// WaitWriteRPC is an RPC interface that waits until the node has applied the writes logged by the command of the
+// catalog at the index args[1] (int), and replies the error of applying them to the fragments of the table named args[0]
+// if any. It also replies an error if the node does not catch up, see CatalogReplica.catchUp, or if the replicas of the
+// table on the node are stale, in which case the node does not acknowledge the writes.
+func (n *Node) WaitWriteRPC(args []interface{}, reply *string) {
+	tableName := args[0].(string)
+	index := args[1].(int)
+	if n.catalog == nil {
+		*reply = "no replica of the catalog on " + n.Identifier
+		return
+	}
+	if err := n.catalog.waitApplied(index); err != nil {
+		*reply = err.Error()
+		return
+	}
+	if n.isStale(tableName) {
+		*reply = errStaleReplica
+		return
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	*reply = n.writeErrors[index]
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+// checkQuery checks the rows returned by a query, or that it fails if expected is nil
+func checkQuery(t *testing.T, script string, expected []Row) {
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", script, &result)
+	if expected == nil {
+		if result.Error == "" {
+			t.Errorf("%s should fail, actual %v", script, result.Dataset.Rows)
+		}
+		return
+	}
+	matched := result.Error == "" && len(result.Dataset.Rows) == len(expected)
+	for i := 0; matched && i < len(expected); i++ {
+		matched = result.Dataset.Rows[i].Equals(&expected[i])
+	}
+	if !matched {
+		t.Errorf("Incorrect results of %s, expected %v, actual %v %v", script, expected, result.Error,
+			result.Dataset.Rows)
+	}
+}
+
+func TestReplicaFailover(t *testing.T) {
+	setupScript(t, `CREATE TABLE student (sid INT32, name STRING, grade FLOAT)
+		PARTITION BY (NODES 0|1 WHERE grade <= 3.6, NODES 2|1 WHERE grade > 3.6);
+		INSERT INTO student VALUES (0, 'John', 4.0), (1, 'Smith', 3.6), (2, 'Hana', 4.0), (3, 'Lily', 3.0)`)
+	fragments := []Fragment{}
+	c.ShowFragments("student", &fragments)
+	if len(fragments) != 4 || fragments[1].FragmentId != 0 || strings.Join(fragments[1].Replicas, ",") != "Node0,Node1" ||
+		fragments[2].FragmentId != 1 || strings.Join(fragments[2].Replicas, ",") != "Node2,Node1" {
+		t.Errorf("Incorrect replicas of the fragments %v", fragments)
+	}
+
+	// the reads fail over from the primaries to the other replica, including those pushed down to the nodes
+	network.DeleteServer("Node0")
+	network.DeleteServer("Node2")
+	script := "SELECT sid, name FROM student ORDER BY sid"
+	checkQuery(t, script, []Row{{0, "John"}, {1, "Smith"}, {2, "Hana"}, {3, "Lily"}})
+	checkQuery(t, "SELECT sid FROM student WHERE grade < 3.5", []Row{{3}})
+	checkQuery(t, "SELECT COUNT(*), MAX(grade) FROM student", []Row{{int64(4), 4.0}})
+
+	// a single replica acknowledges a write by default, while the replicas missing it apply it from the catalog
+	checkQuery(t, "INSERT INTO student VALUES (4, 'Ann', 3.2); DELETE FROM student WHERE sid = 3", []Row{})
+	if len(c.staleReplicas["student"]) != 0 {
+		t.Errorf("No replica should be stale, actual %v", c.staleReplicas)
+	}
+	reply := ""
+	cli.Call("Cluster.SetWriteQuorum", 2, &reply)
+	if reply != "Set write quorum success" {
+		t.Fatal(reply)
+	}
+	checkQuery(t, "INSERT INTO student VALUES (5, 'Lucy', 3.9)", nil)
+	all := []Row{{0, "John"}, {1, "Smith"}, {2, "Hana"}, {4, "Ann"}}
+	checkQuery(t, script, all)
+	cli.Call("Cluster.SetWriteQuorum", 0, &reply)
+	if reply != "Set write quorum error: the quorum should be positive!" {
+		t.Errorf("A quorum of 0 should be rejected, actual %s", reply)
+	}
+
+	// the replicas that did not acknowledge the writes hold them once their nodes are back, and serve the reads when
+	// the other replica is down
+	network.AddServer("Node0", c.GetNodeServer("Node0"))
+	network.AddServer("Node2", c.GetNodeServer("Node2"))
+	checkQuery(t, "INSERT INTO student VALUES (5, 'Lucy', 3.9)", []Row{})
+	network.DeleteServer("Node1")
+	all = append(all, Row{5, "Lucy"})
+	checkQuery(t, script, all)
+	checkQuery(t, "SELECT COUNT(*) FROM student WHERE grade <= 3.6", []Row{{int64(2)}})
+
+	// a write fails if a fragment has no live replica, and the row applied by the other fragments is dropped
+	network.DeleteServer("Node0")
+	checkQuery(t, script, nil)
+	checkQuery(t, "INSERT INTO student VALUES (6, 'Mary', 2.0)", nil)
+	network.AddServer("Node0", c.GetNodeServer("Node0"))
+	checkQuery(t, script, all)
+}
+
+func TestReplicaCoordinators(t *testing.T) {
+	defer func(size int) { catalogMaxRaftState = size }(catalogMaxRaftState)
+	catalogMaxRaftState = 2000
+	setupScript(t, `CREATE TABLE student (sid INT32, name STRING) PARTITION BY (NODES 0|1);
+		CREATE TABLE course (cid INT32) PARTITION BY (NODE 2);
+		INSERT INTO student VALUES (0, 'John')`)
+
+	// a replica missing the acknowledgement of a write to one coordinator is read by the others
+	network.DeleteServer("Node0")
+	checkQuery(t, "INSERT INTO student VALUES (1, 'Smith')", []Row{})
+	network.AddServer("Node0", c.GetNodeServer("Node0"))
+	network.Connect("ClientA", "Node2")
+	script := "SELECT sid FROM student ORDER BY sid"
+	checkQuery(t, script, []Row{{0}, {1}})
+
+	// a replica found stale by one coordinator is marked in the catalog, and synced by another coordinator
+	network.Connect("ClientA", c.Name)
+	c.CrashNode("Node0")
+	checkQuery(t, "INSERT INTO student VALUES (2, 'Hana')", []Row{})
+	for i := 0; i < 80; i++ {
+		reply := ""
+		c.FragmentWrite([]interface{}{"course", Row{i}}, &reply)
+		if reply != "Fragment write success" {
+			t.Fatal(reply)
+		}
+	}
+	c.ReviveNode("Node0")
+	checkQuery(t, "INSERT INTO student VALUES (3, 'Lily')", []Row{})
+	replica := c.catalogReplicas[getCatalogLeader(t)]
+	replica.mu.Lock()
+	marked := replica.state.StaleReplicas["student"]["Node0"]
+	replica.mu.Unlock()
+	if !marked {
+		t.Errorf("Node0 should be marked stale in the catalog, actual %v", c.staleReplicas)
+	}
+	network.Connect("ClientA", "Node3")
+	all := []Row{{0}, {1}, {2}, {3}}
+	checkQuery(t, script, all)
+	c.syncCatalog()
+	if c.isStale("student", "Node0") {
+		t.Errorf("Node0 should be synced, actual %v", c.staleReplicas)
+	}
+	network.DeleteServer("Node1")
+	checkQuery(t, script, all)
+}
+
+func TestReplicaUnreliable(t *testing.T) {
+	setupScript(t, `CREATE TABLE student (sid INT32, name STRING)
+		PARTITION BY (NODES 0|1|2 WHERE sid < 20, NODES 1|2 WHERE sid >= 20)`)
+	reply := ""
+	c.SetWriteQuorum(2, &reply)
+
+	// the writes succeed only if a quorum of replicas acknowledges them
+	network.Reliable(false)
+	var expected []Row
+	for i := 0; i < 40; i++ {
+		reply = ""
+		c.FragmentWrite([]interface{}{"student", Row{i, "name"}}, &reply)
+		if reply == "Fragment write success" {
+			expected = append(expected, Row{i})
+		}
+	}
+	network.Reliable(true)
+	if len(expected) == 0 {
+		t.Fatal("No write succeeds")
+	}
+
+	// every replica holds the successful writes and only them once the stale ones are synced
+	checkQuery(t, "SELECT sid FROM student ORDER BY sid", expected)
+	for _, nodeId := range []string{"Node0", "Node1", "Node2"} {
+		for _, otherId := range []string{"Node0", "Node1", "Node2"} {
+			if otherId != nodeId {
+				network.DeleteServer(otherId)
+			}
+		}
+		if nodeId == "Node0" {
+			checkQuery(t, "SELECT sid FROM student WHERE sid < 20 ORDER BY sid", getRowsBefore(expected, 20))
+		} else {
+			checkQuery(t, "SELECT sid FROM student ORDER BY sid", expected)
+		}
+		for _, otherId := range []string{"Node0", "Node1", "Node2"} {
+			network.AddServer(otherId, c.GetNodeServer(otherId))
+		}
+	}
+}
+
+// getRowsBefore returns the rows whose first values are less than the given one
+func getRowsBefore(rows []Row, value int) []Row {
+	var result []Row
+	for _, row := range rows {
+		if row[0].(int) < value {
+			result = append(result, row)
+		}
+	}
+	return result
+}
@@ -0,0 +1,609 @@
+package models
+
+import (
+	"../labgob"
+	"../labrpc"
+	"../raft"
+	"bytes"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The catalog of the cluster, i.e., the schemas of the tables, their fragments and indexes, and the row ids allocated
+// to their rows, is replicated among the nodes by a Raft group, so that it survives the loss of any minority of the
+// nodes. The coordinator changes the catalog by proposing a CatalogCommand to the leader of the group through
+// CatalogReplica.ProposeRPC, and updates its own copy once the command is committed. Every fragment write allocates the
+// row id of its row by a command, so that the coordinators on the nodes never reuse a row id. The log is also the write
+// log of the fragments: the rows written outside transactions are logged by CatalogWriteRows commands, which the
+// replica of the catalog on each node applies to the fragments held by the node, so the replicas of a fragment apply
+// the same writes in the same order, and a replica that misses some writes catches up with the log, see replica.go.
+// The catalog also records the stale replicas found by any coordinator, allocates the ids of the transactions and logs
+// whether each of them is committed, see transaction.go. The indexes of the commands are the timestamps of the versions of the rows, see mvcc.go.
+
+// the kinds of CatalogCommand
+const (
+	CatalogCreateTable = "CREATE TABLE"
+	CatalogCreateIndex = "CREATE INDEX"
+	CatalogAllocateRows = "ALLOCATE ROWS"
+	CatalogBeginTransaction = "BEGIN TRANSACTION"
+	CatalogDecideTransaction = "DECIDE TRANSACTION"
+	CatalogAllocateTimestamp = "ALLOCATE TIMESTAMP"
+	CatalogWriteRows = "WRITE ROWS"
+	CatalogDropRows = "DROP ROWS"
+	CatalogSync = "SYNC"
+	CatalogMarkStale = "MARK STALE"
+	CatalogMarkSynced = "MARK SYNCED"
+)
+
+// raftStateFileName is the file keeping the Raft state and the catalog snapshot of a persistent node in its directory
+const raftStateFileName = "raft"
+
+// the error replied by a node that cannot commit a command, as it is not the leader of the group
+const errWrongLeader = "not the leader of the catalog"
+
+// the error replied by a node whose catalog has not applied the commands up to a snapshot in time, see catchUp
+const errCatalogBehind = "the catalog on the node lags behind the snapshot"
+
+var (
+	// a node takes a snapshot of its catalog once its Raft state exceeds catalogMaxRaftState bytes, discarding the log
+	// before the snapshot
+	catalogMaxRaftState = 64 * 1024
+	// the time a node waits for a proposed command to be committed
+	catalogCommitTimeout = 500 * time.Millisecond
+	// the time the coordinator keeps trying the nodes to commit a command
+	catalogTimeout = 3 * time.Second
+	// the time the coordinator waits before trying the nodes again once all of them have failed
+	catalogRetryInterval = 20 * time.Millisecond
+	// the time between the checks of a node whether it has become the leader of a new term, see commitTerms
+	catalogSyncInterval = 50 * time.Millisecond
+)
+
+// CatalogCommand is a change of the catalog, which creates a table with its fragments, creates an index, allocates
+// Count row ids of a table, allocates the id of a transaction, decides whether to commit Transaction, allocates its
+// own index as a timestamp, writes rows outside transactions, drops the rows of a failed write, marks the replicas of
+// a table on NodeId stale or synced, or changes nothing but lets a new leader commit the commands of the earlier terms,
+// see ReadRPC. A command may be
+// committed twice if the coordinator retries it after its reply is lost, which the commands tolerate: a table or an
+// index is created idempotently, some row ids, transaction ids or timestamps are skipped, a transaction keeps the
+// decision committed first, and the writes are applied idempotently, see Node.applyWrites.
+type CatalogCommand struct {
+	Kind string
+	Schema TableSchema
+	Fragments []Fragment
+	Index IndexDefinition
+	TableName string
+	Count int
+	Transaction int
+	Commit bool
+	Writes []TableWrite
+	NodeId string
+}
+
+// TableWrite is the part of a CatalogWriteRows or CatalogDropRows command on a table, which removes the rows of RowIds
+// and then inserts Rows, each of which ends with its row id, e.g., an update removes the rows and inserts their new
+// values with the same row ids
+type TableWrite struct {
+	TableName string
+	RowIds []int
+	Rows []Row
+}
+
+// CatalogReply is the reply of CatalogReplica.ProposeRPC and CatalogReplica.ReadRPC, where Err is empty if the command
+// is committed or the catalog is read
+type CatalogReply struct {
+	Err string
+	// the index of the command in the log, or that of the last command applied to the catalog read
+	Index int
+	// the first of the row ids allocated by a CatalogAllocateRows command
+	FirstRowId int
+	// the id of the transaction allocated by a CatalogBeginTransaction command
+	Transaction int
+	// the commit timestamp of the transaction of a CatalogDecideTransaction command, or 0 if it is aborted, which
+	// differs from the proposed decision if another one has been committed first
+	CommitTimestamp int
+	// the catalog read by ReadRPC
+	State CatalogState
+}
+
+// CatalogState is the catalog kept by each node, which is the state machine of the Raft group
+type CatalogState struct {
+	TableSchemaMap map[string]TableSchema
+	FragmentMap map[string][]Fragment
+	IndexMap map[string][]IndexDefinition
+	// tableName -> the number of row ids allocated to the table
+	TableSize map[string]int
+	// the number of transaction ids allocated, which start from 1
+	Transactions int
+	// transactionId -> the commit timestamp of the transaction, i.e., the index of the command committing it, or 0 if
+	// the transaction is aborted
+	Decisions map[int]int
+	// tableName -> nodeId -> whether the replicas of the table on the node are stale, see replica.go
+	StaleReplicas map[string]map[string]bool
+	// tableName -> the index of the last command logging writes to the table, see Node.missWrites
+	WriteIndexes map[string]int
+}
+
+func newCatalogState() CatalogState {
+	return CatalogState{
+		TableSchemaMap: make(map[string]TableSchema),
+		FragmentMap: make(map[string][]Fragment),
+		IndexMap: make(map[string][]IndexDefinition),
+		TableSize: make(map[string]int),
+		Decisions: make(map[int]int),
+		StaleReplicas: make(map[string]map[string]bool),
+		WriteIndexes: make(map[string]int),
+	}
+}
+
+// copy returns a copy of the catalog whose maps are not shared with it, as labgob omits empty maps in an encoded
+// catalog
+func (s *CatalogState) copy() CatalogState {
+	state := newCatalogState()
+	for tableName, schema := range s.TableSchemaMap {
+		state.TableSchemaMap[tableName] = schema
+		state.FragmentMap[tableName] = s.FragmentMap[tableName]
+		state.IndexMap[tableName] = s.IndexMap[tableName]
+		state.TableSize[tableName] = s.TableSize[tableName]
+		state.WriteIndexes[tableName] = s.WriteIndexes[tableName]
+	}
+	state.Transactions = s.Transactions
+	for transactionId, timestamp := range s.Decisions {
+		state.Decisions[transactionId] = timestamp
+	}
+	for tableName, nodeIds := range s.StaleReplicas {
+		state.StaleReplicas[tableName] = make(map[string]bool)
+		for nodeId := range nodeIds {
+			state.StaleReplicas[tableName][nodeId] = true
+		}
+	}
+	return state
+}
+
+// apply applies a command committed at the given index to the catalog, and returns the first row id allocated by the
+// command, the id of the transaction it begins, or the commit timestamp of the transaction it decides
+func (s *CatalogState) apply(command *CatalogCommand, index int) int {
+	for _, write := range command.Writes {
+		s.WriteIndexes[write.TableName] = index
+	}
+	switch command.Kind {
+	case CatalogCreateTable:
+		tableName := command.Schema.TableName
+		s.TableSchemaMap[tableName] = command.Schema
+		s.FragmentMap[tableName] = command.Fragments
+		s.IndexMap[tableName] = nil
+		s.TableSize[tableName] = 0
+		delete(s.StaleReplicas, tableName)
+		delete(s.WriteIndexes, tableName)
+	case CatalogCreateIndex:
+		for _, index := range s.IndexMap[command.Index.Table] {
+			if index.Name == command.Index.Name {
+				return 0
+			}
+		}
+		s.IndexMap[command.Index.Table] = append(s.IndexMap[command.Index.Table], command.Index)
+	case CatalogAllocateRows:
+		firstRowId := s.TableSize[command.TableName]
+		s.TableSize[command.TableName] += command.Count
+		return firstRowId
+	case CatalogBeginTransaction:
+		s.Transactions++
+		return s.Transactions
+	case CatalogDecideTransaction:
+		timestamp, ok := s.Decisions[command.Transaction]
+		if !ok {
+			if command.Commit {
+				timestamp = index
+			}
+			s.Decisions[command.Transaction] = timestamp
+		}
+		return timestamp
+	case CatalogMarkStale:
+		if s.StaleReplicas[command.TableName] == nil {
+			s.StaleReplicas[command.TableName] = make(map[string]bool)
+		}
+		s.StaleReplicas[command.TableName][command.NodeId] = true
+	case CatalogMarkSynced:
+		delete(s.StaleReplicas[command.TableName], command.NodeId)
+	}
+	return 0
+}
+
+// catalogResult is the result of a command applied at an index of the log, see CatalogReplica.waiters
+type catalogResult struct {
+	term int
+	// the value returned by CatalogState.apply
+	value int
+}
+
+// CatalogReplica is the replica of the catalog on a node, which applies the commands committed by its Raft peer
+type CatalogReplica struct {
+	mu sync.Mutex
+	// the node applying the writes of the commands to its fragments
+	node *Node
+	rf *raft.Raft
+	persister *raft.Persister
+	// the Raft state size beyond which the replica takes a snapshot, catalogMaxRaftState when the replica is started
+	maxRaftState int
+	state CatalogState
+	lastApplied int
+	// the term of the last command applied
+	appliedTerm int
+	// set to 1 once the replica is stopped, see kill
+	dead int32
+	// log index -> the channel receiving the result of the command applied at the index, see ProposeCatalogRPC
+	waiters map[int]chan catalogResult
+}
+
+// startCatalog starts the replica of the catalog on the node, which restores the catalog from the snapshot kept by the
+// persister and replicates it with the given peers, where peers[me] is the node itself
+func (n *Node) startCatalog(peers []raft.Peer, me int, persister *raft.Persister) *CatalogReplica {
+	r := &CatalogReplica{
+		node: n,
+		persister: persister,
+		maxRaftState: catalogMaxRaftState,
+		state: newCatalogState(),
+		waiters: make(map[int]chan catalogResult),
+	}
+	r.restore(persister.ReadSnapshot())
+	applyCh := make(chan raft.ApplyMsg)
+	r.rf = raft.Make(peers, me, persister, applyCh)
+	n.catalog = r
+	go r.run(applyCh)
+	go r.commitTerms()
+	return r
+}
+
+// kill stops the Raft peer of the replica, e.g., before the node is restarted
+func (r *CatalogReplica) kill() {
+	atomic.StoreInt32(&r.dead, 1)
+	r.rf.Kill()
+}
+
+// commitTerms commits a CatalogSync command whenever the node becomes the leader of a new term until the replica is
+// stopped, as neither the leader nor the followers apply the commands of the earlier terms until a command of the new
+// term is committed, e.g., after the nodes are restarted, while the nodes wait for them to read the snapshots
+func (r *CatalogReplica) commitTerms() {
+	for atomic.LoadInt32(&r.dead) == 0 {
+		r.commitTerm()
+		time.Sleep(catalogSyncInterval)
+	}
+}
+
+// commitTerm commits a CatalogSync command if the node is the leader of a term in which it has applied no command
+func (r *CatalogReplica) commitTerm() error {
+	term, isLeader := r.rf.GetState()
+	r.mu.Lock()
+	appliedTerm := r.appliedTerm
+	r.mu.Unlock()
+	if !isLeader || appliedTerm >= term {
+		return nil
+	}
+	reply := CatalogReply{}
+	if r.ProposeRPC(CatalogCommand{Kind: CatalogSync}, &reply); reply.Err != "" {
+		return errors.New(reply.Err)
+	}
+	return nil
+}
+
+// run applies the commands and the snapshots sent by the Raft peer, and takes a snapshot once the Raft state grows
+// beyond maxRaftState. The writes of a command are applied to the fragments on the node before the command is
+// seen as applied, while a snapshot sent by the leader discards the writes the node has not applied, so the fragments
+// on the node are stale until they are synced if any of them is to a table on the node, see Node.missWrites.
+func (r *CatalogReplica) run(applyCh chan raft.ApplyMsg) {
+	for msg := range applyCh {
+		r.mu.Lock()
+		if msg.SnapshotValid && msg.SnapshotIndex > r.lastApplied {
+			lastApplied := r.lastApplied
+			r.restore(msg.Snapshot)
+			var tableNames []string
+			for tableName, index := range r.state.WriteIndexes {
+				if index > lastApplied {
+					tableNames = append(tableNames, tableName)
+				}
+			}
+			r.node.missWrites(tableNames, msg.SnapshotIndex)
+		} else if msg.CommandValid && msg.CommandIndex > r.lastApplied {
+			command := msg.Command.(CatalogCommand)
+			result := catalogResult{term: msg.CommandTerm, value: r.state.apply(&command, msg.CommandIndex)}
+			if len(command.Writes) > 0 {
+				r.node.applyWrites(&command, msg.CommandIndex)
+			}
+			r.lastApplied = msg.CommandIndex
+			r.appliedTerm = msg.CommandTerm
+			if waiter, ok := r.waiters[msg.CommandIndex]; ok {
+				waiter <- result
+				delete(r.waiters, msg.CommandIndex)
+			}
+			if r.persister.RaftStateSize() > r.maxRaftState {
+				r.rf.Snapshot(r.lastApplied, r.snapshot())
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *CatalogReplica) snapshot() []byte {
+	buffer := new(bytes.Buffer)
+	encoder := labgob.NewEncoder(buffer)
+	encoder.Encode(r.lastApplied)
+	encoder.Encode(r.state)
+	return buffer.Bytes()
+}
+
+func (r *CatalogReplica) restore(snapshot []byte) {
+	if len(snapshot) == 0 {
+		return
+	}
+	decoder := labgob.NewDecoder(bytes.NewBuffer(snapshot))
+	var lastApplied int
+	state := CatalogState{}
+	if decoder.Decode(&lastApplied) != nil || decoder.Decode(&state) != nil {
+		panic("cannot decode the catalog snapshot")
+	}
+	r.state = state.copy()
+	r.lastApplied = lastApplied
+}
+
+// ProposeRPC commits a CatalogCommand to the catalog if the node is the leader of the Raft group, and replies once the
+// command is applied by the node, or with an error if it is not committed within catalogCommitTimeout.
+func (r *CatalogReplica) ProposeRPC(command CatalogCommand, reply *CatalogReply) {
+	waiter := make(chan catalogResult, 1)
+	r.mu.Lock()
+	index, term, isLeader := r.rf.Start(command)
+	if !isLeader {
+		r.mu.Unlock()
+		reply.Err = errWrongLeader
+		return
+	}
+	r.waiters[index] = waiter
+	r.mu.Unlock()
+
+	select {
+	case result := <-waiter:
+		// another command is committed at the index if the node has lost its leadership
+		if result.term != term {
+			reply.Err = errWrongLeader
+			return
+		}
+		reply.Index = index
+		switch command.Kind {
+		case CatalogBeginTransaction:
+			reply.Transaction = result.value
+		case CatalogDecideTransaction:
+			reply.CommitTimestamp = result.value
+		default:
+			reply.FirstRowId = result.value
+		}
+	case <-time.After(catalogCommitTimeout):
+		r.mu.Lock()
+		delete(r.waiters, index)
+		r.mu.Unlock()
+		reply.Err = "the command is not committed in time"
+	}
+}
+
+// ReadRPC replies the index of the last command applied to the catalog if the node is the leader of the Raft group,
+// together with the catalog if the index is greater than knownIndex, i.e., the caller has missed some commands. The
+// leader applies a command before it replies to the proposer, so the catalog includes every command whose proposer
+// has got the reply, unless the node has lost its leadership without knowing it yet. A new leader does not know which
+// commands of the earlier terms are committed, nor do the followers apply them, until it commits a command of its own
+// term, so it commits a CatalogSync command before the first read of its term, see commitTerm.
+func (r *CatalogReplica) ReadRPC(knownIndex int, reply *CatalogReply) {
+	if _, isLeader := r.rf.GetState(); !isLeader {
+		reply.Err = errWrongLeader
+		return
+	}
+	if err := r.commitTerm(); err != nil {
+		reply.Err = err.Error()
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reply.Index = r.lastApplied
+	if r.lastApplied <= knownIndex {
+		return
+	}
+	// the maps are copied as the reply is encoded after the lock is released
+	reply.State = r.state.copy()
+}
+
+// catchUp waits until the replica has applied the commands up to the given index, together with their writes. The
+// replica is waited for as long as it makes progress, e.g., while it applies a long log after a restart, and it returns
+// an error once it applies no command for catalogCommitTimeout, e.g., because the node is cut off from the leader. The
+// caller should hold mu.
+func (r *CatalogReplica) catchUp(index int) error {
+	applied := r.lastApplied
+	deadline := time.Now().Add(catalogCommitTimeout)
+	for r.lastApplied < index {
+		if r.lastApplied > applied {
+			applied = r.lastApplied
+			deadline = time.Now().Add(catalogCommitTimeout)
+		}
+		if time.Now().After(deadline) || atomic.LoadInt32(&r.dead) == 1 {
+			return errors.New(errCatalogBehind)
+		}
+		r.mu.Unlock()
+		time.Sleep(catalogRetryInterval)
+		r.mu.Lock()
+	}
+	return nil
+}
+
+// waitApplied is the same as catchUp, except that the caller should not hold mu
+func (r *CatalogReplica) waitApplied(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.catchUp(index)
+}
+
+// getCommits returns the commit timestamps of the given transactions that are committed at or before the timestamp,
+// once the replica has applied the commands up to the timestamp, see catchUp
+func (r *CatalogReplica) getCommits(transactionIds []int, timestamp int) (map[int]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.catchUp(timestamp); err != nil {
+		return nil, err
+	}
+	commits := make(map[int]int)
+	for _, transactionId := range transactionIds {
+		if commitTimestamp := r.state.Decisions[transactionId]; commitTimestamp > 0 && commitTimestamp <= timestamp {
+			commits[transactionId] = commitTimestamp
+		}
+	}
+	return commits, nil
+}
+
+// getCatalogServerName returns the name of the server through which a node serves its replica of the catalog
+func getCatalogServerName(nodeId string) string {
+	return nodeId + "-catalog"
+}
+
+// startCatalogPeer starts the replica of the catalog on a node, which is served by the catalog server of the node
+// together with its Raft peer. The peers are served by the catalog servers rather than the node servers, so that they do
+// not disturb the RPC counts of the nodes. The Raft state of a persistent node is kept in its directory, so that the
+// node restarted from the directory recovers its catalog.
+func (c *Cluster) startCatalogPeer(node *Node) error {
+	persister := raft.MakePersister()
+	if node.dir != "" {
+		var err error
+		if persister, err = raft.MakeFilePersister(filepath.Join(node.dir, raftStateFileName)); err != nil {
+			return err
+		}
+	}
+	me := 0
+	peers := make([]raft.Peer, len(c.nodeIds))
+	for i, nodeId := range c.nodeIds {
+		if nodeId == node.Identifier {
+			me = i
+		}
+		peers[i] = c.getRaftEnd(node.Identifier, nodeId)
+	}
+	if replica := c.catalogReplicas[node.Identifier]; replica != nil {
+		replica.kill()
+	}
+	replica := node.startCatalog(peers, me, persister)
+	c.catalogReplicas[node.Identifier] = replica
+
+	server := labrpc.MakeServer()
+	server.AddService(labrpc.MakeService(replica))
+	server.AddService(labrpc.MakeService(replica.rf))
+	c.network.AddServer(getCatalogServerName(node.Identifier), server)
+	c.catalogServers[node.Identifier] = server
+	return nil
+}
+
+// getRaftEndName returns the name of the end through which the Raft peer of a node calls the peer of another node
+func getRaftEndName(nodeId string, otherId string) string {
+	return "Raft" + nodeId + "-" + otherId
+}
+
+// getRaftEnd returns a client (end) through which a node calls another node, the end is created on first use
+func (c *Cluster) getRaftEnd(nodeId string, otherId string) *labrpc.ClientEnd {
+	endName := getRaftEndName(nodeId, otherId)
+	end := c.network.MakeEnd(endName)
+	c.network.Connect(endName, getCatalogServerName(otherId))
+	c.network.Enable(endName, true)
+	return end
+}
+
+// connectCatalogPeer adds the catalog server of a node back to the network and enables the ends of its Raft peer, or
+// removes the server and disables the ends, after which the calls from and to the peer fail as if it crashed
+func (c *Cluster) connectCatalogPeer(nodeId string, connected bool) {
+	if connected {
+		c.network.AddServer(getCatalogServerName(nodeId), c.catalogServers[nodeId])
+	} else {
+		c.network.DeleteServer(getCatalogServerName(nodeId))
+	}
+	for _, otherId := range c.nodeIds {
+		c.network.Enable(getRaftEndName(nodeId, otherId), connected)
+	}
+}
+
+// proposeCatalog commits a command to the catalog replicated among the nodes, trying the nodes in turn from the one
+// that led the Raft group last time, and returns the reply of the leader. It returns an error if the command is not
+// committed within catalogTimeout, e.g., because a majority of the nodes are down. Such a command may still be
+// committed later, as may a command retried after its reply is lost, so the coordinator reloads the catalog from the
+// leader once it finds commands it has not seen before its own, see syncCatalog.
+func (c *Cluster) proposeCatalog(command CatalogCommand) (CatalogReply, error) {
+	deadline := time.Now().Add(catalogTimeout)
+	for tried := 0; time.Now().Before(deadline); tried++ {
+		if tried > 0 && tried % len(c.nodeIds) == 0 {
+			time.Sleep(catalogRetryInterval)
+		}
+		reply := CatalogReply{}
+		leader := c.getCatalogLeader()
+		end := c.getEnd(getCatalogServerName(c.nodeIds[leader]))
+		if end.Call("CatalogReplica.ProposeRPC", command, &reply) && reply.Err == "" {
+			c.mu.Lock()
+			known := reply.Index == c.catalogIndex + 1
+			if known {
+				c.catalogIndex = reply.Index
+			}
+			c.mu.Unlock()
+			if !known {
+				c.syncCatalog()
+			}
+			return reply, nil
+		}
+		c.nextCatalogLeader(leader)
+	}
+	return CatalogReply{}, errors.New("the catalog cannot be replicated to a majority of the nodes")
+}
+
+// syncCatalog loads the catalog from the leader of the Raft group if it has applied commands unknown to the
+// coordinator, e.g., those proposed by the coordinators on the nodes, so that a client sees the same tables through
+// any coordinator. The coordinator keeps its catalog if no leader replies, e.g., while a leader is being elected, so
+// that it can still serve the reads.
+func (c *Cluster) syncCatalog() {
+	for tried := 0; tried < len(c.nodeIds); tried++ {
+		reply := CatalogReply{}
+		leader := c.getCatalogLeader()
+		end := c.getEnd(getCatalogServerName(c.nodeIds[leader]))
+		if end.Call("CatalogReplica.ReadRPC", c.getCatalogIndex(), &reply) && reply.Err == "" {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if reply.Index > c.catalogIndex {
+				c.catalogIndex = reply.Index
+				for tableName, schema := range reply.State.TableSchemaMap {
+					c.tableSchemaMap[tableName] = schema
+					c.fragmentMap[tableName] = reply.State.FragmentMap[tableName]
+					c.indexMap[tableName] = reply.State.IndexMap[tableName]
+					c.tableSize[tableName] = reply.State.TableSize[tableName]
+					c.staleReplicas[tableName] = reply.State.StaleReplicas[tableName]
+				}
+				for transactionId, timestamp := range reply.State.Decisions {
+					c.decisions[transactionId] = timestamp
+				}
+			}
+			return
+		}
+		c.nextCatalogLeader(leader)
+	}
+}
+
+// getCatalogLeader returns the index of the node that led the Raft group of the catalog last time
+func (c *Cluster) getCatalogLeader() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.catalogLeader
+}
+
+// nextCatalogLeader moves on to the node after the given one to find the leader of the Raft group, unless another
+// request has moved on already
+func (c *Cluster) nextCatalogLeader(leader int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.catalogLeader == leader {
+		c.catalogLeader = (leader + 1) % len(c.nodeIds)
+	}
+}
+
+// getCatalogIndex returns the index of the last command of the catalog known to the coordinator
+func (c *Cluster) getCatalogIndex() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.catalogIndex
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// getCatalogLeader returns the live node leading the Raft group of the catalog, waiting for an election if needed
+func getCatalogLeader(t *testing.T) string {
+	for start := time.Now(); time.Since(start) < 3 * time.Second; time.Sleep(50 * time.Millisecond) {
+		for _, nodeId := range c.nodeIds {
+			// a crashed leader keeps its role, but its catalog server no longer replies
+			reply := CatalogReply{}
+			if _, isLeader := c.catalogReplicas[nodeId].rf.GetState(); isLeader &&
+				c.getEnd(getCatalogServerName(nodeId)).Call("CatalogReplica.ReadRPC", c.getCatalogIndex(), &reply) {
+				return nodeId
+			}
+		}
+	}
+	t.Fatal("No leader of the catalog is elected")
+	return ""
+}
+
+// checkCatalogs checks that the catalogs of the given nodes agree with the coordinator and allocate the same row ids,
+// waiting for the nodes to catch up with the leader
+func checkCatalogs(t *testing.T, nodeIds []string) {
+	var mismatched string
+	for start := time.Now(); time.Since(start) < 3 * time.Second; time.Sleep(50 * time.Millisecond) {
+		mismatched = ""
+		tableSizes := ""
+		for i, nodeId := range nodeIds {
+			replica := c.catalogReplicas[nodeId]
+			replica.mu.Lock()
+			state := replica.state
+			if i == 0 {
+				tableSizes = fmt.Sprint(state.TableSize)
+			}
+			if fmt.Sprint(state.TableSchemaMap) != fmt.Sprint(c.tableSchemaMap) ||
+				fmt.Sprint(state.FragmentMap) != fmt.Sprint(c.fragmentMap) ||
+				fmt.Sprint(state.IndexMap) != fmt.Sprint(c.indexMap) || fmt.Sprint(state.TableSize) != tableSizes {
+				mismatched = fmt.Sprintf("%s %v", nodeId, state)
+			}
+			for tableName, size := range c.tableSize {
+				if state.TableSize[tableName] < size {
+					mismatched = fmt.Sprintf("%s allocates %d row ids of %s", nodeId, state.TableSize[tableName],
+						tableName)
+				}
+			}
+			replica.mu.Unlock()
+		}
+		if mismatched == "" {
+			return
+		}
+	}
+	t.Errorf("The catalogs disagree, %s", mismatched)
+}
+
+func TestCatalogLeaderFailover(t *testing.T) {
+	setupScript(t, `CREATE TABLE student (sid INT32, name STRING)
+			PARTITION BY (NODES 1|2|3 WHERE sid < 100, NODES 2|3|4 WHERE sid >= 100);
+		CREATE INDEX studentName ON student (name);
+		INSERT INTO student VALUES (0, 'John'), (100, 'Smith'), (1, 'Hana')`)
+	checkCatalogs(t, c.nodeIds)
+
+	// the writes continue once a new leader is elected after the leader is lost
+	leader := getCatalogLeader(t)
+	c.CrashNode(leader)
+	checkQuery(t, "INSERT INTO student VALUES (2, 'Lily'), (101, 'Ann')", []Row{})
+	if newLeader := getCatalogLeader(t); newLeader == leader {
+		t.Errorf("A new leader should be elected, actual %s", newLeader)
+	}
+	script := "SELECT sid, name FROM student ORDER BY sid"
+	all := []Row{{0, "John"}, {1, "Hana"}, {2, "Lily"}, {100, "Smith"}, {101, "Ann"}}
+	checkQuery(t, script, all)
+	var live []string
+	for _, nodeId := range c.nodeIds {
+		if nodeId != leader {
+			live = append(live, nodeId)
+		}
+	}
+	checkCatalogs(t, live)
+
+	// the old leader catches up once it is back
+	c.ReviveNode(leader)
+	checkCatalogs(t, c.nodeIds)
+
+	// the catalog cannot be changed without a majority of the nodes
+	timeout := catalogTimeout
+	catalogTimeout = 500 * time.Millisecond
+	for _, nodeId := range []string{"Node0", "Node1", "Node4"} {
+		c.CrashNode(nodeId)
+	}
+	checkQuery(t, "INSERT INTO student VALUES (3, 'Mary')", nil)
+	checkQuery(t, "CREATE TABLE course (cid INT32) PARTITION BY (NODE 2)", nil)
+	checkQuery(t, script, all)
+	catalogTimeout = timeout
+	for _, nodeId := range []string{"Node0", "Node1", "Node4"} {
+		c.ReviveNode(nodeId)
+	}
+	checkQuery(t, "INSERT INTO student VALUES (3, 'Mary')", []Row{})
+	checkCatalogs(t, c.nodeIds)
+}
+
+func TestCatalogCompaction(t *testing.T) {
+	defer func(size int) { catalogMaxRaftState = size }(catalogMaxRaftState)
+	catalogMaxRaftState = 2000
+	setupScript(t, `CREATE TABLE student (sid INT32, name STRING)
+		PARTITION BY (NODES 0|1|2 WHERE sid < 100, NODES 2|3|4 WHERE sid >= 100)`)
+
+	// the log is compacted by the snapshots of the catalog, which are sent to a node lagging behind them
+	c.CrashNode("Node4")
+	var expected []Row
+	for i := 0; i < 80; i++ {
+		// a few rows go to the fragment replicated on the node
+		sid := i
+		if i % 20 == 0 {
+			sid = 100 + i
+			expected = append(expected, Row{sid})
+		}
+		reply := ""
+		c.FragmentWrite([]interface{}{"student", Row{sid, "name"}}, &reply)
+		if reply != "Fragment write success" {
+			t.Fatal(reply)
+		}
+	}
+	c.ReviveNode("Node4")
+	checkCatalogs(t, c.nodeIds)
+	if c.tableSize["student"] != 80 {
+		t.Errorf("80 row ids should be allocated, actual %d", c.tableSize["student"])
+	}
+
+	// the node has missed the writes discarded by the snapshot, so its replicas are synced once the coordinator finds
+	// them stale by a later write
+	checkQuery(t, "INSERT INTO student VALUES (200, 'name')", []Row{})
+	expected = append(expected, Row{200})
+	if !c.isStale("student", "Node4") {
+		t.Errorf("Node4 should be stale, actual %v", c.staleReplicas)
+	}
+	script := "SELECT sid FROM student WHERE sid >= 100 ORDER BY sid"
+	checkQuery(t, script, expected)
+	network.DeleteServer("Node2")
+	network.DeleteServer("Node3")
+	checkQuery(t, script, expected)
+	network.AddServer("Node2", c.GetNodeServer("Node2"))
+	network.AddServer("Node3", c.GetNodeServer("Node3"))
+	for _, nodeId := range c.nodeIds {
+		persister := c.catalogReplicas[nodeId].persister
+		if persister.RaftStateSize() > 2 * catalogMaxRaftState || persister.SnapshotSize() == 0 {
+			t.Errorf("The log of %s should be compacted, raft state %d bytes, snapshot %d bytes", nodeId,
+				persister.RaftStateSize(), persister.SnapshotSize())
+		}
+	}
+}
+
+func TestCatalogUnreliable(t *testing.T) {
+	setupScript(t, `CREATE TABLE student (sid INT32, name STRING)
+		PARTITION BY (NODES 0|1 WHERE sid < 100, NODES 2|3 WHERE sid >= 100)`)
+
+	// the row ids are allocated by the catalog while messages are lost and the leader changes
+	network.Reliable(false)
+	var expected []Row
+	leader := ""
+	for i := 0; i < 30; i++ {
+		if i == 10 {
+			leader = getCatalogLeader(t)
+			c.CrashNode(leader)
+		} else if i == 20 {
+			c.ReviveNode(leader)
+		}
+		reply := ""
+		c.FragmentWrite([]interface{}{"student", Row{i * 7 % 200, "name"}}, &reply)
+		if reply == "Fragment write success" {
+			expected = append(expected, Row{i * 7 % 200})
+		}
+	}
+	network.Reliable(true)
+	if len(expected) == 0 {
+		t.Fatal("No write succeeds")
+	}
+
+	checkQuery(t, "SELECT sid FROM student", expected)
+	checkCatalogs(t, c.nodeIds)
+}
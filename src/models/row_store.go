@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"errors"
 	"strconv"
+	"time"
 )
 
 // Row is just an array of objects
@@ -166,13 +167,29 @@ func (r *Row) getStringValue(columnId int) (string, error) {
 	}
 }
 
+func (r *Row) getDateValue(columnId int) (time.Time, error) {
+	return toTime((*r)[columnId], true)
+}
+
+func (r *Row) getTimestampValue(columnId int) (time.Time, error) {
+	return toTime((*r)[columnId], false)
+}
+
+func (r *Row) getDecimalValue(columnId int) (Decimal, error) {
+	return toDecimal((*r)[columnId])
+}
+
+func (r *Row) getBytesValue(columnId int) ([]byte, error) {
+	return toBytes((*r)[columnId])
+}
+
 // Equals compares two rows by their length and each element
 func (r *Row) Equals(another *Row) bool {
 	if len(*r) != len(*another) {
 		return false
 	}
 	for i, val := range *r {
-		if val != (*another)[i] {
+		if !valuesEqual(val, (*another)[i]) {
 			return false
 		}
 	}
@@ -184,7 +201,7 @@ func (r *Row) Equals(another *Row) bool {
 // same length.
 func (r *Row) EqualsWithColumnMapping(another *Row, columnMapping []int) bool {
 	for i, column := range *r {
-		if column != (*another)[columnMapping[i]] {
+		if !valuesEqual(column, (*another)[columnMapping[i]]) {
 			return false
 		}
 	}
@@ -203,15 +220,49 @@ type RowStore interface {
 	remove(row *Row)
 }
 
+// storages of rows that can be chosen for a table by TableSchema.Storage
+const (
+	StorageList = "LIST"
+	StorageSlice = "SLICE"
+	StorageColumnar = "COLUMNAR"
+)
+
+// checkStorage returns an error if the storage is unknown, where an empty storage means StorageList
+func checkStorage(storage string) error {
+	switch storage {
+	case "", StorageList, StorageSlice, StorageColumnar:
+		return nil
+	}
+	return errors.New("unknown storage " + storage)
+}
+
+// newRowStore creates an empty RowStore for the rows of a table by the storage of its schema
+func newRowStore(schema *TableSchema) (RowStore, error) {
+	if err := checkStorage(schema.Storage); err != nil {
+		return nil, err
+	}
+	switch schema.Storage {
+	case StorageSlice:
+		return NewSliceRowStore(), nil
+	case StorageColumnar:
+		return NewColumnarRowStore(schema), nil
+	}
+	return NewMemoryListRowStore(), nil
+}
+
 // RowIterator iterates rows in a RowStore.
 type RowIterator interface {
 	HasNext() bool
 	Next() *Row
 }
 
-// MemoryListRowStore uses a linked list to store rows in memory.
+// MemoryListRowStore uses a linked list to store rows in memory. Like SliceRowStore, removing a row leaves a tombstone
+// (nil) in its element, as an element removed from the list no longer leads to the rest, and the tombstones are dropped
+// by copying the rest rows into a new list once they take more than half of the list. Rows inserted or removed while
+// iterating may or may not be seen by the iterator, e.g., a scan cursor, see scanCursor.
 type MemoryListRowStore struct {
 	rows *list.List
+	removed int
 }
 
 func NewMemoryListRowStore() *MemoryListRowStore {
@@ -219,7 +270,7 @@ func NewMemoryListRowStore() *MemoryListRowStore {
 }
 
 func (s *MemoryListRowStore) count() int {
-	return s.rows.Len()
+	return s.rows.Len() - s.removed
 }
 
 func (s *MemoryListRowStore) iterator() RowIterator {
@@ -235,14 +286,31 @@ func (s *MemoryListRowStore) remove(row *Row) {
 	for curr != nil {
 		// find the first row that equals the argument
 		r,_ := curr.Value.(Row)
-		if r.Equals(row) {
-			s.rows.Remove(curr)
+		if r != nil && r.Equals(row) {
+			curr.Value = nil
+			s.removed++
+			if s.removed * 2 > s.rows.Len() {
+				s.compact()
+			}
 			return
 		}
 		curr = curr.Next()
 	}
 }
 
+// compact drops the tombstones, the list is not modified in place so that the iterators over it are not affected
+func (s *MemoryListRowStore) compact() {
+	rows := list.New()
+	for curr := s.rows.Front(); curr != nil; curr = curr.Next() {
+		if curr.Value != nil {
+			rows.PushBack(curr.Value)
+		}
+	}
+	s.rows = rows
+	s.removed = 0
+}
+
+// MemoryListRowIterator iterates rows in a MemoryListRowStore, skipping the tombstones
 type MemoryListRowIterator struct {
 	next *list.Element
 	rows *list.List
@@ -254,11 +322,14 @@ func NewMemoryListRowIterator(rows *list.List) RowIterator{
 }
 
 func (iter *MemoryListRowIterator) HasNext() bool {
+	for iter.next != nil && iter.next.Value == nil {
+		iter.next = iter.next.Next()
+	}
 	return iter.next != nil
 }
 
 func (iter *MemoryListRowIterator) Next() *Row {
-	if iter.next == nil {
+	if !iter.HasNext() {
 		return nil
 	} else {
 		t,_ := iter.next.Value.(Row)
@@ -267,7 +338,97 @@ func (iter *MemoryListRowIterator) Next() *Row {
 	}
 }
 
+// SliceRowStore stores rows in a slice, which is friendlier to the cache than a linked list. Removing a row leaves a
+// tombstone (nil) in its place instead of shifting the rows behind it, and the tombstones are dropped by copying the
+// rest rows into a new slice once they take more than half of the slice. Rows inserted or removed while iterating may or
+// may not be seen by the iterator.
+type SliceRowStore struct {
+	rows []Row
+	removed int
+}
 
+func NewSliceRowStore() *SliceRowStore {
+	return &SliceRowStore{}
+}
 
+func (s *SliceRowStore) count() int {
+	return len(s.rows) - s.removed
+}
 
+func (s *SliceRowStore) iterator() RowIterator {
+	return &SliceRowStoreIterator{rows: s.rows}
+}
 
+func (s *SliceRowStore) insert(row *Row) {
+	s.rows = append(s.rows, *row)
+}
+
+func (s *SliceRowStore) remove(row *Row) {
+	for i, r := range s.rows {
+		if r != nil && r.Equals(row) {
+			s.rows[i] = nil
+			s.removed++
+			if s.removed * 2 > len(s.rows) {
+				s.compact()
+			}
+			return
+		}
+	}
+}
+
+// compact drops the tombstones, the slice is not modified in place so that the iterators over it are not affected
+func (s *SliceRowStore) compact() {
+	rows := make([]Row, 0, len(s.rows) - s.removed)
+	for _, r := range s.rows {
+		if r != nil {
+			rows = append(rows, r)
+		}
+	}
+	s.rows = rows
+	s.removed = 0
+}
+
+// SliceRowStoreIterator iterates rows in a SliceRowStore, skipping the tombstones
+type SliceRowStoreIterator struct {
+	rows []Row
+	next int
+}
+
+func (iter *SliceRowStoreIterator) HasNext() bool {
+	for iter.next < len(iter.rows) && iter.rows[iter.next] == nil {
+		iter.next++
+	}
+	return iter.next < len(iter.rows)
+}
+
+func (iter *SliceRowStoreIterator) Next() *Row {
+	if !iter.HasNext() {
+		return nil
+	}
+	// the slot may become a tombstone later, so a copy of the row is returned
+	row := iter.rows[iter.next]
+	iter.next++
+	return &row
+}
+
+// RowSliceIterator iterates rows in a slice, e.g., the rows looked up by an index.
+type RowSliceIterator struct {
+	rows []Row
+	next int
+}
+
+func NewRowSliceIterator(rows []Row) RowIterator {
+	return &RowSliceIterator{rows: rows}
+}
+
+func (iter *RowSliceIterator) HasNext() bool {
+	return iter.next < len(iter.rows)
+}
+
+func (iter *RowSliceIterator) Next() *Row {
+	if iter.next >= len(iter.rows) {
+		return nil
+	}
+	iter.next++
+	return &iter.rows[iter.next - 1]
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var storeSchema = TableSchema{TableName: "record-0", ColumnSchemas: []ColumnSchema{
+	{Name: "id", DataType: TypeInt32},
+	{Name: "amount", DataType: TypeDouble},
+	{Name: "name", DataType: TypeString},
+	{Name: "paid", DataType: TypeBoolean},
+	{Name: "paidAt", DataType: TypeTimestamp},
+}}
+
+var storages = []string{StorageList, StorageSlice, StorageColumnar}
+
+func newStore(storage string) RowStore {
+	schema := storeSchema
+	schema.Storage = storage
+	store, err := newRowStore(&schema)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func iterateStore(store RowStore) []Row {
+	var rows []Row
+	for iterator := store.iterator(); iterator.HasNext(); {
+		rows = append(rows, *iterator.Next())
+	}
+	return rows
+}
+
+func TestRowStores(t *testing.T) {
+	paidAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	// values of other Go types than the data types of their columns are read back as they were, and the rows may carry
+	// hidden row ids
+	rows := []Row{
+		{0, 9.5, "John", true, paidAt, 0},
+		{int32(1), float32(2.5), "Smith", false, nil, 1},
+		{int64(2), nil, nil, nil, paidAt.Add(time.Hour), 2},
+		{3, 9.5, "John", true, paidAt, 3},
+		{"4", 1, 4.0, "yes", NewDecimal(4, 0), []byte("4")},
+		{5, 0.5, "Hana", false, paidAt},
+	}
+	for _, storage := range storages {
+		store := newStore(storage)
+		for i := range rows {
+			row := append(Row{}, rows[i]...)
+			store.insert(&row)
+		}
+		// rows of other types or lengths are not removed
+		store.remove(&Row{int32(0), 9.5, "John", true, paidAt, 0})
+		store.remove(&Row{5, 0.5, "Hana", false, paidAt, nil})
+		store.remove(&rows[1])
+		expected := []Row{rows[0], rows[2], rows[3], rows[4], rows[5]}
+		actual := iterateStore(store)
+		matched := store.count() == len(expected) && len(actual) == len(expected)
+		for i := 0; matched && i < len(expected); i++ {
+			matched = actual[i].Equals(&expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect rows of %s, expected %v, actual %d rows %v", storage, expected, store.count(), actual)
+		}
+
+		// the rows left are kept in order after the tombstones are dropped
+		iterator := store.iterator()
+		store.remove(&rows[0])
+		store.remove(&rows[4])
+		store.remove(&rows[2])
+		expected = []Row{rows[3], rows[5]}
+		actual = iterateStore(store)
+		matched = store.count() == len(expected) && len(actual) == len(expected)
+		for i := 0; matched && i < len(expected); i++ {
+			matched = actual[i].Equals(&expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect rows of %s after removal, expected %v, actual %v", storage, expected, actual)
+		}
+		// a list iterator stops at a removed row
+		if count := countRows(iterator); storage != StorageList && count < 2 {
+			t.Errorf("An iterator of %s should still see the rows left, actual %d rows", storage, count)
+		}
+		store.insert(&Row{6})
+		if count := len(iterateStore(store)); count != 3 {
+			t.Errorf("%s should hold 3 rows, actual %d", storage, count)
+		}
+	}
+
+	schema := storeSchema
+	schema.Storage = "BTREE"
+	if _, err := newRowStore(&schema); err == nil {
+		t.Errorf("An unknown storage should be rejected")
+	}
+}
+
+func TestSQLStorage(t *testing.T) {
+	setupLab3(t)
+
+	for _, storage := range storages {
+		table := "student" + storage
+		result := QueryResult{}
+		cli.Call("Cluster.ExecuteSQL", strings.ReplaceAll(`CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING, grade FLOAT)
+			PARTITION BY (NODE 0 COLUMNS (sid, name), NODE 1 COLUMNS (sid, grade)) USING ` + storage + `;
+			INSERT INTO student VALUES (0, 'John', 4.0), (1, 'Smith', 3.6), (2, 'Hana', NULL), (3, 'Lily', 3.0);
+			DELETE FROM student WHERE grade < 3.5; UPDATE student SET name = 'Ann' WHERE sid = 2;
+			SELECT name, grade FROM student ORDER BY sid`, "student", table), &result)
+		if result.Error != "" {
+			t.Errorf("Failed to query a table stored by %s: %s", storage, result.Error)
+			continue
+		}
+		expected := []Row{{"John", 4.0}, {"Smith", 3.6}, {"Ann", nil}}
+		matched := len(result.Dataset.Rows) == len(expected)
+		for i := 0; matched && i < len(expected); i++ {
+			matched = result.Dataset.Rows[i].Equals(&expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect results of %s, expected %v, actual %v", storage, expected, result.Dataset.Rows)
+		}
+		if store := c.tableSchemaMap[table].Storage; store != storage {
+			t.Errorf("%s should be stored by %s, actual %s", table, storage, store)
+		}
+	}
+
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{TableSchema{TableName: "course", Storage: "HEAP",
+		ColumnSchemas: []ColumnSchema{{Name: "cid", DataType: TypeInt32}}}, []byte(`{"0": {"column": ["cid"]}}`)}, &reply)
+	if reply != "Build table error: unknown storage HEAP!" {
+		t.Errorf("Building a table of an unknown storage should fail, actual %s", reply)
+	}
+}
+
+// benchmarkRows returns the rows of a fragment of storeSchema followed by their row ids
+func benchmarkRows(count int) []Row {
+	paidAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	rows := make([]Row, count)
+	for i := range rows {
+		rows[i] = Row{i, float64(i) / 10, "name" + strconv.Itoa(i % 100), i % 2 == 0, paidAt, i}
+	}
+	return rows
+}
+
+func BenchmarkRowStoreInsert(b *testing.B) {
+	rows := benchmarkRows(10000)
+	for _, storage := range storages {
+		b.Run(storage, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				store := newStore(storage)
+				for j := range rows {
+					store.insert(&rows[j])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRowStoreScan(b *testing.B) {
+	rows := benchmarkRows(10000)
+	for _, storage := range storages {
+		store := newStore(storage)
+		for j := range rows {
+			store.insert(&rows[j])
+		}
+		b.Run(storage, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sum := 0
+				for iterator := store.iterator(); iterator.HasNext(); {
+					sum += (*iterator.Next())[0].(int)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRowStoreRemove(b *testing.B) {
+	rows := benchmarkRows(2000)
+	for _, storage := range storages {
+		b.Run(storage, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				store := newStore(storage)
+				for j := range rows {
+					store.insert(&rows[j])
+				}
+				b.StartTimer()
+				// remove the rows from the middle, where each removal finds its row by comparing values
+				for j := len(rows) / 2; j < len(rows); j++ {
+					store.remove(&rows[j])
+				}
+				for j := 0; j < len(rows) / 2; j++ {
+					store.remove(&rows[j])
+				}
+			}
+		})
+	}
+}
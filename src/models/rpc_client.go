@@ -0,0 +1,131 @@
+package models
+
+import (
+	"../labrpc"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// The network may drop a request or its reply, e.g., after Network.Reliable(false), and then labrpc returns false
+// as if the RPC timed out, where the node may or may not have served the request. So every RPC of a coordinator to the
+// nodes goes through an rpcClient, which waits for a reply for at most rpcTimeout and retries the RPC up to
+// rpcAttempts times with an exponential backoff, and returns an error once all attempts fail, which the coordinator
+// reports to the client. A write that would not be idempotent, e.g., InsertRPC, carries a request id allocated by
+// newRequestId, by which the node serves a retried request once and replies the acknowledgement it replied before, see
+// Node.serveOnce. Scans keep no replies, as a retried fetch is told apart by the number of the batch, see FetchScanRPC.
+
+var (
+	// rpcTimeout is how long an RPC waits for the reply before it is retried
+	rpcTimeout = 3 * time.Second
+	// rpcAttempts is how many times an RPC is sent at most
+	rpcAttempts = 4
+	// rpcBackoff is how long the client waits before the first retry, which doubles for each later retry
+	rpcBackoff = 5 * time.Millisecond
+	// servedRequestLimit is how many served writes a node remembers to deduplicate the retried ones
+	servedRequestLimit = 4096
+)
+
+// rpcClient sends the RPCs of a coordinator to the nodes
+type rpcClient struct {
+	network *labrpc.Network
+	// the prefix of the request ids, which is unique among the coordinators
+	name string
+	nextRequestId int64
+}
+
+// servedRequest is a write served by a node, whose acknowledgement is kept to answer the retries of the write
+type servedRequest struct {
+	// closed once the request is served
+	done chan struct{}
+	reply string
+}
+
+// newRPCClient creates the client of the coordinator of the given name
+func newRPCClient(network *labrpc.Network, name string) *rpcClient {
+	return &rpcClient{network: network, name: name + "@" + strconv.FormatInt(time.Now().UnixNano(), 36)}
+}
+
+// getEnd returns a client (end) connected to the given node, the end is created on first use
+func (r *rpcClient) getEnd(nodeId string) *labrpc.ClientEnd {
+	endName := "InternalClient" + nodeId
+	end := r.network.MakeEnd(endName)
+	r.network.Connect(endName, nodeId)
+	r.network.Enable(endName, true)
+	return end
+}
+
+// newRequestId allocates the id of a request that the nodes serve once however many times it is sent
+func (r *rpcClient) newRequestId() string {
+	return r.name + "#" + strconv.FormatInt(atomic.AddInt64(&r.nextRequestId, 1), 10)
+}
+
+// call calls the method of a node like labrpc.ClientEnd.Call, and retries it until the node replies, which is set to
+// reply, or returns an error once the node does not reply to rpcAttempts attempts. Each attempt decodes its reply into
+// a value of its own, so that the reply of an attempt given up by the timeout never races with the caller.
+func (r *rpcClient) call(nodeId string, svcMeth string, args interface{}, reply interface{}) error {
+	replyType := reflect.TypeOf(reply).Elem()
+	backoff := rpcBackoff
+	for attempt := 1; ; attempt++ {
+		attemptReply := reflect.New(replyType)
+		replied := make(chan bool, 1)
+		go func() {
+			replied <- r.getEnd(nodeId).Call(svcMeth, args, attemptReply.Interface())
+		}()
+		ok := false
+		select {
+		case ok = <-replied:
+		case <-time.After(rpcTimeout):
+		}
+		if ok {
+			reflect.ValueOf(reply).Elem().Set(attemptReply.Elem())
+			return nil
+		}
+		if attempt >= rpcAttempts {
+			return errors.New(nodeId + " did not reply to " + svcMeth + " after " + strconv.Itoa(attempt) +
+				" attempts")
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// serveOnce serves a write of the given id by handle, which sets reply, unless the node has served it, in which case
+// reply is set to the acknowledgement of the earlier request. A retried request that arrives while the earlier one is
+// being served waits for it. Requests without ids are always served.
+func (n *Node) serveOnce(requestId string, reply *string, handle func()) {
+	if requestId == "" {
+		handle()
+		return
+	}
+	n.requestMu.Lock()
+	served, ok := n.servedRequests[requestId]
+	if !ok {
+		served = &servedRequest{done: make(chan struct{})}
+		n.servedRequests[requestId] = served
+		n.requestOrder = append(n.requestOrder, requestId)
+		if len(n.requestOrder) > servedRequestLimit {
+			delete(n.servedRequests, n.requestOrder[0])
+			n.requestOrder = n.requestOrder[1:]
+		}
+	}
+	n.requestMu.Unlock()
+	if ok {
+		<-served.done
+		*reply = served.reply
+		return
+	}
+	handle()
+	served.reply = *reply
+	close(served.done)
+}
+
+// getRequestId returns the request id carried by args[i] of an RPC, or an empty string if there is none
+func getRequestId(args []interface{}, i int) string {
+	if len(args) > i {
+		return args[i].(string)
+	}
+	return ""
+}
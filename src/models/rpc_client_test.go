@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRequestDeduplication(t *testing.T) {
+	setupScript(t, "CREATE TABLE student (sid INT32, name STRING) PARTITION BY (NODE 0)")
+
+	// a retried insert is applied once, while another request inserting the same row is applied again
+	requestId := c.client.newRequestId()
+	for i := 0; i < 3; i++ {
+		reply := ""
+		args := []interface{}{"student", Row{1, "John"}, 1000, Snapshot{}, requestId}
+		if err := c.call("Node0", "Node.InsertRPC", args, &reply); err != nil || reply != "" {
+			t.Fatalf("The insert should succeed, actual %v %s", err, reply)
+		}
+	}
+	checkQuery(t, "SELECT sid FROM student", []Row{{1}})
+	reply := ""
+	args := []interface{}{"student", Row{1, "John"}, 1001, Snapshot{}, c.client.newRequestId()}
+	if err := c.call("Node0", "Node.InsertRPC", args, &reply); err != nil || reply != "" {
+		t.Fatalf("The insert should succeed, actual %v %s", err, reply)
+	}
+	checkQuery(t, "SELECT sid FROM student", []Row{{1}, {1}})
+
+	// a node that does not reply fails the call once the retries run out
+	network.DeleteServer("Node0")
+	if err := c.call("Node0", "Node.InsertRPC", args, &reply); err == nil {
+		t.Error("The call to the deleted node should fail")
+	}
+	checkQuery(t, "INSERT INTO student VALUES (2, 'Smith')", nil)
+	checkQuery(t, "SELECT sid FROM student", nil)
+	network.AddServer("Node0", c.GetNodeServer("Node0"))
+	checkQuery(t, "SELECT sid FROM student", []Row{{1}, {1}})
+}
+
+func TestUnreliableNetwork(t *testing.T) {
+	setupScript(t, `CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING)
+			PARTITION BY (NODE 0 WHERE sid < 20, NODE 1 WHERE sid >= 20);
+		CREATE TABLE grade (sid INT32, score INT32) PARTITION BY (NODE 2)`)
+
+	// the RPCs lost by the network are retried, so the writes are neither lost nor applied twice, and the joins either
+	// fail or return all the rows
+	network.Reliable(false)
+	var students, grades []Row
+	for i := 0; i < 40; i++ {
+		result := QueryResult{}
+		c.ExecuteSQL(fmt.Sprintf("INSERT INTO student VALUES (%d, 'name')", i), &result)
+		if result.Error != "" {
+			continue
+		}
+		students = append(students, Row{i})
+		c.ExecuteSQL(fmt.Sprintf("INSERT INTO grade VALUES (%d, %d)", i, i % 5), &result)
+		if result.Error == "" {
+			grades = append(grades, Row{i, i % 5})
+		}
+	}
+	if len(grades) < 30 {
+		t.Errorf("Most writes should succeed, actual %d of 40", len(grades))
+	}
+	script := "SELECT student.sid, score FROM student JOIN grade ON student.sid = grade.sid ORDER BY student.sid"
+	failed := 0
+	for i := 0; i < 10; i++ {
+		result := QueryResult{}
+		c.ExecuteSQL(script, &result)
+		if result.Error != "" {
+			failed++
+			continue
+		}
+		matched := len(result.Dataset.Rows) == len(grades)
+		for j := 0; matched && j < len(grades); j++ {
+			matched = result.Dataset.Rows[j].Equals(&grades[j])
+		}
+		if !matched {
+			t.Errorf("%s should return all the rows %v, actual %v", script, grades, result.Dataset.Rows)
+		}
+	}
+	network.Reliable(true)
+	if failed > 5 {
+		t.Errorf("Most joins should succeed, actual %d of 10 failed", failed)
+	}
+	checkQuery(t, "SELECT sid FROM student ORDER BY sid", students)
+	checkQuery(t, script, grades)
+
+	// the reads merge the rows by their ids, which would hide a retried insert applied twice, so the node itself should
+	// hold each grade once
+	schema, _ := c.getSchema("grade")
+	var rows []Row
+	err := c.scanNode("Node2", ScanRequest{Schema: schema}, func(dataSet Dataset) {
+		rows = append(rows, dataSet.Rows...)
+	})
+	if err != nil || len(rows) != len(grades) {
+		t.Errorf("Node2 should hold %d grades, actual %v %v", len(grades), err, rows)
+	}
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// student table is split vertically on node0 and node1 for low grades and fully held by node1 and node2 for high grades
+func setupSelect(t *testing.T) {
+	setupLab3(t)
+
+	m := map[string]interface{}{
+		"0": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  "<=",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "name",
+			},
+		},
+		"1": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  "<=",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "age", "grade",
+			},
+		},
+		"1|2": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  ">",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "name", "age", "grade",
+			},
+		},
+	}
+	studentTablePartitionRules, _ = json.Marshal(m)
+
+	m = map[string]interface{}{
+		"3": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"courseId": [...]map[string]interface{}{{
+					"op":  ">=",
+					"val": 0,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "courseId",
+			},
+		},
+	}
+	courseRegistrationTablePartitionRules, _ = json.Marshal(m)
+
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+}
+
+func TestSelectWithPredicates(t *testing.T) {
+	setupSelect(t)
+
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{
+		studentTableName,
+		[]string{"sid", "name"},
+		[]Predicate{{ColumnName: "grade", Operator: ">", Value: 3.6}},
+	}, &results)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "name", DataType: TypeString},
+		}},
+		Rows: []Row{
+			{0, "John"},
+			{2, "Hana"},
+		},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, results)
+	}
+}
+
+func TestSelectAcrossVerticalFragments(t *testing.T) {
+	setupSelect(t)
+
+	// name and age of the low-grade student live on different nodes
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{
+		studentTableName,
+		[]string{"name", "age"},
+		[]Predicate{{ColumnName: "age", Operator: ">=", Value: 22}},
+	}, &results)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "name", DataType: TypeString},
+			{Name: "age", DataType: TypeInt32},
+		}},
+		Rows: []Row{
+			{"John", 22},
+			{"Smith", 23},
+		},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, results)
+	}
+
+	// all columns are returned when no column is specified
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{studentTableName, []string{}, []Predicate{}}, &results)
+	expectedDataset = Dataset{
+		Schema: *studentTableSchema,
+		Rows: studentRows,
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, results)
+	}
+
+	// malformed params are replied an empty Dataset instead of failing the coordinator
+	for _, params := range [][]interface{}{
+		{},
+		{1, []string{}, []Predicate{}},
+		{studentTableName, "name", []Predicate{}},
+		{studentTableName, []string{}, []string{"sid"}},
+	} {
+		results = Dataset{}
+		cli.Call("Cluster.Select", params, &results)
+		if len(results.Rows) != 0 || len(results.Schema.ColumnSchemas) != 0 {
+			t.Errorf("Selecting with params %v should reply an empty Dataset, actual %v", params, results)
+		}
+	}
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{studentTableName}, &results)
+	if len(results.Rows) != len(studentRows) {
+		t.Errorf("Selecting without columns and predicates should return all rows, actual %v", results)
+	}
+}
+
+func TestPredicatesSatisfiable(t *testing.T) {
+	cases := []struct {
+		predicates []Predicate
+		expected bool
+	}{
+		{[]Predicate{{"grade", "<=", TypeFloat, 3.6}, {"grade", ">", TypeFloat, 3.6}}, false},
+		{[]Predicate{{"grade", "<=", TypeFloat, 3.6}, {"grade", ">=", TypeFloat, 3.6}}, true},
+		{[]Predicate{{"grade", "<", TypeFloat, 3.6}, {"grade", "==", TypeFloat, 4.0}}, false},
+		{[]Predicate{{"grade", "<=", TypeFloat, 3.6}, {"age", ">", TypeInt32, 30}}, true},
+		{[]Predicate{{"name", "==", TypeString, "John"}, {"name", "!=", TypeString, "John"}}, false},
+		{[]Predicate{{"age", ">=", TypeInt32, 20}, {"age", "<=", TypeInt32, 20}, {"age", "!=", TypeInt32, 20}}, false},
+	}
+	for i, testCase := range cases {
+		if isPredicatesSatisfiable(testCase.predicates) != testCase.expected {
+			t.Errorf("Incorrect satisfiability of case %d, expected %v", i, testCase.expected)
+		}
+	}
+}
@@ -0,0 +1,472 @@
+package models
+
+import (
+	"../labgob"
+	"../sql"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// QueryResult is the reply of ExecuteSQL
+type QueryResult struct {
+	// the rows returned by the last statement if it is a query
+	Dataset Dataset
+	// the message of the last statement, e.g., "Build table success"
+	Message string
+	// the error of the failed statement, empty if all statements succeed
+	Error string
+	// the id of the transaction left open by the script, whose statements are sent by ExecuteTransactionSQL until it
+	// ends, 0 if no transaction is open
+	Transaction int
+}
+
+// ExecuteSQL parses a script of SQL statements separated by semicolons and executes them in order. The execution stops
+// at the first failed statement, whose error is set to reply.Error, otherwise the result of the last statement is set.
+// See package sql for the supported statements. A transaction begun by the script is rolled back if a statement of it
+// fails, and is kept open by the coordinator if the script ends before it, see ExecuteTransactionSQL.
+func (c *Cluster) ExecuteSQL(script string, reply *QueryResult) {
+	c.executeScript(script, nil, reply)
+}
+
+// ExecuteTransactionSQL executes the script params[1] (string) like ExecuteSQL within the transaction params[0] (int)
+// left open by an earlier script sent to the coordinator, see QueryResult.Transaction.
+func (c *Cluster) ExecuteTransactionSQL(params []interface{}, reply *QueryResult) {
+	transaction, ok := c.getTransaction(params[0].(int))
+	if !ok {
+		reply.Error = "Transaction error: no such transaction, it may have been rolled back!"
+		return
+	}
+	c.executeScript(params[1].(string), transaction, reply)
+}
+
+// executeScript is the implementation of ExecuteSQL, which starts within the given transaction unless it is nil
+func (c *Cluster) executeScript(script string, transaction *Transaction, reply *QueryResult) {
+	c.syncCatalog()
+	labgob.Register(Dataset{})
+	statements, err := sql.Parse(script)
+	if err != nil {
+		reply.Error = err.Error()
+		if transaction != nil {
+			reply.Transaction = transaction.Id
+		}
+		return
+	}
+	for _, statement := range statements {
+		var result QueryResult
+		switch statement.(type) {
+		case *sql.BeginStatement:
+			transaction, err = c.beginTransaction(transaction, statement.(*sql.BeginStatement).Serializable)
+			result.Message = "Begin success"
+		case *sql.CommitStatement:
+			err = c.commitTransaction(transaction)
+			transaction = nil
+			result.Message = "Commit success"
+		case *sql.RollbackStatement:
+			err = c.rollbackTransaction(transaction)
+			transaction = nil
+			result.Message = "Rollback success"
+		default:
+			result, err = c.executeStatement(statement, transaction)
+		}
+		if err != nil {
+			if transaction != nil {
+				c.rollbackTransaction(transaction)
+			}
+			*reply = QueryResult{Error: err.Error()}
+			return
+		}
+		*reply = result
+	}
+	if transaction != nil {
+		reply.Transaction = transaction.Id
+	}
+}
+
+// executeStatement compiles a statement into the methods of the cluster and executes it, where the rows are written
+// within the given transaction unless it is nil, and a query reads the snapshot of the statement, see getSnapshot. A
+// statement of a serializable transaction locks the tables it reads first, see lockStatement.
+func (c *Cluster) executeStatement(statement sql.Statement, transaction *Transaction) (QueryResult, error) {
+	if transaction != nil && transaction.serializable {
+		if err := c.lockStatement(c.getReadTables(statement), transaction); err != nil {
+			return QueryResult{}, errors.New("Lock error: " + err.Error() + "!")
+		}
+	}
+	switch statement := statement.(type) {
+	case *sql.CreateTableStatement:
+		return c.executeCreateTable(statement)
+	case *sql.CreateIndexStatement:
+		return c.executeCreateIndex(statement)
+	case *sql.InsertStatement:
+		return c.executeInsert(statement, transaction)
+	case *sql.SelectStatement:
+		return c.executeSelect(statement, c.getSnapshot(transaction))
+	case *sql.DeleteStatement:
+		return c.executeDelete(statement, transaction)
+	case *sql.UpdateStatement:
+		return c.executeUpdate(statement, transaction)
+	}
+	return QueryResult{}, errors.New("unsupported statement")
+}
+
+// getReadTables returns the tables read by a statement, i.e., the tables queried, those scanned for the rows to delete
+// or update, and those referred to by the foreign keys of the rows to insert
+func (c *Cluster) getReadTables(statement sql.Statement) []string {
+	switch statement := statement.(type) {
+	case *sql.InsertStatement:
+		schema, _ := c.getSchema(statement.Table)
+		var tableNames []string
+		for _, foreignKey := range schema.ForeignKeys {
+			tableNames = append(tableNames, foreignKey.RefTable)
+		}
+		return tableNames
+	case *sql.SelectStatement:
+		tableNames := []string{statement.Table}
+		for _, join := range statement.Joins {
+			tableNames = append(tableNames, join.Table)
+		}
+		return tableNames
+	case *sql.DeleteStatement:
+		return []string{statement.Table}
+	case *sql.UpdateStatement:
+		return []string{statement.Table}
+	}
+	return nil
+}
+
+func (c *Cluster) executeCreateTable(statement *sql.CreateTableStatement) (QueryResult, error) {
+	schema := TableSchema{
+		TableName: statement.Table,
+		PrimaryKey: statement.PrimaryKey,
+		UniqueKeys: statement.Unique,
+		Storage: statement.Storage,
+	}
+	for _, foreignKey := range statement.ForeignKeys {
+		schema.ForeignKeys = append(schema.ForeignKeys, ForeignKey{
+			Columns: foreignKey.Columns,
+			RefTable: foreignKey.RefTable,
+			RefColumns: foreignKey.RefColumns,
+			OnDelete: foreignKey.OnDelete,
+		})
+	}
+	for _, column := range statement.Columns {
+		dataType := getDataTypeByName(column.Type)
+		if dataType < 0 {
+			return QueryResult{}, errors.New("Build table error: Unknown data type " + column.Type + "!")
+		}
+		schema.ColumnSchemas = append(schema.ColumnSchemas, ColumnSchema{Name: column.Name, DataType: dataType})
+	}
+	for _, columnName := range statement.NotNull {
+		columnId := schema.getColumnId(columnName)
+		schema.ColumnSchemas[columnId].NotNull = true
+	}
+
+	partitions := statement.Partitions
+	if len(partitions) == 0 {
+		partitions = []sql.PartitionDefinition{{Nodes: []string{"0"}}}
+	}
+	var rules []PartitionRule
+	for _, partition := range partitions {
+		rule := PartitionRule{
+			NodeIds: partition.Nodes,
+			ColumnNames: partition.Columns,
+		}
+		if len(rule.ColumnNames) == 0 {
+			rule.ColumnNames = schema.getColumnNames()
+		}
+		for _, condition := range partition.Conditions {
+			rule.Predicates = append(rule.Predicates, Predicate{
+				ColumnName: condition.Column,
+				Operator: condition.Operator,
+				Value: condition.Value,
+			})
+		}
+		rules = append(rules, rule)
+	}
+
+	message := c.buildTable(schema, rules)
+	if message != "Build table success" {
+		return QueryResult{}, errors.New(message)
+	}
+	return QueryResult{Message: message}, nil
+}
+
+func (c *Cluster) executeCreateIndex(statement *sql.CreateIndexStatement) (QueryResult, error) {
+	message := ""
+	c.CreateIndex(IndexDefinition{
+		Name: statement.Name,
+		Table: statement.Table,
+		ColumnName: stripTableName(statement.Column, statement.Table),
+		Kind: statement.Kind,
+	}, &message)
+	if message != "Create index success" {
+		return QueryResult{}, errors.New(message)
+	}
+	return QueryResult{Message: message}, nil
+}
+
+func (c *Cluster) executeInsert(statement *sql.InsertStatement, transaction *Transaction) (QueryResult, error) {
+	schema, ok := c.getSchema(statement.Table)
+	if !ok {
+		return QueryResult{}, errors.New("Fragment write error: no such table!")
+	}
+	// the position of each given value in the row
+	columnIds := make([]int, len(schema.ColumnSchemas))
+	for i := range columnIds {
+		columnIds[i] = i
+	}
+	if len(statement.Columns) > 0 {
+		columnIds = columnIds[:len(statement.Columns)]
+		for i, columnName := range statement.Columns {
+			columnIds[i] = schema.getColumnId(columnName)
+			if columnIds[i] < 0 {
+				return QueryResult{}, errors.New("Fragment write error: unknown column " + columnName + "!")
+			}
+		}
+	}
+
+	for _, values := range statement.Rows {
+		if len(values) != len(columnIds) {
+			return QueryResult{}, errors.New("Fragment write error: expected " + strconv.Itoa(len(columnIds)) +
+				" values but got " + strconv.Itoa(len(values)) + "!")
+		}
+		// columns whose values are not given are NULL
+		row := make(Row, len(schema.ColumnSchemas))
+		for i, value := range values {
+			row[columnIds[i]] = value
+		}
+		if reply := c.insertRow(statement.Table, row, WriteStrict, transaction); reply != "Fragment write success" {
+			return QueryResult{}, errors.New(reply)
+		}
+	}
+	return QueryResult{Message: "Fragment write success"}, nil
+}
+
+func (c *Cluster) executeDelete(statement *sql.DeleteStatement, transaction *Transaction) (QueryResult, error) {
+	count, err := c.deleteRows(statement.Table, getConditionPredicates(statement.Where, statement.Table), transaction)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	return QueryResult{Message: formatAffectedRows("Delete success", count)}, nil
+}
+
+func (c *Cluster) executeUpdate(statement *sql.UpdateStatement, transaction *Transaction) (QueryResult, error) {
+	var assignments []Assignment
+	for _, assignment := range statement.Set {
+		assignments = append(assignments, Assignment{
+			ColumnName: stripTableName(assignment.Column, statement.Table),
+			Value: assignment.Value,
+		})
+	}
+	count, err := c.updateRows(statement.Table, assignments, getConditionPredicates(statement.Where, statement.Table),
+		transaction)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	return QueryResult{Message: formatAffectedRows("Update success", count)}, nil
+}
+
+func (c *Cluster) executeSelect(statement *sql.SelectStatement, snapshot Snapshot) (QueryResult, error) {
+	var predicates []Predicate
+	for _, condition := range statement.Where {
+		predicates = append(predicates, Predicate{
+			ColumnName: condition.Column,
+			Operator: condition.Operator,
+			Value: condition.Value,
+		})
+	}
+
+	var dataSet Dataset
+	if len(statement.Aggregates) > 0 || len(statement.GroupBy) > 0 {
+		var err error
+		if dataSet, err = c.executeAggregate(statement, predicates, snapshot); err != nil {
+			return QueryResult{}, err
+		}
+	} else if len(statement.Joins) == 0 {
+		// a single table query is pushed down, and each node only returns its first rows in the order
+		request := SelectRequest{Table: statement.Table, Predicates: predicates, Limit: statement.Limit}
+		for _, reference := range statement.Columns {
+			request.ColumnNames = append(request.ColumnNames, stripTableName(reference, statement.Table))
+		}
+		for i := range predicates {
+			predicates[i].ColumnName = stripTableName(predicates[i].ColumnName, statement.Table)
+		}
+		for _, order := range statement.OrderBy {
+			request.OrderBy = append(request.OrderBy, OrderBy{
+				ColumnName: stripTableName(order.Column, statement.Table),
+				Desc: order.Desc,
+				Nulls: order.Nulls,
+			})
+		}
+		if statement.Offset > 0 {
+			request.Offset = statement.Offset
+		}
+		var err error
+		if dataSet, err = c.selectSorted(&request, snapshot); err != nil {
+			return QueryResult{}, err
+		}
+		statement.OrderBy, statement.Limit, statement.Offset = nil, -1, -1
+	} else {
+		var err error
+		if dataSet, err = c.selectJoined(statement, predicates, snapshot); err != nil {
+			return QueryResult{}, err
+		}
+	}
+
+	if len(statement.OrderBy) > 0 {
+		var columnIds []int
+		var orders []OrderBy
+		for _, order := range statement.OrderBy {
+			columnId := dataSet.Schema.resolveColumn(order.Column)
+			if columnId < 0 {
+				return QueryResult{}, errors.New("unknown column " + order.Column)
+			}
+			columnIds = append(columnIds, columnId)
+			orders = append(orders, OrderBy{ColumnName: order.Column, Desc: order.Desc, Nulls: order.Nulls})
+		}
+		dataSet.sortByOrders(columnIds, orders)
+	}
+	if statement.Offset > 0 {
+		if statement.Offset > len(dataSet.Rows) {
+			statement.Offset = len(dataSet.Rows)
+		}
+		dataSet.Rows = dataSet.Rows[statement.Offset:]
+	}
+	if statement.Limit >= 0 && statement.Limit < len(dataSet.Rows) {
+		dataSet.Rows = dataSet.Rows[:statement.Limit]
+	}
+
+	if len(statement.Columns) > 0 {
+		var columnNames []string
+		for _, reference := range statement.Columns {
+			columnId := dataSet.Schema.resolveColumn(reference)
+			if columnId < 0 {
+				return QueryResult{}, errors.New("unknown column " + reference)
+			}
+			columnNames = append(columnNames, dataSet.Schema.ColumnSchemas[columnId].Name)
+		}
+		dataSet = dataSet.getProjectedDataSet(columnNames)
+	}
+	return QueryResult{Dataset: dataSet}, nil
+}
+
+// selectJoined joins the tables of the statement read from the snapshot, and keeps the rows satisfying the predicates
+func (c *Cluster) selectJoined(statement *sql.SelectStatement, predicates []Predicate,
+	snapshot Snapshot) (Dataset, error) {
+	request := JoinRequest{Table: statement.Table}
+	for _, join := range statement.Joins {
+		request.Clauses = append(request.Clauses, JoinClause{
+			Table: join.Table,
+			Type: join.Type,
+			Natural: join.Natural,
+			LeftColumns: join.LeftColumns,
+			RightColumns: join.RightColumns,
+		})
+	}
+	dataSet, err := c.joinWithConditions(&request, snapshot)
+	if err != nil {
+		return Dataset{}, err
+	}
+	return dataSet.getFilteredDataSet(predicates)
+}
+
+// executeAggregate groups the rows selected by the statement and computes the aggregates, whose result columns are
+// named as in the statement. The aggregation over a single table is pushed down by Aggregate, while the joined rows
+// are aggregated by the coordinator. The rows are read from the given snapshot.
+func (c *Cluster) executeAggregate(statement *sql.SelectStatement, predicates []Predicate,
+	snapshot Snapshot) (Dataset, error) {
+	if len(statement.Columns) == 0 {
+		return Dataset{}, errors.New("SELECT * cannot be used with GROUP BY")
+	}
+	request := AggregateRequest{Table: statement.Table, GroupBy: append([]string{}, statement.GroupBy...)}
+	isAggregate := make(map[string]bool)
+	for _, aggregate := range statement.Aggregates {
+		request.Aggregates = append(request.Aggregates, AggregateFunction{
+			Function: aggregate.Function,
+			ColumnName: aggregate.Column,
+			Alias: aggregate.Name,
+		})
+		isAggregate[aggregate.Name] = true
+	}
+	for _, condition := range statement.Having {
+		request.Having = append(request.Having, Predicate{
+			ColumnName: condition.Column,
+			Operator: condition.Operator,
+			Value: condition.Value,
+		})
+	}
+	// a selected column should be an aggregate or a grouped column
+	for _, reference := range statement.Columns {
+		grouped := isAggregate[reference]
+		for _, groupColumn := range statement.GroupBy {
+			grouped = grouped || getBaseName(groupColumn) == getBaseName(reference)
+		}
+		if !grouped {
+			return Dataset{}, errors.New("column " + reference + " must appear in GROUP BY or be used in an aggregate")
+		}
+	}
+
+	if len(statement.Joins) == 0 {
+		for i := range request.GroupBy {
+			request.GroupBy[i] = stripTableName(request.GroupBy[i], statement.Table)
+		}
+		for i := range request.Aggregates {
+			request.Aggregates[i].ColumnName = stripTableName(request.Aggregates[i].ColumnName, statement.Table)
+		}
+		for _, p := range predicates {
+			p.ColumnName = stripTableName(p.ColumnName, statement.Table)
+			request.Predicates = append(request.Predicates, p)
+		}
+		return c.aggregate(&request, snapshot)
+	}
+
+	dataSet, err := c.selectJoined(statement, predicates, snapshot)
+	if err != nil {
+		return Dataset{}, err
+	}
+	// resolve the column references, which may be qualified by table names, into the names of the joined columns
+	resolve := func(reference string) (string, error) {
+		columnId := dataSet.Schema.resolveColumn(reference)
+		if columnId < 0 {
+			return "", errors.New("unknown column " + reference)
+		}
+		return dataSet.Schema.ColumnSchemas[columnId].Name, nil
+	}
+	for i := range request.GroupBy {
+		if request.GroupBy[i], err = resolve(request.GroupBy[i]); err != nil {
+			return Dataset{}, err
+		}
+	}
+	for i := range request.Aggregates {
+		if request.Aggregates[i].ColumnName == "" {
+			continue
+		}
+		if request.Aggregates[i].ColumnName, err = resolve(request.Aggregates[i].ColumnName); err != nil {
+			return Dataset{}, err
+		}
+	}
+	return aggregateDataSet(&dataSet, &request)
+}
+
+// getBaseName removes the qualifier of a column reference, e.g., "student.sid" -> "sid"
+func getBaseName(reference string) string {
+	return reference[strings.LastIndex(reference, ".") + 1:]
+}
+
+// getConditionPredicates converts the conditions on a single table into predicates
+func getConditionPredicates(conditions []sql.Condition, tableName string) []Predicate {
+	var predicates []Predicate
+	for _, condition := range conditions {
+		predicates = append(predicates, Predicate{
+			ColumnName: stripTableName(condition.Column, tableName),
+			Operator: condition.Operator,
+			Value: condition.Value,
+		})
+	}
+	return predicates
+}
+
+// stripTableName removes the qualifier of a column reference to the given table, e.g., "student.sid" -> "sid"
+func stripTableName(reference string, tableName string) string {
+	return strings.TrimPrefix(reference, tableName + ".")
+}
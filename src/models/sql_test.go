@@ -0,0 +1,102 @@
+package models
+
+import (
+	"testing"
+)
+
+// setupScript sets up a cluster as setupLab3 does and runs the given SQL script to create and fill the tables
+func setupScript(t *testing.T, script string) {
+	setupLab3(t)
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", script, &result)
+	if result.Error != "" {
+		t.Fatalf("Failed to set up tables: %s", result.Error)
+	}
+}
+
+func setupSQL(t *testing.T) {
+	setupScript(t, `
+		CREATE TABLE student (sid INT32, name STRING, age INT32, grade FLOAT)
+		PARTITION BY (
+			NODES 0|1 COLUMNS (sid, name) WHERE grade <= 3.6,
+			NODE 2 COLUMNS (sid, age, grade) WHERE grade <= 3.6,
+			NODE 2 WHERE grade > 3.6
+		);
+		CREATE TABLE courseRegistration (sid INT32, courseId INT32) PARTITION BY (NODE 3);
+		INSERT INTO student VALUES (0, 'John', 22, 4.0), (1, 'Smith', 23, 3.6), (2, 'Hana', 21, 4.0);
+		INSERT INTO courseRegistration (courseId, sid) VALUES (0, 0), (1, 0), (0, 1), (2, 2);`)
+}
+
+func TestSQLSelect(t *testing.T) {
+	setupSQL(t)
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "SELECT name FROM student WHERE age > 21 ORDER BY grade DESC, name", &result)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{{Name: "name", DataType: TypeString}}},
+		Rows: []Row{{"John"}, {"Smith"}},
+	}
+	if !compareDataset(expectedDataset, result.Dataset) || result.Dataset.Rows[0][0] != "John" {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, result.Dataset)
+	}
+
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "SELECT sid, name FROM student ORDER BY sid DESC LIMIT 1 OFFSET 1", &result)
+	expectedDataset = Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{{Name: "sid", DataType: TypeInt32}, {Name: "name", DataType: TypeString}}},
+		Rows: []Row{{1, "Smith"}},
+	}
+	if !compareDataset(expectedDataset, result.Dataset) {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, result.Dataset)
+	}
+}
+
+func TestSQLJoin(t *testing.T) {
+	setupSQL(t)
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "SELECT * FROM student NATURAL JOIN courseRegistration", &result)
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows: joinedTableContent,
+	}
+	if !datasetDuplicateChecking(expectedDataset, result.Dataset) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, result.Dataset)
+	}
+
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", `INSERT INTO student VALUES (3, 'Lily', 20, 3.0);
+		SELECT student.name, courseId FROM student LEFT JOIN courseRegistration
+		ON student.sid = courseRegistration.sid WHERE grade < 3.8`, &result)
+	expectedDataset = Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{{Name: "name", DataType: TypeString}, {Name: "courseId", DataType: TypeInt32}}},
+		Rows: []Row{{"Smith", 0}, {"Lily", nil}},
+	}
+	if !datasetDuplicateChecking(expectedDataset, result.Dataset) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, result.Dataset)
+	}
+}
+
+func TestSQLErrors(t *testing.T) {
+	setupSQL(t)
+
+	for _, script := range []string{
+		"SELECT * FROM teacher",
+		"SELECT tid FROM student",
+		"SELECT * FROM student WHERE",
+		"INSERT INTO student VALUES (4, 'Tom')",
+		"CREATE TABLE teacher (tid UUID)",
+		"CREATE TABLE teacher (tid INT32) PARTITION BY (NODE 9)",
+		"SELECT * FROM student JOIN courseRegistration ON student.sid = courseRegistration.cid",
+	} {
+		result := QueryResult{}
+		cli.Call("Cluster.ExecuteSQL", script, &result)
+		if result.Error == "" {
+			t.Errorf("%s should fail, but got %v", script, result)
+		}
+	}
+}
@@ -1,52 +1,77 @@
-package models
-
-// Table is an in-memory two-dimensional table which consists of a table schema and a row store
-// it is not yet a relational table as it does not support primary keys or other constraints.
-type Table struct {
-	schema *TableSchema
-	rowStore RowStore
-}
-
-func NewTable(schema *TableSchema, rowStore RowStore) *Table {
-	return &Table{schema: schema, rowStore: rowStore}
-}
-
-// GetColumnCount returns the number of columns in the table.
-func (t *Table) GetColumnCount() int {
-	return len(t.schema.ColumnSchemas)
-}
-
-// GetColumnName returns the name of the ith column, or an empty string if the index is invalid.
-func (t *Table) GetColumnName(i int) string  {
-	if i < 0 || i >= len(t.schema.ColumnSchemas) {
-		return ""
-	}
-	return t.schema.ColumnSchemas[i].Name
-}
-
-// GetColumnType the return value is one in datatype.go, or -1 if the index is invalid.
-func (t *Table) GetColumnType(i int) int {
-	if i < 0 || i >= len(t.schema.ColumnSchemas) {
-		return -1
-	}
-	return t.schema.ColumnSchemas[i].DataType
-}
-
-func (t *Table) RowIterator() RowIterator {
-	return t.rowStore.iterator()
-}
-
-// Insert inserts a row into the store. The row will be copied by the store.
-func (t *Table) Insert(row *Row) {
-	t.rowStore.insert(row)
-}
-
-// Remove removes a row from the store, and does not concern whether it exists.
-func (t *Table) Remove(row *Row) {
-	t.rowStore.remove(row)
-}
-
-// Count returns how many rows are in the table.
-func (t *Table) Count() int {
-	return t.rowStore.count()
+package models
+
+import "time"
+
+// Table is an in-memory two-dimensional table which consists of a table schema and a row store
+// it does not check constraints like primary keys by itself, which are enforced by the coordinator across fragments.
+type Table struct {
+	schema *TableSchema
+	rowStore RowStore
+	// column id -> the index of the column, see CreateIndex
+	indexes map[int]*columnIndex
+	// row id -> the latest version of a row written recently, see mvcc.go
+	versions map[int]*rowVersion
+	// the snapshots before horizon cannot be read, as the versions they see have been pruned
+	horizon int
+	// the time the version chains were last pruned
+	prunedAt time.Time
+}
+
+func NewTable(schema *TableSchema, rowStore RowStore) *Table {
+	return &Table{schema: schema, rowStore: rowStore}
+}
+
+// GetColumnCount returns the number of columns in the table.
+func (t *Table) GetColumnCount() int {
+	return len(t.schema.ColumnSchemas)
+}
+
+// GetColumnName returns the name of the ith column, or an empty string if the index is invalid.
+func (t *Table) GetColumnName(i int) string  {
+	if i < 0 || i >= len(t.schema.ColumnSchemas) {
+		return ""
+	}
+	return t.schema.ColumnSchemas[i].Name
+}
+
+// GetColumnType the return value is one in datatype.go, or -1 if the index is invalid.
+func (t *Table) GetColumnType(i int) int {
+	if i < 0 || i >= len(t.schema.ColumnSchemas) {
+		return -1
+	}
+	return t.schema.ColumnSchemas[i].DataType
+}
+
+func (t *Table) RowIterator() RowIterator {
+	return t.rowStore.iterator()
+}
+
+// Insert inserts a row into the store. The row will be copied by the store.
+func (t *Table) Insert(row *Row) {
+	t.rowStore.insert(row)
+	for columnId, index := range t.indexes {
+		index.insertRow(columnId, row)
+	}
+}
+
+// Remove removes a row from the store, and does not concern whether it exists.
+func (t *Table) Remove(row *Row) {
+	t.rowStore.remove(row)
+	for columnId, index := range t.indexes {
+		index.removeRow(columnId, row)
+	}
+}
+
+// storeError returns the error of the row store if its rows are kept on the disk and cannot be persisted, see
+// DiskRowStore.Err
+func (t *Table) storeError() error {
+	if store, ok := t.rowStore.(*DiskRowStore); ok {
+		return store.Err()
+	}
+	return nil
+}
+
+// Count returns how many rows are in the table.
+func (t *Table) Count() int {
+	return t.rowStore.count()
 }
\ No newline at end of file
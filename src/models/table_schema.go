@@ -1,9 +1,20 @@
 package models
 
-// TableSchema contains the name of the table and the definition of each column
+import "strings"
+
+// TableSchema contains the name of the table and the definition of each column, as well as the keys whose values
+// should be unique across the rows of the table and the foreign keys
 type TableSchema struct {
 	TableName string
 	ColumnSchemas []ColumnSchema
+	// the names of the columns that identify a row, which cannot be NULL, no primary key if empty
+	PrimaryKey []string
+	// each group of columns whose values should be unique if none of them is NULL
+	UniqueKeys [][]string
+	// the references to the keys of other tables (or this table)
+	ForeignKeys []ForeignKey
+	// how the rows of the table are stored by nodes, e.g., StorageColumnar, StorageList if empty
+	Storage string
 }
 
 func (ts* TableSchema) equals(other *TableSchema) bool {
@@ -64,8 +75,8 @@ func (ts* TableSchema) getSubSchema(columnIds []int) TableSchema {
 		columns = append(columns, ts.ColumnSchemas[columnId])
 	}
 	return TableSchema{
-		ts.TableName,
-		columns,
+		TableName: ts.TableName,
+		ColumnSchemas: columns,
 	}
 }
 
@@ -86,7 +97,28 @@ func (ts* TableSchema) getMergeSchema(other *TableSchema) (TableSchema, []bool)
 		}
 	}
 	return TableSchema{
-		ts.TableName,
-		mergeColumns,
+		TableName: ts.TableName,
+		ColumnSchemas: mergeColumns,
+		Storage: ts.Storage,
 	}, okList
+}
+
+func (ts* TableSchema) getColumnNames() []string {
+	var columnNames []string
+	for _, columnSchema := range ts.ColumnSchemas {
+		columnNames = append(columnNames, columnSchema.Name)
+	}
+	return columnNames
+}
+
+// resolveColumn returns the id of a column referenced by its name, which may be qualified by a table name like
+// "table.column", or -1 if the column does not exist
+func (ts* TableSchema) resolveColumn(reference string) int {
+	if columnId := ts.getColumnId(reference); columnId >= 0 {
+		return columnId
+	}
+	if i := strings.LastIndex(reference, "."); i >= 0 {
+		return ts.getColumnId(reference[i + 1:])
+	}
+	return -1
 }
\ No newline at end of file
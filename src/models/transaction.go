@@ -0,0 +1,567 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// A transaction groups the writes of many statements over many tables, e.g., between BEGIN and COMMIT, so that either
+// all or none of them take effect. Its writes are sent to the nodes as they are executed, so that the later statements
+// of the transaction read them, and each node logs the writes of the transaction on it in a TransactionLog, by which
+// they are undone if the transaction rolls back. The writes are only read by the transaction itself until it commits,
+// while it reads the other tables as of the snapshot taken when it begins, see mvcc.go. The coordinator commits a
+// transaction by two-phase commit:
+//   1. it asks each node written by the transaction (a participant) to prepare, after which the node keeps the writes
+//      until it is told the outcome, whatever happens to the coordinator, as the log of a persistent node is saved;
+//   2. it commits the transaction if all participants are prepared, or aborts it otherwise, logs the decision in the
+//      catalog replicated among the nodes, see CatalogDecideTransaction, and sends it to the participants together
+//      with the commit timestamp, i.e., the index of the command logging the decision.
+// A participant that does not get the decision, e.g., because it is down or the coordinator fails, is left in doubt
+// until a coordinator resolves it by the decision in the catalog, see recoverTransactions, which happens when a
+// transaction begins, when a node is revived or restarted, and periodically on the coordinator of the cluster. A
+// transaction that is left undecided for the transaction timeout of the coordinator, see SetTransactionTimeout, is
+// aborted by logging the abort in the catalog, where the first decision logged for a transaction wins, so a coordinator
+// that commits it late finds it aborted.
+
+// transactionsFileName is the file keeping the logs of the transactions on a persistent node in its directory
+const transactionsFileName = "transactions"
+
+// DefaultTransactionTimeout is how long a transaction is kept undecided after its last request to a node by default,
+// after which it is aborted by recoverTransactions, so that the transactions abandoned by their coordinators do not
+// live forever
+const DefaultTransactionTimeout = 30 * time.Second
+
+// Transaction is a transaction open on the coordinator that begins it
+type Transaction struct {
+	Id int
+	// the timestamp of the snapshot read by the transaction, i.e., the index of the command beginning it
+	snapshot int
+	// the nodes that the writes of the transaction have been sent to, which take part in its commit
+	participants map[string]bool
+	// whether the transaction is isolated by two-phase locking, see locks.go
+	serializable bool
+	// the nodes that the transaction has asked for locks
+	locked map[string]bool
+}
+
+// TransactionLog is the log of the writes of a transaction on a node. Each write to the log of a persistent node is
+// appended to its transaction file before the write is applied, see appendTransactions, so that the writes of a
+// transaction that is not prepared are undone when the node is restored, while those of a prepared transaction are
+// kept in doubt.
+type TransactionLog struct {
+	Id int
+	Prepared bool
+	Writes []TransactionWrite
+	// the time of the last request of the transaction
+	lastActive time.Time
+}
+
+// TransactionWrite is a row inserted into or removed from a table on a node, which ends with the row id
+type TransactionWrite struct {
+	TableName string
+	Row Row
+	Removed bool
+}
+
+// TransactionStatus is a transaction left on a node, see Node.TransactionsRPC
+type TransactionStatus struct {
+	Id int
+	Prepared bool
+	// how long the transaction has been idle on the node
+	Idle time.Duration
+}
+
+// join makes a node a participant of the transaction before a write is sent to it, as the write may be applied even if
+// the node does not reply
+func (t *Transaction) join(nodeId string) {
+	t.participants[nodeId] = true
+}
+
+// lock records a node that the transaction asks for locks, whose locks are released when the transaction ends
+func (t *Transaction) lock(nodeId string) {
+	t.locked[nodeId] = true
+}
+
+// beginTransaction begins a transaction, whose id is allocated by the catalog so that it is unique among the
+// coordinators, and resolves the transactions left in doubt on the nodes. The transaction is isolated by two-phase
+// locking if it is serializable. It fails if a transaction is open already.
+func (c *Cluster) beginTransaction(open *Transaction, serializable bool) (*Transaction, error) {
+	if open != nil {
+		return open, errors.New("Begin error: transaction " + strconv.Itoa(open.Id) + " is open!")
+	}
+	c.recoverTransactions()
+	reply, err := c.proposeCatalog(CatalogCommand{Kind: CatalogBeginTransaction})
+	if err != nil {
+		return nil, errors.New("Begin error: " + err.Error() + "!")
+	}
+	transaction := &Transaction{Id: reply.Transaction, snapshot: reply.Index, participants: make(map[string]bool),
+		serializable: serializable, locked: make(map[string]bool)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transactions[transaction.Id] = transaction
+	return transaction, nil
+}
+
+// commitTransaction commits a transaction by two-phase commit. It returns an error if the transaction is aborted, or
+// if the decision cannot be logged, when the prepared participants are left in doubt.
+func (c *Cluster) commitTransaction(transaction *Transaction) error {
+	if transaction == nil {
+		return errors.New("Commit error: no transaction is open!")
+	}
+	c.closeTransaction(transaction.Id)
+	if len(transaction.participants) == 0 {
+		c.releaseLocks(transaction)
+		return nil
+	}
+	if err := c.prepareTransaction(transaction); err != nil {
+		// no participant commits the transaction, as only its coordinator decides to commit it, and the abort is
+		// logged in case some participants do not get it
+		c.decideTransaction(transaction.Id, false)
+		c.finishTransaction(transaction, false)
+		return errors.New("Commit error: " + err.Error() + ", the transaction is rolled back!")
+	}
+	committed, err := c.decideTransaction(transaction.Id, true)
+	if err != nil {
+		// the participants keep the locks of the writes in doubt, while the others are released
+		c.releaseLocks(transaction)
+		return errors.New("Commit error: " + err.Error() + ", the transaction is in doubt!")
+	}
+	c.finishTransaction(transaction, committed)
+	if !committed {
+		return errors.New("Commit error: the transaction has been aborted, e.g., because it has timed out!")
+	}
+	return nil
+}
+
+// rollbackTransaction rolls a transaction back on its participants. If some of them do not reply, the abort is logged
+// in the catalog, so that they are resolved once they are back, see recoverTransactions.
+func (c *Cluster) rollbackTransaction(transaction *Transaction) error {
+	if transaction == nil {
+		return errors.New("Rollback error: no transaction is open!")
+	}
+	c.closeTransaction(transaction.Id)
+	if unreached := c.finishTransaction(transaction, false); len(unreached) > 0 {
+		c.decideTransaction(transaction.Id, false)
+	}
+	return nil
+}
+
+// prepareTransaction asks each participant of a transaction to prepare it, which is the first phase of two-phase
+// commit, and returns an error if any of them fails or does not reply
+func (c *Cluster) prepareTransaction(transaction *Transaction) error {
+	for _, nodeId := range c.nodeIds {
+		if !transaction.participants[nodeId] {
+			continue
+		}
+		reply := ""
+		if err := c.call(nodeId, "Node.PrepareRPC", transaction.Id, &reply); err != nil {
+			return err
+		}
+		if reply != "" {
+			return errors.New(nodeId + " cannot prepare, " + reply)
+		}
+	}
+	return nil
+}
+
+// closeTransaction forgets an open transaction once it is committed or rolled back
+func (c *Cluster) closeTransaction(transactionId int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.transactions, transactionId)
+}
+
+// getTransaction returns the open transaction of the given id begun through the coordinator
+func (c *Cluster) getTransaction(transactionId int) (*Transaction, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	transaction, ok := c.transactions[transactionId]
+	return transaction, ok
+}
+
+// decideTransaction logs the decision whether to commit a transaction in the catalog, and returns the decision
+// logged first, which is the outcome of the transaction. The commit timestamp of a committed transaction is kept in
+// decisions.
+func (c *Cluster) decideTransaction(transactionId int, commit bool) (bool, error) {
+	command := CatalogCommand{Kind: CatalogDecideTransaction, Transaction: transactionId, Commit: commit}
+	reply, err := c.proposeCatalog(command)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.decisions[transactionId] = reply.CommitTimestamp
+	return reply.CommitTimestamp > 0, nil
+}
+
+// getDecision returns the commit timestamp of a transaction decided in the catalog, 0 if it is aborted, and whether
+// the transaction is decided
+func (c *Cluster) getDecision(transactionId int) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	timestamp, ok := c.decisions[transactionId]
+	return timestamp, ok
+}
+
+// finishTransaction sends the outcome of a transaction to its participants, which is the second phase of two-phase
+// commit, and returns the participants that do not reply. A committed transaction should have been decided by
+// decideTransaction, which tells its commit timestamp. The locks of the transaction are released afterwards.
+func (c *Cluster) finishTransaction(transaction *Transaction, committed bool) []string {
+	timestamp := 0
+	if committed {
+		timestamp, _ = c.getDecision(transaction.Id)
+	}
+	var unreached []string
+	for _, nodeId := range c.nodeIds {
+		if !transaction.participants[nodeId] {
+			continue
+		}
+		reply := ""
+		err := c.call(nodeId, "Node.FinishTransactionRPC", []interface{}{transaction.Id, timestamp}, &reply)
+		if err != nil || reply != "" {
+			unreached = append(unreached, nodeId)
+		}
+	}
+	c.releaseLocks(transaction)
+	return unreached
+}
+
+// SetTransactionTimeout sets how long a transaction is kept undecided after its last request to a node before the
+// coordinator aborts it, see recoverTransactions, and replies "Set transaction timeout success" or an error message.
+func (c *Cluster) SetTransactionTimeout(timeout time.Duration, reply *string) {
+	if timeout <= 0 {
+		*reply = "Set transaction timeout error: the timeout should be positive!"
+		return
+	}
+	c.mu.Lock()
+	c.transactionTimeout = timeout
+	c.mu.Unlock()
+	*reply = "Set transaction timeout success"
+}
+
+// getTransactionTimeout returns the transaction timeout of the coordinator, see SetTransactionTimeout
+func (c *Cluster) getTransactionTimeout() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.transactionTimeout
+}
+
+// recoverTransactions resolves the transactions left on the live nodes, e.g., those whose participants missed the
+// decisions or whose coordinators have failed, see recoverNode
+func (c *Cluster) recoverTransactions() {
+	for _, nodeId := range c.nodeIds {
+		c.recoverNode(nodeId)
+	}
+}
+
+// recoverNode resolves the transactions left on a node. A transaction gets the decision logged in the catalog, or is
+// aborted once it has been idle for the transaction timeout, even if it is open on the coordinator.
+func (c *Cluster) recoverNode(nodeId string) {
+	var statuses []TransactionStatus
+	if c.call(nodeId, "Node.TransactionsRPC", "", &statuses) != nil {
+		return
+	}
+	timeout := c.getTransactionTimeout()
+	for _, status := range statuses {
+		if _, ok := c.getDecision(status.Id); !ok {
+			if status.Idle < timeout {
+				continue
+			}
+			if _, err := c.decideTransaction(status.Id, false); err != nil {
+				continue
+			}
+			c.closeTransaction(status.Id)
+		}
+		timestamp, _ := c.getDecision(status.Id)
+		reply := ""
+		c.call(nodeId, "Node.FinishTransactionRPC", []interface{}{status.Id, timestamp}, &reply)
+	}
+}
+
+// recoverPeriodically recovers the transactions on the nodes once every transaction timeout until the cluster is shut
+// down, so that the transactions abandoned by their coordinators are aborted even if no transaction begins, after
+// being idle for up to twice the timeout
+func (c *Cluster) recoverPeriodically() {
+	recovered := time.Now()
+	for atomic.LoadInt32(&c.dead) == 0 {
+		if time.Since(recovered) >= c.getTransactionTimeout() {
+			c.recoverTransactions()
+			recovered = time.Now()
+		}
+		time.Sleep(catalogSyncInterval)
+	}
+}
+
+// getTransactionLog returns the log of a transaction on the node, which is created by the first write of the
+// transaction, and marks the transaction active. The caller should hold transactionMu.
+func (n *Node) getTransactionLog(transactionId int) *TransactionLog {
+	log, ok := n.transactions[transactionId]
+	if !ok {
+		log = &TransactionLog{Id: transactionId}
+		n.transactions[transactionId] = log
+	}
+	log.lastActive = time.Now()
+	return log
+}
+
+// beginWrites checks that the transaction of the stamp can still write on the node, i.e., it is not prepared, once the
+// node has applied the writes logged up to the snapshot of the transaction, against which its writes are checked, see
+// Table.checkWrite
+func (n *Node) beginWrites(stamp Snapshot) error {
+	if n.catalog != nil {
+		if err := n.catalog.waitApplied(stamp.Timestamp); err != nil {
+			return err
+		}
+	}
+	n.transactionMu.Lock()
+	defer n.transactionMu.Unlock()
+	if n.getTransactionLog(stamp.Transaction).Prepared {
+		return errors.New("transaction " + strconv.Itoa(stamp.Transaction) + " is prepared")
+	}
+	return nil
+}
+
+// logWrites appends the writes to the log of a transaction before they are applied
+func (n *Node) logWrites(transactionId int, writes []TransactionWrite) error {
+	n.transactionMu.Lock()
+	defer n.transactionMu.Unlock()
+	log := n.getTransactionLog(transactionId)
+	log.Writes = append(log.Writes, writes...)
+	return n.appendTransactions(transactionRecord{Id: transactionId, Writes: writes})
+}
+
+// PrepareRPC is an RPC interface that prepares the transaction whose id is args (int), and replies an error message if
+// the transaction is unknown to the node, e.g., because the node has been restarted before it is prepared
+func (n *Node) PrepareRPC(args int, reply *string) {
+	n.transactionMu.Lock()
+	defer n.transactionMu.Unlock()
+	log, ok := n.transactions[args]
+	if !ok {
+		*reply = "no such transaction " + strconv.Itoa(args)
+		return
+	}
+	log.Prepared = true
+	log.lastActive = time.Now()
+	if err := n.appendTransactions(transactionRecord{Id: args, Prepared: true}); err != nil {
+		log.Prepared = false
+		*reply = err.Error()
+	}
+}
+
+// FinishTransactionRPC is an RPC interface that commits the transaction whose id is args[0] (int) at the commit
+// timestamp args[1] (int), or undoes its writes on the node if the timestamp is 0, after which its log is dropped and
+// its locks are released. A transaction unknown to the node has been finished already.
+func (n *Node) FinishTransactionRPC(args []interface{}, reply *string) {
+	transactionId := args[0].(int)
+	timestamp := args[1].(int)
+	defer n.releaseLocks(transactionId)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.transactionMu.Lock()
+	defer n.transactionMu.Unlock()
+	log, ok := n.transactions[transactionId]
+	if !ok {
+		return
+	}
+	if timestamp == 0 {
+		if err := n.undoWrites(log.Writes); err != nil {
+			*reply = err.Error()
+			return
+		}
+	}
+	n.finishVersions(log, timestamp)
+	delete(n.transactions, transactionId)
+	if err := n.appendTransactions(transactionRecord{Id: transactionId, Finished: true}); err != nil {
+		*reply = err.Error()
+	}
+}
+
+// TransactionsRPC is an RPC interface that replies the transactions on the node, see recoverTransactions
+func (n *Node) TransactionsRPC(args interface{}, reply *[]TransactionStatus) {
+	n.transactionMu.Lock()
+	defer n.transactionMu.Unlock()
+	for _, log := range n.transactions {
+		*reply = append(*reply, TransactionStatus{
+			Id: log.Id,
+			Prepared: log.Prepared,
+			Idle: time.Since(log.lastActive),
+		})
+	}
+	sort.Slice(*reply, func(i, j int) bool {
+		return (*reply)[i].Id < (*reply)[j].Id
+	})
+}
+
+// undoWrites undoes the writes in the reverse order. A removed row is inserted back only if it is not in the table, as
+// the node may have crashed after the removal was logged but before it was applied. The caller should hold mu.
+func (n *Node) undoWrites(writes []TransactionWrite) error {
+	for i := len(writes) - 1; i >= 0; i-- {
+		write := writes[i]
+		t, ok := n.TableMap[write.TableName]
+		if !ok {
+			return errors.New("no such table")
+		}
+		if !write.Removed {
+			if err := n.Remove(write.TableName, &write.Row); err != nil {
+				return err
+			}
+			continue
+		}
+		rowId := write.Row[len(write.Row) - 1].(int)
+		if len(n.lookupRowIds(t, []int{rowId})) == 0 {
+			if err := n.Insert(write.TableName, &write.Row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupRowIds returns the rows of a table on the node whose row ids are among the given ones
+func (n *Node) lookupRowIds(t *Table, rowIds []int) []Row {
+	if rows, ok := t.lookupIndex(rowIdColumn, "==", toValues(rowIds)); ok {
+		return rows
+	}
+	isWanted := make(map[int]bool)
+	for _, rowId := range rowIds {
+		isWanted[rowId] = true
+	}
+	var rows []Row
+	loc := len(t.schema.ColumnSchemas)
+	for iterator := t.RowIterator(); iterator.HasNext(); {
+		row := *iterator.Next()
+		if isWanted[row[loc].(int)] {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// transactionRecord is a change of the log of a transaction appended to the transaction file of a persistent node:
+// some writes of the transaction, its preparation, or its end, after which the log is dropped
+type transactionRecord struct {
+	Id int
+	Writes []TransactionWrite
+	Prepared bool
+	Finished bool
+}
+
+// appendTransactions appends a change of the log of a transaction, which has been applied to the logs in memory, to
+// the transaction file of a persistent node and syncs it, like the write-ahead log of a DiskRowStore. The file is
+// rewritten with only the logs left once most of its records are obsolete. The caller should hold transactionMu.
+func (n *Node) appendTransactions(record transactionRecord) error {
+	if n.dir == "" {
+		return nil
+	}
+	// the file is created with the logs in memory, which include the change, on the first change since the node starts
+	if n.transactionFile == nil {
+		return n.compactTransactions()
+	}
+	if err := writeRecord(n.transactionFile, record); err != nil {
+		return err
+	}
+	if err := n.transactionFile.Sync(); err != nil {
+		return err
+	}
+	n.transactionRecords++
+	if n.transactionRecords > walCheckpointRecords && n.transactionRecords > 2 * len(n.transactions) {
+		return n.compactTransactions()
+	}
+	return nil
+}
+
+// compactTransactions writes the logs of the transactions on a persistent node into a new transaction file, which
+// replaces the old one atomically and is appended afterwards. The caller should hold transactionMu.
+func (n *Node) compactTransactions() error {
+	path := filepath.Join(n.dir, transactionsFileName)
+	file, err := os.OpenFile(path + ".tmp", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, log := range n.transactions {
+		record := transactionRecord{Id: log.Id, Writes: log.Writes, Prepared: log.Prepared}
+		if err = writeRecord(writer, record); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err = writer.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(path + ".tmp", path)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if n.transactionFile != nil {
+		n.transactionFile.Close()
+	}
+	n.transactionFile = file
+	n.transactionRecords = len(n.transactions)
+	return nil
+}
+
+// loadTransactions restores the logs of the transactions on a persistent node by replaying its transaction file, where
+// a record torn by a crash at the end is dropped. The writes of the transactions that are not prepared are undone, as
+// their coordinators cannot commit them without the node. The prepared ones are kept in doubt and become idle from now
+// on, while their writes are pending again in the version chains of the rows.
+func (n *Node) loadTransactions() error {
+	file, err := os.Open(filepath.Join(n.dir, transactionsFileName))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	payloads, _, err := readPayloads(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	logs := make(map[int]*TransactionLog)
+	for _, payload := range payloads {
+		record := transactionRecord{}
+		if err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+			return err
+		}
+		if record.Finished {
+			delete(logs, record.Id)
+			continue
+		}
+		log, ok := logs[record.Id]
+		if !ok {
+			log = &TransactionLog{Id: record.Id}
+			logs[record.Id] = log
+		}
+		log.Writes = append(log.Writes, record.Writes...)
+		log.Prepared = log.Prepared || record.Prepared
+	}
+	var transactionIds []int
+	for transactionId := range logs {
+		transactionIds = append(transactionIds, transactionId)
+	}
+	sort.Ints(transactionIds)
+	for _, transactionId := range transactionIds {
+		log := logs[transactionId]
+		if !log.Prepared {
+			if err = n.undoWrites(log.Writes); err != nil {
+				return err
+			}
+			continue
+		}
+		log.lastActive = time.Now()
+		n.transactions[log.Id] = log
+		n.restoreVersions(log)
+	}
+	return n.compactTransactions()
+}
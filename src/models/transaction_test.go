@@ -0,0 +1,273 @@
+package models
+
+import (
+	"../labrpc"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupTransactions creates the accounts on Node0|1 and Node2 and the transfers on Node3 of a cluster of 5 nodes
+func setupTransactions(t *testing.T) {
+	setupScript(t, `CREATE TABLE account (aid INT32 PRIMARY KEY, balance INT32)
+			PARTITION BY (NODES 0|1 WHERE aid < 100, NODE 2 WHERE aid >= 100);
+		CREATE TABLE transfer (tid INT32, amount INT32) PARTITION BY (NODE 3);
+		INSERT INTO account VALUES (1, 100), (101, 50)`)
+}
+
+// beginTransaction begins a transaction by a script, which is left open, and returns its id
+func beginTransaction(t *testing.T, script string) int {
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", script, &result)
+	if result.Error != "" || result.Transaction == 0 {
+		t.Fatalf("%s should leave a transaction open, actual %v", script, result)
+	}
+	return result.Transaction
+}
+
+// checkTransactionQuery checks the rows returned by a query within a transaction like checkQuery, and whether the
+// transaction is still open after it
+func checkTransactionQuery(t *testing.T, transactionId int, script string, expected []Row, open bool) {
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteTransactionSQL", []interface{}{transactionId, script}, &result)
+	if (result.Transaction == transactionId) != open {
+		t.Errorf("%s should leave the transaction open: %v, actual %d", script, open, result.Transaction)
+	}
+	if expected == nil {
+		if result.Error == "" {
+			t.Errorf("%s should fail, actual %v", script, result.Dataset.Rows)
+		}
+		return
+	}
+	matched := result.Error == "" && len(result.Dataset.Rows) == len(expected)
+	for i := 0; matched && i < len(expected); i++ {
+		matched = result.Dataset.Rows[i].Equals(&expected[i])
+	}
+	if !matched {
+		t.Errorf("Incorrect results of %s, expected %v, actual %v %v", script, expected, result.Error,
+			result.Dataset.Rows)
+	}
+}
+
+// checkTransactionLogs checks the number of the transactions left on a node and how many of them are prepared
+func checkTransactionLogs(t *testing.T, nodeId string, count int, prepared int) {
+	var statuses []TransactionStatus
+	if !c.getEnd(nodeId).Call("Node.TransactionsRPC", "", &statuses) {
+		t.Fatalf("%s did not reply", nodeId)
+	}
+	actualPrepared := 0
+	for _, status := range statuses {
+		if status.Prepared {
+			actualPrepared++
+		}
+	}
+	if len(statuses) != count || actualPrepared != prepared {
+		t.Errorf("%s should have %d transactions with %d prepared, actual %v", nodeId, count, prepared, statuses)
+	}
+}
+
+func TestTransactionCommit(t *testing.T) {
+	setupTransactions(t)
+
+	// the writes of a transaction are read by its later statements, and commit together
+	id := beginTransaction(t, "BEGIN; UPDATE account SET balance = 70 WHERE aid = 1")
+	checkTransactionQuery(t, id, "UPDATE account SET balance = 80 WHERE aid = 101; INSERT INTO transfer VALUES (0, 30)",
+		[]Row{}, true)
+	checkTransactionQuery(t, id, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 70}, {101, 80}}, true)
+	checkTransactionQuery(t, id, "COMMIT", []Row{}, false)
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 70}, {101, 80}})
+	checkQuery(t, "SELECT tid, amount FROM transfer", []Row{{0, 30}})
+
+	// a transaction may begin and commit in a script
+	checkQuery(t, `BEGIN TRANSACTION; INSERT INTO account VALUES (2, 10), (102, 20); DELETE FROM transfer;
+		COMMIT`, []Row{})
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 70}, {2, 10}, {101, 80}, {102, 20}})
+	checkQuery(t, "SELECT tid FROM transfer", []Row{})
+	for _, nodeId := range c.nodeIds {
+		checkTransactionLogs(t, nodeId, 0, 0)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	setupTransactions(t)
+	all := []Row{{1, 100}, {101, 50}}
+
+	// the rolled back writes are undone, and the rows removed by them are back in their order
+	id := beginTransaction(t, "BEGIN; INSERT INTO account VALUES (2, 10); DELETE FROM account WHERE aid = 101")
+	checkTransactionQuery(t, id, "UPDATE account SET balance = 0 WHERE aid = 1; INSERT INTO transfer VALUES (0, 30)",
+		[]Row{}, true)
+	checkTransactionQuery(t, id, "SELECT aid, balance FROM account", []Row{{1, 0}, {2, 10}}, true)
+	checkTransactionQuery(t, id, "ROLLBACK WORK", []Row{}, false)
+	checkQuery(t, "SELECT aid, balance FROM account", all)
+	checkQuery(t, "SELECT tid FROM transfer", []Row{})
+
+	// a failed statement rolls the transaction back, after which it is gone
+	id = beginTransaction(t, "BEGIN; INSERT INTO account VALUES (3, 10)")
+	checkTransactionQuery(t, id, "INSERT INTO account VALUES (1, 5)", nil, false)
+	checkTransactionQuery(t, id, "COMMIT", nil, false)
+	checkQuery(t, "BEGIN; INSERT INTO transfer VALUES (1, 10); UPDATE account SET balance = 'x'", nil)
+	checkQuery(t, "SELECT aid, balance FROM account", all)
+	checkQuery(t, "SELECT tid FROM transfer", []Row{})
+
+	// but a statement that cannot be parsed keeps it open
+	id = beginTransaction(t, "BEGIN")
+	checkTransactionQuery(t, id, "UPSERT INTO account VALUES (3, 10)", nil, true)
+	checkTransactionQuery(t, id, "BEGIN", nil, false)
+	checkQuery(t, "COMMIT", nil)
+	checkQuery(t, "ROLLBACK", nil)
+	for _, nodeId := range c.nodeIds {
+		checkTransactionLogs(t, nodeId, 0, 0)
+	}
+}
+
+func TestTransactionParticipantFailure(t *testing.T) {
+	setupTransactions(t)
+
+	// the transaction is rolled back if a participant is lost before it is prepared, and the participant gets the
+	// abort logged in the catalog once it is back
+	id := beginTransaction(t, "BEGIN; UPDATE account SET balance = 70 WHERE aid = 1; INSERT INTO transfer VALUES (0, 30)")
+	c.CrashNode("Node3")
+	checkTransactionQuery(t, id, "COMMIT", nil, false)
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 100}, {101, 50}})
+	c.ReviveNode("Node3")
+	checkTransactionLogs(t, "Node3", 0, 0)
+	checkQuery(t, "SELECT tid FROM transfer", []Row{})
+
+	// a participant lost after it is prepared is left in doubt, and gets the commit once it is back
+	id = beginTransaction(t, "BEGIN; UPDATE account SET balance = 70 WHERE aid = 1; INSERT INTO transfer VALUES (1, 30)")
+	transaction := c.transactions[id]
+	if err := c.prepareTransaction(transaction); err != nil {
+		t.Fatal(err.Error())
+	}
+	c.CrashNode("Node3")
+	delete(c.transactions, id)
+	if committed, err := c.decideTransaction(id, true); !committed || err != nil {
+		t.Fatalf("The transaction should be committed, actual %v %v", committed, err)
+	}
+	if unreached := c.finishTransaction(transaction, true); len(unreached) != 1 || unreached[0] != "Node3" {
+		t.Errorf("Node3 should not get the commit, actual %v", unreached)
+	}
+	c.ReviveNode("Node3")
+	checkTransactionLogs(t, "Node3", 0, 0)
+	checkTransactionLogs(t, "Node0", 0, 0)
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 70}, {101, 50}})
+	checkQuery(t, "SELECT tid, amount FROM transfer", []Row{{1, 30}})
+}
+
+func TestTransactionCoordinatorFailure(t *testing.T) {
+	setupTransactions(t)
+
+	// the coordinator fails after the participants are prepared, which are aborted by another coordinator once the
+	// transaction times out
+	id := beginTransaction(t, "BEGIN; UPDATE account SET balance = 70 WHERE aid = 1; INSERT INTO transfer VALUES (0, 30)")
+	transaction := c.transactions[id]
+	if err := c.prepareTransaction(transaction); err != nil {
+		t.Fatal(err.Error())
+	}
+	timeout := 100 * time.Millisecond
+	network.Connect("ClientA", "Node4")
+	reply := ""
+	if cli.Call("Cluster.SetTransactionTimeout", timeout, &reply); reply != "Set transaction timeout success" {
+		t.Fatal(reply)
+	}
+	checkQuery(t, "BEGIN; ROLLBACK", []Row{})
+	checkTransactionLogs(t, "Node0", 1, 1)
+	time.Sleep(2 * timeout)
+	checkQuery(t, "BEGIN; ROLLBACK", []Row{})
+	for _, nodeId := range c.nodeIds {
+		checkTransactionLogs(t, nodeId, 0, 0)
+	}
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 100}, {101, 50}})
+	checkQuery(t, "SELECT tid FROM transfer", []Row{})
+
+	// the coordinator committing the transaction late finds it aborted
+	if committed, err := c.decideTransaction(id, true); committed || err != nil {
+		t.Errorf("The transaction should be aborted, actual %v %v", committed, err)
+	}
+
+	// the coordinator of the cluster aborts the abandoned transactions periodically even if no transaction begins
+	network.Connect("ClientA", c.Name)
+	id = beginTransaction(t, "BEGIN; INSERT INTO transfer VALUES (1, 10)")
+	if err := c.prepareTransaction(c.transactions[id]); err != nil {
+		t.Fatal(err.Error())
+	}
+	if c.SetTransactionTimeout(timeout, &reply); reply != "Set transaction timeout success" {
+		t.Fatal(reply)
+	}
+	checkTransactionLogs(t, "Node3", 1, 1)
+	time.Sleep(4 * timeout)
+	checkTransactionLogs(t, "Node3", 0, 0)
+	checkQuery(t, "SELECT tid FROM transfer", []Row{})
+}
+
+func TestTransactionRestart(t *testing.T) {
+	defer func(records int) { walCheckpointRecords = records }(walCheckpointRecords)
+	network = labrpc.MakeNetwork()
+	dir := t.TempDir()
+	var err error
+	if c, err = NewDiskCluster(3, network, "MyCluster", dir); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Shutdown()
+	cli = network.MakeEnd("ClientA")
+	network.Connect("ClientA", c.Name)
+	network.Enable("ClientA", true)
+	checkQuery(t, `CREATE TABLE account (aid INT32 PRIMARY KEY, balance INT32)
+			PARTITION BY (NODE 1 WHERE aid < 100, NODE 2 WHERE aid >= 100);
+		INSERT INTO account VALUES (1, 100), (101, 50)`, []Row{})
+
+	// a restarted node undoes the writes of the transactions that are not prepared, and keeps the prepared ones in
+	// doubt until it gets their outcomes. The second transaction only inserts, as the rows of account are written by
+	// the prepared one
+	prepared := beginTransaction(t, "BEGIN; UPDATE account SET balance = 70")
+	if err = c.prepareTransaction(c.transactions[prepared]); err != nil {
+		t.Fatal(err.Error())
+	}
+	delete(c.transactions, prepared)
+	beginTransaction(t, "BEGIN; INSERT INTO account VALUES (102, 20), (103, 30)")
+	checkTransactionLogs(t, "Node2", 2, 1)
+	if err = c.RestartNode("Node2"); err != nil {
+		t.Fatal(err.Error())
+	}
+	checkTransactionLogs(t, "Node2", 1, 1)
+	checkQuery(t, "SELECT aid FROM account ORDER BY aid", []Row{{1}, {101}})
+
+	if _, err = c.decideTransaction(prepared, true); err != nil {
+		t.Fatal(err.Error())
+	}
+	checkQuery(t, "BEGIN; ROLLBACK", []Row{})
+	checkTransactionLogs(t, "Node1", 0, 0)
+	checkTransactionLogs(t, "Node2", 0, 0)
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 70}, {101, 70}})
+
+	// the transaction file is appended by each change of the logs, and compacted once most of its records are obsolete
+	walCheckpointRecords = 4
+	for i := 0; i < 10; i++ {
+		checkQuery(t, "BEGIN; UPDATE account SET balance = 60 WHERE aid = 101; COMMIT", []Row{})
+	}
+	prepared = beginTransaction(t, "BEGIN; UPDATE account SET balance = 40 WHERE aid = 101")
+	if err = c.prepareTransaction(c.transactions[prepared]); err != nil {
+		t.Fatal(err.Error())
+	}
+	delete(c.transactions, prepared)
+	file, err := os.Open(filepath.Join(dir, "Node2", transactionsFileName))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	payloads, _, err := readPayloads(file)
+	file.Close()
+	if err != nil || len(payloads) > walCheckpointRecords + 1 {
+		t.Errorf("The transaction file should be compacted, actual %d records %v", len(payloads), err)
+	}
+	if err = c.RestartNode("Node2"); err != nil {
+		t.Fatal(err.Error())
+	}
+	checkTransactionLogs(t, "Node2", 1, 1)
+	if _, err = c.decideTransaction(prepared, true); err != nil {
+		t.Fatal(err.Error())
+	}
+	checkQuery(t, "BEGIN; ROLLBACK", []Row{})
+	checkTransactionLogs(t, "Node2", 0, 0)
+	checkQuery(t, "SELECT aid, balance FROM account ORDER BY aid", []Row{{1, 70}, {101, 40}})
+}
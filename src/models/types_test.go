@@ -0,0 +1,169 @@
+package models
+
+import (
+	"../labgob"
+	"bytes"
+	"testing"
+	"time"
+)
+
+// payments made before 2026 are held by node0, and the others by node1
+func setupTypes(t *testing.T) {
+	setupScript(t, `
+		CREATE TABLE payment (id INT32 PRIMARY KEY, paidAt TIMESTAMP, day DATE, amount DECIMAL(10, 2), memo BYTES UNIQUE)
+		PARTITION BY (NODE 0 WHERE paidAt < '2026-01-01', NODE 1 WHERE paidAt >= '2026-01-01');
+		INSERT INTO payment VALUES
+			(0, '2025-12-31 23:59:59', '2025-12-31', 12.50, 'a'),
+			(1, '2026-01-01 00:00:00', '2026-01-01', '0.1', 'b'),
+			(2, '2026-03-01T08:00:00+08:00', '2026-03-01', 100, 'ab')`)
+}
+
+func TestTypedValues(t *testing.T) {
+	setupTypes(t)
+
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"payment", []string{}, []Predicate{{ColumnName: "id", Operator: "==", Value: 2}}},
+		&results)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "id", DataType: TypeInt32},
+			{Name: "paidAt", DataType: TypeTimestamp},
+			{Name: "day", DataType: TypeDate},
+			{Name: "amount", DataType: TypeDecimal},
+			{Name: "memo", DataType: TypeBytes},
+		}},
+		Rows: []Row{{2, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			NewDecimal(100, 0), []byte("ab")}},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Values should be stored in their canonical types, expected %v, actual %v", expectedDataset, results)
+	}
+
+	for _, script := range []string{
+		"INSERT INTO payment VALUES (3, 'yesterday', '2026-01-02', 1, 'c')",
+		"INSERT INTO payment VALUES (3, '2026-01-02', '2026-01-02', '1.2.3', 'c')",
+		"INSERT INTO payment VALUES (3, '2026-01-02', '2026-01-02', 1, 'a')",
+		"UPDATE payment SET amount = 'much' WHERE id = 0",
+	} {
+		result := QueryResult{}
+		cli.Call("Cluster.ExecuteSQL", script, &result)
+		if result.Error == "" {
+			t.Errorf("%s should fail, but got %v", script, result)
+		}
+	}
+}
+
+func TestTypedOrdering(t *testing.T) {
+	setupTypes(t)
+
+	for _, test := range []struct {
+		script string
+		expected []Row
+	}{
+		// decimals are ordered by their values rather than their texts
+		{"SELECT id FROM payment ORDER BY amount", []Row{{1}, {0}, {2}}},
+		{"SELECT id FROM payment ORDER BY memo DESC", []Row{{1}, {2}, {0}}},
+		{"SELECT id FROM payment ORDER BY paidAt DESC", []Row{{2}, {1}, {0}}},
+		{"SELECT id FROM payment WHERE amount = 12.5", []Row{{0}}},
+		{"SELECT id FROM payment WHERE amount > '0.10' ORDER BY id", []Row{{0}, {2}}},
+		{"SELECT id FROM payment WHERE day < '2026-01-02' ORDER BY id", []Row{{0}, {1}}},
+		{"SELECT id FROM payment WHERE memo = 'ab'", []Row{{2}}},
+	} {
+		result := QueryResult{}
+		cli.Call("Cluster.ExecuteSQL", test.script, &result)
+		if result.Error != "" {
+			t.Errorf("%s failed: %s", test.script, result.Error)
+			continue
+		}
+		actual := result.Dataset.Rows
+		matched := len(actual) == len(test.expected)
+		for i := 0; matched && i < len(actual); i++ {
+			matched = actual[i].Equals(&test.expected[i])
+		}
+		if !matched {
+			t.Errorf("Incorrect results of %s, expected %v, actual %v", test.script, test.expected, actual)
+		}
+	}
+}
+
+func TestTypedPartitions(t *testing.T) {
+	setupTypes(t)
+
+	countBefore := []int{network.GetCount("Node0"), network.GetCount("Node1")}
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"payment", []string{"id"},
+		[]Predicate{{ColumnName: "paidAt", Operator: ">=", Value: "2026-02-01 00:00:00"}}}, &results)
+	countAfter := []int{network.GetCount("Node0"), network.GetCount("Node1")}
+	if countAfter[0] != countBefore[0] || countAfter[1] != countBefore[1] + 1 {
+		t.Errorf("Select should only reach Node1, RPC counts before %v, after %v", countBefore, countAfter)
+	}
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{{Name: "id", DataType: TypeInt32}}},
+		Rows: []Row{{2}},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, results)
+	}
+
+	// the payment moves to node1 as its time changes
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "UPDATE payment SET paidAt = '2026-01-01 00:00:01' WHERE id = 0", &result)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	countBefore = []int{network.GetCount("Node0"), network.GetCount("Node1")}
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"payment", []string{"id"},
+		[]Predicate{{ColumnName: "paidAt", Operator: "<", Value: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}}}, &results)
+	countAfter = []int{network.GetCount("Node0"), network.GetCount("Node1")}
+	if countAfter[0] != countBefore[0] + 1 || countAfter[1] != countBefore[1] {
+		t.Errorf("Select should only reach Node0, RPC counts before %v, after %v", countBefore, countAfter)
+	}
+	if len(results.Rows) != 0 {
+		t.Errorf("No payment should be made before 2026, actual %v", results)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		expected Decimal
+		formatted string
+	}{
+		{"12.50", Decimal{Unscaled: 125, Scale: 1}, "12.5"},
+		{"-0.05", Decimal{Unscaled: -5, Scale: 2}, "-0.05"},
+		{"+100", Decimal{Unscaled: 100, Scale: 0}, "100"},
+		{".5", Decimal{Unscaled: 5, Scale: 1}, "0.5"},
+		{"0.000", Decimal{Unscaled: 0, Scale: 0}, "0"},
+	} {
+		actual, err := ParseDecimal(test.text)
+		if err != nil || actual != test.expected || actual.String() != test.formatted {
+			t.Errorf("Incorrect decimal of %s, expected %v, actual %#v (%v)", test.text, test.expected, actual, err)
+		}
+	}
+	for _, text := range []string{"", "-", "1.2.3", "1e3", "99999999999999999999"} {
+		if _, err := ParseDecimal(text); err == nil {
+			t.Errorf("%s should not be parsed as a decimal", text)
+		}
+	}
+	if NewDecimal(1, 0).Cmp(NewDecimal(999, 3)) <= 0 || NewDecimal(-1, 0).Cmp(NewDecimal(-1000, 3)) != 0 {
+		t.Errorf("Incorrect comparisons of decimals")
+	}
+}
+
+func TestTypedEncoding(t *testing.T) {
+	setupLab3(t)
+
+	buffer := new(bytes.Buffer)
+	row := Row{time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC), NewDecimal(-125, 1), []byte{0, 1, 2}}
+	if err := labgob.NewEncoder(buffer).Encode(row); err != nil {
+		t.Fatal(err.Error())
+	}
+	var decodedRow Row
+	if err := labgob.NewDecoder(buffer).Decode(&decodedRow); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !decodedRow.Equals(&row) {
+		t.Errorf("Typed values should survive encoding, expected %v, actual %v", row, decodedRow)
+	}
+}
@@ -0,0 +1,300 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Assignment sets a column to a value in an update
+type Assignment struct {
+	ColumnName string
+	Value interface{}
+}
+
+// Delete removes the rows satisfying all predicates in params[1] ([]Predicate, all rows if empty) from the table named
+// params[0], together with every fragment piece of them, and replies "Delete success" or an error message.
+func (c *Cluster) Delete(params []interface{}, reply *string) {
+	c.syncCatalog()
+	tableName := params[0].(string)
+	predicates, _ := params[1].([]Predicate)
+	if _, err := c.deleteRows(tableName, predicates, nil); err != nil {
+		*reply = err.Error()
+		return
+	}
+	*reply = "Delete success"
+}
+
+// Update sets the columns in params[1] ([]Assignment) of the rows satisfying all predicates in params[2] ([]Predicate,
+// all rows if empty) of the table named params[0], and replies "Update success" or an error message. A row whose new
+// values satisfy the partition predicates of other fragments is moved to them, and keeps its row id.
+func (c *Cluster) Update(params []interface{}, reply *string) {
+	c.syncCatalog()
+	tableName := params[0].(string)
+	assignments, _ := params[1].([]Assignment)
+	predicates, _ := params[2].([]Predicate)
+	if _, err := c.updateRows(tableName, assignments, predicates, nil); err != nil {
+		*reply = err.Error()
+		return
+	}
+	*reply = "Update success"
+}
+
+// deleteRows is the implementation of Delete, it returns the number of deleted rows. The rows are deleted within the
+// given transaction unless it is nil, and are located in the snapshot read by the statement, see getSnapshot.
+func (c *Cluster) deleteRows(tableName string, predicates []Predicate, transaction *Transaction) (int, error) {
+	schema, ok := c.getSchema(tableName)
+	if !ok {
+		return 0, errors.New("Delete error: no such table!")
+	}
+	typedPredicates, err := getTypedPredicates(&schema, predicates)
+	if err != nil {
+		return 0, errors.New("Delete error: " + err.Error() + "!")
+	}
+
+	// only the columns of the predicates are needed to locate the rows
+	var scanIds []int
+	isScanned := make([]bool, len(schema.ColumnSchemas))
+	for _, p := range typedPredicates {
+		columnId := schema.getColumnId(p.ColumnName)
+		if !isScanned[columnId] {
+			isScanned[columnId] = true
+			scanIds = append(scanIds, columnId)
+		}
+	}
+	if len(scanIds) == 0 {
+		scanIds = []int{0}
+	}
+	scanSchema := schema.getSubSchema(scanIds)
+	dataSet, err := c.scanTable(&scanSchema, typedPredicates, c.getSnapshot(transaction))
+	if err != nil {
+		return 0, errors.New("Delete error: " + err.Error() + "!")
+	}
+
+	rowIds := getRowIds(&dataSet)
+	plan, err := c.planDeletion(tableName, rowIds)
+	if err != nil {
+		return 0, errors.New("Delete error: " + err.Error() + "!")
+	}
+	if len(rowIds) == 0 {
+		return 0, nil
+	}
+	// the removals of all tables in the plan are logged together outside transactions
+	var writes []TableWrite
+	fragments := make(map[string][]Fragment)
+	for _, name := range sortedKeys(plan) {
+		// the rows of the table are located by the predicates, while the referencing rows by their ids
+		var removePredicates []Predicate
+		if name == tableName {
+			removePredicates = typedPredicates
+		}
+		if transaction != nil {
+			if err := c.removeRows(name, plan[name], removePredicates, transaction); err != nil {
+				return 0, errors.New("Delete error: " + err.Error() + "!")
+			}
+			continue
+		}
+		writes = append(writes, TableWrite{TableName: name, RowIds: plan[name]})
+		fragments[name] = c.getRelevantFragments(name, removePredicates)
+	}
+	if len(writes) > 0 {
+		if err := c.logWrites(writes, fragments); err != nil {
+			return 0, errors.New("Delete error: " + err.Error() + "!")
+		}
+	}
+	return len(rowIds), nil
+}
+
+// updateRows is the implementation of Update, it returns the number of updated rows. The rows are updated within the
+// given transaction unless it is nil, and are read from the snapshot read by the statement like deleteRows.
+func (c *Cluster) updateRows(tableName string, assignments []Assignment, predicates []Predicate,
+	transaction *Transaction) (int, error) {
+	schema, ok := c.getSchema(tableName)
+	if !ok {
+		return 0, errors.New("Update error: no such table!")
+	}
+	if len(assignments) == 0 {
+		return 0, errors.New("Update error: no column to update!")
+	}
+	assignedIds := make([]int, len(assignments))
+	for i, assignment := range assignments {
+		assignedIds[i] = schema.getColumnId(assignment.ColumnName)
+		if assignedIds[i] < 0 {
+			return 0, errors.New("Update error: unknown column " + assignment.ColumnName + "!")
+		}
+	}
+	values := make([]interface{}, len(assignments))
+	for i, assignment := range assignments {
+		column := schema.ColumnSchemas[assignedIds[i]]
+		value, err := normalizeValue(column.DataType, assignment.Value)
+		if err != nil {
+			return 0, fmt.Errorf("Update error: cannot convert %v of column %s to %s!", assignment.Value,
+				column.Name, getDataTypeName(column.DataType))
+		}
+		if !isValueOfType(column.DataType, value) {
+			return 0, fmt.Errorf("Update error: column %s expects %s but got %v (%T)!", column.Name,
+				getDataTypeName(column.DataType), value, value)
+		}
+		values[i] = value
+	}
+	typedPredicates, err := getTypedPredicates(&schema, predicates)
+	if err != nil {
+		return 0, errors.New("Update error: " + err.Error() + "!")
+	}
+
+	// the whole rows are fetched, as the updated rows are written again to the fragments they belong to now
+	dataSet, err := c.scanTable(&schema, typedPredicates, c.getSnapshot(transaction))
+	if err != nil {
+		return 0, errors.New("Update error: " + err.Error() + "!")
+	}
+	rowIds := getRowIds(&dataSet)
+	loc := len(schema.ColumnSchemas)
+	rows := make([]Row, len(dataSet.Rows))
+	for i, oldRow := range dataSet.Rows {
+		rows[i] = make(Row, loc)
+		copy(rows[i], oldRow[:loc])
+		for j := range assignments {
+			rows[i][assignedIds[j]] = values[j]
+		}
+	}
+
+	if err := schema.checkNotNull(rows); err != nil {
+		return 0, errors.New("Update error: " + err.Error() + "!")
+	}
+	for i := range rows {
+		if !c.isRowPlaced(&schema, &rows[i]) {
+			return 0, errors.New("Update error: no fragment accepts the row!")
+		}
+	}
+	// the constraints are checked only if the columns they concern are updated, and the updated rows do not conflict
+	// with their old values
+	if schema.isAnyForeignKeyColumn(assignedIds) {
+		if err := c.checkReferences(&schema, rows); err != nil {
+			return 0, errors.New("Update error: " + err.Error() + "!")
+		}
+	}
+	if err := c.checkReferencedKeys(&schema, dataSet.Rows, rows); err != nil {
+		return 0, errors.New("Update error: " + err.Error() + "!")
+	}
+	if schema.isAnyKeyColumn(assignedIds) {
+		excludedRowIds := make(map[int]bool)
+		for _, rowId := range rowIds {
+			excludedRowIds[rowId] = true
+		}
+		unlockKeys, err := c.lockKeys(&schema, rows)
+		if err != nil {
+			return 0, errors.New("Update error: " + err.Error() + "!")
+		}
+		defer unlockKeys()
+		if err := c.checkKeyConstraints(&schema, rows, excludedRowIds); err != nil {
+			return 0, errors.New("Update error: " + err.Error() + "!")
+		}
+	}
+
+	if len(rowIds) == 0 {
+		return 0, nil
+	}
+	if transaction == nil {
+		// the old rows are replaced by the new ones with the same row ids by one command, which is applied by the
+		// fragments the old rows may be held by and those the new rows belong to
+		write := TableWrite{TableName: tableName, RowIds: rowIds}
+		for i, row := range rows {
+			write.Rows = append(write.Rows, append(row, rowIds[i]))
+		}
+		var fragments []Fragment
+		for _, fragment := range c.getFragments(tableName) {
+			relevant := fragment.isRelevant(nil, typedPredicates)
+			for i := 0; i < len(rows) && !relevant; i++ {
+				ok, err := checkPredicates(&schema, &rows[i], fragment.Predicates)
+				relevant = ok || err != nil
+			}
+			if relevant {
+				fragments = append(fragments, fragment)
+			}
+		}
+		if err := c.logWrites([]TableWrite{write}, map[string][]Fragment{tableName: fragments}); err != nil {
+			return 0, errors.New("Update error: " + err.Error() + "!")
+		}
+		return len(rowIds), nil
+	}
+	if err := c.removeRows(tableName, rowIds, typedPredicates, transaction); err != nil {
+		return 0, errors.New("Update error: " + err.Error() + "!")
+	}
+	for i, row := range rows {
+		if reply := c.writeRow(&schema, row, rowIds[i], transaction); reply != "" {
+			return 0, errors.New("Update error: " + reply + "!")
+		}
+	}
+	return len(rowIds), nil
+}
+
+// removeRows removes the rows with the given row ids from all fragments of a table within a transaction, which may only
+// be held by the fragments whose partition predicates do not contradict the given predicates. Like writeRow, all
+// replicas should remove the rows, and the removals outside transactions are logged instead, see logWrites.
+func (c *Cluster) removeRows(tableName string, rowIds []int, predicates []Predicate, transaction *Transaction) error {
+	if len(rowIds) == 0 {
+		return nil
+	}
+	c.repairReplicas(tableName)
+	for _, nodeId := range c.getFragmentNodes(tableName, nil, predicates) {
+		if c.isStale(tableName, nodeId) {
+			if err := c.lockPrimary(tableName, nodeId, rowIds, transaction); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.lockRows(nodeId, tableName, rowIds, transaction); err != nil {
+			return err
+		}
+		transaction.join(nodeId)
+		args := []interface{}{tableName, rowIds, c.getSnapshot(transaction), c.client.newRequestId()}
+		reply := ""
+		if err := c.call(nodeId, "Node.RemoveRowsRPC", args, &reply); err != nil {
+			return err
+		}
+		if reply != "" {
+			return errors.New(reply)
+		}
+	}
+	return nil
+}
+
+// getRelevantFragments returns the fragments of a table whose partition predicates do not contradict the predicates
+func (c *Cluster) getRelevantFragments(tableName string, predicates []Predicate) []Fragment {
+	var fragments []Fragment
+	for _, fragment := range c.getFragments(tableName) {
+		if fragment.isRelevant(nil, predicates) {
+			fragments = append(fragments, fragment)
+		}
+	}
+	return fragments
+}
+
+// sortedKeys returns the keys of a map in the increasing order
+func sortedKeys(m map[string][]int) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// getRowIds returns the hidden row ids carried by the last column of the rows in a dataset
+func getRowIds(dataSet *Dataset) []int {
+	loc := len(dataSet.Schema.ColumnSchemas)
+	rowIds := make([]int, len(dataSet.Rows))
+	for i, row := range dataSet.Rows {
+		rowIds[i] = row[loc].(int)
+	}
+	return rowIds
+}
+
+// formatAffectedRows formats a message like "Delete success, 2 rows affected"
+func formatAffectedRows(message string, count int) string {
+	if count == 1 {
+		return message + ", 1 row affected"
+	}
+	return message + ", " + strconv.Itoa(count) + " rows affected"
+}
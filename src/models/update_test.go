@@ -0,0 +1,150 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	setupSQL(t)
+
+	reply := ""
+	cli.Call("Cluster.Delete", []interface{}{"student", []Predicate{{ColumnName: "name", Operator: "==", Value: "Smith"}}},
+		&reply)
+	if reply != "Delete success" {
+		t.Fatal(reply)
+	}
+	// Smith is split vertically over three nodes, none of the pieces should be left
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{"sid"}, []Predicate{}}, &results)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{{Name: "sid", DataType: TypeInt32}}},
+		Rows: []Row{{0}, {2}},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect rows after delete, expected %v, actual %v", expectedDataset, results)
+	}
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{"age"}, []Predicate{}}, &results)
+	if len(results.Rows) != 2 {
+		t.Errorf("Incorrect rows after delete, expected 2 rows, actual %v", results)
+	}
+
+	cli.Call("Cluster.Delete", []interface{}{"student", []Predicate{{ColumnName: "height", Operator: "==", Value: 1}}},
+		&reply)
+	if reply == "Delete success" {
+		t.Errorf("Deleting by an unknown column should fail")
+	}
+	cli.Call("Cluster.Delete", []interface{}{"teacher", []Predicate{}}, &reply)
+	if reply == "Delete success" {
+		t.Errorf("Deleting from an unknown table should fail")
+	}
+
+	// delete all rows
+	cli.Call("Cluster.Delete", []interface{}{"student", []Predicate{}}, &reply)
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{}, []Predicate{}}, &results)
+	if reply != "Delete success" || len(results.Rows) != 0 {
+		t.Errorf("All rows should be deleted, actual %v", results)
+	}
+}
+
+func TestUpdateMovesRows(t *testing.T) {
+	setupSQL(t)
+
+	// Smith moves from the vertically split fragments on Node0, Node1 and Node2 to the whole row fragment on Node2
+	reply := ""
+	cli.Call("Cluster.Update", []interface{}{
+		"student",
+		[]Assignment{{ColumnName: "grade", Value: 4.0}, {ColumnName: "age", Value: 24}},
+		[]Predicate{{ColumnName: "sid", Operator: "==", Value: 1}},
+	}, &reply)
+	if reply != "Update success" {
+		t.Fatal(reply)
+	}
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "name", DataType: TypeString},
+			{Name: "age", DataType: TypeInt32},
+			{Name: "grade", DataType: TypeFloat},
+		}},
+		Rows: []Row{
+			{0, "John", 22, 4.0},
+			{1, "Smith", 24, 4.0},
+			{2, "Hana", 21, 4.0},
+		},
+	}
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{}, []Predicate{}}, &results)
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect rows after update, expected %v, actual %v", expectedDataset, results)
+	}
+
+	countBefore := []int{network.GetCount("Node0"), network.GetCount("Node1")}
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{"sid"}, []Predicate{}}, &results)
+	if len(results.Rows) != 3 {
+		t.Errorf("Incorrect rows after update, expected 3 rows, actual %v", results)
+	}
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{"name"},
+		[]Predicate{{ColumnName: "grade", Operator: "<=", Value: 3.6}}}, &results)
+	if len(results.Rows) != 0 {
+		t.Errorf("No row should be left in the fragments of grade <= 3.6, actual %v", results)
+	}
+
+	// John moves the other way, and his name is kept on both Node0 and Node1
+	cli.Call("Cluster.Update", []interface{}{
+		"student",
+		[]Assignment{{ColumnName: "grade", Value: 3.0}},
+		[]Predicate{{ColumnName: "name", Operator: "==", Value: "John"}},
+	}, &reply)
+	expectedDataset.Rows[0][3] = 3.0
+	results = Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{}, []Predicate{}}, &results)
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect rows after update, expected %v, actual %v", expectedDataset, results)
+	}
+	if network.GetCount("Node0") <= countBefore[0] || network.GetCount("Node1") <= countBefore[1] {
+		t.Errorf("The updated row should be written to Node0 and Node1")
+	}
+}
+
+func TestSQLDeleteAndUpdate(t *testing.T) {
+	setupSQL(t)
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "UPDATE student SET student.grade = 3.0 WHERE grade > 3.6 AND age < 22", &result)
+	if result.Error != "" || result.Message != "Update success, 1 row affected" {
+		t.Fatalf("Incorrect update result %v", result)
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "DELETE FROM student WHERE grade <= 3.6", &result)
+	if result.Error != "" || result.Message != "Delete success, 2 rows affected" {
+		t.Fatalf("Incorrect delete result %v", result)
+	}
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "SELECT * FROM student NATURAL JOIN courseRegistration", &result)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "name", DataType: TypeString},
+			{Name: "age", DataType: TypeInt32},
+			{Name: "grade", DataType: TypeFloat},
+			{Name: "courseId", DataType: TypeInt32},
+		}},
+		Rows: []Row{
+			{0, "John", 22, 4.0, 0},
+			{0, "John", 22, 4.0, 1},
+		},
+	}
+	if result.Error != "" || !datasetDuplicateChecking(expectedDataset, result.Dataset) {
+		t.Errorf("Incorrect rows after delete, expected %v, actual %v", expectedDataset, result)
+	}
+
+	result = QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "UPDATE student SET height = 1", &result)
+	if result.Error == "" {
+		t.Errorf("Updating an unknown column should fail")
+	}
+}
@@ -5,11 +5,11 @@ import "testing"
 func TestCompareDataset(t *testing.T) {
 	a := Dataset{
 		Schema: TableSchema{
-			"a",
-			[]ColumnSchema {
-				{"c1", TypeInt32},
-				{"c2", TypeFloat},
-				{"c3", TypeString},
+			TableName: "a",
+			ColumnSchemas: []ColumnSchema {
+				{Name: "c1", DataType: TypeInt32},
+				{Name: "c2", DataType: TypeFloat},
+				{Name: "c3", DataType: TypeString},
 			},
 		},
 
@@ -22,11 +22,11 @@ func TestCompareDataset(t *testing.T) {
 
 	b := Dataset{
 		Schema: TableSchema{
-			"b",
-			[]ColumnSchema {
-				{"c3", TypeString},
-				{"c2", TypeFloat},
-				{"c1", TypeInt32},
+			TableName: "b",
+			ColumnSchemas: []ColumnSchema {
+				{Name: "c3", DataType: TypeString},
+				{Name: "c2", DataType: TypeFloat},
+				{Name: "c1", DataType: TypeInt32},
 			},
 		},
 
@@ -61,10 +61,10 @@ func TestCompareDataset(t *testing.T) {
 	caseNum ++
 	b.Rows[0][0] = "3.0"
 	b.Schema.ColumnSchemas = []ColumnSchema {
-		{"c3", TypeString},
-		{"c2", TypeFloat},
-		{"c1", TypeInt32},
-		{"c4", TypeBoolean},
+		{Name: "c3", DataType: TypeString},
+		{Name: "c2", DataType: TypeFloat},
+		{Name: "c1", DataType: TypeInt32},
+		{Name: "c4", DataType: TypeBoolean},
 	}
 	if compareDataset(a, b) {
 		t.Errorf("Two datasets should not be equal, caseNum: %d", caseNum)
@@ -73,9 +73,9 @@ func TestCompareDataset(t *testing.T) {
 	// add a row
 	caseNum ++
 	b.Schema.ColumnSchemas = []ColumnSchema {
-		{"c3", TypeString},
-		{"c2", TypeFloat},
-		{"c1", TypeInt32},
+		{Name: "c3", DataType: TypeString},
+		{Name: "c2", DataType: TypeFloat},
+		{Name: "c1", DataType: TypeInt32},
 	}
 	b.Rows = []Row{
 		{"4.0", 4.0, 4},
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// modes of FragmentWrite to handle the values whose types differ from their columns
+const (
+	// reject the row
+	WriteStrict = "strict"
+	// coerce the values by the Row getters, e.g., "22" to int32(22) for an INT32 column, and report the columns
+	WriteLenient = "lenient"
+)
+
+// isValueOfType checks whether a value can be stored in a column of the given data type as it is. NULL (nil) fits any
+// type, integers fit a float column, and an integer fits an INT32 column only if it is in the range of int32.
+func isValueOfType(dataType int, value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case int:
+		return dataType == TypeInt64 || dataType == TypeFloat || dataType == TypeDouble ||
+			dataType == TypeInt32 && v >= math.MinInt32 && v <= math.MaxInt32
+	case int32:
+		return dataType == TypeInt32 || dataType == TypeInt64 || dataType == TypeFloat || dataType == TypeDouble
+	case int64:
+		return dataType == TypeInt64 || dataType == TypeFloat || dataType == TypeDouble ||
+			dataType == TypeInt32 && v >= math.MinInt32 && v <= math.MaxInt32
+	case float32, float64:
+		return dataType == TypeFloat || dataType == TypeDouble
+	case bool:
+		return dataType == TypeBoolean
+	case string:
+		return dataType == TypeString
+	case time.Time:
+		return dataType == TypeDate || dataType == TypeTimestamp
+	case Decimal:
+		return dataType == TypeDecimal
+	case []byte:
+		return dataType == TypeBytes
+	}
+	return false
+}
+
+// coerceValue converts a value into the given data type by the Row getters
+func coerceValue(dataType int, value interface{}) (interface{}, error) {
+	row := Row{value}
+	switch dataType {
+	case TypeInt32:
+		// the getter truncates an integer out of the range of int32, which is rejected instead of being stored wrongly
+		if v, err := row.getInt64Value(0); err == nil && (v < math.MinInt32 || v > math.MaxInt32) {
+			return nil, fmt.Errorf("%d is out of the range of INT32", v)
+		}
+		return row.getInt32Value(0)
+	case TypeInt64:
+		return row.getInt64Value(0)
+	case TypeFloat:
+		return row.getFloat32Value(0)
+	case TypeDouble:
+		return row.getFloat64Value(0)
+	case TypeBoolean:
+		return row.getBoolValue(0)
+	case TypeString:
+		return row.getStringValue(0)
+	case TypeDate:
+		return row.getDateValue(0)
+	case TypeTimestamp:
+		return row.getTimestampValue(0)
+	case TypeDecimal:
+		return row.getDecimalValue(0)
+	case TypeBytes:
+		return row.getBytesValue(0)
+	}
+	return nil, fmt.Errorf("unknown data type %d", dataType)
+}
+
+// validateRow checks the arity of a row and the type of each value against the schema. In the lenient mode, the values
+// of other types are coerced, and the names of their columns are returned with the coerced row, while the strict mode
+// fails on them.
+func (schema *TableSchema) validateRow(row Row, mode string) (Row, []string, error) {
+	if len(row) != len(schema.ColumnSchemas) {
+		return nil, nil, fmt.Errorf("expected %d values but got %d", len(schema.ColumnSchemas), len(row))
+	}
+	var coercedColumns []string
+	validated := make(Row, len(row))
+	for i, column := range schema.ColumnSchemas {
+		validated[i] = row[i]
+		if isValueOfType(column.DataType, row[i]) {
+			continue
+		}
+		if mode != WriteLenient {
+			return nil, nil, fmt.Errorf("column %s expects %s but got %v (%T)", column.Name,
+				getDataTypeName(column.DataType), row[i], row[i])
+		}
+		value, err := coerceValue(column.DataType, row[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot coerce %v (%T) of column %s to %s", row[i], row[i], column.Name,
+				getDataTypeName(column.DataType))
+		}
+		validated[i] = value
+		coercedColumns = append(coercedColumns, column.Name)
+	}
+	return validated, coercedColumns, nil
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func setupValidation(t *testing.T) {
+	setupScript(t, `
+		CREATE TABLE student (sid INT32, name STRING, age INT32, grade FLOAT)
+		PARTITION BY (NODE 0 WHERE grade <= 3.6, NODE 1 WHERE grade > 3.6)`)
+}
+
+func TestStrictWrite(t *testing.T) {
+	setupValidation(t)
+
+	for _, test := range []struct {
+		row Row
+		column string
+	}{
+		{Row{"3", "Tom", 22, 3.0}, "sid"},
+		{Row{3, 4, 22, 3.0}, "name"},
+		{Row{3, "Tom", 22.5, 3.0}, "age"},
+		{Row{3, "Tom", int64(1) << 40, 3.0}, "age"},
+		{Row{3, "Tom", 22, "3.0"}, "grade"},
+		{Row{3, "Tom", 22, true}, "grade"},
+	} {
+		replyMsg := ""
+		cli.Call("Cluster.FragmentWrite", []interface{}{"student", test.row}, &replyMsg)
+		if !strings.HasPrefix(replyMsg, "Fragment write error: column " + test.column + " expects") {
+			t.Errorf("Writing %v should fail on column %s, actual %s", test.row, test.column, replyMsg)
+		}
+	}
+	for _, row := range []Row{{3, "Tom"}, {3, "Tom", 22, 3.0, 1}} {
+		replyMsg := ""
+		cli.Call("Cluster.FragmentWrite", []interface{}{"student", row}, &replyMsg)
+		if !strings.HasPrefix(replyMsg, "Fragment write error: expected 4 values") {
+			t.Errorf("Writing %v should fail on its arity, actual %s", row, replyMsg)
+		}
+	}
+
+	// integers fit float columns, and NULL fits any column
+	for _, row := range []Row{{3, "Tom", int32(22), 3}, {int64(4), nil, nil, float32(3.5)}} {
+		replyMsg := ""
+		cli.Call("Cluster.FragmentWrite", []interface{}{"student", row, WriteStrict}, &replyMsg)
+		if replyMsg != "Fragment write success" {
+			t.Errorf("Writing %v should succeed, actual %s", row, replyMsg)
+		}
+	}
+
+	result := QueryResult{}
+	cli.Call("Cluster.ExecuteSQL", "UPDATE student SET age = '23' WHERE sid = 3", &result)
+	if !strings.HasPrefix(result.Error, "Update error: column age expects INT32") {
+		t.Errorf("Updating age to a string should fail, actual %v", result)
+	}
+	cli.Call("Cluster.ExecuteSQL", "INSERT INTO student VALUES (5, 'Ann', 20, 'good')", &result)
+	if result.Error == "" {
+		t.Errorf("Inserting a string into a float column should fail")
+	}
+}
+
+func TestLenientWrite(t *testing.T) {
+	setupValidation(t)
+
+	replyMsg := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{"student", Row{"3", "Tom", 22.0, "3.5"}, WriteLenient}, &replyMsg)
+	if replyMsg != "Fragment write success, coerced columns: sid, age, grade" {
+		t.Errorf("Incorrect reply of a lenient write: %s", replyMsg)
+	}
+	replyMsg = ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{"student", Row{4, 5, 23, 3.9}, WriteLenient}, &replyMsg)
+	if replyMsg != "Fragment write success, coerced columns: name" {
+		t.Errorf("Incorrect reply of a lenient write: %s", replyMsg)
+	}
+	replyMsg = ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{"student", Row{5, "Ann", 20, 3.0}, WriteLenient}, &replyMsg)
+	if replyMsg != "Fragment write success" {
+		t.Errorf("Nothing should be coerced, actual %s", replyMsg)
+	}
+	replyMsg = ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{"student", Row{"three", "Tom", 22, 3.5}, WriteLenient}, &replyMsg)
+	if !strings.HasPrefix(replyMsg, "Fragment write error: cannot coerce three (string) of column sid") {
+		t.Errorf("Writing a non-numeric sid should fail, actual %s", replyMsg)
+	}
+	for _, sid := range []interface{}{int64(1) << 40, 1 << 40, "1099511627776"} {
+		replyMsg = ""
+		cli.Call("Cluster.FragmentWrite", []interface{}{"student", Row{sid, "Tom", 22, 3.5}, WriteLenient}, &replyMsg)
+		if !strings.HasPrefix(replyMsg, "Fragment write error: cannot coerce 1099511627776") {
+			t.Errorf("Writing %v (%T) to an INT32 column should fail, actual %s", sid, sid, replyMsg)
+		}
+	}
+
+	// the coerced values are stored in the types returned by the getters and routed by them
+	results := Dataset{}
+	cli.Call("Cluster.Select", []interface{}{"student", []string{},
+		[]Predicate{{ColumnName: "sid", Operator: "<=", Value: 4}}}, &results)
+	expectedDataset := Dataset{
+		Schema: TableSchema{TableName: "", ColumnSchemas: []ColumnSchema{
+			{Name: "sid", DataType: TypeInt32},
+			{Name: "name", DataType: TypeString},
+			{Name: "age", DataType: TypeInt32},
+			{Name: "grade", DataType: TypeFloat},
+		}},
+		Rows: []Row{{int32(3), "Tom", int32(22), float32(3.5)}, {4, "5", 23, 3.9}},
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect select results, expected %v, actual %v", expectedDataset, results)
+	}
+}
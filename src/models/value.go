@@ -0,0 +1,244 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the layouts accepted when a string is converted into a date or a timestamp, tried in order
+var timeLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339,
+	time.RFC3339Nano,
+}
+
+// Decimal is an exact decimal number whose value is Unscaled * 10^(-Scale). Decimals are always normalized by stripping
+// the trailing zeros of the fraction, so that equal numbers are equal structs and can be compared by == or used as keys.
+type Decimal struct {
+	Unscaled int64
+	Scale int32
+}
+
+// NewDecimal returns the normalized decimal of unscaled * 10^(-scale)
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	for scale > 0 && unscaled % 10 == 0 {
+		unscaled /= 10
+		scale--
+	}
+	if unscaled == 0 {
+		scale = 0
+	}
+	return Decimal{Unscaled: unscaled, Scale: scale}
+}
+
+// ParseDecimal parses a decimal like "-12.50", and fails if the digits do not fit in an int64
+func ParseDecimal(s string) (Decimal, error) {
+	text := strings.TrimSpace(s)
+	sign := ""
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		sign, text = text[:1], text[1:]
+	}
+	integer, fraction := text, ""
+	if point := strings.Index(text, "."); point >= 0 {
+		integer, fraction = text[:point], text[point + 1:]
+	}
+	if integer == "" && fraction == "" || !isDigits(integer) || !isDigits(fraction) {
+		return Decimal{}, errors.New("invalid decimal " + s)
+	}
+	unscaled, err := strconv.ParseInt(sign + integer + fraction, 10, 64)
+	if err != nil {
+		return Decimal{}, errors.New("decimal " + s + " is out of range")
+	}
+	return NewDecimal(unscaled, int32(len(fraction))), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the decimal without trailing zeros, e.g., "-12.5"
+func (d Decimal) String() string {
+	digits := strconv.FormatInt(d.Unscaled, 10)
+	sign := ""
+	if d.Unscaled < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if d.Scale <= 0 {
+		return sign + digits + strings.Repeat("0", int(-d.Scale))
+	}
+	if len(digits) <= int(d.Scale) {
+		digits = strings.Repeat("0", int(d.Scale) - len(digits) + 1) + digits
+	}
+	point := len(digits) - int(d.Scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Cmp returns -1, 0 or 1 if the decimal is less than, equal to or greater than the other one
+func (d Decimal) Cmp(other Decimal) int {
+	return d.bigInt(other.Scale).Cmp(other.bigInt(d.Scale))
+}
+
+// bigInt returns the unscaled value of the decimal scaled to max(d.Scale, scale), which cannot overflow
+func (d Decimal) bigInt(scale int32) *big.Int {
+	value := big.NewInt(d.Unscaled)
+	if scale > d.Scale {
+		exp := big.NewInt(0).Exp(big.NewInt(10), big.NewInt(int64(scale - d.Scale)), nil)
+		value.Mul(value, exp)
+	}
+	return value
+}
+
+// toTime converts a value into a timestamp in UTC, or the midnight of a date if dateOnly is set. Strings are parsed by
+// the timeLayouts, where a timestamp without a zone is taken as UTC.
+func toTime(value interface{}, dateOnly bool) (time.Time, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case string:
+		parsed := false
+		for _, layout := range timeLayouts {
+			if result, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				t, parsed = result, true
+				break
+			}
+		}
+		if !parsed {
+			return time.Time{}, errors.New("invalid time " + v)
+		}
+	default:
+		return time.Time{}, errors.New("unknown data type")
+	}
+	t = t.UTC()
+	if dateOnly {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	// drop the monotonic clock reading so that equal times are equal structs
+	return t.Round(0), nil
+}
+
+// toDecimal converts a value into a decimal, where floats are converted by their shortest decimal representations
+func toDecimal(value interface{}) (Decimal, error) {
+	switch v := value.(type) {
+	case Decimal:
+		return NewDecimal(v.Unscaled, v.Scale), nil
+	case int:
+		return NewDecimal(int64(v), 0), nil
+	case int32:
+		return NewDecimal(int64(v), 0), nil
+	case int64:
+		return NewDecimal(v, 0), nil
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return Decimal{}, errors.New("invalid decimal")
+		}
+		return ParseDecimal(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return Decimal{}, errors.New("invalid decimal")
+		}
+		return ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	case string:
+		return ParseDecimal(v)
+	default:
+		return Decimal{}, errors.New("unknown data type")
+	}
+}
+
+// toBytes converts a value into bytes, where a string is taken as its UTF-8 encoding
+func toBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, errors.New("unknown data type")
+	}
+}
+
+// normalizeValue converts a non-NULL value of a date, timestamp, decimal or bytes column into its canonical Go type,
+// i.e., time.Time in UTC, Decimal and []byte, so that equal values are stored equally. Values of other types are kept.
+func normalizeValue(dataType int, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch dataType {
+	case TypeDate:
+		return toTime(value, true)
+	case TypeTimestamp:
+		return toTime(value, false)
+	case TypeDecimal:
+		return toDecimal(value)
+	case TypeBytes:
+		return toBytes(value)
+	}
+	return value, nil
+}
+
+// getNormalizedRow returns a copy of the row of the given schema whose values are normalized by normalizeValue
+func (schema *TableSchema) getNormalizedRow(row Row) (Row, error) {
+	normalized := make(Row, len(row))
+	copy(normalized, row)
+	for i, column := range schema.ColumnSchemas {
+		if i >= len(row) {
+			break
+		}
+		value, err := normalizeValue(column.DataType, row[i])
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %v of column %s to %s", row[i], column.Name,
+				getDataTypeName(column.DataType))
+		}
+		normalized[i] = value
+	}
+	return normalized, nil
+}
+
+// valuesEqual compares two values by ==, except that bytes are compared by their contents and other uncomparable
+// values by reflect.DeepEqual, on which == panics
+func valuesEqual(a interface{}, b interface{}) bool {
+	if bytesA, ok := a.([]byte); ok {
+		bytesB, ok := b.([]byte)
+		return ok && bytes.Equal(bytesA, bytesB)
+	}
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !reflect.TypeOf(a).Comparable() || !reflect.TypeOf(b).Comparable() {
+		return reflect.DeepEqual(a, b)
+	}
+	return a == b
+}
+
+// Add returns the sum of two decimals, and fails if the digits of the sum do not fit in an int64
+func (d Decimal) Add(other Decimal) (Decimal, error) {
+	scale := d.Scale
+	if other.Scale > scale {
+		scale = other.Scale
+	}
+	sum := big.NewInt(0).Add(d.bigInt(scale), other.bigInt(scale))
+	if !sum.IsInt64() {
+		return Decimal{}, errors.New("decimal " + d.String() + " + " + other.String() + " is out of range")
+	}
+	return NewDecimal(sum.Int64(), scale), nil
+}
+
+// Float64 returns the nearest float64 of the decimal
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
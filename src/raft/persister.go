@@ -0,0 +1,114 @@
+package raft
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Persister keeps the state of a Raft peer and the latest snapshot of its service, which survive a crash of the peer.
+// The state and the snapshot are saved together, so that they are always consistent with each other. A persister made
+// by MakePersister only keeps them in memory, where a crash is simulated by handing a copy to the restarted peer, while
+// one made by MakeFilePersister keeps them in a file.
+type Persister struct {
+	mu sync.Mutex
+	raftState []byte
+	snapshot []byte
+	// the file keeping the state and the snapshot, empty if they are only kept in memory
+	path string
+}
+
+// MakePersister creates a persister keeping the state and the snapshot in memory
+func MakePersister() *Persister {
+	return &Persister{}
+}
+
+// MakeFilePersister creates a persister keeping the state and the snapshot in the file of the given path, and loads
+// them if the file exists
+func MakeFilePersister(path string) (*Persister, error) {
+	ps := &Persister{path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ps, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 || int(binary.LittleEndian.Uint32(data)) > len(data) - 4 {
+		return nil, errors.New("corrupted raft state in " + path)
+	}
+	size := int(binary.LittleEndian.Uint32(data))
+	ps.raftState = data[4:4 + size]
+	ps.snapshot = data[4 + size:]
+	return ps, nil
+}
+
+// Copy returns a persister in memory holding the same state and snapshot
+func (ps *Persister) Copy() *Persister {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return &Persister{raftState: ps.raftState, snapshot: ps.snapshot}
+}
+
+// ReadRaftState returns the saved state of the peer
+func (ps *Persister) ReadRaftState() []byte {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return clone(ps.raftState)
+}
+
+// RaftStateSize returns the size of the saved state of the peer, which grows with its log until it is compacted
+func (ps *Persister) RaftStateSize() int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.raftState)
+}
+
+// ReadSnapshot returns the saved snapshot of the service
+func (ps *Persister) ReadSnapshot() []byte {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return clone(ps.snapshot)
+}
+
+// SnapshotSize returns the size of the saved snapshot of the service
+func (ps *Persister) SnapshotSize() int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.snapshot)
+}
+
+// Save saves the state of the peer together with the snapshot of the service, replacing the saved ones atomically. A
+// peer that cannot save its state would break the promises it has made to the others, so Save panics if the file
+// cannot be written.
+func (ps *Persister) Save(raftState []byte, snapshot []byte) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.raftState = clone(raftState)
+	ps.snapshot = clone(snapshot)
+	if ps.path == "" {
+		return
+	}
+
+	data := make([]byte, 4, 4 + len(raftState) + len(snapshot))
+	binary.LittleEndian.PutUint32(data, uint32(len(raftState)))
+	data = append(append(data, raftState...), snapshot...)
+	file, err := os.Create(ps.path + ".tmp")
+	if err == nil {
+		if _, err = file.Write(data); err == nil {
+			err = file.Sync()
+		}
+		file.Close()
+	}
+	if err == nil {
+		err = os.Rename(ps.path + ".tmp", ps.path)
+	}
+	if err != nil {
+		panic("cannot save raft state: " + err.Error())
+	}
+}
+
+func clone(data []byte) []byte {
+	return append([]byte(nil), data...)
+}
@@ -0,0 +1,653 @@
+// Package raft implements the Raft consensus algorithm on top of labrpc, which replicates a log of commands among a
+// group of peers so that a service built on it behaves as a single state machine as long as a majority of the peers
+// can communicate. The interface follows that of the MIT 6.824 labs: a service submits commands by Start, and
+// receives the committed commands in order through the channel given to Make. The log is compacted by the snapshots
+// of the service, see Raft.Snapshot, and a peer lagging behind the snapshot of the leader receives it instead of the
+// discarded entries.
+package raft
+
+import (
+	"../labgob"
+	"bytes"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the timing of a peer, where the election timeout of each election is chosen randomly in
+// [electionTimeout, 2 * electionTimeout), so that peers rarely split votes
+const (
+	heartbeatInterval = 100 * time.Millisecond
+	electionTimeout = 300 * time.Millisecond
+)
+
+// the roles of a peer
+const (
+	follower = iota
+	candidate
+	leader
+)
+
+// Peer is an end through which a peer calls the RPCs of another peer, e.g., a *labrpc.ClientEnd. Call returns false if
+// no reply is received.
+type Peer interface {
+	Call(svcMeth string, args interface{}, reply interface{}) bool
+}
+
+// ApplyMsg is sent to the service on the apply channel, either for a committed command or for a snapshot received from
+// the leader, which replaces the state of the service
+type ApplyMsg struct {
+	CommandValid bool
+	Command interface{}
+	CommandIndex int
+	CommandTerm int
+
+	SnapshotValid bool
+	Snapshot []byte
+	SnapshotIndex int
+	SnapshotTerm int
+}
+
+// LogEntry is an entry of the log of a peer
+type LogEntry struct {
+	Index int
+	Term int
+	Command interface{}
+}
+
+// Raft is a peer of a Raft group. The RPCs of the peer, i.e., RequestVote, AppendEntries and InstallSnapshot, should be
+// served by a labrpc service made from it.
+type Raft struct {
+	mu sync.Mutex
+	peers []Peer
+	persister *Persister
+	me int
+	dead int32
+	applyCh chan ApplyMsg
+	applyCond *sync.Cond
+
+	// the state saved by the persister
+	currentTerm int
+	votedFor int
+	// log[0] is the last entry included in the snapshot, whose command is dropped, or a dummy entry of index 0
+	log []LogEntry
+
+	role int
+	commitIndex int
+	lastApplied int
+	electionDeadline time.Time
+	heartbeatDeadline time.Time
+	// the snapshot received from the leader, which is to be sent to the service
+	pendingSnapshot *ApplyMsg
+
+	// the replication state of the followers, only used by a leader
+	nextIndex []int
+	matchIndex []int
+}
+
+// Make creates a peer of the group whose peers are reached by the given ends, where peers[me] is the peer itself. The
+// peer restores the state saved by the persister, if any, and sends the committed commands to applyCh. Make returns
+// quickly, while the peer works in the background until it is killed.
+func Make(peers []Peer, me int, persister *Persister, applyCh chan ApplyMsg) *Raft {
+	rf := &Raft{
+		peers: peers,
+		persister: persister,
+		me: me,
+		applyCh: applyCh,
+		votedFor: -1,
+		log: []LogEntry{{}},
+		role: follower,
+	}
+	rf.applyCond = sync.NewCond(&rf.mu)
+	rf.readPersist(persister.ReadRaftState())
+	// the commands in the snapshot are applied by the service when it restores the snapshot
+	rf.commitIndex = rf.log[0].Index
+	rf.lastApplied = rf.log[0].Index
+	rf.resetElectionTimer()
+
+	go rf.ticker()
+	go rf.applier()
+	return rf
+}
+
+// GetState returns the current term of the peer and whether it believes it is the leader
+func (rf *Raft) GetState() (int, bool) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.currentTerm, rf.role == leader
+}
+
+// Start proposes a command to be appended to the log if the peer is the leader, and returns the index the command
+// will have if it is ever committed, the current term and whether the peer is the leader. It returns immediately
+// without waiting for the command to be committed, and there is no guarantee that it ever will be.
+func (rf *Raft) Start(command interface{}) (int, int, bool) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.role != leader || rf.killed() {
+		return -1, rf.currentTerm, false
+	}
+	index := rf.lastIndex() + 1
+	rf.log = append(rf.log, LogEntry{Index: index, Term: rf.currentTerm, Command: command})
+	rf.persist()
+	rf.broadcast()
+	rf.advanceCommitIndex()
+	return index, rf.currentTerm, true
+}
+
+// Campaign makes the peer start an election at once unless it is the leader, e.g., so that a new group need not wait
+// for an election timeout before its first leader is elected.
+func (rf *Raft) Campaign() {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.role != leader && !rf.killed() {
+		rf.startElection()
+	}
+}
+
+// Snapshot tells the peer that the service has taken a snapshot of its state including the commands up to the given
+// index, so that the entries up to the index are discarded from the log. The service may take the snapshot as soon as
+// it receives the command of the index, before the peer has recorded it as applied, so the index is only checked to be
+// committed.
+func (rf *Raft) Snapshot(index int, snapshot []byte) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if index <= rf.log[0].Index || index > rf.commitIndex || rf.killed() {
+		return
+	}
+	rf.log = append([]LogEntry{{Index: index, Term: rf.entry(index).Term}}, rf.log[index - rf.log[0].Index + 1:]...)
+	rf.persister.Save(rf.encodeState(), snapshot)
+}
+
+// Kill stops the peer, which no longer sends RPCs or applies commands
+func (rf *Raft) Kill() {
+	atomic.StoreInt32(&rf.dead, 1)
+	rf.mu.Lock()
+	rf.applyCond.Broadcast()
+	rf.mu.Unlock()
+}
+
+func (rf *Raft) killed() bool {
+	return atomic.LoadInt32(&rf.dead) == 1
+}
+
+func (rf *Raft) lastIndex() int {
+	return rf.log[len(rf.log) - 1].Index
+}
+
+func (rf *Raft) lastTerm() int {
+	return rf.log[len(rf.log) - 1].Term
+}
+
+// entry returns the entry of the given index, which should not be discarded by the snapshot
+func (rf *Raft) entry(index int) LogEntry {
+	return rf.log[index - rf.log[0].Index]
+}
+
+func (rf *Raft) encodeState() []byte {
+	buffer := new(bytes.Buffer)
+	encoder := labgob.NewEncoder(buffer)
+	encoder.Encode(rf.currentTerm)
+	encoder.Encode(rf.votedFor)
+	encoder.Encode(rf.log)
+	return buffer.Bytes()
+}
+
+// persist saves the state of the peer, which must be done before the peer replies to an RPC or sends one that
+// depends on the state. A killed peer saves nothing, as its persister may be handed to its successor.
+func (rf *Raft) persist() {
+	if rf.killed() {
+		return
+	}
+	rf.persister.Save(rf.encodeState(), rf.persister.ReadSnapshot())
+}
+
+func (rf *Raft) readPersist(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	decoder := labgob.NewDecoder(bytes.NewBuffer(data))
+	var currentTerm, votedFor int
+	var log []LogEntry
+	if decoder.Decode(&currentTerm) != nil || decoder.Decode(&votedFor) != nil || decoder.Decode(&log) != nil {
+		panic("cannot decode raft state")
+	}
+	rf.currentTerm = currentTerm
+	rf.votedFor = votedFor
+	rf.log = log
+}
+
+func (rf *Raft) resetElectionTimer() {
+	timeout := electionTimeout + time.Duration(rand.Int63n(int64(electionTimeout)))
+	rf.electionDeadline = time.Now().Add(timeout)
+}
+
+// becomeFollower turns the peer into a follower of a term no older than its current one, the caller should persist
+// the state
+func (rf *Raft) becomeFollower(term int) {
+	if term > rf.currentTerm {
+		rf.currentTerm = term
+		rf.votedFor = -1
+	}
+	rf.role = follower
+}
+
+// ticker starts an election if the peer has heard nothing from a leader for an election timeout, or sends heartbeats
+// if it is the leader
+func (rf *Raft) ticker() {
+	for !rf.killed() {
+		rf.mu.Lock()
+		now := time.Now()
+		var deadline time.Time
+		if rf.role == leader {
+			if !now.Before(rf.heartbeatDeadline) {
+				rf.broadcast()
+			}
+			deadline = rf.heartbeatDeadline
+		} else {
+			if !now.Before(rf.electionDeadline) {
+				rf.startElection()
+			}
+			deadline = rf.electionDeadline
+		}
+		rf.mu.Unlock()
+
+		sleep := time.Until(deadline)
+		if sleep < 5 * time.Millisecond {
+			sleep = 5 * time.Millisecond
+		} else if sleep > heartbeatInterval {
+			sleep = heartbeatInterval
+		}
+		time.Sleep(sleep)
+	}
+}
+
+// RequestVoteArgs is the argument of RequestVote
+type RequestVoteArgs struct {
+	Term int
+	CandidateId int
+	LastLogIndex int
+	LastLogTerm int
+}
+
+// RequestVoteReply is the reply of RequestVote
+type RequestVoteReply struct {
+	Term int
+	VoteGranted bool
+}
+
+// RequestVote is the RPC by which a candidate asks for the vote of the peer, which is granted if the peer has not voted
+// for another candidate in the term and the log of the candidate is at least as up-to-date as its own
+func (rf *Raft) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if args.Term > rf.currentTerm {
+		rf.becomeFollower(args.Term)
+		rf.persist()
+	}
+	reply.Term = rf.currentTerm
+	if args.Term < rf.currentTerm {
+		return
+	}
+	upToDate := args.LastLogTerm > rf.lastTerm() ||
+		args.LastLogTerm == rf.lastTerm() && args.LastLogIndex >= rf.lastIndex()
+	if (rf.votedFor == -1 || rf.votedFor == args.CandidateId) && upToDate {
+		rf.votedFor = args.CandidateId
+		rf.persist()
+		reply.VoteGranted = true
+		rf.resetElectionTimer()
+	}
+}
+
+// startElection turns the peer into a candidate of a new term and asks the other peers for their votes
+func (rf *Raft) startElection() {
+	rf.role = candidate
+	rf.currentTerm++
+	rf.votedFor = rf.me
+	rf.persist()
+	rf.resetElectionTimer()
+
+	term := rf.currentTerm
+	args := RequestVoteArgs{Term: term, CandidateId: rf.me, LastLogIndex: rf.lastIndex(), LastLogTerm: rf.lastTerm()}
+	votes := 1
+	if votes * 2 > len(rf.peers) {
+		rf.becomeLeader()
+		return
+	}
+	for server := range rf.peers {
+		if server == rf.me {
+			continue
+		}
+		go func(server int) {
+			reply := RequestVoteReply{}
+			if !rf.peers[server].Call("Raft.RequestVote", &args, &reply) {
+				return
+			}
+			rf.mu.Lock()
+			defer rf.mu.Unlock()
+			if reply.Term > rf.currentTerm {
+				rf.becomeFollower(reply.Term)
+				rf.persist()
+				return
+			}
+			if rf.role != candidate || rf.currentTerm != term || !reply.VoteGranted {
+				return
+			}
+			votes++
+			if votes * 2 > len(rf.peers) {
+				rf.becomeLeader()
+			}
+		}(server)
+	}
+}
+
+func (rf *Raft) becomeLeader() {
+	rf.role = leader
+	rf.nextIndex = make([]int, len(rf.peers))
+	rf.matchIndex = make([]int, len(rf.peers))
+	for server := range rf.peers {
+		rf.nextIndex[server] = rf.lastIndex() + 1
+	}
+	rf.broadcast()
+}
+
+// AppendEntriesArgs is the argument of AppendEntries
+type AppendEntriesArgs struct {
+	Term int
+	LeaderId int
+	PrevLogIndex int
+	PrevLogTerm int
+	Entries []LogEntry
+	LeaderCommit int
+}
+
+// AppendEntriesReply is the reply of AppendEntries. If the log of the peer does not match the leader at PrevLogIndex,
+// ConflictIndex is the index from which the leader should retry, which skips the entries of ConflictTerm if it is not
+// -1.
+type AppendEntriesReply struct {
+	Term int
+	Success bool
+	ConflictIndex int
+	ConflictTerm int
+}
+
+// AppendEntries is the RPC by which the leader replicates its log to the peer, which also serves as a heartbeat
+func (rf *Raft) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if args.Term > rf.currentTerm {
+		rf.becomeFollower(args.Term)
+		rf.persist()
+	}
+	reply.Term = rf.currentTerm
+	if args.Term < rf.currentTerm {
+		return
+	}
+	rf.becomeFollower(args.Term)
+	rf.resetElectionTimer()
+
+	reply.ConflictTerm = -1
+	if args.PrevLogIndex < rf.log[0].Index {
+		// the entries in the snapshot are committed, so the leader retries after them
+		reply.ConflictIndex = rf.log[0].Index + 1
+		return
+	}
+	if args.PrevLogIndex > rf.lastIndex() {
+		reply.ConflictIndex = rf.lastIndex() + 1
+		return
+	}
+	if term := rf.entry(args.PrevLogIndex).Term; term != args.PrevLogTerm {
+		reply.ConflictTerm = term
+		reply.ConflictIndex = args.PrevLogIndex
+		for reply.ConflictIndex - 1 > rf.log[0].Index && rf.entry(reply.ConflictIndex - 1).Term == term {
+			reply.ConflictIndex--
+		}
+		return
+	}
+
+	// the log is truncated only if it conflicts with the entries, which may be delivered out of order
+	for i, entry := range args.Entries {
+		if entry.Index <= rf.lastIndex() {
+			if rf.entry(entry.Index).Term == entry.Term {
+				continue
+			}
+			rf.log = rf.log[:entry.Index - rf.log[0].Index]
+		}
+		rf.log = append(rf.log, args.Entries[i:]...)
+		rf.persist()
+		break
+	}
+	if lastNew := args.PrevLogIndex + len(args.Entries); args.LeaderCommit > rf.commitIndex && lastNew > rf.commitIndex {
+		rf.commitIndex = args.LeaderCommit
+		if lastNew < rf.commitIndex {
+			rf.commitIndex = lastNew
+		}
+		rf.applyCond.Broadcast()
+	}
+	reply.Success = true
+}
+
+// InstallSnapshotArgs is the argument of InstallSnapshot
+type InstallSnapshotArgs struct {
+	Term int
+	LeaderId int
+	LastIncludedIndex int
+	LastIncludedTerm int
+	Data []byte
+}
+
+// InstallSnapshotReply is the reply of InstallSnapshot
+type InstallSnapshotReply struct {
+	Term int
+}
+
+// InstallSnapshot is the RPC by which the leader sends its snapshot to a peer lagging behind it, whose log is replaced
+// by the snapshot unless the log extends it
+func (rf *Raft) InstallSnapshot(args *InstallSnapshotArgs, reply *InstallSnapshotReply) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if args.Term > rf.currentTerm {
+		rf.becomeFollower(args.Term)
+		rf.persist()
+	}
+	reply.Term = rf.currentTerm
+	if args.Term < rf.currentTerm {
+		return
+	}
+	rf.becomeFollower(args.Term)
+	rf.resetElectionTimer()
+	if args.LastIncludedIndex <= rf.commitIndex || rf.killed() {
+		return
+	}
+
+	// a follower already holding the last entry of the snapshot applies its own entries instead, so that the service
+	// sees every command in the log
+	if args.LastIncludedIndex <= rf.lastIndex() && rf.entry(args.LastIncludedIndex).Term == args.LastIncludedTerm {
+		rf.commitIndex = args.LastIncludedIndex
+		rf.applyCond.Broadcast()
+		return
+	}
+	rf.log = []LogEntry{{Index: args.LastIncludedIndex, Term: args.LastIncludedTerm}}
+	rf.commitIndex = args.LastIncludedIndex
+	rf.persister.Save(rf.encodeState(), args.Data)
+	rf.pendingSnapshot = &ApplyMsg{
+		SnapshotValid: true,
+		Snapshot: args.Data,
+		SnapshotIndex: args.LastIncludedIndex,
+		SnapshotTerm: args.LastIncludedTerm,
+	}
+	rf.applyCond.Broadcast()
+}
+
+// broadcast sends the entries that each follower lacks, or heartbeats if there are none
+func (rf *Raft) broadcast() {
+	rf.heartbeatDeadline = time.Now().Add(heartbeatInterval)
+	for server := range rf.peers {
+		if server != rf.me {
+			go rf.replicate(server)
+		}
+	}
+}
+
+// replicate sends the entries from the next index of a follower, or the snapshot if the entries have been discarded
+func (rf *Raft) replicate(server int) {
+	rf.mu.Lock()
+	if rf.role != leader || rf.killed() {
+		rf.mu.Unlock()
+		return
+	}
+	term := rf.currentTerm
+	if rf.nextIndex[server] <= rf.log[0].Index {
+		args := InstallSnapshotArgs{
+			Term: term,
+			LeaderId: rf.me,
+			LastIncludedIndex: rf.log[0].Index,
+			LastIncludedTerm: rf.log[0].Term,
+			Data: rf.persister.ReadSnapshot(),
+		}
+		rf.mu.Unlock()
+		reply := InstallSnapshotReply{}
+		if !rf.peers[server].Call("Raft.InstallSnapshot", &args, &reply) {
+			return
+		}
+		rf.mu.Lock()
+		defer rf.mu.Unlock()
+		if reply.Term > rf.currentTerm {
+			rf.becomeFollower(reply.Term)
+			rf.persist()
+			return
+		}
+		if rf.role == leader && rf.currentTerm == term {
+			rf.updateMatchIndex(server, args.LastIncludedIndex)
+		}
+		return
+	}
+
+	prevLogIndex := rf.nextIndex[server] - 1
+	args := AppendEntriesArgs{
+		Term: term,
+		LeaderId: rf.me,
+		PrevLogIndex: prevLogIndex,
+		PrevLogTerm: rf.entry(prevLogIndex).Term,
+		Entries: append([]LogEntry(nil), rf.log[prevLogIndex - rf.log[0].Index + 1:]...),
+		LeaderCommit: rf.commitIndex,
+	}
+	rf.mu.Unlock()
+	reply := AppendEntriesReply{}
+	if !rf.peers[server].Call("Raft.AppendEntries", &args, &reply) {
+		return
+	}
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if reply.Term > rf.currentTerm {
+		rf.becomeFollower(reply.Term)
+		rf.persist()
+		return
+	}
+	if rf.role != leader || rf.currentTerm != term {
+		return
+	}
+	if reply.Success {
+		rf.updateMatchIndex(server, prevLogIndex + len(args.Entries))
+		return
+	}
+	// a stale reply received out of order may move the next index back, which only causes entries to be resent
+	nextIndex := reply.ConflictIndex
+	if reply.ConflictTerm >= 0 {
+		for index := rf.lastIndex(); index > rf.log[0].Index; index-- {
+			if term := rf.entry(index).Term; term == reply.ConflictTerm {
+				nextIndex = index + 1
+				break
+			} else if term < reply.ConflictTerm {
+				break
+			}
+		}
+	}
+	if nextIndex < 1 {
+		nextIndex = 1
+	}
+	if nextIndex != rf.nextIndex[server] {
+		rf.nextIndex[server] = nextIndex
+		go rf.replicate(server)
+	}
+}
+
+// updateMatchIndex records that a follower holds the entries up to the given index, and commits the entries held by a
+// majority
+func (rf *Raft) updateMatchIndex(server int, index int) {
+	if index > rf.matchIndex[server] {
+		rf.matchIndex[server] = index
+	}
+	if index + 1 > rf.nextIndex[server] {
+		rf.nextIndex[server] = index + 1
+	}
+	rf.advanceCommitIndex()
+}
+
+// advanceCommitIndex commits the entries of the current term held by a majority, together with the entries before them.
+// The followers are told the new commit index at once rather than by the next heartbeat, so that they apply the
+// commands soon after the leader does.
+func (rf *Raft) advanceCommitIndex() {
+	for index := rf.lastIndex(); index > rf.commitIndex && index > rf.log[0].Index; index-- {
+		if rf.entry(index).Term != rf.currentTerm {
+			break
+		}
+		count := 1
+		for server := range rf.peers {
+			if server != rf.me && rf.matchIndex[server] >= index {
+				count++
+			}
+		}
+		if count * 2 > len(rf.peers) {
+			rf.commitIndex = index
+			rf.applyCond.Broadcast()
+			rf.broadcast()
+			break
+		}
+	}
+}
+
+// applier sends the committed commands and the snapshots received from the leader to the service in order
+func (rf *Raft) applier() {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	for !rf.killed() {
+		if rf.pendingSnapshot != nil {
+			msg := *rf.pendingSnapshot
+			rf.pendingSnapshot = nil
+			if msg.SnapshotIndex > rf.lastApplied {
+				rf.lastApplied = msg.SnapshotIndex
+			}
+			rf.mu.Unlock()
+			rf.applyCh <- msg
+			rf.mu.Lock()
+			continue
+		}
+		if rf.lastApplied >= rf.commitIndex {
+			rf.applyCond.Wait()
+			continue
+		}
+
+		var msgs []ApplyMsg
+		for index := rf.lastApplied + 1; index <= rf.commitIndex; index++ {
+			entry := rf.entry(index)
+			msgs = append(msgs, ApplyMsg{
+				CommandValid: true,
+				Command: entry.Command,
+				CommandIndex: entry.Index,
+				CommandTerm: entry.Term,
+			})
+		}
+		rf.mu.Unlock()
+		for _, msg := range msgs {
+			rf.applyCh <- msg
+			rf.mu.Lock()
+			if msg.CommandIndex > rf.lastApplied {
+				rf.lastApplied = msg.CommandIndex
+			}
+			rf.mu.Unlock()
+		}
+		rf.mu.Lock()
+	}
+}
@@ -0,0 +1,608 @@
+package raft
+
+import (
+	"../labgob"
+	"../labrpc"
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// config is a group of peers connected by a labrpc network, where each peer can be disconnected, crashed and restarted
+type config struct {
+	mu sync.Mutex
+	t *testing.T
+	network *labrpc.Network
+	n int
+	rafts []*Raft
+	persisters []*Persister
+	connected []bool
+	// the commands applied by each peer, indexed by their log indices
+	logs []map[int]int
+	lastApplied []int
+	// the peers take a snapshot every snapshotInterval commands if it is positive
+	snapshotInterval int
+	endNames [][]string
+	// the largest index committed by every peer so far
+	maxIndex int
+}
+
+func makeConfig(t *testing.T, n int, unreliable bool, snapshotInterval int) *config {
+	cfg := &config{
+		t: t,
+		network: labrpc.MakeNetwork(),
+		n: n,
+		rafts: make([]*Raft, n),
+		persisters: make([]*Persister, n),
+		connected: make([]bool, n),
+		logs: make([]map[int]int, n),
+		lastApplied: make([]int, n),
+		snapshotInterval: snapshotInterval,
+		endNames: make([][]string, n),
+	}
+	cfg.network.Reliable(!unreliable)
+	for i := 0; i < n; i++ {
+		cfg.persisters[i] = MakePersister()
+		cfg.start(i)
+	}
+	for i := 0; i < n; i++ {
+		cfg.connect(i)
+	}
+	return cfg
+}
+
+func (cfg *config) cleanup() {
+	for i := 0; i < cfg.n; i++ {
+		cfg.crash(i)
+	}
+	cfg.network.Cleanup()
+}
+
+// start starts or restarts a peer from its persisted state, with fresh ends so that the replies to the RPCs of its
+// previous incarnation are not delivered to it
+func (cfg *config) start(i int) {
+	cfg.crash(i)
+
+	cfg.endNames[i] = make([]string, cfg.n)
+	peers := make([]Peer, cfg.n)
+	for j := 0; j < cfg.n; j++ {
+		cfg.endNames[i][j] = strconv.Itoa(i) + "-" + strconv.Itoa(j) + "-" + strconv.Itoa(rand.Int())
+		end := cfg.network.MakeEnd(cfg.endNames[i][j])
+		cfg.network.Connect(cfg.endNames[i][j], j)
+		peers[j] = end
+	}
+
+	cfg.mu.Lock()
+	cfg.persisters[i] = cfg.persisters[i].Copy()
+	cfg.logs[i] = make(map[int]int)
+	cfg.lastApplied[i] = 0
+	if snapshot := cfg.persisters[i].ReadSnapshot(); len(snapshot) > 0 {
+		cfg.restore(i, snapshot)
+	}
+	cfg.mu.Unlock()
+
+	applyCh := make(chan ApplyMsg)
+	rf := Make(peers, i, cfg.persisters[i], applyCh)
+	cfg.mu.Lock()
+	cfg.rafts[i] = rf
+	cfg.mu.Unlock()
+	go cfg.applier(i, rf, applyCh)
+
+	server := labrpc.MakeServer()
+	server.AddService(labrpc.MakeService(rf))
+	cfg.network.AddServer(i, server)
+}
+
+// crash kills a peer, keeping a copy of its persisted state so that the killed peer cannot modify it
+func (cfg *config) crash(i int) {
+	cfg.disconnect(i)
+	cfg.network.DeleteServer(i)
+
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.persisters[i] != nil {
+		cfg.persisters[i] = cfg.persisters[i].Copy()
+	}
+	if cfg.rafts[i] != nil {
+		cfg.mu.Unlock()
+		cfg.rafts[i].Kill()
+		cfg.mu.Lock()
+		cfg.rafts[i] = nil
+	}
+}
+
+func (cfg *config) connect(i int) {
+	cfg.connected[i] = true
+	for j := 0; j < cfg.n; j++ {
+		if cfg.connected[j] {
+			cfg.network.Enable(cfg.endNames[i][j], true)
+			cfg.network.Enable(cfg.endNames[j][i], true)
+		}
+	}
+}
+
+func (cfg *config) disconnect(i int) {
+	cfg.connected[i] = false
+	for j := 0; j < cfg.n; j++ {
+		if cfg.endNames[i] != nil {
+			cfg.network.Enable(cfg.endNames[i][j], false)
+		}
+		if cfg.endNames[j] != nil {
+			cfg.network.Enable(cfg.endNames[j][i], false)
+		}
+	}
+}
+
+// applier receives the messages applied by a peer, checks that they agree with the other peers and takes snapshots
+func (cfg *config) applier(i int, rf *Raft, applyCh chan ApplyMsg) {
+	for msg := range applyCh {
+		cfg.mu.Lock()
+		if cfg.rafts[i] != rf {
+			// the messages of a crashed peer are ignored
+			cfg.mu.Unlock()
+			continue
+		}
+		if msg.SnapshotValid {
+			cfg.restore(i, msg.Snapshot)
+			cfg.mu.Unlock()
+			continue
+		}
+		if msg.CommandIndex != cfg.lastApplied[i] + 1 {
+			cfg.t.Errorf("Peer %d applies index %d after %d", i, msg.CommandIndex, cfg.lastApplied[i])
+		}
+		command := msg.Command.(int)
+		for j := 0; j < cfg.n; j++ {
+			if other, ok := cfg.logs[j][msg.CommandIndex]; ok && other != command {
+				cfg.t.Errorf("Peer %d applies %d at index %d, while peer %d applies %d", i, command, msg.CommandIndex,
+					j, other)
+			}
+		}
+		cfg.logs[i][msg.CommandIndex] = command
+		cfg.lastApplied[i] = msg.CommandIndex
+		if msg.CommandIndex > cfg.maxIndex {
+			cfg.maxIndex = msg.CommandIndex
+		}
+		var snapshot []byte
+		if cfg.snapshotInterval > 0 && msg.CommandIndex % cfg.snapshotInterval == 0 {
+			snapshot = cfg.encodeSnapshot(i)
+		}
+		cfg.mu.Unlock()
+		if snapshot != nil {
+			rf.Snapshot(msg.CommandIndex, snapshot)
+		}
+	}
+}
+
+func (cfg *config) encodeSnapshot(i int) []byte {
+	commands := make([]int, cfg.lastApplied[i])
+	for index := range commands {
+		commands[index] = cfg.logs[i][index + 1]
+	}
+	buffer := new(bytes.Buffer)
+	labgob.NewEncoder(buffer).Encode(commands)
+	return buffer.Bytes()
+}
+
+func (cfg *config) restore(i int, snapshot []byte) {
+	var commands []int
+	if labgob.NewDecoder(bytes.NewBuffer(snapshot)).Decode(&commands) != nil {
+		cfg.t.Fatalf("Peer %d cannot decode its snapshot", i)
+	}
+	cfg.logs[i] = make(map[int]int)
+	for index, command := range commands {
+		cfg.logs[i][index + 1] = command
+	}
+	cfg.lastApplied[i] = len(commands)
+}
+
+// checkOneLeader checks that exactly one connected peer believes it is the leader of its term, retrying for a while
+// as an election may be in progress, and returns the leader
+func (cfg *config) checkOneLeader() int {
+	for iteration := 0; iteration < 10; iteration++ {
+		time.Sleep(time.Duration(450 + rand.Intn(100)) * time.Millisecond)
+		leaders := make(map[int][]int)
+		for i := 0; i < cfg.n; i++ {
+			if cfg.connected[i] {
+				if term, isLeader := cfg.rafts[i].GetState(); isLeader {
+					leaders[term] = append(leaders[term], i)
+				}
+			}
+		}
+		lastTerm := -1
+		for term, peers := range leaders {
+			if len(peers) > 1 {
+				cfg.t.Fatalf("Term %d has %d leaders", term, len(peers))
+			}
+			if term > lastTerm {
+				lastTerm = term
+			}
+		}
+		if lastTerm >= 0 {
+			return leaders[lastTerm][0]
+		}
+	}
+	cfg.t.Fatal("No leader is elected")
+	return -1
+}
+
+func (cfg *config) checkNoLeader() {
+	for i := 0; i < cfg.n; i++ {
+		if cfg.connected[i] {
+			if _, isLeader := cfg.rafts[i].GetState(); isLeader {
+				cfg.t.Fatalf("Peer %d believes it is the leader without a majority", i)
+			}
+		}
+	}
+}
+
+// checkTerms checks that the connected peers agree on the term and returns it
+func (cfg *config) checkTerms() int {
+	term := -1
+	for i := 0; i < cfg.n; i++ {
+		if cfg.connected[i] {
+			peerTerm, _ := cfg.rafts[i].GetState()
+			if term == -1 {
+				term = peerTerm
+			} else if term != peerTerm {
+				cfg.t.Fatal("The peers disagree on the term")
+			}
+		}
+	}
+	return term
+}
+
+// nCommitted returns the number of peers that have applied the command of an index, and the command
+func (cfg *config) nCommitted(index int) (int, int) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	count, command := 0, -1
+	for i := 0; i < cfg.n; i++ {
+		if c, ok := cfg.logs[i][index]; ok {
+			count++
+			command = c
+		}
+	}
+	return count, command
+}
+
+// one submits a command to the leader and waits until it is committed by at least the expected number of peers,
+// retrying with a new leader if the command is lost. It returns the index of the command.
+func (cfg *config) one(command int, expectedServers int, retry bool) int {
+	start := time.Now()
+	starts := 0
+	for time.Since(start) < 10 * time.Second {
+		index := -1
+		for si := 0; si < cfg.n; si++ {
+			starts = (starts + 1) % cfg.n
+			cfg.mu.Lock()
+			rf := cfg.rafts[starts]
+			cfg.mu.Unlock()
+			if rf != nil && cfg.connected[starts] {
+				if i, _, isLeader := rf.Start(command); isLeader {
+					index = i
+					break
+				}
+			}
+		}
+
+		if index != -1 {
+			submitted := time.Now()
+			for time.Since(submitted) < 2 * time.Second {
+				count, committed := cfg.nCommitted(index)
+				if count > 0 && count >= expectedServers && committed == command {
+					return index
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			if !retry {
+				cfg.t.Fatalf("Command %d fails to reach agreement", command)
+			}
+		} else {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	cfg.t.Fatalf("Command %d fails to reach agreement", command)
+	return -1
+}
+
+func TestInitialElection(t *testing.T) {
+	cfg := makeConfig(t, 3, false, 0)
+	defer cfg.cleanup()
+
+	cfg.checkOneLeader()
+	term := cfg.checkTerms()
+	if term < 1 {
+		t.Fatalf("The term should be positive after an election, actual %d", term)
+	}
+	// the term does not change without failures
+	time.Sleep(2 * electionTimeout)
+	if cfg.checkTerms() != term {
+		t.Errorf("The term changes without failures")
+	}
+	cfg.checkOneLeader()
+}
+
+func TestReElection(t *testing.T) {
+	cfg := makeConfig(t, 3, false, 0)
+	defer cfg.cleanup()
+
+	leader1 := cfg.checkOneLeader()
+	// a new leader is elected if the leader is disconnected, and the old one does not disturb it once it is back
+	cfg.disconnect(leader1)
+	cfg.checkOneLeader()
+	cfg.connect(leader1)
+	leader2 := cfg.checkOneLeader()
+
+	// no leader is elected without a majority
+	cfg.disconnect(leader2)
+	cfg.disconnect((leader2 + 1) % 3)
+	time.Sleep(4 * electionTimeout)
+	cfg.checkNoLeader()
+	cfg.connect((leader2 + 1) % 3)
+	cfg.checkOneLeader()
+	cfg.connect(leader2)
+	cfg.checkOneLeader()
+}
+
+func TestBasicAgree(t *testing.T) {
+	cfg := makeConfig(t, 3, false, 0)
+	defer cfg.cleanup()
+
+	for index := 1; index <= 3; index++ {
+		if count, _ := cfg.nCommitted(index); count > 0 {
+			t.Fatal("Some peer commits before Start")
+		}
+		if actual := cfg.one(index * 100, 3, false); actual != index {
+			t.Fatalf("Command %d gets index %d, expected %d", index * 100, actual, index)
+		}
+	}
+}
+
+func TestFailAgree(t *testing.T) {
+	cfg := makeConfig(t, 3, false, 0)
+	defer cfg.cleanup()
+
+	cfg.one(101, 3, false)
+	// the remaining majority still agrees when a follower is disconnected
+	leader := cfg.checkOneLeader()
+	cfg.disconnect((leader + 1) % 3)
+	cfg.one(102, 2, false)
+	cfg.one(103, 2, false)
+	time.Sleep(electionTimeout)
+	cfg.one(104, 2, false)
+	// the follower catches up once it is back
+	cfg.connect((leader + 1) % 3)
+	cfg.one(105, 3, true)
+}
+
+func TestFailNoAgree(t *testing.T) {
+	cfg := makeConfig(t, 5, false, 0)
+	defer cfg.cleanup()
+
+	cfg.one(10, 5, false)
+	leader := cfg.checkOneLeader()
+	for i := 1; i <= 3; i++ {
+		cfg.disconnect((leader + i) % 5)
+	}
+	index, _, isLeader := cfg.rafts[leader].Start(20)
+	if !isLeader {
+		t.Fatal("The leader rejects Start")
+	}
+	if index != 2 {
+		t.Fatalf("Start returns index %d, expected 2", index)
+	}
+	time.Sleep(2 * electionTimeout)
+	if count, _ := cfg.nCommitted(index); count > 0 {
+		t.Fatalf("%d peers commit without a majority", count)
+	}
+
+	for i := 1; i <= 3; i++ {
+		cfg.connect((leader + i) % 5)
+	}
+	// the disconnected followers may elect a leader without the uncommitted command, which is then discarded
+	leader = cfg.checkOneLeader()
+	index, _, isLeader = cfg.rafts[leader].Start(30)
+	if !isLeader {
+		t.Fatal("The leader rejects Start")
+	}
+	if index < 2 || index > 3 {
+		t.Fatalf("Start returns an unexpected index %d", index)
+	}
+	cfg.one(1000, 5, true)
+}
+
+func TestPersist(t *testing.T) {
+	cfg := makeConfig(t, 3, false, 0)
+	defer cfg.cleanup()
+
+	cfg.one(11, 3, true)
+	// the peers keep the committed commands after all of them crash
+	for i := 0; i < 3; i++ {
+		cfg.start(i)
+	}
+	for i := 0; i < 3; i++ {
+		cfg.connect(i)
+	}
+	cfg.one(12, 3, true)
+
+	leader := cfg.checkOneLeader()
+	cfg.crash(leader)
+	cfg.one(13, 2, true)
+	cfg.start(leader)
+	cfg.connect(leader)
+	cfg.one(14, 3, true)
+
+	// a restarted follower that missed some commands catches up
+	follower := (cfg.checkOneLeader() + 1) % 3
+	cfg.crash(follower)
+	cfg.one(15, 2, true)
+	cfg.start(follower)
+	cfg.connect(follower)
+	cfg.one(16, 3, true)
+}
+
+func TestUnreliableAgree(t *testing.T) {
+	cfg := makeConfig(t, 5, true, 0)
+	defer cfg.cleanup()
+
+	var wg sync.WaitGroup
+	for iteration := 1; iteration < 20; iteration++ {
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(command int) {
+				defer wg.Done()
+				cfg.one(command, 1, true)
+			}(iteration * 100 + j)
+		}
+		cfg.one(iteration, 1, true)
+	}
+	cfg.network.Reliable(true)
+	wg.Wait()
+	cfg.one(100, 5, true)
+}
+
+func TestReorderingUnreliable(t *testing.T) {
+	cfg := makeConfig(t, 5, true, 0)
+	defer cfg.cleanup()
+
+	cfg.network.LongReordering(true)
+	cfg.one(rand.Int(), 1, true)
+	up := 5
+	for iteration := 0; iteration < 300; iteration++ {
+		leader := -1
+		for i := 0; i < 5; i++ {
+			if cfg.connected[i] {
+				if _, _, isLeader := cfg.rafts[i].Start(rand.Int()); isLeader {
+					leader = i
+				}
+			}
+		}
+		if rand.Intn(1000) < 100 {
+			time.Sleep(time.Duration(rand.Intn(electionTimeoutMillis() / 2)) * time.Millisecond)
+		} else {
+			time.Sleep(time.Duration(rand.Intn(13)) * time.Millisecond)
+		}
+		// the leaders are disconnected from time to time, so that their uncommitted entries are overwritten
+		if leader != -1 && rand.Intn(1000) < 500 {
+			cfg.disconnect(leader)
+			up--
+		}
+		if up < 3 {
+			i := rand.Intn(5)
+			if !cfg.connected[i] {
+				cfg.connect(i)
+				up++
+			}
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if !cfg.connected[i] {
+			cfg.connect(i)
+		}
+	}
+	cfg.network.LongReordering(false)
+	cfg.network.Reliable(true)
+	cfg.one(rand.Int(), 5, true)
+}
+
+func electionTimeoutMillis() int {
+	return int(electionTimeout / time.Millisecond)
+}
+
+func TestSnapshotInstall(t *testing.T) {
+	cfg := makeConfig(t, 3, false, 10)
+	defer cfg.cleanup()
+
+	cfg.one(rand.Int(), 3, true)
+	// a follower lagging behind the snapshot of the leader receives the snapshot
+	leader := cfg.checkOneLeader()
+	follower := (leader + 1) % 3
+	cfg.disconnect(follower)
+	for i := 0; i < 50; i++ {
+		cfg.rafts[leader].Start(rand.Int())
+	}
+	cfg.one(rand.Int(), 2, true)
+	cfg.connect(follower)
+	index := cfg.one(rand.Int(), 3, true)
+	if index < 52 {
+		t.Fatalf("Unexpected index %d", index)
+	}
+
+	// the logs are compacted, so the states stay small
+	time.Sleep(heartbeatInterval * 3)
+	for i := 0; i < 3; i++ {
+		if size := cfg.persisters[i].RaftStateSize(); size > 1000 {
+			t.Errorf("The raft state of peer %d has %d bytes, which should be compacted", i, size)
+		}
+	}
+}
+
+func TestSnapshotRestart(t *testing.T) {
+	cfg := makeConfig(t, 3, true, 10)
+	defer cfg.cleanup()
+
+	for iteration := 0; iteration < 6; iteration++ {
+		victim := (cfg.checkOneLeader() + 1) % 3
+		if iteration % 2 == 1 {
+			cfg.crash(victim)
+		} else {
+			cfg.disconnect(victim)
+		}
+		for i := 0; i < 12; i++ {
+			cfg.one(rand.Int(), 2, true)
+		}
+		if iteration % 2 == 1 {
+			cfg.start(victim)
+		}
+		cfg.connect(victim)
+		cfg.one(rand.Int(), 3, true)
+	}
+
+	// every peer restarts from its snapshot and the rest of its log
+	cfg.network.Reliable(true)
+	for i := 0; i < 3; i++ {
+		cfg.start(i)
+	}
+	for i := 0; i < 3; i++ {
+		cfg.connect(i)
+	}
+	cfg.one(rand.Int(), 3, true)
+	for i := 0; i < 3; i++ {
+		if cfg.persisters[i].SnapshotSize() == 0 {
+			t.Errorf("Peer %d has no snapshot", i)
+		}
+	}
+}
+
+func TestFilePersister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "raft-state")
+	ps, err := MakeFilePersister(path)
+	if err != nil || ps.RaftStateSize() != 0 || ps.SnapshotSize() != 0 {
+		t.Fatalf("A new persister should be empty, actual %v", err)
+	}
+	ps.Save([]byte("state"), []byte("snapshot"))
+	ps.Save([]byte("new state"), nil)
+
+	ps, err = MakeFilePersister(path)
+	if err != nil || string(ps.ReadRaftState()) != "new state" || ps.SnapshotSize() != 0 {
+		t.Fatalf("Incorrect state loaded %v %q", err, ps.ReadRaftState())
+	}
+	if err = ioutil.WriteFile(path, []byte{100, 0, 0, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = MakeFilePersister(path); err == nil {
+		t.Errorf("A corrupted file should be rejected")
+	}
+}
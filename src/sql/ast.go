@@ -0,0 +1,180 @@
+package sql
+
+// Statement is one of the statements below
+type Statement interface {
+	statement()
+}
+
+// CreateTableStatement creates a table and partitions it over the nodes, e.g.,
+//   CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING NOT NULL, grade FLOAT, UNIQUE (name, grade))
+//   PARTITION BY (NODES 0|1 COLUMNS (sid, name) WHERE grade <= 3.6, NODE 2 WHERE grade > 3.6) USING COLUMNAR
+type CreateTableStatement struct {
+	Table string
+	Columns []ColumnDefinition
+	// the columns of the primary key, no primary key if empty
+	PrimaryKey []string
+	// each group of columns declared UNIQUE, either on a column or as a table constraint
+	Unique [][]string
+	ForeignKeys []ForeignKeyDefinition
+	// the columns declared NOT NULL
+	NotNull []string
+	// the whole table is placed on node 0 if no partition is given
+	Partitions []PartitionDefinition
+	// "LIST", "SLICE" or "COLUMNAR" given by USING after the partitions, empty if not given
+	Storage string
+}
+
+// ColumnDefinition is the name and the type name (e.g., "INT32") of a column
+type ColumnDefinition struct {
+	Name string
+	Type string
+}
+
+// ForeignKeyDefinition refers from the columns to the key of another table, e.g.,
+//   FOREIGN KEY (sid) REFERENCES student (sid) ON DELETE CASCADE
+// or on a column,
+//   sid INT32 REFERENCES student ON DELETE CASCADE
+type ForeignKeyDefinition struct {
+	Columns []string
+	RefTable string
+	// the primary key of RefTable if empty
+	RefColumns []string
+	// "CASCADE", "RESTRICT" or empty
+	OnDelete string
+}
+
+// PartitionDefinition places the given columns (all columns if empty) of the rows satisfying the conditions on the
+// given nodes, which are identified by their numbers.
+type PartitionDefinition struct {
+	Nodes []string
+	Columns []string
+	Conditions []Condition
+}
+
+// CreateIndexStatement creates an index on a column of a table, e.g.,
+//   CREATE INDEX studentGrade ON student (grade) USING HASH
+type CreateIndexStatement struct {
+	Name string
+	Table string
+	Column string
+	// "HASH" or "BTREE", empty if not given
+	Kind string
+}
+
+// InsertStatement inserts rows into a table, e.g.,
+//   INSERT INTO student (sid, name, grade) VALUES (0, 'John', 4.0), (1, 'Smith', 3.6)
+type InsertStatement struct {
+	Table string
+	// the columns that the values are given for, all columns in their defined order if empty
+	Columns []string
+	Rows [][]interface{}
+}
+
+// SelectStatement queries a table or the join of some tables, e.g.,
+//   SELECT name, courseId FROM student LEFT JOIN courseRegistration ON student.sid = courseRegistration.sid
+//   WHERE grade > 3.6 ORDER BY name DESC NULLS LAST LIMIT 10 OFFSET 10
+// or groups the rows and aggregates each group, e.g.,
+//   SELECT age, COUNT(*), AVG(grade) AS average FROM student GROUP BY age HAVING COUNT(*) > 1 ORDER BY average
+type SelectStatement struct {
+	// the selected columns, all columns if empty, where an aggregate is referred to by its name
+	Columns []string
+	Table string
+	Joins []JoinDefinition
+	Where []Condition
+	// the aggregates used in the select list, HAVING and ORDER BY, each of which appears once
+	Aggregates []AggregateDefinition
+	GroupBy []string
+	// conditions on the groups, which refer to the grouped columns and the aggregates by their names
+	Having []Condition
+	OrderBy []OrderDefinition
+	// -1 if absent
+	Limit int
+	Offset int
+}
+
+// JoinDefinition joins the preceding tables with Table, LeftColumns[i] of the preceding tables should equal
+// RightColumns[i] of Table. Column references may be qualified by table names, e.g., "student.sid".
+type JoinDefinition struct {
+	Table string
+	// one of "INNER", "LEFT", "RIGHT" and "FULL"
+	Type string
+	// a natural join matches the columns with the same names, and has no LeftColumns or RightColumns
+	Natural bool
+	LeftColumns []string
+	RightColumns []string
+}
+
+// AggregateDefinition applies Function, one of "COUNT", "SUM", "AVG", "MIN" and "MAX", to Column, which is empty for
+// COUNT(*). Name is its alias given by AS, or its text like "SUM(grade)" and "COUNT(*)".
+type AggregateDefinition struct {
+	Function string
+	Column string
+	Name string
+}
+
+// OrderDefinition sorts the result by a column, NULLs are placed by Nulls, one of "FIRST" and "LAST", or last in
+// ascending order and first in descending order if empty
+type OrderDefinition struct {
+	Column string
+	Desc bool
+	Nulls string
+}
+
+// DeleteStatement deletes the rows satisfying the conditions from a table, e.g.,
+//   DELETE FROM student WHERE grade < 2.0
+type DeleteStatement struct {
+	Table string
+	Where []Condition
+}
+
+// UpdateStatement sets the columns of the rows satisfying the conditions to constants, e.g.,
+//   UPDATE student SET grade = 4.0, name = 'John' WHERE sid = 0
+type UpdateStatement struct {
+	Table string
+	Set []Assignment
+	Where []Condition
+}
+
+// Assignment sets a column to a constant
+type Assignment struct {
+	Column string
+	// an int, a float64, a string, a bool or nil
+	Value interface{}
+}
+
+// Condition compares a column with a constant, where Operator is one of "<", "<=", "==", ">", ">=" and "!=", or tests
+// whether a column is NULL, where Operator is "IS NULL" or "IS NOT NULL" and Value is nil. A comparison with NULL is
+// never satisfied.
+type Condition struct {
+	Column string
+	Operator string
+	// an int, a float64, a string, a bool or nil
+	Value interface{}
+}
+
+// BeginStatement begins a transaction, which ends with a CommitStatement or a RollbackStatement, e.g.,
+//   BEGIN TRANSACTION
+//   BEGIN ISOLATION LEVEL SERIALIZABLE
+type BeginStatement struct {
+	// whether the transaction is serializable by two-phase locking, or reads a snapshot if false, which is the default
+	// and may be asked for by ISOLATION LEVEL SNAPSHOT
+	Serializable bool
+}
+
+// CommitStatement commits the open transaction, e.g.,
+//   COMMIT
+type CommitStatement struct{}
+
+// RollbackStatement rolls the open transaction back, e.g.,
+//   ROLLBACK WORK
+type RollbackStatement struct{}
+
+func (s *CreateTableStatement) statement() {}
+func (s *CreateIndexStatement) statement() {}
+func (s *InsertStatement) statement() {}
+func (s *SelectStatement) statement() {}
+func (s *DeleteStatement) statement() {}
+func (s *UpdateStatement) statement() {}
+func (s *BeginStatement) statement() {}
+func (s *CommitStatement) statement() {}
+func (s *RollbackStatement) statement() {}
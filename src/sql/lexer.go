@@ -0,0 +1,131 @@
+package sql
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// kinds of tokens
+const (
+	TokenEOF = iota
+	TokenIdentifier
+	TokenKeyword
+	TokenInteger
+	TokenFloat
+	TokenString
+	TokenOperator
+	TokenSymbol
+)
+
+// keywords are recognized case-insensitively and stored in upper case
+var keywords = map[string]bool{
+	"CREATE": true, "TABLE": true, "INDEX": true, "USING": true, "PARTITION": true, "BY": true, "NODE": true, "NODES": true, "COLUMNS": true,
+	"PRIMARY": true, "KEY": true, "UNIQUE": true, "FOREIGN": true, "REFERENCES": true, "CASCADE": true, "RESTRICT": true,
+	"INSERT": true, "INTO": true, "VALUES": true,
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true,
+	"JOIN": true, "NATURAL": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "OUTER": true, "ON": true,
+	"GROUP": true, "HAVING": true, "AS": true,
+	"ORDER": true, "ASC": true, "DESC": true, "NULLS": true, "LIMIT": true, "OFFSET": true,
+	"DELETE": true, "UPDATE": true, "SET": true,
+	"BEGIN": true, "COMMIT": true, "ROLLBACK": true,
+	"TRUE": true, "FALSE": true, "NULL": true, "IS": true, "NOT": true,
+}
+
+// Token is a lexical unit of a statement
+type Token struct {
+	Kind int
+	// the text of the token, keywords are in upper case and quotes of strings and identifiers are removed
+	Text string
+	// the offset of the token in the statement, used in error messages
+	Pos int
+}
+
+// Tokenize splits a statement into tokens, the last of which is always a TokenEOF.
+func Tokenize(input string) ([]Token, error) {
+	var tokens []Token
+	runes := []rune(input)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i + 1 < len(runes) && runes[i + 1] == '-':
+			// a comment lasts until the end of the line
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			text := string(runes[start:i])
+			if keywords[strings.ToUpper(text)] {
+				tokens = append(tokens, Token{TokenKeyword, strings.ToUpper(text), start})
+			} else {
+				tokens = append(tokens, Token{TokenIdentifier, text, start})
+			}
+		case unicode.IsDigit(r):
+			kind := TokenInteger
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				(runes[i] == '-' || runes[i] == '+') && (runes[i - 1] == 'e' || runes[i - 1] == 'E')) {
+				if !unicode.IsDigit(runes[i]) {
+					kind = TokenFloat
+				}
+				i++
+			}
+			tokens = append(tokens, Token{kind, string(runes[start:i]), start})
+		case r == '\'' || r == '"' || r == '`':
+			// a quote inside a string or an identifier is escaped by doubling it
+			var text []rune
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == r {
+					if i + 1 < len(runes) && runes[i + 1] == r {
+						text = append(text, r)
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				text = append(text, runes[i])
+				i++
+			}
+			if !closed {
+				return nil, errorAt(start, "unterminated quote")
+			}
+			if r == '\'' {
+				tokens = append(tokens, Token{TokenString, string(text), start})
+			} else {
+				tokens = append(tokens, Token{TokenIdentifier, string(text), start})
+			}
+		case strings.ContainsRune("<>=!", r):
+			i++
+			if i < len(runes) && (runes[i] == '=' || r == '<' && runes[i] == '>') {
+				i++
+			}
+			text := string(runes[start:i])
+			if text == "!" {
+				return nil, errorAt(start, "unknown operator !")
+			}
+			tokens = append(tokens, Token{TokenOperator, text, start})
+		case strings.ContainsRune("(),;*.|-+", r):
+			i++
+			tokens = append(tokens, Token{TokenSymbol, string(r), start})
+		default:
+			return nil, errorAt(start, "unexpected character " + string(r))
+		}
+	}
+	tokens = append(tokens, Token{TokenEOF, "", len(runes)})
+	return tokens, nil
+}
+
+func errorAt(pos int, message string) error {
+	return errors.New("syntax error at " + strconv.Itoa(pos) + ": " + message)
+}
@@ -0,0 +1,945 @@
+package sql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parse parses a script of statements separated by semicolons.
+func Parse(input string) ([]Statement, error) {
+	tokens, err := Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	var statements []Statement
+	for {
+		for p.acceptSymbol(";") {
+		}
+		if p.peek().Kind == TokenEOF {
+			return statements, nil
+		}
+		statement, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+		if p.peek().Kind != TokenEOF && !p.acceptSymbol(";") {
+			return nil, p.unexpected("; or end of input")
+		}
+	}
+}
+
+// parser is a recursive descent parser over the tokens of a script
+type parser struct {
+	tokens []Token
+	pos int
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() Token {
+	token := p.tokens[p.pos]
+	if token.Kind != TokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *parser) unexpected(expected string) error {
+	token := p.peek()
+	if token.Kind == TokenEOF {
+		return errorAt(token.Pos, "expected " + expected + " but reached the end")
+	}
+	return errorAt(token.Pos, "expected " + expected + " but found " + token.Text)
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.Kind == TokenKeyword && token.Text == keyword
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.unexpected(keyword)
+	}
+	return nil
+}
+
+func (p *parser) acceptSymbol(symbol string) bool {
+	token := p.peek()
+	if token.Kind == TokenSymbol && token.Text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.unexpected(symbol)
+	}
+	return nil
+}
+
+func (p *parser) expectIdentifier() (string, error) {
+	if p.peek().Kind != TokenIdentifier {
+		return "", p.unexpected("an identifier")
+	}
+	return p.next().Text, nil
+}
+
+// parseColumnReference parses a column name that may be qualified by a table name, e.g., "student.sid"
+func (p *parser) parseColumnReference() (string, error) {
+	name, err := p.expectIdentifier()
+	if err != nil {
+		return "", err
+	}
+	if p.acceptSymbol(".") {
+		column, err := p.expectIdentifier()
+		if err != nil {
+			return "", err
+		}
+		name += "." + column
+	}
+	return name, nil
+}
+
+// parseIdentifierList parses a parenthesized list of identifiers
+func (p *parser) parseIdentifierList() ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.expectIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return names, p.expectSymbol(")")
+}
+
+func (p *parser) parseStatement() (Statement, error) {
+	switch {
+	case p.isKeyword("CREATE"):
+		if p.tokens[p.pos + 1].Kind == TokenKeyword && p.tokens[p.pos + 1].Text == "INDEX" {
+			return p.parseCreateIndex()
+		}
+		return p.parseCreateTable()
+	case p.isKeyword("INSERT"):
+		return p.parseInsert()
+	case p.isKeyword("SELECT"):
+		return p.parseSelect()
+	case p.isKeyword("DELETE"):
+		return p.parseDelete()
+	case p.isKeyword("UPDATE"):
+		return p.parseUpdate()
+	case p.isKeyword("BEGIN"):
+		p.next()
+		p.acceptTransaction()
+		return p.parseIsolationLevel()
+	case p.isKeyword("COMMIT"):
+		p.next()
+		p.acceptTransaction()
+		return &CommitStatement{}, nil
+	case p.isKeyword("ROLLBACK"):
+		p.next()
+		p.acceptTransaction()
+		return &RollbackStatement{}, nil
+	}
+	return nil, p.unexpected("a statement")
+}
+
+// acceptTransaction skips the optional TRANSACTION or WORK after BEGIN, COMMIT and ROLLBACK, which are not keywords so
+// that columns can still be named by them
+func (p *parser) acceptTransaction() {
+	token := p.peek()
+	if text := strings.ToUpper(token.Text); token.Kind == TokenIdentifier && (text == "TRANSACTION" || text == "WORK") {
+		p.next()
+	}
+}
+
+// parseIsolationLevel parses the optional ISOLATION LEVEL SERIALIZABLE or ISOLATION LEVEL SNAPSHOT after BEGIN, whose
+// words are not keywords either
+func (p *parser) parseIsolationLevel() (Statement, error) {
+	statement := &BeginStatement{}
+	if !p.acceptWord("ISOLATION") {
+		return statement, nil
+	}
+	if !p.acceptWord("LEVEL") {
+		return nil, p.unexpected("LEVEL")
+	}
+	switch {
+	case p.acceptWord("SERIALIZABLE"):
+		statement.Serializable = true
+	case p.acceptWord("SNAPSHOT"):
+	default:
+		return nil, p.unexpected("SERIALIZABLE or SNAPSHOT")
+	}
+	return statement, nil
+}
+
+// acceptWord skips an identifier that is the given word case-insensitively
+func (p *parser) acceptWord(word string) bool {
+	token := p.peek()
+	if token.Kind == TokenIdentifier && strings.ToUpper(token.Text) == word {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseCreateTable() (Statement, error) {
+	p.next()
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	statement := &CreateTableStatement{}
+	var err error
+	if statement.Table, err = p.expectIdentifier(); err != nil {
+		return nil, err
+	}
+
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.parseTableElement(statement); err != nil {
+			return nil, err
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("PARTITION") {
+		p.acceptKeyword("BY")
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		for {
+			partition, err := p.parsePartition()
+			if err != nil {
+				return nil, err
+			}
+			statement.Partitions = append(statement.Partitions, partition)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("USING") {
+		token := p.peek()
+		statement.Storage = strings.ToUpper(token.Text)
+		if token.Kind != TokenIdentifier || statement.Storage != "LIST" && statement.Storage != "SLICE" &&
+			statement.Storage != "COLUMNAR" {
+			return nil, p.unexpected("LIST, SLICE or COLUMNAR")
+		}
+		p.next()
+	}
+	return statement, nil
+}
+
+// parseCreateIndex parses a statement like "CREATE INDEX studentGrade ON student (grade) USING HASH", where HASH and
+// BTREE are not keywords so that columns can still be named by them
+func (p *parser) parseCreateIndex() (Statement, error) {
+	p.pos += 2
+	statement := &CreateIndexStatement{}
+	var err error
+	if statement.Name, err = p.expectIdentifier(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("ON"); err != nil {
+		return nil, err
+	}
+	if statement.Table, err = p.expectIdentifier(); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	if statement.Column, err = p.expectIdentifier(); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("USING") {
+		token := p.peek()
+		statement.Kind = strings.ToUpper(token.Text)
+		if token.Kind != TokenIdentifier || statement.Kind != "HASH" && statement.Kind != "BTREE" {
+			return nil, p.unexpected("HASH or BTREE")
+		}
+		p.next()
+	}
+	return statement, nil
+}
+
+// parseTableElement parses a column definition followed by its constraints like "sid INT32 PRIMARY KEY", or a table
+// constraint like "PRIMARY KEY (sid, name)", "UNIQUE (name)" or "FOREIGN KEY (sid) REFERENCES student (sid)"
+func (p *parser) parseTableElement(statement *CreateTableStatement) error {
+	var err error
+	if p.acceptKeyword("FOREIGN") {
+		if err = p.expectKeyword("KEY"); err != nil {
+			return err
+		}
+		columns, err := p.parseIdentifierList()
+		if err != nil {
+			return err
+		}
+		foreignKey, err := p.parseReferences(columns)
+		if err != nil {
+			return err
+		}
+		statement.ForeignKeys = append(statement.ForeignKeys, foreignKey)
+		return nil
+	}
+	if p.isKeyword("PRIMARY") || p.isKeyword("UNIQUE") {
+		primary := p.acceptKeyword("PRIMARY")
+		if primary {
+			if err = p.expectKeyword("KEY"); err != nil {
+				return err
+			}
+		} else {
+			p.next()
+		}
+		columns, err := p.parseIdentifierList()
+		if err != nil {
+			return err
+		}
+		return p.addKey(statement, primary, columns)
+	}
+
+	var column ColumnDefinition
+	if column.Name, err = p.expectIdentifier(); err != nil {
+		return err
+	}
+	if p.peek().Kind != TokenIdentifier {
+		return p.unexpected("a data type")
+	}
+	column.Type = strings.ToUpper(p.next().Text)
+	// the length or precision of a type, e.g., VARCHAR(20) or DECIMAL(10, 2), is accepted but not enforced
+	if p.acceptSymbol("(") {
+		for {
+			if _, err = p.parseCount(); err != nil {
+				return err
+			}
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return err
+		}
+	}
+	statement.Columns = append(statement.Columns, column)
+	for {
+		switch {
+		case p.acceptKeyword("PRIMARY"):
+			if err = p.expectKeyword("KEY"); err != nil {
+				return err
+			}
+			if err = p.addKey(statement, true, []string{column.Name}); err != nil {
+				return err
+			}
+		case p.acceptKeyword("UNIQUE"):
+			if err = p.addKey(statement, false, []string{column.Name}); err != nil {
+				return err
+			}
+		case p.acceptKeyword("NOT"):
+			if err = p.expectKeyword("NULL"); err != nil {
+				return err
+			}
+			statement.NotNull = append(statement.NotNull, column.Name)
+		case p.acceptKeyword("NULL"):
+			// columns are nullable by default
+		case p.isKeyword("REFERENCES"):
+			foreignKey, err := p.parseReferences([]string{column.Name})
+			if err != nil {
+				return err
+			}
+			statement.ForeignKeys = append(statement.ForeignKeys, foreignKey)
+		default:
+			return nil
+		}
+	}
+}
+
+// parseReferences parses the referenced table of a foreign key and the action on deletion like
+// "REFERENCES student (sid) ON DELETE CASCADE", where the referenced columns may be omitted
+func (p *parser) parseReferences(columns []string) (ForeignKeyDefinition, error) {
+	foreignKey := ForeignKeyDefinition{Columns: columns}
+	var err error
+	if err = p.expectKeyword("REFERENCES"); err != nil {
+		return foreignKey, err
+	}
+	if foreignKey.RefTable, err = p.expectIdentifier(); err != nil {
+		return foreignKey, err
+	}
+	if p.peek().Kind == TokenSymbol && p.peek().Text == "(" {
+		if foreignKey.RefColumns, err = p.parseIdentifierList(); err != nil {
+			return foreignKey, err
+		}
+	}
+	if p.acceptKeyword("ON") {
+		if err = p.expectKeyword("DELETE"); err != nil {
+			return foreignKey, err
+		}
+		switch {
+		case p.acceptKeyword("CASCADE"):
+			foreignKey.OnDelete = "CASCADE"
+		case p.acceptKeyword("RESTRICT"):
+			foreignKey.OnDelete = "RESTRICT"
+		default:
+			return foreignKey, p.unexpected("CASCADE or RESTRICT")
+		}
+	}
+	return foreignKey, nil
+}
+
+// addKey adds a primary key or a group of unique columns to the statement, a table has at most one primary key
+func (p *parser) addKey(statement *CreateTableStatement, primary bool, columns []string) error {
+	if !primary {
+		statement.Unique = append(statement.Unique, columns)
+		return nil
+	}
+	if len(statement.PrimaryKey) > 0 {
+		return errorAt(p.tokens[p.pos - 1].Pos, "multiple primary keys for table " + statement.Table)
+	}
+	statement.PrimaryKey = columns
+	return nil
+}
+
+// parsePartition parses a partition like "NODES 0|1 COLUMNS (sid, name) WHERE grade <= 3.6"
+func (p *parser) parsePartition() (PartitionDefinition, error) {
+	var partition PartitionDefinition
+	if !p.acceptKeyword("NODE") && !p.acceptKeyword("NODES") {
+		return partition, p.unexpected("NODE")
+	}
+	for {
+		if p.peek().Kind != TokenInteger {
+			return partition, p.unexpected("a node number")
+		}
+		partition.Nodes = append(partition.Nodes, p.next().Text)
+		if !p.acceptSymbol("|") {
+			break
+		}
+	}
+
+	var err error
+	if p.acceptKeyword("COLUMNS") {
+		if partition.Columns, err = p.parseIdentifierList(); err != nil {
+			return partition, err
+		}
+	}
+	if p.acceptKeyword("WHERE") {
+		if partition.Conditions, err = p.parseConditions(); err != nil {
+			return partition, err
+		}
+	}
+	return partition, nil
+}
+
+func (p *parser) parseInsert() (Statement, error) {
+	p.next()
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	statement := &InsertStatement{}
+	var err error
+	if statement.Table, err = p.expectIdentifier(); err != nil {
+		return nil, err
+	}
+	if p.peek().Kind == TokenSymbol && p.peek().Text == "(" {
+		if statement.Columns, err = p.parseIdentifierList(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+
+	for {
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var row []interface{}
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, value)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		statement.Rows = append(statement.Rows, row)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return statement, nil
+}
+
+func (p *parser) parseSelect() (Statement, error) {
+	p.next()
+	statement := &SelectStatement{Limit: -1, Offset: -1}
+	if !p.acceptSymbol("*") {
+		for {
+			aggregate, err := p.parseAggregate()
+			if err != nil {
+				return nil, err
+			}
+			if aggregate == nil {
+				column, err := p.parseColumnReference()
+				if err != nil {
+					return nil, err
+				}
+				statement.Columns = append(statement.Columns, column)
+			} else {
+				if p.acceptKeyword("AS") {
+					if aggregate.Name, err = p.expectIdentifier(); err != nil {
+						return nil, err
+					}
+				}
+				addAggregate(statement, *aggregate)
+				statement.Columns = append(statement.Columns, aggregate.Name)
+			}
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if statement.Table, err = p.expectIdentifier(); err != nil {
+		return nil, err
+	}
+	for p.isKeyword("JOIN") || p.isKeyword("NATURAL") || p.isKeyword("INNER") || p.isKeyword("LEFT") ||
+		p.isKeyword("RIGHT") || p.isKeyword("FULL") {
+		join, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		statement.Joins = append(statement.Joins, join)
+	}
+
+	if p.acceptKeyword("WHERE") {
+		if statement.Where, err = p.parseConditions(); err != nil {
+			return nil, err
+		}
+	}
+	// HAVING and ORDER BY may refer to aggregates that are not selected
+	parseTerm := func() (string, error) {
+		return p.parseTerm(statement)
+	}
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			column, err := p.parseColumnReference()
+			if err != nil {
+				return nil, err
+			}
+			statement.GroupBy = append(statement.GroupBy, column)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		if statement.Having, err = p.parseConditionsOn(parseTerm); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			var order OrderDefinition
+			if order.Column, err = parseTerm(); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("DESC") {
+				order.Desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			// FIRST and LAST are not keywords so that columns can still be named by them
+			if p.acceptKeyword("NULLS") {
+				token := p.peek()
+				order.Nulls = strings.ToUpper(token.Text)
+				if token.Kind != TokenIdentifier || order.Nulls != "FIRST" && order.Nulls != "LAST" {
+					return nil, p.unexpected("FIRST or LAST")
+				}
+				p.next()
+			}
+			statement.OrderBy = append(statement.OrderBy, order)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		if statement.Limit, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		if statement.Offset, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+// aggregateFunctions are the names of the aggregate functions, which are not keywords so that columns can still be
+// named by them
+var aggregateFunctions = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+// parseAggregate parses an aggregate like "COUNT(*)" or "SUM(student.grade)", or returns nil if the next tokens do not
+// start an aggregate
+func (p *parser) parseAggregate() (*AggregateDefinition, error) {
+	token := p.peek()
+	function := strings.ToUpper(token.Text)
+	if token.Kind != TokenIdentifier || !aggregateFunctions[function] {
+		return nil, nil
+	}
+	if next := p.tokens[p.pos + 1]; next.Kind != TokenSymbol || next.Text != "(" {
+		return nil, nil
+	}
+	p.next()
+	p.next()
+
+	aggregate := &AggregateDefinition{Function: function}
+	if p.acceptSymbol("*") {
+		if function != "COUNT" {
+			return nil, errorAt(token.Pos, "only COUNT accepts *")
+		}
+	} else {
+		var err error
+		if aggregate.Column, err = p.parseColumnReference(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if aggregate.Column == "" {
+		aggregate.Name = function + "(*)"
+	} else {
+		aggregate.Name = function + "(" + aggregate.Column + ")"
+	}
+	return aggregate, nil
+}
+
+// parseTerm parses a column reference or an aggregate, which is added to the statement, and returns the column
+// reference or the name of the aggregate
+func (p *parser) parseTerm(statement *SelectStatement) (string, error) {
+	aggregate, err := p.parseAggregate()
+	if err != nil {
+		return "", err
+	}
+	if aggregate == nil {
+		return p.parseColumnReference()
+	}
+	addAggregate(statement, *aggregate)
+	return aggregate.Name, nil
+}
+
+// addAggregate adds an aggregate to the statement unless another one with the same name exists
+func addAggregate(statement *SelectStatement, aggregate AggregateDefinition) {
+	for _, existing := range statement.Aggregates {
+		if existing.Name == aggregate.Name {
+			return
+		}
+	}
+	statement.Aggregates = append(statement.Aggregates, aggregate)
+}
+
+// parseJoin parses a join like "LEFT OUTER JOIN t ON a.x = t.y AND a.z = t.w" or "NATURAL JOIN t"
+func (p *parser) parseJoin() (JoinDefinition, error) {
+	join := JoinDefinition{Type: "INNER"}
+	join.Natural = p.acceptKeyword("NATURAL")
+	if p.acceptKeyword("LEFT") {
+		join.Type = "LEFT"
+		p.acceptKeyword("OUTER")
+	} else if p.acceptKeyword("RIGHT") {
+		join.Type = "RIGHT"
+		p.acceptKeyword("OUTER")
+	} else if p.acceptKeyword("FULL") {
+		join.Type = "FULL"
+		p.acceptKeyword("OUTER")
+	} else {
+		p.acceptKeyword("INNER")
+	}
+	if err := p.expectKeyword("JOIN"); err != nil {
+		return join, err
+	}
+
+	var err error
+	if join.Table, err = p.expectIdentifier(); err != nil {
+		return join, err
+	}
+	if join.Natural {
+		return join, nil
+	}
+	if err := p.expectKeyword("ON"); err != nil {
+		return join, err
+	}
+	for {
+		left, err := p.parseColumnReference()
+		if err != nil {
+			return join, err
+		}
+		if token := p.peek(); token.Kind != TokenOperator || token.Text != "=" && token.Text != "==" {
+			return join, p.unexpected("=")
+		}
+		p.next()
+		right, err := p.parseColumnReference()
+		if err != nil {
+			return join, err
+		}
+		// let the columns of the joined table be on the right
+		if strings.HasPrefix(left, join.Table + ".") && !strings.HasPrefix(right, join.Table + ".") {
+			left, right = right, left
+		}
+		join.LeftColumns = append(join.LeftColumns, left)
+		join.RightColumns = append(join.RightColumns, right)
+		if !p.acceptKeyword("AND") {
+			break
+		}
+	}
+	return join, nil
+}
+
+func (p *parser) parseDelete() (Statement, error) {
+	p.next()
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	statement := &DeleteStatement{}
+	var err error
+	if statement.Table, err = p.expectIdentifier(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		if statement.Where, err = p.parseConditions(); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+func (p *parser) parseUpdate() (Statement, error) {
+	p.next()
+	statement := &UpdateStatement{}
+	var err error
+	if statement.Table, err = p.expectIdentifier(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		var assignment Assignment
+		if assignment.Column, err = p.parseColumnReference(); err != nil {
+			return nil, err
+		}
+		if token := p.peek(); token.Kind != TokenOperator || token.Text != "=" {
+			return nil, p.unexpected("=")
+		}
+		p.next()
+		if assignment.Value, err = p.parseValue(); err != nil {
+			return nil, err
+		}
+		statement.Set = append(statement.Set, assignment)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if p.acceptKeyword("WHERE") {
+		if statement.Where, err = p.parseConditions(); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+// parseConditions parses conditions connected by AND
+func (p *parser) parseConditions() ([]Condition, error) {
+	return p.parseConditionsOn(p.parseColumnReference)
+}
+
+// parseConditionsOn parses conditions connected by AND, whose columns are parsed by parseColumn
+func (p *parser) parseConditionsOn(parseColumn func() (string, error)) ([]Condition, error) {
+	var conditions []Condition
+	for {
+		condition, err := p.parseCondition(parseColumn)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		if !p.acceptKeyword("AND") {
+			return conditions, nil
+		}
+	}
+}
+
+// parseCondition parses a comparison between a column and a constant, in either order, or a test of NULL like
+// "name IS NOT NULL"
+func (p *parser) parseCondition(parseColumn func() (string, error)) (Condition, error) {
+	var condition Condition
+	valueFirst := p.peek().Kind != TokenIdentifier
+	var err error
+	if valueFirst {
+		if condition.Value, err = p.parseValue(); err != nil {
+			return condition, err
+		}
+	} else if condition.Column, err = parseColumn(); err != nil {
+		return condition, err
+	}
+
+	if !valueFirst && p.acceptKeyword("IS") {
+		condition.Operator = "IS NULL"
+		if p.acceptKeyword("NOT") {
+			condition.Operator = "IS NOT NULL"
+		}
+		return condition, p.expectKeyword("NULL")
+	}
+
+	if p.peek().Kind != TokenOperator {
+		return condition, p.unexpected("a comparison operator")
+	}
+	condition.Operator = normalizeOperator(p.next().Text)
+
+	if valueFirst {
+		if condition.Column, err = parseColumn(); err != nil {
+			return condition, err
+		}
+		condition.Operator = flipOperator(condition.Operator)
+	} else if condition.Value, err = p.parseValue(); err != nil {
+		return condition, err
+	}
+	return condition, nil
+}
+
+func normalizeOperator(operator string) string {
+	switch operator {
+	case "=":
+		return "=="
+	case "<>":
+		return "!="
+	}
+	return operator
+}
+
+// flipOperator returns the operator after swapping its operands
+func flipOperator(operator string) string {
+	switch operator {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return operator
+}
+
+// parseValue parses a constant, which is an int, a float64, a string, a bool or nil
+func (p *parser) parseValue() (interface{}, error) {
+	negative := false
+	if p.acceptSymbol("-") {
+		negative = true
+	} else {
+		p.acceptSymbol("+")
+	}
+
+	token := p.peek()
+	switch token.Kind {
+	case TokenInteger:
+		p.next()
+		value, err := strconv.Atoi(token.Text)
+		if err != nil {
+			return nil, errorAt(token.Pos, "invalid integer " + token.Text)
+		}
+		if negative {
+			value = -value
+		}
+		return value, nil
+	case TokenFloat:
+		p.next()
+		value, err := strconv.ParseFloat(token.Text, 64)
+		if err != nil {
+			return nil, errorAt(token.Pos, "invalid number " + token.Text)
+		}
+		if negative {
+			value = -value
+		}
+		return value, nil
+	}
+	if negative {
+		return nil, p.unexpected("a number")
+	}
+
+	switch {
+	case token.Kind == TokenString:
+		p.next()
+		return token.Text, nil
+	case p.acceptKeyword("TRUE"):
+		return true, nil
+	case p.acceptKeyword("FALSE"):
+		return false, nil
+	case p.acceptKeyword("NULL"):
+		return nil, nil
+	}
+	return nil, p.unexpected("a constant")
+}
+
+// parseCount parses a non-negative integer
+func (p *parser) parseCount() (int, error) {
+	token := p.peek()
+	if token.Kind != TokenInteger {
+		return 0, p.unexpected("a non-negative integer")
+	}
+	p.next()
+	count, err := strconv.Atoi(token.Text)
+	if err != nil {
+		return 0, errorAt(token.Pos, "invalid integer " + token.Text)
+	}
+	return count, nil
+}
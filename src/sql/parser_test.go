@@ -0,0 +1,308 @@
+package sql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCreateTable(t *testing.T) {
+	statements, err := Parse(`CREATE TABLE student (sid INT32, name string, grade FLOAT)
+		PARTITION BY (NODES 0|1 COLUMNS (sid, name) WHERE grade <= 3.6, NODE 2 WHERE 3.6 < grade AND sid != -1) USING columnar;`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{&CreateTableStatement{
+		Table: "student",
+		Columns: []ColumnDefinition{{"sid", "INT32"}, {"name", "STRING"}, {"grade", "FLOAT"}},
+		Partitions: []PartitionDefinition{
+			{
+				Nodes: []string{"0", "1"},
+				Columns: []string{"sid", "name"},
+				Conditions: []Condition{{"grade", "<=", 3.6}},
+			},
+			{
+				Nodes: []string{"2"},
+				Conditions: []Condition{{"grade", ">", 3.6}, {"sid", "!=", -1}},
+			},
+		},
+		Storage: "COLUMNAR",
+	}}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+}
+
+func TestParseCreateTableWithKeys(t *testing.T) {
+	statements, err := Parse(`CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING UNIQUE NOT NULL, grade FLOAT NULL,
+		UNIQUE (name, grade))`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{&CreateTableStatement{
+		Table: "student",
+		Columns: []ColumnDefinition{{"sid", "INT32"}, {"name", "STRING"}, {"grade", "FLOAT"}},
+		PrimaryKey: []string{"sid"},
+		Unique: [][]string{{"name"}, {"name", "grade"}},
+		NotNull: []string{"name"},
+	}}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+
+	statements, err = Parse(`CREATE TABLE courseRegistration (sid INT32 REFERENCES student ON DELETE CASCADE,
+		courseId INT32, FOREIGN KEY (courseId) REFERENCES course (cid) ON DELETE RESTRICT)`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected = []Statement{&CreateTableStatement{
+		Table: "courseRegistration",
+		Columns: []ColumnDefinition{{"sid", "INT32"}, {"courseId", "INT32"}},
+		ForeignKeys: []ForeignKeyDefinition{
+			{Columns: []string{"sid"}, RefTable: "student", OnDelete: "CASCADE"},
+			{Columns: []string{"courseId"}, RefTable: "course", RefColumns: []string{"cid"}, OnDelete: "RESTRICT"},
+		},
+	}}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+
+	for _, input := range []string{
+		"CREATE TABLE student (sid INT32 PRIMARY KEY, name STRING PRIMARY KEY)",
+		"CREATE TABLE student (sid INT32 REFERENCES)",
+		"CREATE TABLE student (sid INT32 REFERENCES a ON DELETE SET NULL)",
+		"CREATE TABLE student (sid INT32, FOREIGN KEY sid REFERENCES a)",
+		"CREATE TABLE student (sid INT32, PRIMARY (sid))",
+		"CREATE TABLE student (sid INT32, UNIQUE ())",
+	} {
+		if statements, err := Parse(input); err == nil {
+			t.Errorf("%s should not be parsed, but parsed as %v", input, statements)
+		}
+	}
+}
+
+func TestParseCreateIndex(t *testing.T) {
+	statements, err := Parse(`CREATE INDEX studentGrade ON student (grade); create index studentName ON student (name) USING hash`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{
+		&CreateIndexStatement{Name: "studentGrade", Table: "student", Column: "grade"},
+		&CreateIndexStatement{Name: "studentName", Table: "student", Column: "name", Kind: "HASH"},
+	}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+}
+
+func TestParseInsertAndDelete(t *testing.T) {
+	statements, err := Parse(`insert into student values (0, 'John', 4.0), (1, 'O''Neil', 3.6);
+		INSERT INTO flags (id, ok) VALUES (1, TRUE), (2, null); DELETE FROM student WHERE name = 'John'`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{
+		&InsertStatement{
+			Table: "student",
+			Rows: [][]interface{}{{0, "John", 4.0}, {1, "O'Neil", 3.6}},
+		},
+		&InsertStatement{
+			Table: "flags",
+			Columns: []string{"id", "ok"},
+			Rows: [][]interface{}{{1, true}, {2, nil}},
+		},
+		&DeleteStatement{
+			Table: "student",
+			Where: []Condition{{"name", "==", "John"}},
+		},
+	}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+}
+
+func TestParseUpdate(t *testing.T) {
+	statements, err := Parse(`UPDATE student SET grade = 4.0, student.name = 'John' WHERE sid = 0; UPDATE flags SET ok = NULL`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{
+		&UpdateStatement{
+			Table: "student",
+			Set: []Assignment{{"grade", 4.0}, {"student.name", "John"}},
+			Where: []Condition{{"sid", "==", 0}},
+		},
+		&UpdateStatement{
+			Table: "flags",
+			Set: []Assignment{{"ok", nil}},
+		},
+	}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+}
+
+func TestParseTransaction(t *testing.T) {
+	statements, err := Parse(`BEGIN; DELETE FROM student; ROLLBACK WORK; begin transaction; COMMIT;
+		BEGIN TRANSACTION ISOLATION LEVEL SERIALIZABLE; begin isolation level snapshot`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{
+		&BeginStatement{},
+		&DeleteStatement{Table: "student"},
+		&RollbackStatement{},
+		&BeginStatement{},
+		&CommitStatement{},
+		&BeginStatement{Serializable: true},
+		&BeginStatement{},
+	}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+	if _, err = Parse("BEGIN ISOLATION LEVEL READ COMMITTED"); err == nil {
+		t.Error("Only the serializable and snapshot isolation levels should be supported")
+	}
+}
+
+func TestParseNullConditions(t *testing.T) {
+	statements, err := Parse(`DELETE FROM student WHERE name IS NULL AND grade IS NOT NULL AND age = NULL`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{&DeleteStatement{
+		Table: "student",
+		Where: []Condition{{"name", "IS NULL", nil}, {"grade", "IS NOT NULL", nil}, {"age", "==", nil}},
+	}}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+
+	for _, input := range []string{
+		"DELETE FROM student WHERE NULL IS name",
+		"DELETE FROM student WHERE name IS 1",
+		"DELETE FROM student WHERE name IS NOT",
+	} {
+		if statements, err := Parse(input); err == nil {
+			t.Errorf("%s should not be parsed, but parsed as %v", input, statements)
+		}
+	}
+}
+
+func TestParseSelect(t *testing.T) {
+	statements, err := Parse(`SELECT s.name, courseId FROM student s_ignored`)
+	if err == nil {
+		t.Errorf("Table aliases are not supported, but parsed as %v", statements)
+	}
+
+	statements, err = Parse(`SELECT student.name, courseId FROM student
+		LEFT OUTER JOIN courseRegistration ON courseRegistration.sid = student.sid
+		NATURAL JOIN course
+		WHERE grade >= 3.6 AND courseId <> 2 ORDER BY name DESC NULLS last, courseId LIMIT 10 OFFSET 5`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{&SelectStatement{
+		Columns: []string{"student.name", "courseId"},
+		Table: "student",
+		Joins: []JoinDefinition{
+			{
+				Table: "courseRegistration",
+				Type: "LEFT",
+				LeftColumns: []string{"student.sid"},
+				RightColumns: []string{"courseRegistration.sid"},
+			},
+			{
+				Table: "course",
+				Type: "INNER",
+				Natural: true,
+			},
+		},
+		Where: []Condition{{"grade", ">=", 3.6}, {"courseId", "!=", 2}},
+		OrderBy: []OrderDefinition{{"name", true, "LAST"}, {"courseId", false, ""}},
+		Limit: 10,
+		Offset: 5,
+	}}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"SELECT FROM student",
+		"SELECT * FROM student WHERE",
+		"INSERT INTO student VALUES (1, 'John'",
+		"CREATE TABLE student (sid)",
+		"DELETE student",
+		"SELECT * FROM a JOIN b",
+		"SELECT * FROM student LIMIT -1",
+		"SELECT * FROM student ORDER BY name NULLS MIDDLE",
+		"UPSERT INTO student VALUES (1)",
+		"UPDATE student WHERE sid = 0",
+		"UPDATE student SET grade > 1",
+		"CREATE INDEX studentGrade ON student (grade) USING BITMAP",
+		"CREATE INDEX ON student (grade)",
+		"CREATE TABLE student (sid INT32) USING HASH",
+		"COMMIT student",
+	} {
+		if statements, err := Parse(input); err == nil {
+			t.Errorf("%s should not be parsed, but parsed as %v", input, statements)
+		}
+	}
+}
+
+func TestParseTypeParameters(t *testing.T) {
+	statements, err := Parse(`CREATE TABLE payment (id INT32, amount DECIMAL(10, 2), note VARCHAR(20), paidAt TIMESTAMP)`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{&CreateTableStatement{
+		Table: "payment",
+		Columns: []ColumnDefinition{{"id", "INT32"}, {"amount", "DECIMAL"}, {"note", "VARCHAR"}, {"paidAt", "TIMESTAMP"}},
+	}}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+
+	if _, err := Parse("CREATE TABLE payment (amount DECIMAL(10,"); err == nil {
+		t.Errorf("An unterminated type parameter list should fail")
+	}
+}
+
+func TestParseAggregate(t *testing.T) {
+	statements, err := Parse(`SELECT age, COUNT(*), AVG(grade) AS average, max(student.grade) FROM student WHERE sid > 0
+		GROUP BY age HAVING COUNT(*) > 1 AND MIN(grade) >= 2.0 ORDER BY average DESC, count LIMIT 3`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Statement{&SelectStatement{
+		Columns: []string{"age", "COUNT(*)", "average", "MAX(student.grade)"},
+		Table: "student",
+		Where: []Condition{{"sid", ">", 0}},
+		Aggregates: []AggregateDefinition{
+			{"COUNT", "", "COUNT(*)"},
+			{"AVG", "grade", "average"},
+			{"MAX", "student.grade", "MAX(student.grade)"},
+			{"MIN", "grade", "MIN(grade)"},
+		},
+		GroupBy: []string{"age"},
+		Having: []Condition{{"COUNT(*)", ">", 1}, {"MIN(grade)", ">=", 2.0}},
+		OrderBy: []OrderDefinition{{"average", true, ""}, {"count", false, ""}},
+		Limit: 3,
+		Offset: -1,
+	}}
+	if !reflect.DeepEqual(expected, statements) {
+		t.Errorf("Incorrect statements, expected %v, actual %v", expected, statements)
+	}
+
+	for _, script := range []string{
+		"SELECT SUM(*) FROM student",
+		"SELECT COUNT(sid FROM student",
+		"SELECT name FROM student GROUP BY",
+		"SELECT name FROM student WHERE COUNT(*) > 1",
+	} {
+		if _, err := Parse(script); err == nil {
+			t.Errorf("%s should fail", script)
+		}
+	}
+}